@@ -3,11 +3,14 @@ package main
 
 import (
 	"log"
+	"strings"
+	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/rakin92/go-rest-service/internal/orm"
 	"github.com/rakin92/go-rest-service/internal/server"
 	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
 	"github.com/rakin92/go-rest-service/pkg/env"
 	"github.com/rakin92/go-rest-service/pkg/logger"
 	"github.com/rakin92/go-rest-service/pkg/storage/cache"
@@ -27,9 +30,33 @@ func main() {
 		URISchema:      env.MustGet("SERVER_URI_SCHEMA"),
 		ServiceVersion: env.MustGet("SERVER_PATH_VERSION"),
 		SessionSecret:  env.MustGet("SESSION_SECRET"),
+		TrustedProxies: env.GetList("SERVER_TRUSTED_PROXIES"),
 		JWT: cfg.JWT{
-			Secret:    env.MustGet("AUTH_JWT_SECRET"),
-			Algorithm: env.MustGet("AUTH_JWT_SIGNING_ALGORITHM"),
+			Secret:          env.MustGet("AUTH_JWT_SECRET"),
+			Algorithm:       env.MustGet("AUTH_JWT_SIGNING_ALGORITHM"),
+			AccessTokenTTL:  env.GetDuration("AUTH_JWT_ACCESS_TOKEN_TTL", time.Hour),
+			RefreshTokenTTL: env.GetDuration("AUTH_JWT_REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		},
+		Auth: cfg.Auth{
+			MergeVerifiedEmails: env.GetBool("AUTH_MERGE_VERIFIED_EMAILS", false),
+			RedirectAllowlist:   env.GetList("AUTH_REDIRECT_ALLOWLIST"),
+			DefaultRedirectURI:  env.Get("AUTH_DEFAULT_REDIRECT_URI", ""),
+			ImpersonationTTL:    env.GetDuration("AUTH_IMPERSONATION_TTL", 15*time.Minute),
+			SessionCutover:      env.GetTime("AUTH_SESSION_CUTOVER"),
+			PolicyFile:          env.Get("AUTH_POLICY_FILE", ""),
+			Lockout: cfg.Lockout{
+				Enabled:         env.GetBool("AUTH_LOCKOUT_ENABLED", true),
+				MaxAttempts:     env.GetInt("AUTH_LOCKOUT_MAX_ATTEMPTS", 10),
+				MaxAttemptsIP:   env.GetInt("AUTH_LOCKOUT_MAX_ATTEMPTS_IP", 50),
+				DelayAfter:      env.GetInt("AUTH_LOCKOUT_DELAY_AFTER", 3),
+				BaseDelay:       env.GetDuration("AUTH_LOCKOUT_BASE_DELAY", 250*time.Millisecond),
+				MaxDelay:        env.GetDuration("AUTH_LOCKOUT_MAX_DELAY", 5*time.Second),
+				Window:          env.GetDuration("AUTH_LOCKOUT_WINDOW", 15*time.Minute),
+				LockoutDuration: env.GetDuration("AUTH_LOCKOUT_DURATION", 15*time.Minute),
+			},
+			Signing: cfg.Signing{
+				MaxSkew: env.GetDuration("AUTH_SIGNING_MAX_SKEW", 5*time.Minute),
+			},
 		},
 		Database: cfg.DB{
 			Dialect:     env.MustGet("DB_DIALECT"),
@@ -37,6 +64,12 @@ func main() {
 			SeedDB:      env.MustGetBool("DB_SEED_DB"),
 			LogMode:     env.MustGetBool("DB_LOGMODE"),
 			AutoMigrate: env.MustGetBool("DB_AUTOMIGRATE"),
+			MaxCon:      env.GetInt("DB_MAX_CON", 0),
+			MaxIdleCon:  env.GetInt("DB_MAX_IDLE_CON", 0),
+
+			// Reads go to the replicas while they are up
+			ReplicaDSNs:          env.GetList("DB_REPLICA_DSNS"),
+			ReplicaCheckInterval: env.GetDuration("DB_REPLICA_CHECK_INTERVAL", 10*time.Second),
 		},
 		MDB: cfg.MongoDB{
 			Host:     env.MustGet("MONGO_DB_HOST"),
@@ -49,20 +82,52 @@ func main() {
 		},
 		AuthProviders: []cfg.AuthProvider{
 			{
-				Provider:  "facebook",
-				ClientKey: env.MustGet("PROVIDER_FACEBOOK_KEY"),
-				Secret:    env.MustGet("PROVIDER_FACEBOOK_SECRET"),
+				Provider:     "facebook",
+				ClientKey:    env.MustGet("PROVIDER_FACEBOOK_KEY"),
+				Secret:       env.MustGet("PROVIDER_FACEBOOK_SECRET"),
+				ResponseMode: env.Get("PROVIDER_FACEBOOK_RESPONSE_MODE", consts.ResponseModes.JSON),
+				Audiences:    env.GetList("PROVIDER_FACEBOOK_AUDIENCES"),
 			},
 			{
-				Provider:  "google",
-				ClientKey: env.MustGet("PROVIDER_GOOGLE_KEY"),
-				Secret:    env.MustGet("PROVIDER_GOOGLE_SECRET"),
+				Provider:     "google",
+				ClientKey:    env.MustGet("PROVIDER_GOOGLE_KEY"),
+				Secret:       env.MustGet("PROVIDER_GOOGLE_SECRET"),
+				ResponseMode: env.Get("PROVIDER_GOOGLE_RESPONSE_MODE", consts.ResponseModes.JSON),
+				Audiences:    env.GetList("PROVIDER_GOOGLE_AUDIENCES"),
 			},
 			{
-				Provider:  "twitter",
-				ClientKey: env.MustGet("PROVIDER_TWITTER_KEY"),
-				Secret:    env.MustGet("PROVIDER_TWITTER_SECRET"),
+				Provider:     "twitter",
+				ClientKey:    env.MustGet("PROVIDER_TWITTER_KEY"),
+				Secret:       env.MustGet("PROVIDER_TWITTER_SECRET"),
+				ResponseMode: env.Get("PROVIDER_TWITTER_RESPONSE_MODE", consts.ResponseModes.JSON),
+			},
+		},
+		LDAP: cfg.LDAP{
+			URL:                env.Get("LDAP_URL", ""),
+			StartTLS:           env.GetBool("LDAP_START_TLS", false),
+			InsecureSkipVerify: env.GetBool("LDAP_INSECURE_SKIP_VERIFY", false),
+			Timeout:            env.GetDuration("LDAP_TIMEOUT", 10*time.Second),
+			BindDN:             env.Get("LDAP_BIND_DN", ""),
+			BindPassword:       env.Get("LDAP_BIND_PASSWORD", ""),
+			BaseDN:             env.Get("LDAP_BASE_DN", ""),
+			UserFilter:         env.Get("LDAP_USER_FILTER", "(&(objectClass=user)(sAMAccountName=%s))"),
+			GroupBaseDN:        env.Get("LDAP_GROUP_BASE_DN", ""),
+			GroupFilter:        env.Get("LDAP_GROUP_FILTER", ""),
+			EmailsVerified:     env.GetBool("LDAP_EMAILS_VERIFIED", false),
+			Attributes: cfg.LDAPAttributes{
+				ID:        env.Get("LDAP_ATTR_ID", "objectGUID"),
+				Email:     env.Get("LDAP_ATTR_EMAIL", "mail"),
+				FirstName: env.Get("LDAP_ATTR_FIRST_NAME", "givenName"),
+				LastName:  env.Get("LDAP_ATTR_LAST_NAME", "sn"),
+				Name:      env.Get("LDAP_ATTR_NAME", "displayName"),
+				MemberOf:  env.Get("LDAP_ATTR_MEMBER_OF", "memberOf"),
 			},
+			GroupRoles: env.GetMap("LDAP_GROUP_ROLES"),
+		},
+		SAML: cfg.SAML{
+			CertificateFile: env.Get("SAML_CERTIFICATE_FILE", ""),
+			KeyFile:         env.Get("SAML_KEY_FILE", ""),
+			IDPs:            samlIdPs(),
 		},
 		Sentry: cfg.Sentry{
 			Enabled:          env.MustGetBool("SENTRY_ENABLED"),
@@ -100,3 +165,28 @@ func main() {
 	// Runs the gin service
 	server.Run(conf, o, c)
 }
+
+// samlIdPs reads the SAML identity providers listed in SAML_IDPS, each one
+// configured with its SAML_IDP_<NAME>_* variables
+func samlIdPs() []cfg.SAMLIdP {
+	idps := []cfg.SAMLIdP{}
+	for _, name := range env.GetList("SAML_IDPS") {
+		prefix := "SAML_IDP_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		idps = append(idps, cfg.SAMLIdP{
+			Name:              name,
+			MetadataURL:       env.Get(prefix+"METADATA_URL", ""),
+			MetadataFile:      env.Get(prefix+"METADATA_FILE", ""),
+			AllowIDPInitiated: env.GetBool(prefix+"ALLOW_IDP_INITIATED", false),
+			EmailsVerified:    env.GetBool(prefix+"EMAILS_VERIFIED", false),
+			ResponseMode:      env.Get(prefix+"RESPONSE_MODE", consts.ResponseModes.JSON),
+			Attributes: cfg.SAMLAttributes{
+				ID:        env.Get(prefix+"ATTR_ID", ""),
+				Email:     env.Get(prefix+"ATTR_EMAIL", "email"),
+				FirstName: env.Get(prefix+"ATTR_FIRST_NAME", "firstName"),
+				LastName:  env.Get(prefix+"ATTR_LAST_NAME", "lastName"),
+				Name:      env.Get(prefix+"ATTR_NAME", "displayName"),
+			},
+		})
+	}
+	return idps
+}
@@ -0,0 +1,120 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+)
+
+var (
+	// ErrNoSigningSecret when signing is required of a key without a secret
+	ErrNoSigningSecret = errors.New("the api key has no signing secret")
+
+	// ErrInvalidAPIKeyRestriction when an allowed CIDR range or path prefix
+	// of a key isn't valid
+	ErrInvalidAPIKeyRestriction = errors.New("invalid api key restriction")
+)
+
+// APIKeySettings are the changes to the settings of an API key, the nil
+// ones are left as they are
+type APIKeySettings struct {
+	RequireSigning      *bool
+	AllowedCIDRs        *[]string
+	AllowedPathPrefixes *[]string
+}
+
+// FindAPIKey finds the API key along with its user, roles and permissions.
+// It's read from the primary so a deleted key or a deactivated user is
+// refused at once
+func (o *ORM) FindAPIKey(apiKey string) (*models.UserAPIKey, error) {
+	if apiKey == "" {
+		return nil, errors.New("API key is empty")
+	}
+	uak := &models.UserAPIKey{}
+	usrPerm := fmt.Sprintf(nestedFmt, sUserTbl, consts.EntityNames.Permissions)
+	usrRole := fmt.Sprintf(nestedFmt, sUserTbl, consts.EntityNames.Roles)
+	usrRolePerm := fmt.Sprintf(nestedFmt, usrRole, consts.EntityNames.Permissions)
+	if err := o.Primary().DB.Preload(sUserTbl).Preload(usrPerm).Preload(usrRole).Preload(usrRolePerm).
+		First(uak, "api_key = ?", apiKey).Error; err != nil {
+		return nil, err
+	}
+	if !uak.User.Active() {
+		return nil, ErrUserDeactivated
+	}
+	return uak, nil
+}
+
+// ListUserAPIKeys lists the API keys of the user
+func (o *ORM) ListUserAPIKeys(userID uuid.UUID) ([]*models.UserAPIKey, error) {
+	keys := []*models.UserAPIKey{}
+	if err := o.DB.Where("user_id = ?", userID).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// findUserAPIKey finds the API key of the user by its id
+func (o *ORM) findUserAPIKey(userID uuid.UUID, id uint) (*models.UserAPIKey, error) {
+	k := &models.UserAPIKey{}
+	if err := o.DB.First(k, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// RotateAPIKeySigningSecret sets a new signing secret on the API key of the
+// user, it is returned only this once
+func (o *ORM) RotateAPIKeySigningSecret(userID uuid.UUID, id uint) (string, error) {
+	k, err := o.findUserAPIKey(userID, id)
+	if err != nil {
+		return "", err
+	}
+	secret, err := randomSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := o.DB.Model(k).Update("signing_secret", secret).Error; err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// UpdateAPIKeySettings changes the settings of the API key of the user, the
+// key must have a signing secret to require signed requests
+func (o *ORM) UpdateAPIKeySettings(userID uuid.UUID, id uint, s *APIKeySettings) (*models.UserAPIKey, error) {
+	k, err := o.findUserAPIKey(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]any{}
+	if s.RequireSigning != nil {
+		if *s.RequireSigning && k.SigningSecret == "" {
+			return nil, ErrNoSigningSecret
+		}
+		changes["require_signing"] = *s.RequireSigning
+	}
+	if s.AllowedCIDRs != nil {
+		cidrs, err := models.NormalizeCIDRs(*s.AllowedCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAPIKeyRestriction, err)
+		}
+		changes["allowed_cidrs"] = cidrs
+	}
+	if s.AllowedPathPrefixes != nil {
+		prefixes, err := models.NormalizePathPrefixes(*s.AllowedPathPrefixes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAPIKeyRestriction, err)
+		}
+		changes["allowed_path_prefixes"] = prefixes
+	}
+	if len(changes) == 0 {
+		return k, nil
+	}
+	if err := o.DB.Model(k).Updates(changes).Error; err != nil {
+		return nil, err
+	}
+	return k, nil
+}
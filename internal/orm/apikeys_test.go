@@ -0,0 +1,84 @@
+package orm_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+)
+
+func TestORM_UpdateAPIKeySettings(t *testing.T) {
+	userID := uuid.Must(uuid.NewV4())
+	yes, no := true, false
+	tests := []struct {
+		name     string
+		secret   string
+		settings *orm.APIKeySettings
+		column   string
+		value    any
+		wantErr  error
+	}{
+		{name: "require signing without secret", settings: &orm.APIKeySettings{RequireSigning: &yes},
+			wantErr: orm.ErrNoSigningSecret},
+		{name: "require signing with secret", secret: "s3cr3t", settings: &orm.APIKeySettings{RequireSigning: &yes},
+			column: "require_signing", value: true},
+		{name: "stop requiring signing without secret", settings: &orm.APIKeySettings{RequireSigning: &no},
+			column: "require_signing", value: false},
+		{name: "cidr ranges are normalized", settings: &orm.APIKeySettings{AllowedCIDRs: &[]string{"10.1.2.3/8", "192.168.1.7"}},
+			column: "allowed_cidrs", value: "10.0.0.0/8 192.168.1.7/32"},
+		{name: "invalid cidr range", settings: &orm.APIKeySettings{AllowedCIDRs: &[]string{"10.0.0.0/33"}},
+			wantErr: orm.ErrInvalidAPIKeyRestriction},
+		{name: "path prefixes", settings: &orm.APIKeySettings{AllowedPathPrefixes: &[]string{"/v1/api/orgs/"}},
+			column: "allowed_path_prefixes", value: "/v1/api/orgs"},
+		{name: "relative path prefix", settings: &orm.APIKeySettings{AllowedPathPrefixes: &[]string{"v1/api"}},
+			wantErr: orm.ErrInvalidAPIKeyRestriction},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_api_keys" WHERE id = $1 AND user_id = $2`)).
+				WithArgs(7, userID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "signing_secret"}).AddRow(7, userID, tt.secret))
+			if tt.wantErr == nil {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user_api_keys" SET "`+tt.column+`"=$1`)).
+					WithArgs(tt.value, sqlmock.AnyArg(), 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+			_, err := o.UpdateAPIKeySettings(userID, 7, tt.settings)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ORM.UpdateAPIKeySettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestORM_UpdateAPIKeySettings_sqlite(t *testing.T) {
+	o := sqliteOrm(t)
+	k := &models.UserAPIKey{}
+	if err := o.DB.Joins("User").First(k, `"User"."email" = ?`, "user@test.com").Error; err != nil {
+		t.Fatal(err)
+	}
+	cidrs, prefixes := []string{"10.0.0.0/8"}, []string{"/v1/api/orgs"}
+	if _, err := o.UpdateAPIKeySettings(k.UserID, k.ID, &orm.APIKeySettings{
+		AllowedCIDRs: &cidrs, AllowedPathPrefixes: &prefixes,
+	}); err != nil {
+		t.Fatalf("UpdateAPIKeySettings() error = %v", err)
+	}
+	got, err := o.FindAPIKey(k.APIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AllowedCIDRs != "10.0.0.0/8" || got.AllowedPathPrefixes != "/v1/api/orgs" {
+		t.Errorf("FindAPIKey() = %q %q, want the restrictions saved", got.AllowedCIDRs, got.AllowedPathPrefixes)
+	}
+}
@@ -0,0 +1,386 @@
+package orm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/listing"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// The actions of the audit entries
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// auditRowsKey holds the rows a statement is about to change
+const auditRowsKey = "audit:rows"
+
+// redacted replaces the values of the sensitive columns
+const redacted = "[REDACTED]"
+
+var (
+	// ErrAuditAppendOnly when an audit entry is updated or deleted
+	ErrAuditAppendOnly = errors.New("the audit log is append-only")
+
+	// AuditListing is what the audit log can be filtered and sorted on
+	AuditListing = &listing.Options{
+		Filters: map[string]string{
+			"action":          "action",
+			"table":           "table_name",
+			"row_id":          "row_id",
+			"actor_id":        "actor_id",
+			"impersonator_id": "impersonator_id",
+			"api_key_id":      "api_key_id",
+			"client_id":       "client_id",
+			"organization_id": "organization_id",
+			"request_id":      "request_id",
+			"created_at":      "created_at",
+		},
+	}
+
+	// sensitiveColumn matches the columns whose values never reach the log
+	sensitiveColumn = regexp.MustCompile(`password|secret|token|api_key|hash|private`)
+
+	// auditIgnored are the columns that change on their own, an update of
+	// only them isn't logged
+	auditIgnored = map[string]bool{"updated_at": true, "last_used_at": true, "version": true}
+
+	// auditSkipped are the models not audited: the logs themselves, and the
+	// short lived sessions and tokens
+	auditSkipped = map[reflect.Type]bool{
+		reflect.TypeOf(models.AuditEntry{}):             true,
+		reflect.TypeOf(models.ImpersonationLog{}):       true,
+		reflect.TypeOf(models.Session{}):                true,
+		reflect.TypeOf(models.OAuthAuthorizationCode{}): true,
+		reflect.TypeOf(models.OAuthRefreshToken{}):      true,
+	}
+)
+
+// AuditPlugin logs the creates, updates and deletes of the models to the
+// audit entries, in the transaction of the change and along with who made it
+// from the statement context. Updates and deletes are logged from the rows
+// they match, so the ones without conditions and raw SQL aren't logged
+type AuditPlugin struct{}
+
+// Name of the plugin for gorm
+func (AuditPlugin) Name() string {
+	return "audit"
+}
+
+// Initialize registers the callbacks of the plugin
+func (p AuditPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	// the entries are written before the transaction of the change ends
+	if err := cb.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").
+		Register("audit:create", p.created); err != nil {
+		return err
+	}
+	// the rows are read once the conditions of the other plugins are added
+	if err := cb.Update().Before("gorm:update").After("version:update").
+		Register("audit:before_update", p.load); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").
+		Register("audit:update", p.updated); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").After("version:delete").
+		Register("audit:before_delete", p.load); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").
+		Register("audit:delete", p.deleted)
+}
+
+// ListAuditEntries lists the page of the audit log the list query asks for
+func (o *ORM) ListAuditEntries(q *listing.Query) (*Page[models.AuditEntry], error) {
+	return ListPage[models.AuditEntry](o.DB, q)
+}
+
+// audited returns the schema of the model of the statement when it's logged
+func audited(db *gorm.DB) (*schema.Schema, bool) {
+	s := db.Statement.Schema
+	if db.Error != nil || s == nil {
+		return nil, false
+	}
+	return s, !auditSkipped[s.ModelType]
+}
+
+// created logs the rows created
+func (AuditPlugin) created(db *gorm.DB) {
+	s, ok := audited(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+	entries := []models.AuditEntry{}
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	add := func(v reflect.Value) {
+		row := map[string]any{}
+		for _, f := range s.Fields {
+			if f.DBName != "" {
+				row[f.DBName], _ = f.ValueOf(db.Statement.Context, v)
+			}
+		}
+		after, err := auditJSON(s, row, nil)
+		db.AddError(err)
+		entries = append(entries, models.AuditEntry{Action: AuditCreate, Table: s.Table,
+			RowID: rowID(s, row), After: after})
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		add(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			add(reflect.Indirect(rv.Index(i)))
+		}
+	}
+	writeAudit(db, entries)
+}
+
+// load keeps the rows the update or delete is about to change, and refuses
+// the changes to the log itself
+func (AuditPlugin) load(db *gorm.DB) {
+	if s := db.Statement.Schema; db.Error == nil && s != nil && s.ModelType == reflect.TypeOf(models.AuditEntry{}) {
+		db.AddError(ErrAuditAppendOnly)
+		return
+	}
+	s, ok := audited(db)
+	if !ok {
+		return
+	}
+	exprs := auditConditions(db)
+	if len(exprs) == 0 {
+		return
+	}
+	rows, err := auditRows(db, s, db.Statement.Unscoped, exprs)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(auditRowsKey, rows)
+}
+
+// updated logs the columns the update changed in each row
+func (AuditPlugin) updated(db *gorm.DB) {
+	s, before, ok := loaded(db)
+	if !ok || s.PrioritizedPrimaryField == nil {
+		return
+	}
+	pk := s.PrioritizedPrimaryField.DBName
+	ids := make([]any, 0, len(before))
+	for _, row := range before {
+		ids = append(ids, row[pk])
+	}
+	rows, err := auditRows(db, s, true, []clause.Expression{
+		clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: pk}, Values: ids},
+	})
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	after := make(map[string]map[string]any, len(rows))
+	for _, row := range rows {
+		after[auditString(row[pk])] = row
+	}
+	entries := []models.AuditEntry{}
+	for _, b := range before {
+		a, ok := after[auditString(b[pk])]
+		if !ok {
+			continue
+		}
+		changed := []string{}
+		for column := range a {
+			if !auditIgnored[column] && !sameValue(b[column], a[column]) {
+				changed = append(changed, column)
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		e := models.AuditEntry{Action: AuditUpdate, Table: s.Table, RowID: rowID(s, a)}
+		if e.Before, err = auditJSON(s, b, changed); err == nil {
+			e.After, err = auditJSON(s, a, changed)
+		}
+		db.AddError(err)
+		entries = append(entries, e)
+	}
+	writeAudit(db, entries)
+}
+
+// deleted logs the rows deleted
+func (AuditPlugin) deleted(db *gorm.DB) {
+	s, before, ok := loaded(db)
+	if !ok {
+		return
+	}
+	entries := make([]models.AuditEntry, 0, len(before))
+	for _, row := range before {
+		b, err := auditJSON(s, row, nil)
+		db.AddError(err)
+		entries = append(entries, models.AuditEntry{Action: AuditDelete, Table: s.Table,
+			RowID: rowID(s, row), Before: b})
+	}
+	writeAudit(db, entries)
+}
+
+// loaded returns the rows kept by load, when the statement changed some
+func loaded(db *gorm.DB) (*schema.Schema, []map[string]any, bool) {
+	s, ok := audited(db)
+	if !ok || db.RowsAffected == 0 {
+		return nil, nil, false
+	}
+	v, ok := db.InstanceGet(auditRowsKey)
+	if !ok {
+		return nil, nil, false
+	}
+	rows, _ := v.([]map[string]any)
+	return s, rows, len(rows) > 0
+}
+
+// auditConditions are the conditions of the rows the statement changes: its
+// own and the primary keys of its model
+func auditConditions(db *gorm.DB) []clause.Expression {
+	stmt := db.Statement
+	exprs := []clause.Expression{}
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			exprs = append(exprs, where.Exprs...)
+		}
+	}
+	rv := reflect.Indirect(stmt.ReflectValue)
+	if rv.Kind() != reflect.Struct {
+		return exprs
+	}
+	for _, f := range stmt.Schema.PrimaryFields {
+		if v, zero := f.ValueOf(stmt.Context, rv); !zero {
+			exprs = append(exprs, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName}, Value: v})
+		}
+	}
+	return exprs
+}
+
+// auditRows reads the rows of the model matching the conditions, in the
+// transaction of the statement. The unscoped ones include the deleted rows
+func auditRows(db *gorm.DB, s *schema.Schema, unscoped bool, exprs []clause.Expression) ([]map[string]any, error) {
+	rows := []map[string]any{}
+	tx := db.Session(&gorm.Session{NewDB: true})
+	if unscoped {
+		tx = tx.Unscoped()
+	}
+	err := tx.Model(reflect.New(s.ModelType).Interface()).
+		Clauses(clause.Where{Exprs: exprs}).
+		Find(&rows).Error
+	for _, row := range rows {
+		for column, v := range row {
+			if b, ok := v.([]byte); ok {
+				row[column] = string(b)
+			}
+		}
+	}
+	return rows, err
+}
+
+// writeAudit writes the entries with who made the change, failing the
+// statement when they can't be
+func writeAudit(db *gorm.DB, entries []models.AuditEntry) {
+	if len(entries) == 0 || db.Error != nil {
+		return
+	}
+	for i := range entries {
+		auditActor(db.Statement.Context, &entries[i])
+	}
+	db.AddError(db.Session(&gorm.Session{NewDB: true, SkipDefaultTransaction: true}).
+		Create(&entries).Error)
+}
+
+// auditActor stamps the entry with who made the change
+func auditActor(ctx context.Context, e *models.AuditEntry) {
+	keys := consts.ProjectContextKeys
+	if id, ok := ctx.Value(keys.UserIDCtxKey).(uuid.UUID); ok {
+		e.ActorID = &id
+	}
+	if id, ok := ctx.Value(keys.ImpersonatorIDCtxKey).(uuid.UUID); ok {
+		e.ImpersonatorID = &id
+	}
+	if id, ok := ctx.Value(keys.APIKeyIDCtxKey).(uint); ok {
+		e.APIKeyID = &id
+	}
+	if id, ok := TenantFromContext(ctx); ok {
+		e.OrganizationID = &id
+	}
+	e.ClientID, _ = ctx.Value(keys.ClientIDCtxKey).(string)
+	e.RequestID, _ = ctx.Value(keys.RequestIDCtxKey).(string)
+}
+
+// auditJSON encodes the columns of the row, all of them when nil, with the
+// sensitive ones redacted
+func auditJSON(s *schema.Schema, row map[string]any, columns []string) (string, error) {
+	if columns == nil {
+		for column := range row {
+			columns = append(columns, column)
+		}
+	}
+	values := make(map[string]any, len(columns))
+	for _, column := range columns {
+		if sensitive(s, column) {
+			values[column] = redacted
+		} else {
+			values[column] = row[column]
+		}
+	}
+	b, err := json.Marshal(values)
+	return string(b), err
+}
+
+// sensitive verifies if the values of the column are secrets, the ones
+// named like it and the ones never answered
+func sensitive(s *schema.Schema, column string) bool {
+	if sensitiveColumn.MatchString(column) {
+		return true
+	}
+	f, ok := s.FieldsByDBName[column]
+	return ok && strings.Split(f.Tag.Get("json"), ",")[0] == "-"
+}
+
+// rowID is the primary key of the row, its columns joined by commas
+func rowID(s *schema.Schema, row map[string]any) string {
+	ids := make([]string, 0, len(s.PrimaryFieldDBNames))
+	for _, column := range s.PrimaryFieldDBNames {
+		ids = append(ids, auditString(row[column]))
+	}
+	return strings.Join(ids, ",")
+}
+
+// auditString is the value as text
+func auditString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// sameValue compares the values read before and after a change by their
+// JSON, the drivers don't always read a column to the same type
+func sameValue(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
@@ -0,0 +1,176 @@
+package orm_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"gorm.io/gorm"
+)
+
+// ledger is an audited model for the tests, its secret is redacted
+type ledger struct {
+	models.BaseModel
+	Name   string
+	Secret string
+}
+
+// jsonArg matches an argument holding the JSON object
+type jsonArg map[string]any
+
+// Match verifies the argument is the same JSON object
+func (j jsonArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	got := map[string]any{}
+	if !ok || json.Unmarshal([]byte(s), &got) != nil {
+		return false
+	}
+	return reflect.DeepEqual(got, map[string]any(j))
+}
+
+func mockAuditOrm(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	gormDB, mock := mockOrm(t)
+	if err := gormDB.Use(orm.AuditPlugin{}); err != nil {
+		t.Fatalf("gorm.DB.Use() error = %v", err)
+	}
+	return gormDB, mock
+}
+
+// auditContext is the context of a request of the user
+func auditContext(userID uuid.UUID) context.Context {
+	ctx := context.WithValue(context.Background(), consts.ProjectContextKeys.UserIDCtxKey, userID)
+	return context.WithValue(ctx, consts.ProjectContextKeys.RequestIDCtxKey, "req-1")
+}
+
+// expectAudit expects the audit entry to be written
+func expectAudit(mock sqlmock.Sqlmock, action string, id, userID uuid.UUID, before, after driver.Value) {
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_entries"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), action, "ledgers", id.String(), userID,
+			nil, nil, "", nil, "req-1", before, after).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+}
+
+func TestAuditPlugin_create(t *testing.T) {
+	db, mock := mockAuditOrm(t)
+	id := uuid.Must(uuid.NewV4())
+	userID := uuid.Must(uuid.NewV4())
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	created := now.Format(time.RFC3339)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "ledgers"`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(mock, orm.AuditCreate, id, userID, "", jsonArg{
+		"id": id.String(), "created_at": created, "updated_at": created, "name": "books", "secret": "[REDACTED]",
+	})
+	mock.ExpectCommit()
+	l := &ledger{BaseModel: models.BaseModel{ID: id, CreatedAt: &now, UpdatedAt: &now}, Name: "books", Secret: "s3cr3t"}
+	if err := db.WithContext(auditContext(userID)).Create(l).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAuditPlugin_update(t *testing.T) {
+	id := uuid.Must(uuid.NewV4())
+	userID := uuid.Must(uuid.NewV4())
+	row := func(name, secret string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "secret", "updated_at"}).AddRow(id.String(), name, secret, nil)
+	}
+	tests := []struct {
+		name    string
+		changes map[string]any
+		after   *sqlmock.Rows
+		audit   func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:    "logs the columns changed",
+			changes: map[string]any{"name": "ledgers", "secret": "n3w"},
+			after:   row("ledgers", "n3w"),
+			audit: func(mock sqlmock.Sqlmock) {
+				expectAudit(mock, orm.AuditUpdate, id, userID,
+					jsonArg{"name": "books", "secret": "[REDACTED]"},
+					jsonArg{"name": "ledgers", "secret": "[REDACTED]"})
+			},
+		},
+		{
+			name:    "nothing changed",
+			changes: map[string]any{"name": "books"},
+			after:   row("books", "s3cr3t"),
+			audit:   func(mock sqlmock.Sqlmock) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := mockAuditOrm(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "ledgers" WHERE "ledgers"."id" = $1`)).
+				WithArgs(id).
+				WillReturnRows(row("books", "s3cr3t"))
+			mock.ExpectExec(regexp.QuoteMeta(`UPDATE "ledgers" SET`)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "ledgers" WHERE "ledgers"."id" = $1`)).
+				WithArgs(id.String()).
+				WillReturnRows(tt.after)
+			tt.audit(mock)
+			mock.ExpectCommit()
+			l := &ledger{BaseModel: models.BaseModel{ID: id}}
+			if err := db.WithContext(auditContext(userID)).Model(l).Updates(tt.changes).Error; err != nil {
+				t.Fatalf("Updates() error = %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestAuditPlugin_delete(t *testing.T) {
+	id := uuid.Must(uuid.NewV4())
+	userID := uuid.Must(uuid.NewV4())
+
+	t.Run("logs the row deleted", func(t *testing.T) {
+		db, mock := mockAuditOrm(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "ledgers" WHERE "ledgers"."id" = $1`)).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "secret"}).AddRow(id.String(), "books", "s3cr3t"))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "ledgers" WHERE "ledgers"."id" = $1`)).
+			WithArgs(id).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAudit(mock, orm.AuditDelete, id, userID,
+			jsonArg{"id": id.String(), "name": "books", "secret": "[REDACTED]"}, "")
+		mock.ExpectCommit()
+		l := &ledger{BaseModel: models.BaseModel{ID: id}}
+		if err := db.WithContext(auditContext(userID)).Delete(l).Error; err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("the log is append-only", func(t *testing.T) {
+		db, mock := mockAuditOrm(t)
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		err := db.Delete(&models.AuditEntry{}, 1).Error
+		if !errors.Is(err, orm.ErrAuditAppendOnly) {
+			t.Errorf("Delete() error = %v, want %v", err, orm.ErrAuditAppendOnly)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// uuidType is the type the models give their uuid columns, only postgres
+// has it
+const uuidType = "uuid"
+
+// ErrUnknownDialect when the dialect of the config isn't one of consts.Dialects
+var ErrUnknownDialect = errors.New("unknown database dialect")
+
+// dialector opens the database of the config with the driver of its dialect
+func dialector(c *cfg.DB) (gorm.Dialector, error) {
+	switch c.Dialect {
+	case consts.Dialects.PostgresSQL:
+		return postgres.Open(c.DSN), nil
+	case consts.Dialects.MySQL:
+		return mysqlDialector{Dialector: mysql.New(mysql.Config{DSN: c.DSN}).(*mysql.Dialector)}, nil
+	case consts.Dialects.SQLite:
+		return sqlite.Open(c.DSN), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownDialect, c.Dialect)
+}
+
+// mysqlDialector stores the uuid columns as text, mysql has no uuid type
+type mysqlDialector struct {
+	*mysql.Dialector
+}
+
+// DataTypeOf the field for the migrations
+func (d mysqlDialector) DataTypeOf(f *schema.Field) string {
+	if f.DataType == uuidType {
+		return "char(36)"
+	}
+	return d.Dialector.DataTypeOf(f)
+}
+
+// Migrator migrates the columns with the types of the dialector
+func (d mysqlDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	m := d.Dialector.Migrator(db).(mysql.Migrator)
+	m.Migrator.Dialector = d
+	return m
+}
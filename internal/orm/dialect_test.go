@@ -0,0 +1,103 @@
+package orm_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/migration"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/listing"
+)
+
+// sqliteOrm is the orm on a migrated and seeded SQLite database of the test
+func sqliteOrm(t *testing.T) *orm.ORM {
+	o, err := orm.Init(&cfg.DB{
+		Dialect: consts.Dialects.SQLite,
+		DSN:     filepath.Join(t.TempDir(), "test.db") + "?_foreign_keys=on",
+	})
+	if err != nil {
+		t.Fatalf("orm.Init() error = %v", err)
+	}
+	if err := migration.ServiceAutoMigration(o.DB); err != nil {
+		t.Fatalf("migration.ServiceAutoMigration() error = %v", err)
+	}
+	return o
+}
+
+func TestInit_sqlite(t *testing.T) {
+	o := sqliteOrm(t)
+	k := &models.UserAPIKey{}
+	if err := o.DB.Joins("User").First(k, `"User"."email" = ?`, "admin@test.com").Error; err != nil {
+		t.Fatalf("First() of the seeded API key error = %v", err)
+	}
+	u, err := o.FindUserByAPIKey(k.APIKey)
+	if err != nil {
+		t.Fatalf("FindUserByAPIKey() error = %v", err)
+	}
+	if ok, _ := u.HasPermissionTag(consts.FormatPermissionTag(consts.Permissions.List,
+		consts.GetTableName(consts.EntityNames.AuditEntries))); !ok {
+		t.Errorf("FindUserByAPIKey() = %s without the seeded permissions", u.Email)
+	}
+
+	name := "Ada"
+	if _, err := o.WithContext(orm.IfVersion(context.Background(), u.Version+1)).
+		UpdateUser(u.ID, &orm.UserChanges{FirstName: &name}); !errors.Is(err, orm.ErrVersionConflict) {
+		t.Errorf("UpdateUser() of another version error = %v, want %v", err, orm.ErrVersionConflict)
+	}
+	updated, err := o.WithContext(orm.IfVersion(context.Background(), u.Version)).
+		UpdateUser(u.ID, &orm.UserChanges{FirstName: &name})
+	if err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if updated.Version != u.Version+1 {
+		t.Errorf("UpdateUser() version = %d, want %d", updated.Version, u.Version+1)
+	}
+
+	q, err := listing.Parse(url.Values{"filter[table]": {"users"}, "filter[action]": {orm.AuditUpdate}}, orm.AuditListing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := o.ListAuditEntries(q)
+	if err != nil {
+		t.Fatalf("ListAuditEntries() error = %v", err)
+	}
+	if len(page.Rows) != 1 || page.Rows[0].RowID != u.ID.String() || page.Rows[0].After != `{"first_name":"Ada"}` {
+		t.Errorf("ListAuditEntries() = %+v, want the update of the first name", page.Rows)
+	}
+}
+
+func TestInit_sqlite_userRole(t *testing.T) {
+	o := sqliteOrm(t)
+	k := &models.UserAPIKey{}
+	if err := o.DB.Joins("User").First(k, `"User"."email" = ?`, "user@test.com").Error; err != nil {
+		t.Fatalf("First() of the seeded API key error = %v", err)
+	}
+	u, err := o.FindUserByAPIKey(k.APIKey)
+	if err != nil {
+		t.Fatalf("FindUserByAPIKey() error = %v", err)
+	}
+	tests := map[string]bool{
+		consts.FormatPermissionTag(consts.Permissions.Read, consts.GetTableName(consts.EntityNames.Users)):             true,
+		consts.FormatPermissionTag(consts.Permissions.Create, consts.GetTableName(consts.EntityNames.Impersonations)):  false,
+		consts.FormatPermissionTag(consts.Permissions.List, consts.GetTableName(consts.EntityNames.AuditEntries)):      false,
+		consts.FormatPermissionTag(consts.Permissions.Create, consts.GetTableName(consts.EntityNames.OauthClients)):    false,
+		consts.FormatPermissionTag(consts.Permissions.Read, consts.GetTableName(consts.EntityNames.Metrics)):           false,
+		consts.FormatPermissionTag(consts.Permissions.List, consts.GetTableName(consts.EntityNames.Users)):             false,
+		consts.FormatPermissionTag(consts.Permissions.Update, consts.GetTableName(consts.EntityNames.Users)):           false,
+		consts.FormatPermissionTag(consts.Permissions.Assign, consts.GetTableName(consts.EntityNames.UserRoles)):       false,
+		consts.FormatPermissionTag(consts.Permissions.Assign, consts.GetTableName(consts.EntityNames.UserPermissions)): false,
+		consts.FormatPermissionTag(consts.Permissions.Assign, consts.GetTableName(consts.EntityNames.RolePermissions)): false,
+		consts.FormatPermissionTag(consts.Permissions.Assign, consts.GetTableName(consts.EntityNames.Roles)):           false,
+	}
+	for tag, want := range tests {
+		if ok, _ := u.HasPermissionTag(tag); ok != want {
+			t.Errorf("HasPermissionTag(%q) of the user role = %v, want %v", tag, ok, want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package orm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/gorm"
+)
+
+// GrantOAuthScopes records the consent of the user for the client, adding
+// the scopes to the ones granted before and not revoked
+func (o *ORM) GrantOAuthScopes(userID uuid.UUID, clientID string, scopes []string) (*models.OAuthGrant, error) {
+	g := &models.OAuthGrant{}
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(g, "user_id = ? AND client_id = ? AND deleted_at IS NULL", userID, clientID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			g = &models.OAuthGrant{UserID: userID, ClientID: clientID, Scope: strings.Join(scopes, " ")}
+			return tx.Omit("Client").Create(g).Error
+		}
+		if err != nil {
+			return err
+		}
+		merged := g.ScopeList()
+		for _, s := range scopes {
+			if !g.HasScopes([]string{s}) {
+				merged = append(merged, s)
+			}
+		}
+		g.Scope = strings.Join(merged, " ")
+		return tx.Model(g).Update("scope", g.Scope).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// FindOAuthGrant finds the consent of the user for the client, unless it was
+// revoked. The primary is read, a replica could still have a revoked grant
+func (o *ORM) FindOAuthGrant(userID uuid.UUID, clientID string) (*models.OAuthGrant, error) {
+	g := &models.OAuthGrant{}
+	if err := o.Primary().DB.First(g, "user_id = ? AND client_id = ? AND deleted_at IS NULL", userID, clientID).Error; err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// FindOAuthGrantByID finds a grant that hasn't been revoked, on the primary
+func (o *ORM) FindOAuthGrantByID(id uuid.UUID) (*models.OAuthGrant, error) {
+	g := &models.OAuthGrant{}
+	if err := o.Primary().DB.First(g, "id = ? AND deleted_at IS NULL", id).Error; err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// ListOAuthGrants lists the apps the user authorised and didn't revoke, with
+// their client
+func (o *ORM) ListOAuthGrants(userID uuid.UUID) ([]models.OAuthGrant, error) {
+	gs := []models.OAuthGrant{}
+	if err := o.DB.Preload("Client").Where("user_id = ? AND deleted_at IS NULL", userID).
+		Order("created_at").Find(&gs).Error; err != nil {
+		return nil, err
+	}
+	return gs, nil
+}
+
+// RevokeOAuthGrant revokes the consent of the user for the client along with
+// its refresh tokens, the access tokens stop working as the grant is soft
+// deleted. The grant is kept for the record
+func (o *ORM) RevokeOAuthGrant(userID uuid.UUID, clientID string) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		g := &models.OAuthGrant{}
+		if err := tx.First(g, "user_id = ? AND client_id = ? AND deleted_at IS NULL", userID, clientID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("grant_id = ?", g.ID).Delete(&models.OAuthRefreshToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(g).Update("deleted_at", time.Now().UTC()).Error
+	})
+}
+
+// CreateOAuthAuthorizationCode stores the code with a random value, which is
+// returned to hand to the client
+func (o *ORM) CreateOAuthAuthorizationCode(code *models.OAuthAuthorizationCode) (string, error) {
+	raw, err := randomSecret()
+	if err != nil {
+		return "", err
+	}
+	code.CodeHash = hashToken(raw)
+	if err := o.DB.Create(code).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// ConsumeOAuthAuthorizationCode finds and deletes the code, so it can only be
+// exchanged once
+func (o *ORM) ConsumeOAuthAuthorizationCode(raw string) (*models.OAuthAuthorizationCode, error) {
+	code := &models.OAuthAuthorizationCode{}
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(code, "code_hash = ?", hashToken(raw)).Error; err != nil {
+			return err
+		}
+		del := tx.Delete(code)
+		if del.Error != nil {
+			return del.Error
+		}
+		if del.RowsAffected == 0 {
+			return ErrInvalidGrant
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && code.Expired()) {
+		return nil, ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// CreateOAuthRefreshToken issues a refresh token for the grant, the raw token
+// is returned to hand to the client
+func (o *ORM) CreateOAuthRefreshToken(grantID uuid.UUID, scope string, ttl time.Duration) (string, error) {
+	return createOAuthRefreshToken(o.DB, grantID, scope, ttl)
+}
+
+// RotateOAuthRefreshToken exchanges the refresh token of the client for a new
+// one with the same scope, the used token is deleted. A token of another
+// client is left as is. The token is returned with its grant
+func (o *ORM) RotateOAuthRefreshToken(raw string, clientID string, ttl time.Duration) (*models.OAuthRefreshToken, string, error) {
+	rt := &models.OAuthRefreshToken{}
+	next := ""
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Grant").First(rt, "token_hash = ?", hashToken(raw)).Error; err != nil {
+			return err
+		}
+		// a leaked token presented by someone else doesn't burn it
+		if rt.Grant == nil || rt.Grant.ClientID != clientID {
+			return ErrInvalidGrant
+		}
+		del := tx.Delete(rt)
+		if del.Error != nil {
+			return del.Error
+		}
+		if del.RowsAffected == 0 || rt.Expired() || rt.Grant == nil || rt.Grant.DeletedAt != nil {
+			return ErrInvalidGrant
+		}
+		var err error
+		next, err = createOAuthRefreshToken(tx, rt.GrantID, rt.Scope, ttl)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return rt, next, nil
+}
+
+func createOAuthRefreshToken(tx *gorm.DB, grantID uuid.UUID, scope string, ttl time.Duration) (string, error) {
+	raw, err := randomSecret()
+	if err != nil {
+		return "", err
+	}
+	rt := &models.OAuthRefreshToken{
+		GrantID:   grantID,
+		TokenHash: hashToken(raw),
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := tx.Omit("Grant").Create(rt).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// hashToken hashes the random tokens we hand out, they have enough entropy
+// for a plain sha256 to be safe
+func hashToken(raw string) string {
+	h := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(h[:])
+}
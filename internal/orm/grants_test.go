@@ -0,0 +1,86 @@
+package orm_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/gorm"
+)
+
+func TestORM_RevokeOAuthGrant(t *testing.T) {
+	o := sqliteOrm(t)
+	c := &models.OAuthClient{Name: "app", GrantTypes: "authorization_code", RedirectURIs: "https://app.test/cb"}
+	if _, err := o.CreateOAuthClient(c, nil); err != nil {
+		t.Fatalf("CreateOAuthClient() error = %v", err)
+	}
+	userID := uuid.Must(uuid.NewV4())
+	g, err := o.GrantOAuthScopes(userID, c.ClientID, []string{"read:users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := o.CreateOAuthRefreshToken(g.ID, "read:users", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.RevokeOAuthGrant(userID, c.ClientID); err != nil {
+		t.Fatalf("RevokeOAuthGrant() error = %v", err)
+	}
+	kept := &models.OAuthGrant{}
+	if err := o.DB.First(kept, "id = ?", g.ID).Error; err != nil || kept.DeletedAt == nil {
+		t.Errorf("RevokeOAuthGrant() kept %+v, err %v, want the grant soft deleted", kept, err)
+	}
+	if _, err := o.FindOAuthGrantByID(g.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("FindOAuthGrantByID() of a revoked grant error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if gs, err := o.ListOAuthGrants(userID); err != nil || len(gs) != 0 {
+		t.Errorf("ListOAuthGrants() = %v, err %v, want no grant", gs, err)
+	}
+	if _, _, err := o.RotateOAuthRefreshToken(raw, c.ClientID, time.Hour); !errors.Is(err, orm.ErrInvalidGrant) {
+		t.Errorf("RotateOAuthRefreshToken() of a revoked grant error = %v, want %v", err, orm.ErrInvalidGrant)
+	}
+	if err := o.RevokeOAuthGrant(userID, c.ClientID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("RevokeOAuthGrant() of a revoked grant error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+
+	// consenting again starts a new grant, not the revoked one
+	again, err := o.GrantOAuthScopes(userID, c.ClientID, []string{"read:users"})
+	if err != nil {
+		t.Fatalf("GrantOAuthScopes() after a revoke error = %v", err)
+	}
+	if again.ID == g.ID {
+		t.Errorf("GrantOAuthScopes() after a revoke = the revoked grant %s", g.ID)
+	}
+}
+
+func TestORM_RotateOAuthRefreshToken_otherClient(t *testing.T) {
+	o := sqliteOrm(t)
+	owner := &models.OAuthClient{Name: "app", GrantTypes: "authorization_code", RedirectURIs: "https://app.test/cb"}
+	other := &models.OAuthClient{Name: "other", GrantTypes: "authorization_code", RedirectURIs: "https://other.test/cb"}
+	for _, c := range []*models.OAuthClient{owner, other} {
+		if _, err := o.CreateOAuthClient(c, nil); err != nil {
+			t.Fatalf("CreateOAuthClient() error = %v", err)
+		}
+	}
+	g, err := o.GrantOAuthScopes(uuid.Must(uuid.NewV4()), owner.ClientID, []string{"read:users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := o.CreateOAuthRefreshToken(g.ID, "read:users", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := o.RotateOAuthRefreshToken(raw, other.ClientID, time.Hour); !errors.Is(err, orm.ErrInvalidGrant) {
+		t.Errorf("RotateOAuthRefreshToken() by another client error = %v, want %v", err, orm.ErrInvalidGrant)
+	}
+	// the token of the client still works
+	rt, next, err := o.RotateOAuthRefreshToken(raw, owner.ClientID, time.Hour)
+	if err != nil || next == "" || rt.GrantID != g.ID {
+		t.Errorf("RotateOAuthRefreshToken() by its client = %v, %q, err %v, want a new token", rt, next, err)
+	}
+}
@@ -0,0 +1,40 @@
+package orm
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+)
+
+// maxImpersonationLogs is the most entries listed at once
+const maxImpersonationLogs = 500
+
+// CreateImpersonationLog appends the entry to the impersonation audit log
+func (o *ORM) CreateImpersonationLog(l *models.ImpersonationLog) error {
+	return o.DB.Create(l).Error
+}
+
+// SetImpersonationLogStatus records the status the impersonated request was
+// answered with, the entry itself was written before it was handled
+func (o *ORM) SetImpersonationLogStatus(id uint, status int) error {
+	return o.DB.Model(&models.ImpersonationLog{}).Where("id = ?", id).Update("status", status).Error
+}
+
+// ListImpersonationLogs lists the newest entries of the impersonation audit
+// log, filtered by the impersonated user and/or the admin when not uuid.Nil
+func (o *ORM) ListImpersonationLogs(userID uuid.UUID, impersonatorID uuid.UUID, limit int) ([]models.ImpersonationLog, error) {
+	if limit <= 0 || limit > maxImpersonationLogs {
+		limit = maxImpersonationLogs
+	}
+	q := o.DB.Order("id DESC").Limit(limit)
+	if userID != uuid.Nil {
+		q = q.Where("user_id = ?", userID)
+	}
+	if impersonatorID != uuid.Nil {
+		q = q.Where("impersonator_id = ?", impersonatorID)
+	}
+	ls := []models.ImpersonationLog{}
+	if err := q.Find(&ls).Error; err != nil {
+		return nil, err
+	}
+	return ls, nil
+}
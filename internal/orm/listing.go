@@ -0,0 +1,119 @@
+package orm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/rakin92/go-rest-service/pkg/listing"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Page is a page of the rows of a list, along with how many rows match its
+// filters and the cursor of the next page, empty on the last one
+type Page[T any] struct {
+	Rows  []T
+	Total int64
+	Next  string
+}
+
+// Filtered narrows the query to the filters of the list, their columns are
+// the allowlisted ones the list query was parsed against
+func Filtered(q *listing.Query) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if cond, args := q.Where(); cond != "" {
+			return db.Where(cond, args...)
+		}
+		return db
+	}
+}
+
+// Seeked narrows the query to the rows after the cursor of the list and
+// sorts them
+func Seeked(q *listing.Query) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if cond, args := q.Seek(); cond != "" {
+			db = db.Where(cond, args...)
+		}
+		return db.Order(q.OrderBy())
+	}
+}
+
+// ListPage lists the page of the rows of the model the list query asks for,
+// the rows after its cursor. The preloads are only done for the rows listed
+func ListPage[T any](db *gorm.DB, q *listing.Query, preloads ...string) (*Page[T], error) {
+	s, err := resourceSchema[T](db)
+	if err != nil {
+		return nil, err
+	}
+	// the filtered query is counted and then listed
+	db = db.Model(new(T)).Scopes(Filtered(q)).Session(&gorm.Session{})
+	page := &Page[T]{Rows: []T{}}
+	if err := db.Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+	if q, err = seekTyped(s, q); err != nil {
+		return nil, err
+	}
+	db = db.Scopes(Seeked(q))
+	for _, p := range preloads {
+		db = db.Preload(p)
+	}
+	// one more row than asked tells there is a next page
+	if err := db.Limit(q.Limit + 1).Find(&page.Rows).Error; err != nil {
+		return nil, err
+	}
+	if len(page.Rows) <= q.Limit {
+		return page, nil
+	}
+	page.Rows = page.Rows[:q.Limit]
+	last := reflect.ValueOf(&page.Rows[q.Limit-1]).Elem()
+	values := make([]any, 0, len(q.Sort))
+	for _, o := range q.Sort {
+		f := s.LookUpField(o.Column)
+		if f == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, o.Column)
+		}
+		v, _ := f.ValueOf(context.Background(), last)
+		values = append(values, v)
+	}
+	if page.Next, err = q.Cursor(values); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// seekTyped is the list query with the values of its cursor decoded back to
+// the types of their fields. The cursors hold them as JSON, the creation
+// times as strings a database won't compare to its own times
+func seekTyped(s *schema.Schema, q *listing.Query) (*listing.Query, error) {
+	if len(q.After) == 0 {
+		return q, nil
+	}
+	typed := *q
+	typed.After = make([]any, len(q.After))
+	for i, o := range q.Sort {
+		f := s.LookUpField(o.Column)
+		if f == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, o.Column)
+		}
+		v, ok := q.After[i].(string)
+		if !ok {
+			typed.After[i] = q.After[i]
+			continue
+		}
+		// the numbers were kept as strings not to lose their precision
+		raw, _ := json.Marshal(v)
+		if k := f.IndirectFieldType.Kind(); k >= reflect.Int && k <= reflect.Float64 {
+			raw = []byte(v)
+		}
+		value := reflect.New(f.IndirectFieldType)
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", listing.ErrInvalidQuery)
+		}
+		typed.After[i] = value.Elem().Interface()
+	}
+	return &typed, nil
+}
@@ -0,0 +1,163 @@
+package orm_test
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/pkg/listing"
+)
+
+func TestListResources(t *testing.T) {
+	ids := []uuid.UUID{uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())}
+	created := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	options := &listing.Options{Filters: map[string]string{"title": "title"}, Sorts: map[string]string{"title": "title"}}
+	rows := func(n int) *sqlmock.Rows {
+		r := sqlmock.NewRows([]string{"id", "created_at", "title"})
+		for i := 0; i < n; i++ {
+			r.AddRow(ids[i], created.Add(time.Duration(-i)*time.Hour), "Note")
+		}
+		return r
+	}
+	tests := []struct {
+		name     string
+		query    string
+		mock     func(mock sqlmock.Sqlmock)
+		wantRows int
+		wantNext bool
+	}{
+		{
+			name:  "first page",
+			query: "filter[title][ilike]=no%25&sort=-created_at&limit=2",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "memos" WHERE "memos"."deleted_at" IS NULL AND LOWER(title) LIKE LOWER($1)`)).
+					WithArgs("no%").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "memos" WHERE "memos"."deleted_at" IS NULL AND LOWER(title) LIKE LOWER($1) ORDER BY created_at DESC, id DESC LIMIT 3`)).
+					WithArgs("no%").
+					WillReturnRows(rows(3))
+			},
+			wantRows: 2,
+			wantNext: true,
+		},
+		{
+			name:  "last page",
+			query: "limit=2",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "memos" WHERE "memos"."deleted_at" IS NULL`)).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "memos" WHERE "memos"."deleted_at" IS NULL ORDER BY created_at, id LIMIT 3`)).
+					WillReturnRows(rows(1))
+			},
+			wantRows: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			params, _ := url.ParseQuery(tt.query)
+			q, err := listing.Parse(params, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.mock(mock)
+			page, err := orm.ListResources[memo](gormDB, q)
+			if err != nil {
+				t.Fatalf("ListResources() error = %v", err)
+			}
+			if len(page.Rows) != tt.wantRows || (page.Next != "") != tt.wantNext {
+				t.Errorf("ListResources() = %d rows next %q, want %d rows next %v", len(page.Rows), page.Next, tt.wantRows, tt.wantNext)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+			if !tt.wantNext {
+				return
+			}
+
+			// the next page starts after the last row listed
+			params.Set("cursor", page.Next)
+			q, err = listing.Parse(params, options)
+			if err != nil {
+				t.Fatalf("listing.Parse() of the next page error = %v", err)
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "memos"`)).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+			mock.ExpectQuery(regexp.QuoteMeta(`LOWER(title) LIKE LOWER($1) AND (((created_at < $2) OR (created_at = $3 AND id < $4))) ORDER BY created_at DESC, id DESC LIMIT 3`)).
+				WithArgs("no%", created.Add(-time.Hour), created.Add(-time.Hour), ids[1]).
+				WillReturnRows(rows(1))
+			if _, err := orm.ListResources[memo](gormDB, q); err != nil {
+				t.Fatalf("ListResources() of the next page error = %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestListResources_sqlite(t *testing.T) {
+	o := sqliteOrm(t)
+	if err := o.DB.AutoMigrate(&memo{}); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	want := map[uuid.UUID]bool{}
+	for i := 0; i < 5; i++ {
+		m := &memo{Title: "Note"}
+		m.ID = uuid.Must(uuid.NewV4())
+		// two of the memos are created at once, the ids break the tie
+		at := created.Add(time.Duration(i/2) * time.Hour)
+		m.CreatedAt = &at
+		if err := o.DB.Create(m).Error; err != nil {
+			t.Fatal(err)
+		}
+		want[m.ID] = true
+	}
+	options := &listing.Options{}
+	for _, sort := range []string{"", "-created_at"} {
+		t.Run("sort "+sort, func(t *testing.T) {
+			params := url.Values{"limit": {"2"}}
+			if sort != "" {
+				params.Set("sort", sort)
+			}
+			seen := map[uuid.UUID]bool{}
+			var last time.Time
+			for pages := 1; ; pages++ {
+				if pages > len(want) {
+					t.Fatalf("ListResources() is still listing after %d pages", len(want))
+				}
+				q, err := listing.Parse(params, options)
+				if err != nil {
+					t.Fatalf("listing.Parse() error = %v", err)
+				}
+				page, err := orm.ListResources[memo](o.DB, q)
+				if err != nil {
+					t.Fatalf("ListResources() error = %v", err)
+				}
+				for _, m := range page.Rows {
+					if seen[m.ID] {
+						t.Fatalf("ListResources() listed %s twice", m.ID)
+					}
+					seen[m.ID] = true
+					at := *m.CreatedAt
+					if !last.IsZero() && (sort == "" && at.Before(last) || sort != "" && at.After(last)) {
+						t.Errorf("ListResources() listed %s created at %s after %s", m.ID, at, last)
+					}
+					last = at
+				}
+				if page.Next == "" {
+					break
+				}
+				params.Set("cursor", page.Next)
+			}
+			if len(seen) != len(want) {
+				t.Errorf("ListResources() listed %d memos, want %d", len(seen), len(want))
+			}
+		})
+	}
+}
@@ -11,14 +11,43 @@ import (
 	"github.com/rakin92/go-rest-service/pkg/logger"
 )
 
+// wrongGrantClientFK is the constraint the clients were first migrated with,
+// referencing the grants the wrong way around
+const wrongGrantClientFK = "fk_oauth_grants_client"
+
+// wrongAPIKeyCIDRsColumn is the column the CIDR ranges of the API keys were
+// first migrated to, gorm's naming splits the acronym
+const wrongAPIKeyCIDRsColumn = "allowed_c_id_rs"
+
 // updateMigration updates our orm models schemas
 func updateMigration(db *gorm.DB) (err error) {
+	if m := db.Migrator(); m.HasTable(&models.OAuthClient{}) && m.HasConstraint(&models.OAuthClient{}, wrongGrantClientFK) {
+		if err := m.DropConstraint(&models.OAuthClient{}, wrongGrantClientFK); err != nil {
+			return err
+		}
+	}
+	if m := db.Migrator(); m.HasTable(&models.UserAPIKey{}) && m.HasColumn(&models.UserAPIKey{}, wrongAPIKeyCIDRsColumn) {
+		if err := m.RenameColumn(&models.UserAPIKey{}, wrongAPIKeyCIDRsColumn, "allowed_cidrs"); err != nil {
+			return err
+		}
+	}
 	return db.AutoMigrate(
 		&models.Role{},
 		&models.Permission{},
 		&models.UserProfile{},
 		&models.UserAPIKey{},
 		&models.User{},
+		&models.OAuthClient{},
+		&models.OAuthGrant{},
+		&models.OAuthAuthorizationCode{},
+		&models.OAuthRefreshToken{},
+		&models.ImpersonationLog{},
+		&models.Organization{},
+		&models.Membership{},
+		&models.Invitation{},
+		&models.Session{},
+		&models.SCIMClient{},
+		&models.AuditEntry{},
 	)
 }
 
@@ -45,6 +74,15 @@ func ServiceAutoMigration(db *gorm.DB) error {
 	m = gormigrate.New(db, gormigrate.DefaultOptions, []*gormigrate.Migration{
 		SeedRBAC,
 		SeedUsers,
+		SeedOAuthClientPermissions,
+		SeedImpersonationPermissions,
+		SeedOrganizations,
+		SeedPolicyPermissions,
+		SeedSCIMClientPermissions,
+		SeedAuditPermissions,
+		SeedUserRoleScope,
+		SeedMetricsPermissions,
+		SeedUserRoleRead,
 	})
 
 	return m.Migrate()
@@ -1,6 +1,7 @@
 package migration
 
 import (
+	"errors"
 	"reflect"
 
 	"github.com/go-gormigrate/gormigrate/v2"
@@ -69,18 +70,36 @@ var SeedUsers *gormigrate.Migration = &gormigrate.Migration{
 	},
 }
 
+// rbacEntities are the entities SEED_RBAC grants to the admin role, the ones
+// added later are granted to it by their own seed
+var rbacEntities = []string{
+	consts.EntityNames.Users,
+	consts.EntityNames.Roles,
+	consts.EntityNames.Permissions,
+	consts.EntityNames.RoleParents,
+	consts.EntityNames.RolePermissions,
+	consts.EntityNames.UserPermissions,
+	consts.EntityNames.UserProfiles,
+	consts.EntityNames.UserRoles,
+}
+
+// userRoleTags are the only permissions of the user role, everything else a
+// user does is on themselves and the policies allow it
+var userRoleTags = map[string]bool{
+	consts.FormatPermissionTag(consts.Permissions.Read, consts.GetTableName(consts.EntityNames.Users)): true,
+}
+
 // SeedRBAC inserts the first role-based access control
 var SeedRBAC *gormigrate.Migration = &gormigrate.Migration{
 	ID: "SEED_RBAC",
 	Migrate: func(db *gorm.DB) error {
 		tx := db.Begin()
 		defer rollback(tx)
-		v := reflect.ValueOf(consts.EntityNames)
-		tableNames := make([]any, v.NumField())
-		for i := 0; i < v.NumField(); i++ {
-			tableNames[i] = consts.GetTableName(v.Field(i).Interface().(string))
+		tableNames := make([]any, len(rbacEntities))
+		for i, e := range rbacEntities {
+			tableNames[i] = consts.GetTableName(e)
 		}
-		v = reflect.ValueOf(consts.Permissions)
+		v := reflect.ValueOf(consts.Permissions)
 		permissions := make([]any, v.NumField())
 		for i := 0; i < v.NumField(); i++ {
 			permissions[i] = v.Field(i).Interface()
@@ -98,7 +117,9 @@ var SeedRBAC *gormigrate.Migration = &gormigrate.Migration{
 					return err
 				}
 				padmin = append(padmin, permission)
-				puser = append(puser, permission)
+				if userRoleTags[permission.Tag] {
+					puser = append(puser, permission)
+				}
 			}
 		}
 		for _, r := range consts.Roles {
@@ -110,14 +131,18 @@ var SeedRBAC *gormigrate.Migration = &gormigrate.Migration{
 				logger.Error(&err, "[Migration.Jobs.SeedRBAC.roles] error: %s", err.Error())
 				return err
 			}
+			perms := []models.Permission{}
 			switch r.Name {
 			case "admin":
-				for _, p := range padmin {
-					tx.Model(role).Association(consts.EntityNames.Permissions).Append(p)
-				}
+				perms = padmin
 			case "user":
-				for _, p := range puser {
-					tx.Model(role).Association(consts.EntityNames.Permissions).Append(p)
+				perms = puser
+			}
+			// appended by pointer, gorm can't address the values
+			for i := range perms {
+				if err := tx.Model(role).Association(consts.EntityNames.Permissions).Append(&perms[i]); err != nil {
+					logger.Error(&err, "[Migration.Jobs.SeedRBAC.roles] error: %s", err.Error())
+					return err
 				}
 			}
 		}
@@ -136,3 +161,185 @@ var SeedRBAC *gormigrate.Migration = &gormigrate.Migration{
 		return nil
 	},
 }
+
+// seedEntityPermissions creates the permissions of the entities added after
+// SEED_RBAC ran and grants them to the admin role
+func seedEntityPermissions(id string, entities ...string) *gormigrate.Migration {
+	return &gormigrate.Migration{
+		ID: id,
+		Migrate: func(db *gorm.DB) error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				_, err := createEntityPermissions(tx, id, entities...)
+				return err
+			})
+		},
+		Rollback: func(db *gorm.DB) error {
+			return nil
+		},
+	}
+}
+
+// createEntityPermissions creates the permissions of the entities, if they
+// don't exist yet, and grants them to the admin role. They are returned by tag
+func createEntityPermissions(tx *gorm.DB, id string, entities ...string) (map[string]models.Permission, error) {
+	admin := &models.Role{}
+	if err := tx.First(admin, "name = ?", "admin").Error; err != nil {
+		return nil, err
+	}
+	perms := map[string]models.Permission{}
+	v := reflect.ValueOf(consts.Permissions)
+	for _, e := range entities {
+		t := consts.GetTableName(e)
+		for i := 0; i < v.NumField(); i++ {
+			p := v.Field(i).Interface().(string)
+			permission := models.Permission{}
+			err := tx.Where(models.Permission{Tag: consts.FormatPermissionTag(p, t)}).
+				Attrs(models.Permission{Description: consts.FormatPermissionDesc(p, t)}).
+				FirstOrCreate(&permission).Error
+			if err != nil {
+				logger.Error(&err, "[Migration.Jobs.%s.permissions] error: %s", id, err.Error())
+				return nil, err
+			}
+			if err := tx.Model(admin).Association(consts.EntityNames.Permissions).Append(&permission); err != nil {
+				return nil, err
+			}
+			perms[permission.Tag] = permission
+		}
+	}
+	return perms, nil
+}
+
+// SeedOAuthClientPermissions inserts the permissions to manage oauth clients
+var SeedOAuthClientPermissions = seedEntityPermissions("SEED_RBAC_OAUTH_CLIENTS",
+	consts.EntityNames.OauthClients)
+
+// SeedImpersonationPermissions inserts the permissions to impersonate users
+var SeedImpersonationPermissions = seedEntityPermissions("SEED_RBAC_IMPERSONATIONS",
+	consts.EntityNames.Impersonations)
+
+// SeedPolicyPermissions inserts the permissions to inspect the policies
+var SeedPolicyPermissions = seedEntityPermissions("SEED_RBAC_POLICIES",
+	consts.EntityNames.Policies)
+
+// SeedSCIMClientPermissions inserts the permissions to manage the SCIM
+// clients of the identity providers
+var SeedSCIMClientPermissions = seedEntityPermissions("SEED_RBAC_SCIM_CLIENTS",
+	consts.EntityNames.ScimClients)
+
+// SeedAuditPermissions inserts the permissions to read the audit log
+var SeedAuditPermissions = seedEntityPermissions("SEED_RBAC_AUDIT_ENTRIES",
+	consts.EntityNames.AuditEntries)
+
+// SeedMetricsPermissions inserts the permissions to read the metrics
+var SeedMetricsPermissions = seedEntityPermissions("SEED_RBAC_METRICS",
+	consts.EntityNames.Metrics)
+
+// SeedUserRoleScope takes back from the user role the permissions of the
+// entities added after SEED_RBAC, that it granted to it when it ran after them
+var SeedUserRoleScope *gormigrate.Migration = &gormigrate.Migration{
+	ID: "SEED_RBAC_USER_ROLE_SCOPE",
+	Migrate: func(db *gorm.DB) error {
+		granted := map[string]bool{}
+		v := reflect.ValueOf(consts.Permissions)
+		for _, e := range rbacEntities {
+			for i := 0; i < v.NumField(); i++ {
+				granted[consts.FormatPermissionTag(v.Field(i).Interface().(string), consts.GetTableName(e))] = true
+			}
+		}
+		return db.Transaction(func(tx *gorm.DB) error {
+			return scopeUserRole(tx, "SeedUserRoleScope", granted)
+		})
+	},
+	Rollback: func(db *gorm.DB) error {
+		return nil
+	},
+}
+
+// SeedUserRoleRead takes back from the user role the permissions SEED_RBAC
+// granted to it on the users, roles and permissions, with them any user could
+// grant themselves the admin role
+var SeedUserRoleRead *gormigrate.Migration = &gormigrate.Migration{
+	ID: "SEED_RBAC_USER_ROLE_READ",
+	Migrate: func(db *gorm.DB) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			return scopeUserRole(tx, "SeedUserRoleRead", userRoleTags)
+		})
+	},
+	Rollback: func(db *gorm.DB) error {
+		return nil
+	},
+}
+
+// scopeUserRole takes from the user role every permission not in granted
+func scopeUserRole(tx *gorm.DB, id string, granted map[string]bool) error {
+	role := &models.Role{}
+	err := tx.First(role, "name = ?", "user").Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	perms := []models.Permission{}
+	if err := tx.Model(role).Association(consts.EntityNames.Permissions).Find(&perms); err != nil {
+		return err
+	}
+	for i := range perms {
+		if granted[perms[i].Tag] {
+			continue
+		}
+		if err := tx.Model(role).Association(consts.EntityNames.Permissions).Delete(&perms[i]); err != nil {
+			logger.Error(&err, "[Migration.Jobs.%s] error: %s", id, err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// SeedOrganizations inserts the permissions to manage organizations and the
+// roles of their members
+var SeedOrganizations *gormigrate.Migration = &gormigrate.Migration{
+	ID: "SEED_RBAC_ORGANIZATIONS",
+	Migrate: func(db *gorm.DB) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			perms, err := createEntityPermissions(tx, "SEED_RBAC_ORGANIZATIONS",
+				consts.EntityNames.Organizations, consts.EntityNames.Memberships)
+			if err != nil {
+				return err
+			}
+			orgs := consts.GetTableName(consts.EntityNames.Organizations)
+			members := consts.GetTableName(consts.EntityNames.Memberships)
+			tag := consts.FormatPermissionTag
+			grants := map[string][]string{
+				consts.OrgRoles.Owner.Name: {
+					tag(consts.Permissions.Read, orgs), tag(consts.Permissions.Update, orgs),
+					tag(consts.Permissions.Delete, orgs), tag(consts.Permissions.List, members),
+					tag(consts.Permissions.Read, members), tag(consts.Permissions.Create, members),
+					tag(consts.Permissions.Update, members), tag(consts.Permissions.Delete, members),
+				},
+				consts.OrgRoles.Member.Name: {
+					tag(consts.Permissions.Read, orgs), tag(consts.Permissions.List, members),
+					tag(consts.Permissions.Read, members),
+				},
+			}
+			for _, r := range []struct{ Name, Description string }{consts.OrgRoles.Owner, consts.OrgRoles.Member} {
+				role := &models.Role{}
+				if err := tx.Where(models.Role{Name: r.Name}).
+					Attrs(models.Role{Description: r.Description}).FirstOrCreate(role).Error; err != nil {
+					logger.Error(&err, "[Migration.Jobs.SeedOrganizations.roles] error: %s", err.Error())
+					return err
+				}
+				for _, t := range grants[r.Name] {
+					p := perms[t]
+					if err := tx.Model(role).Association(consts.EntityNames.Permissions).Append(&p); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	},
+	Rollback: func(db *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,22 @@
+package models
+
+import "github.com/gofrs/uuid"
+
+// AuditEntry records a change made to a row through the orm, rows are only
+// ever appended. Before and After are JSON objects of the columns changed,
+// with the sensitive ones redacted: a create only has After, a delete only
+// has Before
+type AuditEntry struct {
+	BaseModelSeq
+	Action         string     `gorm:"size:16;not null;index"`
+	Table          string     `gorm:"column:table_name;size:128;not null;index:idx_audit_entries_row"`
+	RowID          string     `gorm:"size:255;index:idx_audit_entries_row"`
+	ActorID        *uuid.UUID `gorm:"type:uuid;index"` // User who made the change
+	ImpersonatorID *uuid.UUID `gorm:"type:uuid;index"` // Admin impersonating the user
+	APIKeyID       *uint      // API key the user authenticated with
+	ClientID       string     `gorm:"size:128;index"` // OAuth client of a service or acting for the user
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index"`
+	RequestID      string     `gorm:"size:64;index"`
+	Before         string     `gorm:"type:text"`
+	After          string     `gorm:"type:text"`
+}
@@ -4,15 +4,17 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
 )
 
 // BaseModel defines the common columns that all db structs should hold, usually
 // db structs based on this have no soft delete
 type BaseModel struct {
-	// Default values for PostgreSQL, change it for other DBMS
-	ID        uuid.UUID  `gorm:"primary_key;type:uuid;default:uuid_generate_v4()"`
-	CreatedAt *time.Time `gorm:"index;not null;default:current_timestamp"`
-	UpdatedAt *time.Time `gorm:"index;not null;default:current_timestamp"`
+	// The values are set on create rather than by defaults of the DBMS, so
+	// every dialect gets the same ones
+	ID        uuid.UUID  `gorm:"primary_key;type:uuid"`
+	CreatedAt *time.Time `gorm:"index;not null"`
+	UpdatedAt *time.Time `gorm:"index;not null"`
 }
 
 // BaseModelSoftDelete defines the common columns that all db structs should
@@ -26,10 +28,23 @@ type BaseModelSoftDelete struct {
 // BaseModelSeq defines the common columns that all db structs should hold, with
 // an INT key
 type BaseModelSeq struct {
-	// Default values for PostgreSQL, change it for other DBMS
+	// The timestamps are set on create rather than by defaults of the DBMS
 	ID        uint       `gorm:"primary_key,auto_increment"`
-	CreatedAt *time.Time `gorm:"index;not null;default:current_timestamp"`
-	UpdatedAt *time.Time `gorm:"index;not null;default:current_timestamp"`
+	CreatedAt *time.Time `gorm:"index;not null"`
+	UpdatedAt *time.Time `gorm:"index;not null"`
+}
+
+// BeforeCreate hook for BaseModel, the id is made here for every dialect
+func (m *BaseModel) BeforeCreate(db *gorm.DB) error {
+	if m.ID != uuid.Nil {
+		return nil
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	m.ID = id
+	return nil
 }
 
 // BaseModelSeqSoftDelete defines the common columns that all db structs should
@@ -39,3 +54,43 @@ type BaseModelSeqSoftDelete struct {
 	BaseModelSeq
 	DeletedAt *time.Time `gorm:"index"`
 }
+
+// BaseModelTenant is embedded, alongside BaseModel or BaseModelSoftDelete, by
+// the db structs whose rows belong to an organization. The orm filters and
+// stamps the organization of the request on them
+type BaseModelTenant struct {
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;index"`
+}
+
+// TenantColumn is the column holding the organization of the row
+func (BaseModelTenant) TenantColumn() string {
+	return "organization_id"
+}
+
+// TenantOwned is implemented by the db structs embedding BaseModelTenant
+type TenantOwned interface {
+	TenantColumn() string
+}
+
+// BaseModelVersioned is embedded by the db structs edited concurrently, every
+// update bumps their version and the orm refuses the updates and deletes made
+// against another version than the one expected
+type BaseModelVersioned struct {
+	Version uint `gorm:"not null;default:1"`
+}
+
+// VersionColumn is the column holding the version of the row
+func (BaseModelVersioned) VersionColumn() string {
+	return "version"
+}
+
+// CurrentVersion is the version of the row as it was read
+func (v BaseModelVersioned) CurrentVersion() uint {
+	return v.Version
+}
+
+// Versioned is implemented by the db structs embedding BaseModelVersioned
+type Versioned interface {
+	VersionColumn() string
+	CurrentVersion() uint
+}
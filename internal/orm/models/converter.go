@@ -2,6 +2,7 @@ package models
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/gofrs/uuid"
 	"github.com/markbates/goth"
@@ -41,6 +42,8 @@ func GothUserToDBUserProfile(i *goth.User, update bool, ids ...int) (o *UserProf
 		Email:          i.Email,
 		FirstName:      i.FirstName,
 		LastName:       i.LastName,
+		AvatarURL:      i.AvatarURL,
+		Description:    i.Description,
 	}
 	if len(ids) > 0 {
 		updID := ids[0]
@@ -48,3 +51,17 @@ func GothUserToDBUserProfile(i *goth.User, update bool, ids ...int) (o *UserProf
 	}
 	return o, err
 }
+
+// GothUserEmailVerified checks if the auth provider asserts the [user] email
+// has been verified, providers that don't say so are treated as unverified
+func GothUserEmailVerified(i *goth.User) bool {
+	for _, k := range []string{"email_verified", "verified_email"} {
+		switch v := i.RawData[k].(type) {
+		case bool:
+			return v
+		case string:
+			return strings.EqualFold(v, "true")
+		}
+	}
+	return false
+}
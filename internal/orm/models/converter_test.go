@@ -193,3 +193,44 @@ func TestGothUserToDBUser(t *testing.T) {
 		})
 	}
 }
+
+func TestGothUserEmailVerified(t *testing.T) {
+	tests := []struct {
+		name string
+		i    *goth.User
+		want bool
+	}{
+		{
+			name: "no raw data",
+			i:    &goth.User{Email: "email"},
+			want: false,
+		},
+		{
+			name: "oidc email_verified",
+			i:    &goth.User{RawData: map[string]any{"email_verified": true}},
+			want: true,
+		},
+		{
+			name: "oidc email_verified as string",
+			i:    &goth.User{RawData: map[string]any{"email_verified": "true"}},
+			want: true,
+		},
+		{
+			name: "google verified_email",
+			i:    &goth.User{RawData: map[string]any{"verified_email": true}},
+			want: true,
+		},
+		{
+			name: "unverified email",
+			i:    &goth.User{RawData: map[string]any{"email_verified": false}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := models.GothUserEmailVerified(tt.i); got != tt.want {
+				t.Errorf("GothUserEmailVerified() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package models
+
+import "github.com/gofrs/uuid"
+
+// ImpersonationLog records each request an admin made impersonating a user,
+// rows are appended before the request is handled and only get its status
+// once it's answered
+type ImpersonationLog struct {
+	BaseModelSeq
+	TokenID        string    `gorm:"size:64;not null;index"`
+	ImpersonatorID uuid.UUID `gorm:"type:uuid;not null;index"`
+	UserID         uuid.UUID `gorm:"type:uuid;not null;index"`
+	Method         string    `gorm:"size:16;not null"`
+	Path           string    `gorm:"size:1024;not null"`
+	Status         int
+	ClientIP       string `gorm:"size:64"`
+}
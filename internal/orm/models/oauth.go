@@ -0,0 +1,172 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// OAuthClient is an application registered to get tokens from the service,
+// like our internal services using the client credentials grant or partner
+// apps acting on behalf of our users. Public clients, like mobile apps or
+// SPAs, can't keep a secret and must use PKCE
+type OAuthClient struct {
+	BaseModelSoftDelete
+	Name         string       `gorm:"not null"`
+	ClientID     string       `gorm:"size:64;not null;uniqueIndex"`
+	SecretHash   string       `gorm:"size:128;not null" json:"-"`
+	Public       bool         `gorm:"not null;default:false"`
+	GrantTypes   string       `gorm:"size:256"`  // space separated grant types
+	RedirectURIs string       `gorm:"size:2048"` // space separated redirect uris
+	Scopes       []Permission `gorm:"many2many:oauth_client_scopes;association_autocreate:false;association_autoupdate:false"`
+}
+
+// TableName keeps the oauth_clients name instead of o_auth_clients
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// OAuthGrant is the consent of a user for a client to act on their behalf
+// with the scopes, revoking it stops all the tokens issued from it. Client has
+// no constraint, gorm takes it for a has one and would make it the wrong way
+type OAuthGrant struct {
+	BaseModelSoftDelete
+	UserID   uuid.UUID    `gorm:"type:uuid;not null;index"`
+	ClientID string       `gorm:"size:64;not null;index"`
+	Scope    string       `gorm:"size:2048"` // space separated permission tags
+	Client   *OAuthClient `gorm:"foreignKey:ClientID;references:ClientID;constraint:-"`
+}
+
+// TableName keeps the oauth_grants name instead of o_auth_grants
+func (OAuthGrant) TableName() string {
+	return "oauth_grants"
+}
+
+// OAuthAuthorizationCode is the single use code handed to the client on the
+// redirect, only its hash is stored
+type OAuthAuthorizationCode struct {
+	BaseModel
+	CodeHash            string    `gorm:"size:64;not null;uniqueIndex"`
+	ClientID            string    `gorm:"size:64;not null"`
+	UserID              uuid.UUID `gorm:"type:uuid;not null"`
+	RedirectURI         string    `gorm:"size:1024;not null"`
+	Scope               string    `gorm:"size:2048"`
+	CodeChallenge       string    `gorm:"size:128;not null"`
+	CodeChallengeMethod string    `gorm:"size:16;not null"`
+	ExpiresAt           time.Time `gorm:"not null"`
+}
+
+// TableName keeps the oauth_authorization_codes name
+func (OAuthAuthorizationCode) TableName() string {
+	return "oauth_authorization_codes"
+}
+
+// OAuthRefreshToken is a refresh token issued from a grant, it's rotated on
+// every use and only its hash is stored
+type OAuthRefreshToken struct {
+	BaseModel
+	GrantID   uuid.UUID   `gorm:"type:uuid;not null;index"`
+	TokenHash string      `gorm:"size:64;not null;uniqueIndex"`
+	Scope     string      `gorm:"size:2048"`
+	ExpiresAt time.Time   `gorm:"not null"`
+	Grant     *OAuthGrant `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// TableName keeps the oauth_refresh_tokens name
+func (OAuthRefreshToken) TableName() string {
+	return "oauth_refresh_tokens"
+}
+
+// ## Helper functions
+
+// SetSecret hashes the client secret, the plain secret is never stored
+func (c *OAuthClient) SetSecret(secret string) error {
+	h, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	c.SecretHash = string(h)
+	return nil
+}
+
+// VerifySecret checks the secret against the stored hash
+func (c *OAuthClient) VerifySecret(secret string) bool {
+	if c.SecretHash == "" || secret == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(c.SecretHash), []byte(secret)) == nil
+}
+
+// RedirectURIList returns the redirect uris registered for the client
+func (c *OAuthClient) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+// HasRedirectURI verifies the redirect uri is exactly one of the registered
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	for _, r := range c.RedirectURIList() {
+		if r == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantTypeList returns the grant types the client is allowed to use
+func (c *OAuthClient) GrantTypeList() []string {
+	return strings.Fields(c.GrantTypes)
+}
+
+// HasGrantType verifies if the client is allowed to use the grant type
+func (c *OAuthClient) HasGrantType(grantType string) bool {
+	for _, g := range c.GrantTypeList() {
+		if g == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeTags returns the permission tags the client is allowed to ask for
+func (c *OAuthClient) ScopeTags() []string {
+	tags := make([]string, 0, len(c.Scopes))
+	for _, p := range c.Scopes {
+		tags = append(tags, p.Tag)
+	}
+	return tags
+}
+
+// ScopeList returns the permission tags the user granted
+func (g *OAuthGrant) ScopeList() []string {
+	return strings.Fields(g.Scope)
+}
+
+// HasScopes verifies the user already granted all the scopes
+func (g *OAuthGrant) HasScopes(scopes []string) bool {
+	granted := g.ScopeList()
+	for _, s := range scopes {
+		found := false
+		for _, gs := range granted {
+			if gs == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Expired verifies if the code can't be exchanged anymore
+func (c *OAuthAuthorizationCode) Expired() bool {
+	return time.Now().After(c.ExpiresAt)
+}
+
+// Expired verifies if the refresh token can't be used anymore
+func (t *OAuthRefreshToken) Expired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
@@ -0,0 +1,94 @@
+package models_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+)
+
+func TestOAuthClient_VerifySecret(t *testing.T) {
+	c := &models.OAuthClient{}
+	if err := c.SetSecret("s3cret"); err != nil {
+		t.Fatalf("OAuthClient.SetSecret() error = %v", err)
+	}
+	if c.SecretHash == "s3cret" {
+		t.Errorf("OAuthClient.SetSecret() stored the plain secret")
+	}
+	tests := []struct {
+		name   string
+		secret string
+		want   bool
+	}{
+		{name: "valid secret", secret: "s3cret", want: true},
+		{name: "invalid secret", secret: "secret", want: false},
+		{name: "empty secret", secret: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.VerifySecret(tt.secret); got != tt.want {
+				t.Errorf("OAuthClient.VerifySecret() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOAuthClient_HasGrantType(t *testing.T) {
+	c := &models.OAuthClient{GrantTypes: "client_credentials refresh_token"}
+	if !c.HasGrantType("client_credentials") {
+		t.Errorf("OAuthClient.HasGrantType() = false, want true")
+	}
+	if c.HasGrantType("authorization_code") {
+		t.Errorf("OAuthClient.HasGrantType() = true, want false")
+	}
+}
+
+func TestOAuthClient_ScopeTags(t *testing.T) {
+	c := &models.OAuthClient{Scopes: []models.Permission{{Tag: "read:users"}, {Tag: "list:users"}}}
+	want := []string{"read:users", "list:users"}
+	if got := c.ScopeTags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("OAuthClient.ScopeTags() = %v, want %v", got, want)
+	}
+}
+
+func TestOAuthClient_HasRedirectURI(t *testing.T) {
+	c := &models.OAuthClient{RedirectURIs: "https://app.test/cb com.app:/oauth"}
+	tests := []struct {
+		name string
+		uri  string
+		want bool
+	}{
+		{name: "registered uri", uri: "https://app.test/cb", want: true},
+		{name: "native app uri", uri: "com.app:/oauth", want: true},
+		{name: "sub path", uri: "https://app.test/cb/other", want: false},
+		{name: "extra query", uri: "https://app.test/cb?x=1", want: false},
+		{name: "empty uri", uri: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.HasRedirectURI(tt.uri); got != tt.want {
+				t.Errorf("OAuthClient.HasRedirectURI() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOAuthGrant_HasScopes(t *testing.T) {
+	g := &models.OAuthGrant{Scope: "read:users list:users"}
+	tests := []struct {
+		name   string
+		scopes []string
+		want   bool
+	}{
+		{name: "all granted", scopes: []string{"list:users", "read:users"}, want: true},
+		{name: "none asked", scopes: nil, want: true},
+		{name: "one not granted", scopes: []string{"read:users", "update:users"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.HasScopes(tt.scopes); got != tt.want {
+				t.Errorf("OAuthGrant.HasScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+)
+
+// Organization is a company using the service, its data is only seen by
+// its members
+type Organization struct {
+	BaseModelSoftDelete
+	Name        string       `gorm:"not null"`
+	Memberships []Membership `json:",omitempty" gorm:"association_autocreate:false;association_autoupdate:false"`
+}
+
+// Membership of a user to an organization, with the roles they have within it
+type Membership struct {
+	BaseModelSoftDelete
+	OrganizationID uuid.UUID     `gorm:"type:uuid;not null;index"`
+	UserID         uuid.UUID     `gorm:"type:uuid;not null;index"`
+	Organization   *Organization `json:",omitempty" gorm:"association_autocreate:false;association_autoupdate:false"`
+	User           *User         `json:",omitempty" gorm:"association_autocreate:false;association_autoupdate:false"`
+	Roles          []Role        `gorm:"many2many:membership_roles;association_autocreate:false;association_autoupdate:false"`
+}
+
+// Invitation for the user signed in with the email to join the organization
+// with the roles, with the token sent to them. The token is single use and
+// only its hash is kept
+type Invitation struct {
+	BaseModelSoftDelete
+	OrganizationID uuid.UUID     `gorm:"type:uuid;not null;index"`
+	Email          string        `gorm:"not null;index"`
+	TokenHash      string        `gorm:"size:128;index" json:"-"`
+	InvitedByID    uuid.UUID     `gorm:"type:uuid;not null"`
+	ExpiresAt      time.Time     `gorm:"not null"`
+	Organization   *Organization `json:",omitempty" gorm:"association_autocreate:false;association_autoupdate:false"`
+	Roles          []Role        `gorm:"many2many:invitation_roles;association_autocreate:false;association_autoupdate:false"`
+}
+
+// ## Hooks
+
+// BeforeSave hook for Invitation
+func (i *Invitation) BeforeSave(db *gorm.DB) error {
+	i.Email = strings.ToLower(i.Email)
+	return nil
+}
+
+// ## Helper functions
+
+// HasRole verifies if the member has the role within the organization
+func (m *Membership) HasRole(name string) bool {
+	for _, r := range m.Roles {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermissionTag verifies if the member has the permission tag within the
+// organization through one of its roles
+func (m *Membership) HasPermissionTag(tag string) bool {
+	for _, r := range m.Roles {
+		for _, p := range r.Permissions {
+			if p.Tag == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Expired verifies if the invitation can't be accepted anymore
+func (i *Invitation) Expired() bool {
+	return time.Now().After(i.ExpiresAt)
+}
@@ -0,0 +1,31 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+)
+
+func TestMembership_HasPermissionTag(t *testing.T) {
+	m := &models.Membership{Roles: []models.Role{
+		{Name: "org:member", Permissions: []models.Permission{{Tag: "list:memberships"}}},
+	}}
+	tests := []struct {
+		name string
+		tag  string
+		want bool
+	}{
+		{name: "permission of a role", tag: "list:memberships", want: true},
+		{name: "missing permission", tag: "delete:memberships", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.HasPermissionTag(tt.tag); got != tt.want {
+				t.Errorf("Membership.HasPermissionTag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !m.HasRole("org:member") || m.HasRole("org:owner") {
+		t.Errorf("Membership.HasRole() = %v, want only org:member", m.Roles)
+	}
+}
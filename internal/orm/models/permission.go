@@ -3,11 +3,15 @@ package models
 // Role defines a role for the user
 type Role struct {
 	BaseModelSeq
+	BaseModelVersioned
 	Name        string       `gorm:"not null;unique_index"`
 	Description string       `gorm:"size:1024"`
 	ParentRoles []Role       `gorm:"many2many:role_parents;association_jointable_foreignkey:parent_role_id"`
 	ChildRoles  []Role       `gorm:"many2many:role_parents;association_jointable_foreignkey:role_id"`
 	Permissions []Permission `gorm:"many2many:role_permissions;association_autoupdate:false;association_autocreate:false"`
+	// SCIMProvider is the provider of the SCIM client that created the role
+	// as a group, only that client manages it
+	SCIMProvider string `gorm:"column:scim_provider;size:255;index"`
 }
 
 // Permission defines a permission scope for the user
@@ -16,3 +20,15 @@ type Permission struct {
 	Tag         string `gorm:"not null;unique_index"`
 	Description string `gorm:"size:1024"`
 }
+
+// RoleParent relation between a role and the roles it inherits from
+type RoleParent struct {
+	RoleID       int `gorm:"index"`
+	ParentRoleID int `gorm:"index"`
+}
+
+// RolePermission relation between a role and its permissions
+type RolePermission struct {
+	RoleID       int `gorm:"index"`
+	PermissionID int `gorm:"index"`
+}
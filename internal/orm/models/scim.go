@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// SCIMClient is an identity provider provisioning our users and groups
+// through SCIM, it authenticates with a bearer token
+type SCIMClient struct {
+	BaseModel
+	Name       string `gorm:"size:128;not null;uniqueIndex"`
+	TokenHash  string `gorm:"size:128;not null;uniqueIndex" json:"-"`
+	LastUsedAt *time.Time
+}
+
+// TableName keeps the scim_clients name instead of s_c_i_m_clients
+func (SCIMClient) TableName() string {
+	return "scim_clients"
+}
+
+// Provider is the provider of the user profiles the client provisions, they
+// hold the external ids the identity provider knows the users by
+func (c *SCIMClient) Provider() string {
+	return "scim:" + c.Name
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Session is a token family issued on a login, every refresh of its tokens
+// keeps it alive until it's revoked or expires
+type Session struct {
+	BaseModel
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	Provider   string    `gorm:"size:64;not null"`
+	Device     string    `gorm:"size:128"`
+	UserAgent  string    `gorm:"size:512"`
+	ClientIP   string    `gorm:"size:64"`
+	LastSeenAt *time.Time
+	ExpiresAt  time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+}
+
+// Active verifies the session wasn't revoked and hasn't expired
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
@@ -1,7 +1,10 @@
 package models
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"path"
 	"strings"
 
 	"github.com/gofrs/uuid"
@@ -20,6 +23,8 @@ type User struct {
 	UserProfiles        []UserProfile `gorm:"association_autocreate:false;association_autoupdate:false"`
 	Roles               []Role        `gorm:"many2many:user_roles;association_autocreate:false;association_autoupdate:false"`
 	Permissions         []Permission  `gorm:"many2many:user_permissions;association_autocreate:false;association_autoupdate:false"`
+
+	BaseModelVersioned // Concurrent admin edits don't overwrite each other
 }
 
 // UserProfile saves all the related OAuth Profiles
@@ -42,8 +47,16 @@ type UserAPIKey struct {
 	Name        string
 	User        User         `gorm:"association_autocreate:false;association_autoupdate:false"`
 	UserID      uuid.UUID    `gorm:"not null;index"`
-	APIKey      string       `gorm:"size:128;unique;index;default:uuid_generate_v4()"`
+	APIKey      string       `gorm:"size:128;unique;index"`
 	Permissions []Permission `gorm:"many2many:user_api_key_permissions;association_autocreate:false;association_autoupdate:false"`
+	// SigningSecret signs the requests made with the key, it's kept as is
+	// since the server must compute the same signature
+	SigningSecret  string `gorm:"size:128" json:"-"`
+	RequireSigning bool   `gorm:"not null;default:false"`
+	// AllowedCIDRs and AllowedPathPrefixes restrict where the key can be
+	// used from and what for, anything is allowed when empty
+	AllowedCIDRs        string `gorm:"column:allowed_cidrs;size:2048"` // space separated CIDR ranges
+	AllowedPathPrefixes string `gorm:"size:2048"`                      // space separated path prefixes
 }
 
 // UserRole relation between an user and its roles
@@ -68,8 +81,27 @@ func (u *User) BeforeSave(db *gorm.DB) error {
 	return nil
 }
 
+// BeforeCreate hook for UserAPIKey, a key is made when none is given
+func (k *UserAPIKey) BeforeCreate(db *gorm.DB) error {
+	if k.APIKey != "" {
+		return nil
+	}
+	key, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	k.APIKey = key.String()
+	return nil
+}
+
 // ## Helper functions
 
+// Active verifies the user wasn't deactivated, deactivated users are soft
+// deleted and can't sign in
+func (u *User) Active() bool {
+	return u.DeletedAt == nil
+}
+
 // HasRole verifies if user possesses a role
 func (u *User) HasRole(roleID int) (bool, error) {
 	for _, r := range u.Roles {
@@ -91,16 +123,141 @@ func (u *User) HasPermission(permission string, entity string) (bool, error) {
 	return false, fmt.Errorf("user has no permission: [%s]", tag)
 }
 
-// HasPermissionTag verifies if user has a specific permission tag
+// HasPermissionTag verifies if user has a specific permission tag, directly
+// or through one of its roles
 func (u *User) HasPermissionTag(tag string) (bool, error) {
 	for _, r := range u.Permissions {
 		if r.Tag == tag {
 			return true, nil
 		}
 	}
+	for _, r := range u.Roles {
+		for _, p := range r.Permissions {
+			if p.Tag == tag {
+				return true, nil
+			}
+		}
+	}
 	return false, fmt.Errorf("user has no [%s] permission", tag)
 }
 
+// PermissionTags are the effective permissions of the user, the ones given
+// directly and through its roles, without duplicates
+func (u *User) PermissionTags() []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	add := func(perms []Permission) {
+		for _, p := range perms {
+			if !seen[p.Tag] {
+				seen[p.Tag] = true
+				tags = append(tags, p.Tag)
+			}
+		}
+	}
+	add(u.Permissions)
+	for _, r := range u.Roles {
+		add(r.Permissions)
+	}
+	return tags
+}
+
+// RoleNames are the names of the roles of the user
+func (u *User) RoleNames() []string {
+	names := []string{}
+	for _, r := range u.Roles {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// Prefix is the start of the api key, enough for the user to tell them apart
+func (k *UserAPIKey) Prefix() string {
+	if len(k.APIKey) <= 8 {
+		return k.APIKey
+	}
+	return k.APIKey[:8]
+}
+
+// CIDRList returns the CIDR ranges the key can be used from
+func (k *UserAPIKey) CIDRList() []string {
+	return strings.Fields(k.AllowedCIDRs)
+}
+
+// PathPrefixList returns the path prefixes the key can be used for
+func (k *UserAPIKey) PathPrefixList() []string {
+	return strings.Fields(k.AllowedPathPrefixes)
+}
+
+// AllowsIP verifies if the key can be used from the ip
+func (k *UserAPIKey) AllowsIP(ip net.IP) bool {
+	cidrs := k.CIDRList()
+	if len(cidrs) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, c := range cidrs {
+		if _, n, err := net.ParseCIDR(c); err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsPath verifies if the key can be used for the path, prefixes match
+// whole segments so /api/orgs doesn't allow /api/orgsx
+func (k *UserAPIKey) AllowsPath(p string) bool {
+	prefixes := k.PathPrefixList()
+	if len(prefixes) == 0 {
+		return true
+	}
+	p = path.Clean("/" + p)
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeCIDRs validates the CIDR ranges and returns them space separated,
+// single IPs are turned into ranges of their own
+func NormalizeCIDRs(cidrs []string) (string, error) {
+	out := make([]string, 0, len(cidrs))
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if ip := net.ParseIP(c); ip != nil {
+			if ip.To4() != nil {
+				c += "/32"
+			} else {
+				c += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return "", fmt.Errorf("invalid CIDR range [%s]", c)
+		}
+		out = append(out, n.String())
+	}
+	return strings.Join(out, " "), nil
+}
+
+// NormalizePathPrefixes validates the path prefixes and returns them space
+// separated
+func NormalizePathPrefixes(prefixes []string) (string, error) {
+	out := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "/") || strings.ContainsAny(p, " ?#") {
+			return "", errors.New("invalid path prefix [" + p + "]")
+		}
+		out = append(out, path.Clean(p))
+	}
+	return strings.Join(out, " "), nil
+}
+
 // CanUpdate verifies if user can update if owner - returns t/f
 func (u *User) CanUpdate(id string) (bool, error) {
 	if id == u.ID.String() {
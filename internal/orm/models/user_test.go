@@ -1,6 +1,8 @@
 package models_test
 
 import (
+	"net"
+	"reflect"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -27,6 +29,7 @@ func mockOrm(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
 func TestUser_HasPermissionTag(t *testing.T) {
 	type fields struct {
 		Permissions []models.Permission
+		Roles       []models.Role
 	}
 	type args struct {
 		tag string
@@ -64,11 +67,25 @@ func TestUser_HasPermissionTag(t *testing.T) {
 			want:    false,
 			wantErr: true,
 		},
+		{
+			name: "User has permission tag through role",
+			fields: fields{
+				Roles: []models.Role{
+					{Permissions: []models.Permission{{Tag: "update:users"}}},
+				},
+			},
+			args: args{
+				tag: "update:users",
+			},
+			want:    true,
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			u := &models.User{
 				Permissions: tt.fields.Permissions,
+				Roles:       tt.fields.Roles,
 			}
 			got, err := u.HasPermissionTag(tt.args.tag)
 			if (err != nil) != tt.wantErr {
@@ -82,6 +99,21 @@ func TestUser_HasPermissionTag(t *testing.T) {
 	}
 }
 
+func TestUser_PermissionTags(t *testing.T) {
+	u := &models.User{
+		Permissions: []models.Permission{{Tag: "read:users"}},
+		Roles: []models.Role{
+			{Permissions: []models.Permission{{Tag: "read:users"}, {Tag: "update:users"}}},
+			{Permissions: []models.Permission{{Tag: "list:users"}}},
+		},
+	}
+	got := u.PermissionTags()
+	want := []string{"read:users", "update:users", "list:users"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("User.PermissionTags() = %v, want %v", got, want)
+	}
+}
+
 func TestUser_HasRole(t *testing.T) {
 	type fields struct {
 		Roles []models.Role
@@ -300,3 +332,76 @@ func TestUser_BeforeSave(t *testing.T) {
 		})
 	}
 }
+
+func TestUserAPIKey_AllowsIP(t *testing.T) {
+	k := &models.UserAPIKey{AllowedCIDRs: "10.0.0.0/8 2001:db8::/32"}
+	tests := []struct {
+		name string
+		key  *models.UserAPIKey
+		ip   string
+		want bool
+	}{
+		{name: "unrestricted", key: &models.UserAPIKey{}, ip: "203.0.113.9", want: true},
+		{name: "inside the ipv4 range", key: k, ip: "10.20.30.40", want: true},
+		{name: "inside the ipv6 range", key: k, ip: "2001:db8::1", want: true},
+		{name: "outside the ranges", key: k, ip: "203.0.113.9", want: false},
+		{name: "unknown ip", key: k, ip: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key.AllowsIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("UserAPIKey.AllowsIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserAPIKey_AllowsPath(t *testing.T) {
+	k := &models.UserAPIKey{AllowedPathPrefixes: "/v1/api/orgs /v1/api/me/apps"}
+	tests := []struct {
+		name string
+		key  *models.UserAPIKey
+		path string
+		want bool
+	}{
+		{name: "unrestricted", key: &models.UserAPIKey{}, path: "/v1/api/admin/policies", want: true},
+		{name: "the prefix itself", key: k, path: "/v1/api/orgs", want: true},
+		{name: "under the prefix", key: k, path: "/v1/api/orgs/42/members", want: true},
+		{name: "another prefix", key: k, path: "/v1/api/me/apps", want: true},
+		{name: "partial segment", key: k, path: "/v1/api/orgsx", want: false},
+		{name: "outside the prefixes", key: k, path: "/v1/api/admin/policies", want: false},
+		{name: "dot segments", key: k, path: "/v1/api/orgs/../admin/policies", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key.AllowsPath(tt.path); got != tt.want {
+				t.Errorf("UserAPIKey.AllowsPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaseModel_BeforeCreate(t *testing.T) {
+	gormDB, _ := mockOrm(t)
+	id := uuid.Must(uuid.NewV4())
+	kept := &models.BaseModel{ID: id}
+	if err := kept.BeforeCreate(gormDB); err != nil || kept.ID != id {
+		t.Errorf("BaseModel.BeforeCreate() = %v, %v, want %v", kept.ID, err, id)
+	}
+	made := &models.BaseModel{}
+	if err := made.BeforeCreate(gormDB); err != nil || made.ID == uuid.Nil {
+		t.Errorf("BaseModel.BeforeCreate() = %v, %v, want an id", made.ID, err)
+	}
+}
+
+func TestUserAPIKey_BeforeCreate(t *testing.T) {
+	gormDB, _ := mockOrm(t)
+	k := &models.UserAPIKey{}
+	if err := k.BeforeCreate(gormDB); err != nil || k.APIKey == "" {
+		t.Errorf("UserAPIKey.BeforeCreate() = %q, %v, want a key", k.APIKey, err)
+	}
+	given := &models.UserAPIKey{APIKey: "given"}
+	if err := given.BeforeCreate(gormDB); err != nil || given.APIKey != "given" {
+		t.Errorf("UserAPIKey.BeforeCreate() = %q, %v, want %q", given.APIKey, err, "given")
+	}
+}
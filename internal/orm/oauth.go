@@ -0,0 +1,182 @@
+package orm
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidClient when the client doesn't exist or the secret is wrong
+	ErrInvalidClient = errors.New("invalid client credentials")
+
+	// ErrUnknownScope when a scope isn't one of the permission tags
+	ErrUnknownScope = errors.New("unknown scope")
+
+	// ErrInvalidGrantType when a grant type isn't supported
+	ErrInvalidGrantType = errors.New("unsupported grant type")
+
+	// ErrInvalidRedirectURI when a client redirect uri can't be registered
+	ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+
+	// ErrInvalidGrant when a code or refresh token is unknown, used or expired,
+	// or the grant it came from was revoked
+	ErrInvalidGrant = errors.New("invalid or expired grant")
+)
+
+// CreateOAuthClient registers the oauth client allowed to ask for the
+// scopes, confidential clients get a secret that is returned only this once
+func (o *ORM) CreateOAuthClient(c *models.OAuthClient, scopes []string) (string, error) {
+	if err := validateOAuthClient(c); err != nil {
+		return "", err
+	}
+	c.ClientID = uuid.Must(uuid.NewV4()).String()
+	secret := ""
+	if !c.Public {
+		var err error
+		if secret, err = randomSecret(); err != nil {
+			return "", err
+		}
+		if err := c.SetSecret(secret); err != nil {
+			return "", err
+		}
+	}
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		perms, err := findPermissionsByTag(tx, scopes)
+		if err != nil {
+			return err
+		}
+		c.Scopes = perms
+		return tx.Create(c).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// FindOAuthClient finds the client along with its allowed scopes, from the
+// primary as a deleted client must no longer authenticate
+func (o *ORM) FindOAuthClient(clientID string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, errors.New("client id is empty")
+	}
+	c := &models.OAuthClient{}
+	if err := o.Primary().DB.Preload("Scopes").First(c, "client_id = ?", clientID).Error; err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AuthenticateOAuthClient finds the client and verifies its secret
+func (o *ORM) AuthenticateOAuthClient(clientID string, secret string) (*models.OAuthClient, error) {
+	c, err := o.FindOAuthClient(clientID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidClient
+		}
+		return nil, err
+	}
+	if !c.VerifySecret(secret) {
+		return nil, ErrInvalidClient
+	}
+	return c, nil
+}
+
+// ListOAuthClients lists the registered clients
+func (o *ORM) ListOAuthClients() ([]models.OAuthClient, error) {
+	cs := []models.OAuthClient{}
+	if err := o.DB.Preload("Scopes").Order("created_at").Find(&cs).Error; err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// DeleteOAuthClient deletes the client for good, along with the grants, codes
+// and refresh tokens issued to it, so its tokens stop working. Its DeletedAt
+// isn't gorm's soft delete, the client lookups don't filter on it
+func (o *ORM) DeleteOAuthClient(clientID string) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		c := &models.OAuthClient{}
+		if err := tx.First(c, "client_id = ?", clientID).Error; err != nil {
+			return err
+		}
+		grants := tx.Model(&models.OAuthGrant{}).Select("id").Where("client_id = ?", clientID)
+		if err := tx.Where("grant_id IN (?)", grants).Delete(&models.OAuthRefreshToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("client_id = ?", clientID).Delete(&models.OAuthGrant{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("client_id = ?", clientID).Delete(&models.OAuthAuthorizationCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Select("Scopes").Delete(c).Error
+	})
+}
+
+// validateOAuthClient checks the client can be registered as it is
+func validateOAuthClient(c *models.OAuthClient) error {
+	if c.Name == "" {
+		return errors.New("client name is empty")
+	}
+	for _, g := range c.GrantTypeList() {
+		if !consts.IsGrantType(g) {
+			return fmt.Errorf("%w: %s", ErrInvalidGrantType, g)
+		}
+	}
+	if c.Public && c.HasGrantType(consts.GrantTypes.ClientCredentials) {
+		return fmt.Errorf("%w: public clients can't use %s", ErrInvalidGrantType, consts.GrantTypes.ClientCredentials)
+	}
+	uris := c.RedirectURIList()
+	if c.HasGrantType(consts.GrantTypes.AuthorizationCode) && len(uris) == 0 {
+		return fmt.Errorf("%w: %s needs at least one", ErrInvalidRedirectURI, consts.GrantTypes.AuthorizationCode)
+	}
+	for _, r := range uris {
+		u, err := url.Parse(r)
+		if err != nil || u.Scheme == "" || u.Fragment != "" || u.User != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidRedirectURI, r)
+		}
+	}
+	return nil
+}
+
+// findPermissionsByTag finds the permissions, all the tags must exist
+func findPermissionsByTag(tx *gorm.DB, tags []string) ([]models.Permission, error) {
+	perms := []models.Permission{}
+	if len(tags) == 0 {
+		return perms, nil
+	}
+	if err := tx.Where("tag IN ?", tags).Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		found := false
+		for _, p := range perms {
+			if p.Tag == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownScope, t)
+		}
+	}
+	return perms, nil
+}
+
+// randomSecret generates a url safe random secret
+func randomSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,172 @@
+package orm_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/gorm"
+)
+
+func TestORM_AuthenticateOAuthClient(t *testing.T) {
+	client := &models.OAuthClient{}
+	if err := client.SetSecret("secret"); err != nil {
+		t.Fatalf("SetSecret() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		secret  string
+		found   bool
+		wantErr error
+	}{
+		{name: "unknown client", secret: "secret", found: false, wantErr: orm.ErrInvalidClient},
+		{name: "wrong secret", secret: "wrong", found: true, wantErr: orm.ErrInvalidClient},
+		{name: "authenticates the client", secret: "secret", found: true, wantErr: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+
+			rows := sqlmock.NewRows([]string{"id", "client_id", "secret_hash"})
+			if tt.found {
+				rows.AddRow("6ba7b810-9dad-11d1-80b4-00c04fd430c8", "client_id", client.SecretHash)
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "oauth_clients"`)).
+				WithArgs("client_id").WillReturnRows(rows)
+			if tt.found {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "oauth_client_scopes"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"o_auth_client_id", "permission_id"}))
+			}
+
+			got, err := o.AuthenticateOAuthClient("client_id", tt.secret)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.AuthenticateOAuthClient() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == nil && got.ClientID != "client_id" {
+				t.Errorf("ORM.AuthenticateOAuthClient() = %v, want client_id", got)
+			}
+		})
+	}
+}
+
+func TestORM_CreateOAuthClient_validation(t *testing.T) {
+	gormDB, _ := mockOrm(t)
+	o := &orm.ORM{DB: gormDB}
+	tests := []struct {
+		name    string
+		client  *models.OAuthClient
+		wantErr error
+	}{
+		{
+			name:    "unsupported grant type",
+			client:  &models.OAuthClient{Name: "app", GrantTypes: "password"},
+			wantErr: orm.ErrInvalidGrantType,
+		},
+		{
+			name:    "public client with client credentials",
+			client:  &models.OAuthClient{Name: "app", Public: true, GrantTypes: "client_credentials"},
+			wantErr: orm.ErrInvalidGrantType,
+		},
+		{
+			name:    "authorization code without redirect uri",
+			client:  &models.OAuthClient{Name: "app", GrantTypes: "authorization_code"},
+			wantErr: orm.ErrInvalidRedirectURI,
+		},
+		{
+			name:    "redirect uri with fragment",
+			client:  &models.OAuthClient{Name: "app", GrantTypes: "authorization_code", RedirectURIs: "https://app.test/cb#x"},
+			wantErr: orm.ErrInvalidRedirectURI,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := o.CreateOAuthClient(tt.client, nil); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.CreateOAuthClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestORM_ConsumeOAuthAuthorizationCode(t *testing.T) {
+	tests := []struct {
+		name      string
+		found     bool
+		expiresIn time.Duration
+		deleted   int64
+		wantErr   error
+	}{
+		{name: "unknown code", found: false, wantErr: orm.ErrInvalidGrant},
+		{name: "code already used", found: true, expiresIn: time.Minute, deleted: 0, wantErr: orm.ErrInvalidGrant},
+		{name: "expired code", found: true, expiresIn: -time.Minute, deleted: 1, wantErr: orm.ErrInvalidGrant},
+		{name: "consumes the code", found: true, expiresIn: time.Minute, deleted: 1, wantErr: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+
+			mock.ExpectBegin()
+			rows := sqlmock.NewRows([]string{"id", "client_id", "expires_at"})
+			if tt.found {
+				rows.AddRow("6ba7b810-9dad-11d1-80b4-00c04fd430c8", "client_id", time.Now().Add(tt.expiresIn))
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "oauth_authorization_codes"`)).WillReturnRows(rows)
+			if tt.found {
+				mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "oauth_authorization_codes"`)).
+					WillReturnResult(sqlmock.NewResult(0, tt.deleted))
+			}
+			if tt.deleted == 1 {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			got, err := o.ConsumeOAuthAuthorizationCode("code")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.ConsumeOAuthAuthorizationCode() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == nil && got.ClientID != "client_id" {
+				t.Errorf("ORM.ConsumeOAuthAuthorizationCode() = %v, want client_id", got)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestORM_DeleteOAuthClient(t *testing.T) {
+	o := sqliteOrm(t)
+	c := &models.OAuthClient{Name: "app", GrantTypes: "authorization_code", RedirectURIs: "https://app.test/cb"}
+	if _, err := o.CreateOAuthClient(c, nil); err != nil {
+		t.Fatalf("CreateOAuthClient() error = %v", err)
+	}
+	g, err := o.GrantOAuthScopes(uuid.Must(uuid.NewV4()), c.ClientID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.CreateOAuthRefreshToken(g.ID, "", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.DeleteOAuthClient(c.ClientID); err != nil {
+		t.Fatalf("DeleteOAuthClient() error = %v", err)
+	}
+	for _, m := range []any{&models.OAuthClient{}, &models.OAuthGrant{}, &models.OAuthRefreshToken{}} {
+		var n int64
+		if err := o.DB.Model(m).Count(&n).Error; err != nil || n != 0 {
+			t.Errorf("DeleteOAuthClient() left %d %T rows, err %v", n, m, err)
+		}
+	}
+	if err := o.DeleteOAuthClient(c.ClientID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("DeleteOAuthClient() of a deleted client error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
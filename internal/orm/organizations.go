@@ -0,0 +1,220 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// invitationTTL is how long an invitation to join an organization lasts
+const invitationTTL = 7 * 24 * time.Hour
+
+var (
+	// ErrAlreadyMember when the user is already a member of the organization
+	ErrAlreadyMember = errors.New("already a member of the organization")
+
+	// ErrLastOwner when removing the member would leave the organization
+	// without an owner
+	ErrLastOwner = errors.New("can't remove the last owner of the organization")
+
+	// ErrInvalidOrgRole when a role isn't one of the organization roles
+	ErrInvalidOrgRole = errors.New("invalid organization role")
+)
+
+// CreateOrganization creates the organization with the user as its owner
+func (o *ORM) CreateOrganization(org *models.Organization, ownerID uuid.UUID) error {
+	if org.Name == "" {
+		return errors.New("organization name is empty")
+	}
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		roles, err := findOrgRoles(tx, []string{consts.OrgRoles.Owner.Name})
+		if err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Create(org).Error; err != nil {
+			return err
+		}
+		m := &models.Membership{OrganizationID: org.ID, UserID: ownerID, Roles: roles}
+		return tx.Omit("Organization", "User").Create(m).Error
+	})
+}
+
+// FindMembership finds the membership of the user to the organization along
+// with its roles and their permissions. A removed member must lose access at
+// once, so it's read from the primary
+func (o *ORM) FindMembership(orgID uuid.UUID, userID uuid.UUID) (*models.Membership, error) {
+	m := &models.Membership{}
+	rolePerm := fmt.Sprintf(nestedFmt, consts.EntityNames.Roles, consts.EntityNames.Permissions)
+	if err := o.Primary().DB.Preload("Organization").Preload(consts.EntityNames.Roles).Preload(rolePerm).
+		First(m, "organization_id = ? AND user_id = ?", orgID, userID).Error; err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ListUserMemberships lists the organizations the user is a member of
+func (o *ORM) ListUserMemberships(userID uuid.UUID) ([]models.Membership, error) {
+	ms := []models.Membership{}
+	if err := o.DB.Preload("Organization").Preload(consts.EntityNames.Roles).
+		Where("user_id = ?", userID).Order("created_at").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// ListMembers lists the members of the organization
+func (o *ORM) ListMembers(orgID uuid.UUID) ([]models.Membership, error) {
+	ms := []models.Membership{}
+	if err := o.DB.Preload(sUserTbl).Preload(consts.EntityNames.Roles).
+		Where("organization_id = ?", orgID).Order("created_at").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// CreateInvitation invites the user with the email to join the organization
+// with the roles, members by default. The token to accept it is only ever
+// returned here, for the inviter to send it to the email
+func (o *ORM) CreateInvitation(orgID uuid.UUID, email string, roleNames []string,
+	invitedBy uuid.UUID) (*models.Invitation, string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return nil, "", errors.New("email is empty")
+	}
+	if len(roleNames) == 0 {
+		roleNames = []string{consts.OrgRoles.Member.Name}
+	}
+	token, err := randomSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	inv := &models.Invitation{
+		OrganizationID: orgID,
+		Email:          email,
+		TokenHash:      hashToken(token),
+		InvitedByID:    invitedBy,
+		ExpiresAt:      time.Now().Add(invitationTTL),
+	}
+	err = o.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&models.Membership{}).
+			Joins("JOIN users ON users.id = memberships.user_id").
+			Where("memberships.organization_id = ? AND users.email = ?", orgID, email).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyMember
+		}
+		if inv.Roles, err = findOrgRoles(tx, roleNames); err != nil {
+			return err
+		}
+		return tx.Omit("Organization").Create(inv).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return inv, token, nil
+}
+
+// ListInvitations lists the pending invitations for the email
+func (o *ORM) ListInvitations(email string) ([]models.Invitation, error) {
+	is := []models.Invitation{}
+	if err := o.DB.Preload("Organization").Preload(consts.EntityNames.Roles).
+		Where("email = ? AND expires_at > ?", strings.ToLower(email), time.Now()).
+		Order("created_at").Find(&is).Error; err != nil {
+		return nil, err
+	}
+	return is, nil
+}
+
+// AcceptInvitation makes the user a member of the organization, the
+// invitation must be for the email of the user and come with its token. The
+// email alone isn't proof enough, providers don't all verify it. The
+// invitation is used up
+func (o *ORM) AcceptInvitation(id uuid.UUID, token string, u *models.User) (*models.Membership, error) {
+	if token == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	m := &models.Membership{}
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		inv := &models.Invitation{}
+		if err := tx.Preload(consts.EntityNames.Roles).First(inv, "id = ? AND email = ? AND token_hash = ?",
+			id, strings.ToLower(u.Email), hashToken(token)).Error; err != nil {
+			return err
+		}
+		if inv.Expired() {
+			return gorm.ErrRecordNotFound
+		}
+		err := tx.First(m, "organization_id = ? AND user_id = ?", inv.OrganizationID, u.ID).Error
+		if err == nil {
+			return ErrAlreadyMember
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		m = &models.Membership{OrganizationID: inv.OrganizationID, UserID: u.ID, Roles: inv.Roles}
+		if err := tx.Omit("Organization", "User").Create(m).Error; err != nil {
+			return err
+		}
+		return tx.Select(consts.EntityNames.Roles).Delete(inv).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RemoveMember removes the user from the organization, an organization can't
+// be left without an owner
+func (o *ORM) RemoveMember(orgID uuid.UUID, userID uuid.UUID) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		m := &models.Membership{}
+		if err := tx.Preload(consts.EntityNames.Roles).
+			First(m, "organization_id = ? AND user_id = ?", orgID, userID).Error; err != nil {
+			return err
+		}
+		if m.HasRole(consts.OrgRoles.Owner.Name) {
+			var owners int64
+			err := tx.Model(&models.Membership{}).
+				Joins("JOIN membership_roles ON membership_roles.membership_id = memberships.id").
+				Joins("JOIN roles ON roles.id = membership_roles.role_id").
+				Where("memberships.organization_id = ? AND roles.name = ?", orgID, consts.OrgRoles.Owner.Name).
+				Count(&owners).Error
+			if err != nil {
+				return err
+			}
+			if owners <= 1 {
+				return ErrLastOwner
+			}
+		}
+		return tx.Select(consts.EntityNames.Roles).Delete(m).Error
+	})
+}
+
+// findOrgRoles finds the organization roles by name
+func findOrgRoles(tx *gorm.DB, names []string) ([]models.Role, error) {
+	unique := map[string]bool{}
+	for _, n := range names {
+		if !consts.IsOrgRole(n) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidOrgRole, n)
+		}
+		unique[n] = true
+	}
+	roles := []models.Role{}
+	if err := tx.Where("name IN ?", names).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	if len(roles) != len(unique) {
+		return nil, fmt.Errorf("%w: organization roles aren't seeded", ErrInvalidOrgRole)
+	}
+	return roles, nil
+}
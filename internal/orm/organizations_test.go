@@ -0,0 +1,121 @@
+package orm_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/markbates/goth"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/gorm"
+)
+
+func TestORM_RemoveMember(t *testing.T) {
+	orgID := uuid.Must(uuid.NewV4())
+	userID := uuid.Must(uuid.NewV4())
+	membershipID := uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name    string
+		role    string
+		owners  int
+		wantErr error
+	}{
+		{name: "removes a member", role: "org:member", wantErr: nil},
+		{name: "removes one of the owners", role: "org:owner", owners: 2, wantErr: nil},
+		{name: "last owner", role: "org:owner", owners: 1, wantErr: orm.ErrLastOwner},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "memberships"`)).
+				WithArgs(orgID, userID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "organization_id", "user_id"}).
+					AddRow(membershipID, orgID, userID))
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "membership_roles"`)).
+				WillReturnRows(sqlmock.NewRows([]string{"membership_id", "role_id"}).AddRow(membershipID, 1))
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles"`)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, tt.role))
+			if tt.role == "org:owner" {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "memberships"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.owners))
+			}
+			if tt.wantErr == nil {
+				mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "membership_roles"`)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "memberships"`)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			if err := o.RemoveMember(orgID, userID); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.RemoveMember() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestORM_CreateInvitation_invalidRole(t *testing.T) {
+	gormDB, mock := mockOrm(t)
+	o := &orm.ORM{DB: gormDB}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "memberships"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+
+	_, _, err := o.CreateInvitation(uuid.Must(uuid.NewV4()), "new@test.com", []string{"admin"}, uuid.Must(uuid.NewV4()))
+	if !errors.Is(err, orm.ErrInvalidOrgRole) {
+		t.Errorf("ORM.CreateInvitation() error = %v, wantErr %v", err, orm.ErrInvalidOrgRole)
+	}
+}
+
+func TestORM_AcceptInvitation(t *testing.T) {
+	o := sqliteOrm(t)
+	owner, err := o.UpsertUserProfile(&goth.User{Provider: "google", UserID: "g-1", Email: "owner@example.com"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the provider doesn't verify emails, anyone can sign in with this one
+	invitee, err := o.UpsertUserProfile(&goth.User{Provider: "github", UserID: "gh-1", Email: "bob@example.com"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	org := &models.Organization{Name: "Acme"}
+	if err := o.CreateOrganization(org, owner.ID); err != nil {
+		t.Fatalf("CreateOrganization() error = %v", err)
+	}
+	inv, token, err := o.CreateInvitation(org.ID, "Bob@example.com", nil, owner.ID)
+	if err != nil {
+		t.Fatalf("CreateInvitation() error = %v", err)
+	}
+
+	for name, token := range map[string]string{"without the token": "", "with another token": "guessed"} {
+		if _, err := o.AcceptInvitation(inv.ID, token, invitee); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("AcceptInvitation() %s error = %v, want %v", name, err, gorm.ErrRecordNotFound)
+		}
+	}
+	if _, err := o.AcceptInvitation(inv.ID, token, owner); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("AcceptInvitation() for another email error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	m, err := o.AcceptInvitation(inv.ID, token, invitee)
+	if err != nil {
+		t.Fatalf("AcceptInvitation() error = %v", err)
+	}
+	if m.OrganizationID != org.ID || m.UserID != invitee.ID {
+		t.Errorf("AcceptInvitation() = %+v, want a membership of %s to %s", m, invitee.ID, org.ID)
+	}
+	if _, err := o.AcceptInvitation(inv.ID, token, invitee); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("AcceptInvitation() used up error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
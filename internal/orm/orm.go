@@ -3,9 +3,12 @@
 package orm
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/gofrs/uuid"
 	"github.com/markbates/goth"
 	"github.com/rakin92/go-rest-service/internal/orm/migration"
 	"github.com/rakin92/go-rest-service/internal/orm/models"
@@ -14,13 +17,26 @@ import (
 	"github.com/rakin92/go-rest-service/pkg/logger"
 	"github.com/rakin92/go-rest-service/pkg/storage/dbm"
 
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
 	sUserTbl  = "User"
 	nestedFmt = "%s.%s"
+
+	// ErrEmailAlreadyRegistered when a new provider profile matches the email
+	// of an existing user that it can't be merged into
+	ErrEmailAlreadyRegistered = errors.New("email is already registered, sign in and link this provider instead")
+
+	// ErrProfileLinkedToOtherUser when the provider profile belongs to someone else
+	ErrProfileLinkedToOtherUser = errors.New("provider profile is linked to another user")
+
+	// ErrLastLoginMethod when removing a profile would leave the user without login
+	ErrLastLoginMethod = errors.New("can't remove the last login method of the user")
+
+	// ErrUserDeactivated when the user was deactivated and can't sign in
+	ErrUserDeactivated = errors.New("user is deactivated")
 )
 
 // ORM struct to holds the gorm pointer to db
@@ -31,10 +47,34 @@ type ORM struct {
 // Init creates a db connection with the selected dialect and connection
 // along with running all the db migrations
 func Init(c *cfg.DB) (*ORM, error) {
-	db, err := gorm.Open(postgres.Open(c.DSN))
+	d, err := dialector(c)
+	if err != nil {
+		logger.Panic(&err, "[ORM] err: %s", err.Error())
+	}
+	db, err := gorm.Open(d)
+	if err != nil {
+		logger.Panic(&err, "[ORM] err: %s", err.Error())
+	}
+	pool, err := db.DB()
 	if err != nil {
 		logger.Panic(&err, "[ORM] err: %s", err.Error())
 	}
+	limitPool(pool, c)
+	if err := db.Use(TenantPlugin{}); err != nil {
+		logger.Panic(&err, "[ORM] tenant plugin err: %s", err.Error())
+	}
+	if err := db.Use(VersionPlugin{}); err != nil {
+		logger.Panic(&err, "[ORM] version plugin err: %s", err.Error())
+	}
+	if err := db.Use(AuditPlugin{}); err != nil {
+		logger.Panic(&err, "[ORM] audit plugin err: %s", err.Error())
+	}
+	if len(c.ReplicaDSNs) > 0 {
+		p := &ReplicaPlugin{Replicas: openReplicas(c), CheckInterval: c.ReplicaCheckInterval}
+		if err := db.Use(p); err != nil {
+			logger.Panic(&err, "[ORM] replica plugin err: %s", err.Error())
+		}
+	}
 	orm := &ORM{DB: db}
 	// Log every SQL command on dev, @prod: this should be disabled? Maybe.
 	// db.LogMode(c.LogMode) TODO: look into this
@@ -46,7 +86,7 @@ func Init(c *cfg.DB) (*ORM, error) {
 			logger.Fatal(&err, "[sql.Migrate] scripts err: %s", err.Error())
 		}
 		// migrats our orm schema
-		err = migration.ServiceAutoMigration(orm.DB)
+		err = migration.ServiceAutoMigration(orm.Primary().DB)
 		if err != nil {
 			logger.Fatal(&err, "[ORM.autoMigrate] err: %v", err.Error())
 		}
@@ -56,69 +96,114 @@ func Init(c *cfg.DB) (*ORM, error) {
 	return orm, nil
 }
 
-//FindUserByAPIKey finds the user that is related to the API key
-func (o *ORM) FindUserByAPIKey(apiKey string) (*models.User, error) {
-	if apiKey == "" {
-		return nil, errors.New("API key is empty")
+// limitPool bounds the connections of the pool to the ones of the config
+func limitPool(pool *sql.DB, c *cfg.DB) {
+	if c.MaxIdleCon > 0 {
+		pool.SetMaxIdleConns(c.MaxIdleCon)
 	}
-	uak := &models.UserAPIKey{}
-	usrPerm := fmt.Sprintf(nestedFmt, sUserTbl, consts.EntityNames.Permissions)
-	usrRole := fmt.Sprintf(nestedFmt, sUserTbl, consts.EntityNames.Roles)
-	if err := o.DB.Preload(sUserTbl).Preload(usrPerm).Preload(usrRole).
-		First(uak, "api_key = ?", apiKey).Error; err != nil {
+	if c.MaxCon > 0 {
+		pool.SetMaxOpenConns(c.MaxCon)
+	}
+}
+
+// FindUserByAPIKey finds the user that is related to the API key
+func (o *ORM) FindUserByAPIKey(apiKey string) (*models.User, error) {
+	uak, err := o.FindAPIKey(apiKey)
+	if err != nil {
 		return nil, err
 	}
 	return &uak.User, nil
 }
 
-// FindUserByJWT finds the user that is related to the APIKey token
-func (o *ORM) FindUserByJWT(email string, provider string, userID string) (*models.User, error) {
+// FindUserByJWT finds the user of the provider profile the token was issued
+// for. The profile is identified by its provider and external user id only,
+// the email of a linked profile may not be the one of the user. Read from the
+// primary, like every lookup authenticating a request
+func (o *ORM) FindUserByJWT(provider string, userID string) (*models.User, error) {
 	if provider == "" || userID == "" {
 		return nil, errors.New("provider or userId empty")
 	}
-	tx := o.DB.Begin()
 	p := &models.UserProfile{}
 	usrPerm := fmt.Sprintf(nestedFmt, sUserTbl, consts.EntityNames.Permissions)
 	usrRole := fmt.Sprintf(nestedFmt, sUserTbl, consts.EntityNames.Roles)
-	if err := tx.Preload(sUserTbl).Preload(usrPerm).Preload(usrRole).
-		First(p, "email  = ? AND provider = ? AND external_user_id = ?", email, provider, userID).Error; err != nil {
+	usrRolePerm := fmt.Sprintf(nestedFmt, usrRole, consts.EntityNames.Permissions)
+	if err := o.Primary().DB.Preload(sUserTbl).Preload(usrPerm).Preload(usrRole).Preload(usrRolePerm).
+		First(p, "provider = ? AND external_user_id = ?", provider, userID).Error; err != nil {
 		return nil, err
 	}
+	if !p.User.Active() {
+		return nil, ErrUserDeactivated
+	}
 	return &p.User, nil
 }
 
+// FindUserByID finds the active user along with its roles and permissions,
+// on the primary as a replica may not know yet the user was deactivated
+func (o *ORM) FindUserByID(id uuid.UUID) (*models.User, error) {
+	u := &models.User{}
+	rolePerm := fmt.Sprintf(nestedFmt, consts.EntityNames.Roles, consts.EntityNames.Permissions)
+	if err := o.Primary().DB.Preload(consts.EntityNames.Permissions).Preload(consts.EntityNames.Roles).
+		Preload(rolePerm).First(u, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if !u.Active() {
+		return nil, ErrUserDeactivated
+	}
+	return u, nil
+}
+
 // UpsertUserProfile saves the user if doesn't exists and adds the OAuth profile
-// and updates existing user info if record exist in db
-func (o *ORM) UpsertUserProfile(gu *goth.User) (*models.User, error) {
-	db := o.DB
-	up := &models.UserProfile{}
+// and updates the profile info if it was already linked. A new profile is only
+// attached to an existing user with the same email when [mergeVerified] is set
+// and the provider asserts the email was verified
+func (o *ORM) UpsertUserProfile(gu *goth.User, mergeVerified bool) (*models.User, error) {
 	u, err := models.GothUserToDBUser(gu, false)
 	if err != nil {
 		return nil, err
 	}
-
-	tx := db.Where("email = ?", gu.Email).First(u)
-	if tx.Error != nil && tx.Error != gorm.ErrRecordNotFound {
-		return nil, tx.Error
+	up, err := models.GothUserToDBUserProfile(gu, false)
+	if err != nil {
+		return nil, err
 	}
 
-	if tx := db.Model(u).Save(u); tx.Error != nil {
-		return nil, tx.Error
-	}
+	err = o.DB.Transaction(func(tx *gorm.DB) error {
+		p := &models.UserProfile{}
+		err := tx.Preload(sUserTbl).
+			First(p, "provider = ? AND external_user_id = ?", gu.Provider, gu.UserID).Error
+		if err == nil {
+			// the profile is already linked, just refresh the provider info
+			*u = p.User
+			if !u.Active() {
+				return ErrUserDeactivated
+			}
+			return tx.Model(p).Omit(clause.Associations).Updates(up).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
 
-	tx = db.Where("email = ? AND provider = ? AND external_user_id = ?", gu.Email, gu.Provider, gu.UserID).First(up)
-	if tx.Error != nil && tx.Error != gorm.ErrRecordNotFound {
-		return nil, tx.Error
-	}
+		err = tx.First(u, "email = ?", strings.ToLower(gu.Email)).Error
+		switch {
+		case err == nil:
+			if !u.Active() {
+				return ErrUserDeactivated
+			}
+			if !mergeVerified || !models.GothUserEmailVerified(gu) {
+				return ErrEmailAlreadyRegistered
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(u).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
 
-	up, err = models.GothUserToDBUserProfile(gu, false)
+		up.UserID = u.ID
+		return tx.Omit(clause.Associations).Create(up).Error
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	up.User = *u
-	if tx := db.Model(up).Save(up); tx.Error != nil {
-		return nil, tx.Error
-	}
 	return u, nil
 }
@@ -116,7 +116,6 @@ func TestORM_FindUserByJWT(t *testing.T) {
 		rows *sqlmock.Rows
 	}
 	type args struct {
-		email    string
 		provider string
 		userID   string
 	}
@@ -130,7 +129,6 @@ func TestORM_FindUserByJWT(t *testing.T) {
 		{
 			name: "valid user",
 			args: args{
-				email:    "valid",
 				userID:   "valid",
 				provider: "valid",
 			},
@@ -144,7 +142,6 @@ func TestORM_FindUserByJWT(t *testing.T) {
 		{
 			name: "valid user sql error",
 			args: args{
-				email:    "valid",
 				userID:   "valid",
 				provider: "valid",
 			},
@@ -158,7 +155,6 @@ func TestORM_FindUserByJWT(t *testing.T) {
 		{
 			name: "missing user id",
 			args: args{
-				email:    "valid",
 				userID:   "",
 				provider: "valid",
 			},
@@ -170,11 +166,10 @@ func TestORM_FindUserByJWT(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "missing user email",
+			name: "missing provider",
 			args: args{
-				email:    "",
 				userID:   "valid",
-				provider: "valid",
+				provider: "",
 			},
 			fields: fields{
 				DB:   gormDB,
@@ -190,15 +185,15 @@ func TestORM_FindUserByJWT(t *testing.T) {
 				DB: tt.fields.DB,
 			}
 
-			mock.ExpectBegin()
-			query := mock.ExpectQuery(regexp.QuoteMeta(`SELECT`)).WithArgs(tt.args.email, tt.args.provider, tt.args.userID)
+			// the lookup is a plain read, no transaction is left open
+			query := mock.ExpectQuery(regexp.QuoteMeta(`SELECT`)).WithArgs(tt.args.provider, tt.args.userID)
 			if tt.wantErr {
 				query.WillReturnError(errors.New("Bad Id"))
 			} else {
 				query.WillReturnRows(tt.fields.rows)
 			}
 
-			got, err := o.FindUserByJWT(tt.args.email, tt.args.provider, tt.args.userID)
+			got, err := o.FindUserByJWT(tt.args.provider, tt.args.userID)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ORM.FindUserByJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
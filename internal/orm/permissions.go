@@ -0,0 +1,133 @@
+package orm
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrPermissionExists when another permission already has the tag
+	ErrPermissionExists = errors.New("a permission with the tag already exists")
+
+	// ErrSystemPermission when a permission the service seeds would be
+	// retagged or removed
+	ErrSystemPermission = errors.New("system permissions can't be retagged or deleted")
+
+	// ErrInvalidPermissionTag when the tag isn't an `action:entity` one
+	ErrInvalidPermissionTag = errors.New("the permission tag must be action:entity")
+
+	permissionTag = regexp.MustCompile(`^[a-z][a-z0-9_]*:[a-z][a-z0-9_.-]*$`)
+)
+
+// PermissionChanges are the changes to the permission, the nil ones are left
+// as they are
+type PermissionChanges struct {
+	Tag         *string
+	Description *string
+}
+
+// ListPermissions lists the permissions
+func (o *ORM) ListPermissions() ([]models.Permission, error) {
+	perms := []models.Permission{}
+	if err := o.DB.Order("id").Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
+
+// FindPermission finds the permission
+func (o *ORM) FindPermission(id uint) (*models.Permission, error) {
+	p := &models.Permission{}
+	if err := o.DB.First(p, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CreatePermission creates the permission, its tag must be unique
+func (o *ORM) CreatePermission(p *models.Permission) error {
+	if !permissionTag.MatchString(p.Tag) {
+		return ErrInvalidPermissionTag
+	}
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := permissionTagTaken(tx, p.Tag, 0); err != nil {
+			return err
+		}
+		return tx.Create(p).Error
+	})
+}
+
+// UpdatePermission retags the permission or changes its description, the
+// system permissions can't be retagged
+func (o *ORM) UpdatePermission(id uint, ch *PermissionChanges) (*models.Permission, error) {
+	p := &models.Permission{}
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(p, "id = ?", id).Error; err != nil {
+			return err
+		}
+		changes := map[string]any{}
+		if ch.Tag != nil && *ch.Tag != p.Tag {
+			if consts.IsSystemPermission(p.Tag) {
+				return ErrSystemPermission
+			}
+			if !permissionTag.MatchString(*ch.Tag) {
+				return ErrInvalidPermissionTag
+			}
+			if err := permissionTagTaken(tx, *ch.Tag, id); err != nil {
+				return err
+			}
+			changes["tag"] = *ch.Tag
+		}
+		if ch.Description != nil {
+			changes["description"] = *ch.Description
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		return tx.Model(p).Updates(changes).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DeletePermission takes the permission from the roles, users, API keys and
+// OAuth clients having it and deletes it, the system permissions can't be
+// deleted
+func (o *ORM) DeletePermission(id uint) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		p := &models.Permission{}
+		if err := tx.First(p, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if consts.IsSystemPermission(p.Tag) {
+			return ErrSystemPermission
+		}
+		// the join tables of the roles, users, API keys and OAuth clients
+		for _, table := range []string{"role_permissions", "user_permissions",
+			"user_api_key_permissions", "oauth_client_scopes"} {
+			if err := tx.Exec("DELETE FROM "+table+" WHERE permission_id = ?", id).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(p).Error
+	})
+}
+
+// permissionTagTaken fails when another permission has the tag
+func permissionTagTaken(tx *gorm.DB, tag string, id uint) error {
+	var taken int64
+	if err := tx.Model(&models.Permission{}).Where("tag = ? AND id <> ?", tag, id).
+		Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrPermissionExists
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package orm_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+)
+
+func TestORM_CreatePermission(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		mock    func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "new permission",
+			tag:  "export:reports",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "permissions" WHERE tag = $1 AND id <> $2`)).
+					WithArgs("export:reports", 0).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "permissions"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(90))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "taken tag",
+			tag:  "read:users",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "permissions" WHERE tag = $1 AND id <> $2`)).
+					WithArgs("read:users", 0).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectRollback()
+			},
+			wantErr: orm.ErrPermissionExists,
+		},
+		{
+			name:    "not an action:entity tag",
+			tag:     "Export Reports",
+			mock:    func(mock sqlmock.Sqlmock) {},
+			wantErr: orm.ErrInvalidPermissionTag,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			tt.mock(mock)
+			if err := o.CreatePermission(&models.Permission{Tag: tt.tag}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.CreatePermission() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestORM_DeletePermission(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		wantErr error
+	}{
+		{name: "custom permission", tag: "export:reports"},
+		{name: "system permission", tag: "read:users", wantErr: orm.ErrSystemPermission},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "permissions" WHERE id = $1`)).
+				WithArgs(90).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "tag"}).AddRow(90, tt.tag))
+			if tt.wantErr == nil {
+				for _, table := range []string{"role_permissions", "user_permissions",
+					"user_api_key_permissions", "oauth_client_scopes"} {
+					mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM ` + table + ` WHERE permission_id = $1`)).
+						WithArgs(90).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "permissions" WHERE "permissions"."id" = $1`)).
+					WithArgs(90).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+			if err := o.DeletePermission(90); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.DeletePermission() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package orm
+
+import (
+	"errors"
+
+	"github.com/gofrs/uuid"
+	"github.com/markbates/goth"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FindUserProfiles lists the OAuth profiles linked to the user
+func (o *ORM) FindUserProfiles(userID uuid.UUID) ([]models.UserProfile, error) {
+	if userID == uuid.Nil {
+		return nil, errors.New("user id is empty")
+	}
+	ups := []models.UserProfile{}
+	if err := o.DB.Where("user_id = ?", userID).Order("id").Find(&ups).Error; err != nil {
+		return nil, err
+	}
+	return ups, nil
+}
+
+// LinkUserProfile explicitly attaches the OAuth profile to an authenticated
+// user, a profile already linked to another user is never moved
+func (o *ORM) LinkUserProfile(userID uuid.UUID, gu *goth.User) (*models.UserProfile, error) {
+	if userID == uuid.Nil {
+		return nil, errors.New("user id is empty")
+	}
+	up, err := models.GothUserToDBUserProfile(gu, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = o.DB.Transaction(func(tx *gorm.DB) error {
+		p := &models.UserProfile{}
+		err := tx.First(p, "provider = ? AND external_user_id = ?", gu.Provider, gu.UserID).Error
+		if err == nil {
+			if p.UserID != userID {
+				return ErrProfileLinkedToOtherUser
+			}
+			up.BaseModelSeq, up.UserID = p.BaseModelSeq, p.UserID
+			return tx.Model(p).Omit(clause.Associations).Updates(up).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		up.UserID = userID
+		return tx.Omit(clause.Associations).Create(up).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return up, nil
+}
+
+// UnlinkUserProfile removes the OAuth profile from the user, as long as it's
+// not the last way the user has to log in
+func (o *ORM) UnlinkUserProfile(userID uuid.UUID, profileID uint) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		p := &models.UserProfile{}
+		if err := tx.First(p, "id = ? AND user_id = ?", profileID, userID).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.UserProfile{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count <= 1 {
+			return ErrLastLoginMethod
+		}
+		return tx.Delete(p).Error
+	})
+}
@@ -0,0 +1,132 @@
+package orm_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/markbates/goth"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"gorm.io/gorm"
+)
+
+func TestORM_FindUserProfiles(t *testing.T) {
+	gormDB, mock := mockOrm(t)
+	o := &orm.ORM{DB: gormDB}
+	uid := uuid.Must(uuid.NewV4())
+
+	t.Run("missing user id", func(t *testing.T) {
+		if _, err := o.FindUserProfiles(uuid.Nil); err == nil {
+			t.Errorf("ORM.FindUserProfiles() error = %v, wantErr %v", err, true)
+		}
+	})
+	t.Run("lists the profiles", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT`)).WithArgs(uid).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "provider"}).
+				AddRow(1, "google").AddRow(2, "facebook"))
+		got, err := o.FindUserProfiles(uid)
+		if err != nil {
+			t.Errorf("ORM.FindUserProfiles() error = %v, wantErr %v", err, false)
+			return
+		}
+		if len(got) != 2 || got[1].Provider != "facebook" {
+			t.Errorf("ORM.FindUserProfiles() = %v, want 2 profiles", got)
+		}
+	})
+}
+
+func TestORM_UnlinkUserProfile(t *testing.T) {
+	uid := uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name    string
+		count   int
+		found   bool
+		wantErr error
+	}{
+		{
+			name:    "profile not found",
+			found:   false,
+			wantErr: gorm.ErrRecordNotFound,
+		},
+		{
+			name:    "last login method",
+			found:   true,
+			count:   1,
+			wantErr: orm.ErrLastLoginMethod,
+		},
+		{
+			name:    "unlinks the profile",
+			found:   true,
+			count:   2,
+			wantErr: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+
+			mock.ExpectBegin()
+			query := mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_profiles"`)).WithArgs(1, uid)
+			if !tt.found {
+				query.WillReturnError(gorm.ErrRecordNotFound)
+				mock.ExpectRollback()
+			} else {
+				query.WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(1, uid))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*)`)).WithArgs(uid).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.count))
+				if tt.wantErr != nil {
+					mock.ExpectRollback()
+				} else {
+					mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "user_profiles"`)).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectCommit()
+				}
+			}
+
+			err := o.UnlinkUserProfile(uid, 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.UnlinkUserProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("ORM.UnlinkUserProfile() expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestORM_LinkUserProfile_login(t *testing.T) {
+	o := sqliteOrm(t)
+	u, err := o.UpsertUserProfile(&goth.User{Provider: "google", UserID: "g-1", Email: "ada@example.com"}, false)
+	if err != nil {
+		t.Fatalf("UpsertUserProfile() error = %v", err)
+	}
+	// the provider of the linked profile knows the user by another email
+	if _, err := o.LinkUserProfile(u.ID, &goth.User{Provider: "github", UserID: "gh-1",
+		Email: "ada@users.noreply.github.com"}); err != nil {
+		t.Fatalf("LinkUserProfile() error = %v", err)
+	}
+
+	sc := &cfg.Server{JWT: cfg.JWT{Algorithm: "HS512", Secret: "{JWTsecret}",
+		AccessTokenTTL: time.Hour, RefreshTokenTTL: time.Hour}}
+	pair, err := auth.IssueTokenPair(sc, u, "github", "gh-1", uuid.Must(uuid.NewV4()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := auth.ParseClaims(sc, pair.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := o.FindUserByJWT(claims.Issuer, claims.ID)
+	if err != nil {
+		t.Fatalf("FindUserByJWT() of the linked profile error = %v", err)
+	}
+	if got.ID != u.ID {
+		t.Errorf("FindUserByJWT() = %s, want %s", got.ID, u.ID)
+	}
+}
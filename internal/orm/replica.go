@@ -0,0 +1,162 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// replicaPingTimeout bounds the health check of a replica
+const replicaPingTimeout = 2 * time.Second
+
+// readPrimaryCtxKey marks a context whose reads go to the primary
+type readPrimaryCtxKey struct{}
+
+// ReplicaPlugin routes the reads to the healthy read replicas, in turns, and
+// leaves on the primary the writes, the transactions, the locking reads, raw
+// SQL and the reads of a context made by ReadPrimary. The replicas are
+// checked every CheckInterval, the reads fall back to the primary while none
+// of them is up
+type ReplicaPlugin struct {
+	Replicas      []*sql.DB
+	CheckInterval time.Duration
+
+	// down holds 1 for the replicas failing their health check
+	down []int32
+	next uint32
+	once sync.Once
+}
+
+// Name of the plugin for gorm
+func (*ReplicaPlugin) Name() string {
+	return "replica"
+}
+
+// Initialize checks the replicas, registers the callbacks of the plugin and
+// keeps checking the replicas in the background
+func (p *ReplicaPlugin) Initialize(db *gorm.DB) error {
+	p.down = make([]int32, len(p.Replicas))
+	p.Check(context.Background())
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("replica:query", p.route); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("replica:row", p.route); err != nil {
+		return err
+	}
+	if p.CheckInterval > 0 {
+		p.once.Do(func() { go p.watch() })
+	}
+	return nil
+}
+
+// openReplicas opens the read replicas of the config with the driver of its
+// dialect and its connection limits. The ones that can't be opened are left
+// out, the reads fall back to the primary
+func openReplicas(c *cfg.DB) []*sql.DB {
+	pools := make([]*sql.DB, 0, len(c.ReplicaDSNs))
+	for i, dsn := range c.ReplicaDSNs {
+		d, err := dialector(&cfg.DB{Dialect: c.Dialect, DSN: dsn})
+		if err != nil {
+			logger.Error(&err, "[ORM] replica %d err: %s", i, err.Error())
+			continue
+		}
+		// they are pinged by the health checks, not here
+		db, err := gorm.Open(d, &gorm.Config{DisableAutomaticPing: true})
+		if err == nil {
+			var pool *sql.DB
+			if pool, err = db.DB(); err == nil {
+				limitPool(pool, c)
+				pools = append(pools, pool)
+				continue
+			}
+		}
+		logger.Error(&err, "[ORM] replica %d err: %s", i, err.Error())
+	}
+	return pools
+}
+
+// ReadPrimary returns a context whose reads go to the primary, for the reads
+// that must see the writes just made
+func ReadPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readPrimaryCtxKey{}, true)
+}
+
+// Primary returns the orm reading from the primary, see ReadPrimary
+func (o *ORM) Primary() *ORM {
+	return o.WithContext(ReadPrimary(o.DB.Statement.Context))
+}
+
+// Check pings the replicas and marks the ones not answering as down
+func (p *ReplicaPlugin) Check(ctx context.Context) {
+	for i, r := range p.Replicas {
+		pctx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+		err := r.PingContext(pctx)
+		cancel()
+		down := int32(0)
+		if err != nil {
+			down = 1
+		}
+		if old := atomic.SwapInt32(&p.down[i], down); old == down {
+			continue
+		}
+		if err != nil {
+			logger.Error(&err, "[ORM] replica %d is down: %s", i, err.Error())
+		} else {
+			logger.Info("[ORM] replica %d is up", i)
+		}
+	}
+}
+
+// watch checks the replicas every interval
+func (p *ReplicaPlugin) watch() {
+	t := time.NewTicker(p.CheckInterval)
+	defer t.Stop()
+	for range t.C {
+		p.Check(context.Background())
+	}
+}
+
+// replica returns the next healthy replica, if any
+func (p *ReplicaPlugin) replica() (*sql.DB, bool) {
+	n := uint32(len(p.Replicas))
+	for i := uint32(0); i < n; i++ {
+		j := atomic.AddUint32(&p.next, 1) % n
+		if atomic.LoadInt32(&p.down[j]) == 0 {
+			return p.Replicas[j], true
+		}
+	}
+	return nil, false
+}
+
+// route sends the read to a replica when it can go to one
+func (p *ReplicaPlugin) route(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.SQL.Len() > 0 {
+		return
+	}
+	if _, ok := stmt.ConnPool.(gorm.TxCommitter); ok {
+		return
+	}
+	// the preloads stay on the replica of their query
+	for _, r := range p.Replicas {
+		if stmt.ConnPool == gorm.ConnPool(r) {
+			return
+		}
+	}
+	if _, ok := stmt.Clauses["FOR"]; ok {
+		return
+	}
+	if primary, _ := stmt.Context.Value(readPrimaryCtxKey{}).(bool); primary {
+		return
+	}
+	if r, ok := p.replica(); ok {
+		stmt.ConnPool = r
+	}
+}
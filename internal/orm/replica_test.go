@@ -0,0 +1,145 @@
+package orm_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// mockReplicaOrm is the orm on a mocked primary with a mocked replica whose
+// pings are expected
+func mockReplicaOrm(t *testing.T, up bool) (*orm.ORM, *orm.ReplicaPlugin, sqlmock.Sqlmock, sqlmock.Sqlmock) {
+	gormDB, primary := mockOrm(t)
+	replicaDB, replica, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ping := replica.ExpectPing()
+	if !up {
+		ping.WillReturnError(errors.New("connection refused"))
+	}
+	p := &orm.ReplicaPlugin{Replicas: []*sql.DB{replicaDB}}
+	if err := gormDB.Use(p); err != nil {
+		t.Fatalf("gorm.DB.Use() error = %v", err)
+	}
+	return &orm.ORM{DB: gormDB}, p, primary, replica
+}
+
+func TestReplicaPlugin(t *testing.T) {
+	query := regexp.QuoteMeta(`SELECT * FROM "memos"`)
+	rows := func() *sqlmock.Rows { return sqlmock.NewRows([]string{"id", "title"}) }
+	tests := []struct {
+		name string
+		up   bool
+		read func(o *orm.ORM) error
+		// onReplica when the read is expected on the replica
+		onReplica bool
+	}{
+		{
+			name:      "reads go to the replica",
+			up:        true,
+			read:      func(o *orm.ORM) error { return o.DB.Find(&[]memo{}).Error },
+			onReplica: true,
+		},
+		{
+			name: "read your writes on the primary",
+			up:   true,
+			read: func(o *orm.ORM) error { return o.Primary().DB.Find(&[]memo{}).Error },
+		},
+		{
+			name: "locking reads on the primary",
+			up:   true,
+			read: func(o *orm.ORM) error {
+				return o.DB.Clauses(clause.Locking{Strength: "UPDATE"}).Find(&[]memo{}).Error
+			},
+		},
+		{
+			name: "fallback to the primary when the replica is down",
+			up:   false,
+			read: func(o *orm.ORM) error { return o.DB.Find(&[]memo{}).Error },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, _, primary, replica := mockReplicaOrm(t, tt.up)
+			if tt.onReplica {
+				replica.ExpectQuery(query).WillReturnRows(rows())
+			} else {
+				primary.ExpectQuery(query).WillReturnRows(rows())
+			}
+			if err := tt.read(o); err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			if err := primary.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations on the primary: %s", err)
+			}
+			if err := replica.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations on the replica: %s", err)
+			}
+		})
+	}
+
+	t.Run("transactions on the primary", func(t *testing.T) {
+		o, _, primary, replica := mockReplicaOrm(t, true)
+		primary.ExpectBegin()
+		primary.ExpectQuery(query).WillReturnRows(rows())
+		primary.ExpectCommit()
+		err := o.DB.Transaction(func(tx *gorm.DB) error {
+			return tx.Find(&[]memo{}).Error
+		})
+		if err != nil {
+			t.Fatalf("Transaction() error = %v", err)
+		}
+		if err := primary.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations on the primary: %s", err)
+		}
+		if err := replica.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations on the replica: %s", err)
+		}
+	})
+
+	t.Run("authentication lookups on the primary", func(t *testing.T) {
+		o, _, primary, replica := mockReplicaOrm(t, true)
+		lookups := map[string]func() error{
+			"user_api_keys": func() error { _, err := o.FindAPIKey("key"); return err },
+			"oauth_grants": func() error {
+				_, err := o.FindOAuthGrantByID(uuid.Must(uuid.NewV4()))
+				return err
+			},
+			"scim_clients": func() error { _, err := o.AuthenticateSCIMClient("token"); return err },
+		}
+		for table, lookup := range lookups {
+			primary.ExpectQuery(regexp.QuoteMeta(`FROM "` + table + `"`)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			if err := lookup(); err == nil {
+				t.Errorf("lookup of %s found a row", table)
+			}
+		}
+		if err := primary.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations on the primary: %s", err)
+		}
+		if err := replica.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations on the replica: %s", err)
+		}
+	})
+
+	t.Run("the replica is back once its check passes", func(t *testing.T) {
+		o, p, _, replica := mockReplicaOrm(t, false)
+		replica.ExpectPing()
+		p.Check(context.Background())
+		replica.ExpectQuery(query).WillReturnRows(rows())
+		if err := o.DB.Find(&[]memo{}).Error; err != nil {
+			t.Fatalf("Find() error = %v", err)
+		}
+		if err := replica.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations on the replica: %s", err)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/listing"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// softDeleteField is the field of the models deleted by setting it
+const softDeleteField = "DeletedAt"
+
+// ErrUnknownField when a field isn't one of the model
+var ErrUnknownField = errors.New("unknown field")
+
+// resourceSchema parses the schema of the model
+func resourceSchema[T any](db *gorm.DB) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// softDeleted returns the column of the models with a *time.Time DeletedAt,
+// the ones with a gorm.DeletedAt are soft deleted by gorm itself
+func softDeleted(s *schema.Schema) (string, bool) {
+	f := s.LookUpField(softDeleteField)
+	if f == nil || f.FieldType == reflect.TypeOf(gorm.DeletedAt{}) {
+		return "", false
+	}
+	return f.DBName, true
+}
+
+// notDeleted leaves the soft deleted rows out
+func notDeleted(db *gorm.DB, s *schema.Schema) *gorm.DB {
+	if column, ok := softDeleted(s); ok {
+		return db.Where(clause.Expr{SQL: "? IS NULL", Vars: []any{clause.Column{Table: clause.CurrentTable, Name: column}}})
+	}
+	return db
+}
+
+// ResourceColumns maps the json names of the fields of the model to their
+// columns, the json name is the one of the tag or else the field name
+func ResourceColumns[T any](db *gorm.DB, fields []string) ([]string, error) {
+	s, err := resourceSchema[T](db)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, 0, len(fields))
+	for _, name := range fields {
+		found := false
+		for _, f := range s.Fields {
+			if f.DBName != "" && jsonName(f) == name {
+				columns = append(columns, f.DBName)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, name)
+		}
+	}
+	return columns, nil
+}
+
+// jsonName is the name of the field when the model is encoded
+func jsonName(f *schema.Field) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// ListResources lists the page of the rows of the model the list query asks
+// for, the soft deleted ones left out
+func ListResources[T any](db *gorm.DB, q *listing.Query) (*Page[T], error) {
+	s, err := resourceSchema[T](db)
+	if err != nil {
+		return nil, err
+	}
+	return ListPage[T](notDeleted(db, s), q)
+}
+
+// ResourceHasColumns verifies the columns are columns of the model
+func ResourceHasColumns[T any](db *gorm.DB, columns []string) error {
+	s, err := resourceSchema[T](db)
+	if err != nil {
+		return err
+	}
+	for _, c := range columns {
+		if _, ok := s.FieldsByDBName[c]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownField, c)
+		}
+	}
+	return nil
+}
+
+// FindResource finds the row of the model by its primary key, ids that
+// can't be one aren't found
+func FindResource[T any](db *gorm.DB, id string) (*T, error) {
+	s, err := resourceSchema[T](db)
+	if err != nil {
+		return nil, err
+	}
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return nil, fmt.Errorf("%s has no primary key", s.Name)
+	}
+	var key any = id
+	switch {
+	case pk.FieldType == reflect.TypeOf(uuid.UUID{}):
+		if key, err = uuid.FromString(id); err != nil {
+			return nil, gorm.ErrRecordNotFound
+		}
+	case pk.DataType == schema.Uint || pk.DataType == schema.Int:
+		if key, err = strconv.ParseUint(id, 10, 64); err != nil {
+			return nil, gorm.ErrRecordNotFound
+		}
+	}
+	m := new(T)
+	if err := notDeleted(db, s).Where(clause.Eq{
+		Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}, Value: key,
+	}).First(m).Error; err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CreateResource creates the row of the model, without its associations
+func CreateResource[T any](db *gorm.DB, m *T) error {
+	return db.Omit(clause.Associations).Create(m).Error
+}
+
+// UpdateResource saves the columns of the row of the model, without its
+// associations. The versioned ones must be at the version expected if any
+func UpdateResource[T any](db *gorm.DB, m *T, columns []string) error {
+	if v, ok := any(m).(models.Versioned); ok {
+		if err := checkVersion(db, v); err != nil {
+			return err
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	return db.Model(m).Select(columns).Omit(clause.Associations).Updates(m).Error
+}
+
+// DeleteResource deletes the row of the model, the ones with a DeletedAt
+// time are soft deleted
+func DeleteResource[T any](db *gorm.DB, m *T) error {
+	s, err := resourceSchema[T](db)
+	if err != nil {
+		return err
+	}
+	if column, ok := softDeleted(s); ok {
+		return db.Model(m).UpdateColumn(column, time.Now().UTC()).Error
+	}
+	return db.Omit(clause.Associations).Delete(m).Error
+}
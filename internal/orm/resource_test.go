@@ -0,0 +1,134 @@
+package orm_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/gorm"
+)
+
+// memo is a soft deleted model of a resource
+type memo struct {
+	models.BaseModelSoftDelete
+	Title string `json:"title"`
+	Body  string
+}
+
+func TestResourceColumns(t *testing.T) {
+	gormDB, _ := mockOrm(t)
+	tests := []struct {
+		name    string
+		fields  []string
+		want    []string
+		wantErr error
+	}{
+		{name: "json names", fields: []string{"title", "Body"}, want: []string{"title", "body"}},
+		{name: "go name of a tagged field", fields: []string{"Title"}, wantErr: orm.ErrUnknownField},
+		{name: "unknown field", fields: []string{"owner"}, wantErr: orm.ErrUnknownField},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orm.ResourceColumns[memo](gormDB, tt.fields)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ResourceColumns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ResourceColumns() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ResourceColumns() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFindResource(t *testing.T) {
+	id := uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name    string
+		id      string
+		mock    func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "not deleted",
+			id:   id.String(),
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "memos" WHERE "memos"."deleted_at" IS NULL AND "memos"."id" = $1`)).
+					WithArgs(id).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(id, "reminder"))
+			},
+		},
+		{
+			name:    "not an id",
+			id:      "42",
+			mock:    func(mock sqlmock.Sqlmock) {},
+			wantErr: gorm.ErrRecordNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			tt.mock(mock)
+			if _, err := orm.FindResource[memo](gormDB, tt.id); !errors.Is(err, tt.wantErr) {
+				t.Errorf("FindResource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestDeleteResource(t *testing.T) {
+	tests := []struct {
+		name string
+		del  func(db *gorm.DB) error
+		mock func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "soft deleted",
+			del: func(db *gorm.DB) error {
+				n := &memo{}
+				n.ID = uuid.Must(uuid.NewV4())
+				return orm.DeleteResource(db, n)
+			},
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "memos" SET "deleted_at"=$1 WHERE "id" = $2`)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "deleted",
+			del: func(db *gorm.DB) error {
+				return orm.DeleteResource(db, &models.Permission{BaseModelSeq: models.BaseModelSeq{ID: 7}})
+			},
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "permissions" WHERE "permissions"."id" = $1`)).
+					WithArgs(7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			mock.ExpectBegin()
+			tt.mock(mock)
+			mock.ExpectCommit()
+			if err := tt.del(gormDB); err != nil {
+				t.Errorf("DeleteResource() error = %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
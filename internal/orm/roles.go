@@ -0,0 +1,347 @@
+package orm
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// orgRolePrefix prefixes the names of the roles within organizations
+const orgRolePrefix = "org:"
+
+// parentRoles is the association of the roles a role inherits from
+const parentRoles = "ParentRoles"
+
+// ErrRoleCycle when a role would end up inheriting from itself
+var ErrRoleCycle = errors.New("a role can't inherit from itself")
+
+// SyncUserRoles grants the user the [granted] roles and revokes the rest of
+// the [managed] ones, like the roles a directory maps its groups to. Roles
+// outside of the managed ones are left alone, missing roles are created
+func (o *ORM) SyncUserRoles(userID uuid.UUID, managed, granted []string) error {
+	if len(managed) == 0 {
+		return nil
+	}
+	grant := map[string]bool{}
+	for _, name := range granted {
+		grant[name] = true
+	}
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		ids := make([]int, 0, len(managed))
+		links := []models.UserRole{}
+		for _, name := range managed {
+			if consts.IsOrgRole(name) {
+				return ErrSystemRole
+			}
+			r := &models.Role{}
+			if err := tx.Omit(clause.Associations).Where(models.Role{Name: name}).
+				FirstOrCreate(r).Error; err != nil {
+				return err
+			}
+			ids = append(ids, int(r.ID))
+			if grant[name] {
+				links = append(links, models.UserRole{UserID: userID, RoleID: int(r.ID)})
+			}
+		}
+		if err := tx.Where("user_id = ? AND role_id IN ?", userID, ids).
+			Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		if len(links) == 0 {
+			return nil
+		}
+		return tx.Create(&links).Error
+	})
+}
+
+// RoleChanges are the changes to the role, the nil ones are left as they are
+type RoleChanges struct {
+	Name        *string
+	Description *string
+}
+
+// ListRoles lists the roles along with their parents and permissions
+func (o *ORM) ListRoles() ([]models.Role, error) {
+	roles := []models.Role{}
+	if err := o.DB.Preload(parentRoles).Preload(consts.EntityNames.Permissions).
+		Order("id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// FindRole finds the role along with its parents and permissions
+func (o *ORM) FindRole(id uint) (*models.Role, error) {
+	r := &models.Role{}
+	if err := o.DB.Preload(parentRoles).Preload(consts.EntityNames.Permissions).
+		First(r, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CreateRole creates the role, the roles within organizations are only the
+// system ones
+func (o *ORM) CreateRole(r *models.Role) error {
+	if consts.IsOrgRole(r.Name) || strings.HasPrefix(r.Name, orgRolePrefix) {
+		return ErrSystemRole
+	}
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := roleNameTaken(tx, r.Name, 0); err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Create(r).Error
+	})
+}
+
+// UpdateRole renames the role or changes its description, the system roles
+// can't be renamed
+func (o *ORM) UpdateRole(id uint, ch *RoleChanges) (*models.Role, error) {
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		r := &models.Role{}
+		if err := tx.First(r, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := checkVersion(tx, r); err != nil {
+			return err
+		}
+		changes := map[string]any{}
+		if ch.Name != nil && *ch.Name != r.Name {
+			if consts.IsSystemRole(r.Name) || strings.HasPrefix(*ch.Name, orgRolePrefix) {
+				return ErrSystemRole
+			}
+			if err := roleNameTaken(tx, *ch.Name, id); err != nil {
+				return err
+			}
+			changes["name"] = *ch.Name
+		}
+		if ch.Description != nil {
+			changes["description"] = *ch.Description
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		return tx.Model(r).Omit(clause.Associations).Updates(changes).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	// read back from the primary, a replica may not have the update yet
+	return o.Primary().FindRole(id)
+}
+
+// DeleteRole removes the role from the users, roles and permissions it's
+// related to and deletes it, the system roles can't be deleted
+func (o *ORM) DeleteRole(id uint) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		r := &models.Role{}
+		if err := tx.First(r, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if consts.IsSystemRole(r.Name) {
+			return ErrSystemRole
+		}
+		if err := checkVersion(tx, r); err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", id).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", id).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ? OR parent_role_id = ?", id, id).
+			Delete(&models.RoleParent{}).Error; err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Delete(r).Error
+	})
+}
+
+// AddRoleParent makes the role inherit from the parent, a role can't end up
+// inheriting from itself
+func (o *ORM) AddRoleParent(id uint, parentID uint) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := exists(tx, &models.Role{}, id, parentID); err != nil {
+			return err
+		}
+		// the role can't be one of the ancestors of its parent
+		seen := map[uint]bool{}
+		next := []uint{parentID}
+		for len(next) > 0 {
+			for _, n := range next {
+				if n == id {
+					return ErrRoleCycle
+				}
+				seen[n] = true
+			}
+			var parents []int
+			if err := tx.Model(&models.RoleParent{}).Where("role_id IN ?", next).
+				Pluck("parent_role_id", &parents).Error; err != nil {
+				return err
+			}
+			next = next[:0]
+			for _, p := range parents {
+				if !seen[uint(p)] {
+					next = append(next, uint(p))
+				}
+			}
+		}
+		if err := link(tx, &models.RoleParent{RoleID: int(id), ParentRoleID: int(parentID)}); err != nil {
+			return err
+		}
+		return touch(tx, &models.Role{}, id)
+	})
+}
+
+// RemoveRoleParent stops the role from inheriting from the parent
+func (o *ORM) RemoveRoleParent(id uint, parentID uint) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := unlink(tx, &models.RoleParent{RoleID: int(id), ParentRoleID: int(parentID)}); err != nil {
+			return err
+		}
+		return touch(tx, &models.Role{}, id)
+	})
+}
+
+// AddRolePermission gives the permission to the role
+func (o *ORM) AddRolePermission(id uint, permissionID uint) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := exists(tx, &models.Role{}, id); err != nil {
+			return err
+		}
+		if err := exists(tx, &models.Permission{}, permissionID); err != nil {
+			return err
+		}
+		if err := link(tx, &models.RolePermission{RoleID: int(id), PermissionID: int(permissionID)}); err != nil {
+			return err
+		}
+		return touch(tx, &models.Role{}, id)
+	})
+}
+
+// RemoveRolePermission takes the permission from the role
+func (o *ORM) RemoveRolePermission(id uint, permissionID uint) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := unlink(tx, &models.RolePermission{RoleID: int(id), PermissionID: int(permissionID)}); err != nil {
+			return err
+		}
+		return touch(tx, &models.Role{}, id)
+	})
+}
+
+// AddUserRole gives the role to the user, the roles within organizations
+// are given through the memberships
+func (o *ORM) AddUserRole(userID uuid.UUID, roleID uint) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := exists(tx, &models.User{}, userID); err != nil {
+			return err
+		}
+		r := &models.Role{}
+		if err := tx.First(r, "id = ?", roleID).Error; err != nil {
+			return err
+		}
+		if consts.IsOrgRole(r.Name) {
+			return ErrSystemRole
+		}
+		if err := link(tx, &models.UserRole{UserID: userID, RoleID: int(roleID)}); err != nil {
+			return err
+		}
+		return touch(tx, &models.User{}, userID)
+	})
+}
+
+// RemoveUserRole takes the role from the user
+func (o *ORM) RemoveUserRole(userID uuid.UUID, roleID uint) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := unlink(tx, &models.UserRole{UserID: userID, RoleID: int(roleID)}); err != nil {
+			return err
+		}
+		return touch(tx, &models.User{}, userID)
+	})
+}
+
+// AddUserPermission gives the permission to the user directly
+func (o *ORM) AddUserPermission(userID uuid.UUID, permissionID uint) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := exists(tx, &models.User{}, userID); err != nil {
+			return err
+		}
+		if err := exists(tx, &models.Permission{}, permissionID); err != nil {
+			return err
+		}
+		if err := link(tx, &models.UserPermission{UserID: userID, PermissionID: int(permissionID)}); err != nil {
+			return err
+		}
+		return touch(tx, &models.User{}, userID)
+	})
+}
+
+// RemoveUserPermission takes the direct permission from the user
+func (o *ORM) RemoveUserPermission(userID uuid.UUID, permissionID uint) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := unlink(tx, &models.UserPermission{UserID: userID, PermissionID: int(permissionID)}); err != nil {
+			return err
+		}
+		return touch(tx, &models.User{}, userID)
+	})
+}
+
+// roleNameTaken fails when another role has the name
+func roleNameTaken(tx *gorm.DB, name string, id uint) error {
+	var taken int64
+	if err := tx.Model(&models.Role{}).Where("name = ? AND id <> ?", name, id).
+		Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrRoleExists
+	}
+	return nil
+}
+
+// exists fails with gorm.ErrRecordNotFound unless there are rows of the
+// model with each of the ids
+func exists[ID comparable](tx *gorm.DB, model any, ids ...ID) error {
+	unique := map[ID]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+	var found int64
+	if err := tx.Model(model).Where("id IN ?", ids).Count(&found).Error; err != nil {
+		return err
+	}
+	if int(found) != len(unique) {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// link adds the relation to its join table unless it's already there
+func link(tx *gorm.DB, row any) error {
+	return tx.Where(row).FirstOrCreate(row).Error
+}
+
+// touch bumps the updated time, and so the version, of the row whose
+// relations changed
+func touch[ID comparable](tx *gorm.DB, model any, id ID) error {
+	return tx.Model(model).Where("id = ?", id).UpdateColumn("updated_at", time.Now().UTC()).Error
+}
+
+// unlink removes the relation from its join table
+func unlink(db *gorm.DB, row any) error {
+	del := db.Where(row).Delete(row)
+	if del.Error != nil {
+		return del.Error
+	}
+	if del.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
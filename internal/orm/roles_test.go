@@ -0,0 +1,234 @@
+package orm_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/gorm"
+)
+
+func TestORM_SyncUserRoles(t *testing.T) {
+	userID := uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name    string
+		managed []string
+		granted []string
+		mock    func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "nothing managed",
+			mock: func(mock sqlmock.Sqlmock) {},
+		},
+		{
+			name:    "grants and revokes the managed roles",
+			managed: []string{"admin", "developer"},
+			granted: []string{"developer"},
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(`FROM "roles" WHERE "roles"."name" = $1`)).
+					WithArgs("admin").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "admin"))
+				mock.ExpectQuery(regexp.QuoteMeta(`FROM "roles" WHERE "roles"."name" = $1`)).
+					WithArgs("developer").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "developer"))
+				mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "user_roles" WHERE user_id = $1 AND role_id IN ($2,$3)`)).
+					WithArgs(userID, 1, 2).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "user_roles" ("user_id","role_id") VALUES ($1,$2)`)).
+					WithArgs(userID, 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:    "organization roles",
+			managed: []string{"org:owner"},
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+			},
+			wantErr: orm.ErrSystemRole,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			tt.mock(mock)
+			if err := o.SyncUserRoles(userID, tt.managed, tt.granted); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.SyncUserRoles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestORM_CreateRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    string
+		mock    func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "new role",
+			role: "billing",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "roles" WHERE name = $1 AND id <> $2`)).
+					WithArgs("billing", 0).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "roles"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "taken name",
+			role: "billing",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "roles" WHERE name = $1 AND id <> $2`)).
+					WithArgs("billing", 0).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectRollback()
+			},
+			wantErr: orm.ErrRoleExists,
+		},
+		{
+			name:    "organization role",
+			role:    "org:billing",
+			mock:    func(mock sqlmock.Sqlmock) {},
+			wantErr: orm.ErrSystemRole,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			tt.mock(mock)
+			if err := o.CreateRole(&models.Role{Name: tt.role}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.CreateRole() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestORM_DeleteRole_system(t *testing.T) {
+	gormDB, mock := mockOrm(t)
+	o := &orm.ORM{DB: gormDB}
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "admin"))
+	mock.ExpectRollback()
+	if err := o.DeleteRole(1); !errors.Is(err, orm.ErrSystemRole) {
+		t.Errorf("ORM.DeleteRole() error = %v, wantErr %v", err, orm.ErrSystemRole)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestORM_AddRoleParent(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       uint
+		parentID uint
+		// ancestors are the parents of the parent, then theirs
+		ancestors [][]int
+		wantErr   error
+	}{
+		{name: "new parent", id: 1, parentID: 2, ancestors: [][]int{{3}, {}}},
+		{name: "itself", id: 1, parentID: 1, wantErr: orm.ErrRoleCycle},
+		{name: "one of its children", id: 1, parentID: 2, ancestors: [][]int{{3}, {1}}, wantErr: orm.ErrRoleCycle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			mock.ExpectBegin()
+			found := 2
+			if tt.id == tt.parentID {
+				found = 1
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "roles" WHERE id IN`)).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(found))
+			for _, parents := range tt.ancestors {
+				rows := sqlmock.NewRows([]string{"parent_role_id"})
+				for _, p := range parents {
+					rows.AddRow(p)
+				}
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT "parent_role_id" FROM "role_parents" WHERE role_id IN`)).
+					WillReturnRows(rows)
+			}
+			if tt.wantErr == nil {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "role_parents" WHERE "role_parents"."role_id" = $1 AND "role_parents"."parent_role_id" = $2`)).
+					WithArgs(tt.id, tt.parentID).
+					WillReturnRows(sqlmock.NewRows([]string{"role_id", "parent_role_id"}))
+				mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "role_parents" ("role_id","parent_role_id") VALUES ($1,$2)`)).
+					WithArgs(tt.id, tt.parentID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "roles" SET "updated_at"=$1 WHERE id = $2`)).
+					WithArgs(sqlmock.AnyArg(), tt.id).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+			if err := o.AddRoleParent(tt.id, tt.parentID); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.AddRoleParent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestORM_RemoveUserRole(t *testing.T) {
+	userID := uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name    string
+		rows    int64
+		wantErr error
+	}{
+		{name: "granted role", rows: 1},
+		{name: "role the user doesn't have", rows: 0, wantErr: gorm.ErrRecordNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "user_roles" WHERE "user_roles"."user_id" = $1 AND "user_roles"."role_id" = $2`)).
+				WithArgs(userID, 2).
+				WillReturnResult(sqlmock.NewResult(0, tt.rows))
+			if tt.wantErr == nil {
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "updated_at"=$1 WHERE id = $2`)).
+					WithArgs(sqlmock.AnyArg(), userID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+			if err := o.RemoveUserRole(userID, 2); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.RemoveUserRole() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/scim"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidSCIMClient when the bearer token isn't the one of a SCIM client
+	ErrInvalidSCIMClient = errors.New("invalid scim client token")
+
+	// ErrSystemRole when a role the service relies on would be renamed or removed
+	ErrSystemRole = errors.New("system roles can't be renamed or deleted")
+
+	// ErrRoleExists when another role already has the name
+	ErrRoleExists = errors.New("a role with the name already exists")
+
+	// ErrUnknownMember when a group member isn't one of our users
+	ErrUnknownMember = errors.New("unknown group member")
+)
+
+// noMatch is the condition of a comparison nothing can match, like an id
+// that isn't one
+const noMatch = "1 = 0"
+
+// scimUserColumns are the columns of the user attributes SCIM filters on
+var scimUserColumns = map[string]scim.Column{
+	"username":          {Name: "email"},
+	"emails":            {Name: "email"},
+	"emails.value":      {Name: "email"},
+	"name.givenname":    {Name: "first_name"},
+	"name.familyname":   {Name: "last_name"},
+	"meta.created":      {Name: "created_at", CaseExact: true},
+	"meta.lastmodified": {Name: "updated_at", CaseExact: true},
+}
+
+// scimGroupColumns are the columns of the group attributes SCIM filters on
+var scimGroupColumns = map[string]scim.Column{
+	"displayname":       {Name: "name"},
+	"meta.created":      {Name: "created_at", CaseExact: true},
+	"meta.lastmodified": {Name: "updated_at", CaseExact: true},
+}
+
+// CreateSCIMClient registers the identity provider, its bearer token is only
+// ever returned here
+func (o *ORM) CreateSCIMClient(c *models.SCIMClient) (string, error) {
+	token, err := randomSecret()
+	if err != nil {
+		return "", err
+	}
+	c.TokenHash = hashToken(token)
+	if err := o.DB.Create(c).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// AuthenticateSCIMClient finds the client of the bearer token and records it
+// was used. The token is looked up on the primary, a deleted client is
+// refused at once
+func (o *ORM) AuthenticateSCIMClient(token string) (*models.SCIMClient, error) {
+	if token == "" {
+		return nil, ErrInvalidSCIMClient
+	}
+	c := &models.SCIMClient{}
+	if err := o.Primary().DB.First(c, "token_hash = ?", hashToken(token)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidSCIMClient
+		}
+		return nil, err
+	}
+	now := time.Now().UTC()
+	c.LastUsedAt = &now
+	if err := o.DB.Model(c).UpdateColumn("last_used_at", now).Error; err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ListSCIMClients lists the registered identity providers
+func (o *ORM) ListSCIMClients() ([]models.SCIMClient, error) {
+	var clients []models.SCIMClient
+	if err := o.DB.Order("created_at").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// DeleteSCIMClient removes the identity provider, its token stops working
+// while the users it provisioned are kept
+func (o *ORM) DeleteSCIMClient(id uuid.UUID) error {
+	del := o.DB.Delete(&models.SCIMClient{}, "id = ?", id)
+	if del.Error != nil {
+		return del.Error
+	}
+	if del.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// scimUserMapper maps the filters on the users, the external ids are the
+// ones of the profiles of the provider
+func scimUserMapper(provider string) scim.Mapper {
+	columns := scim.Columns(scimUserColumns)
+	return func(cmp *scim.Comparison) (string, []any, error) {
+		switch cmp.Attr {
+		case "id":
+			return uuidComparison("id", cmp)
+		case "active":
+			active, ok := cmp.Value.(bool)
+			if !ok || (cmp.Op != "eq" && cmp.Op != "ne") {
+				return "", nil, scimFilterError(cmp)
+			}
+			if active == (cmp.Op == "eq") {
+				return "deleted_at IS NULL", nil, nil
+			}
+			return "deleted_at IS NOT NULL", nil, nil
+		case "externalid":
+			if cmp.Op != "eq" {
+				return "", nil, scimFilterError(cmp)
+			}
+			return "id IN (SELECT user_id FROM user_profiles WHERE provider = ? AND external_user_id = ?)",
+				[]any{provider, cmp.Value}, nil
+		}
+		return columns(cmp)
+	}
+}
+
+// scimGroupMapper maps the filters on the groups
+func scimGroupMapper(cmp *scim.Comparison) (string, []any, error) {
+	switch cmp.Attr {
+	case "id":
+		s, _ := cmp.Value.(string)
+		if cmp.Op != "eq" {
+			return "", nil, scimFilterError(cmp)
+		}
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return noMatch, nil, nil
+		}
+		return "id = ?", []any{id}, nil
+	case "members", "members.value":
+		s, _ := cmp.Value.(string)
+		if cmp.Op != "eq" {
+			return "", nil, scimFilterError(cmp)
+		}
+		id, err := uuid.FromString(s)
+		if err != nil {
+			return noMatch, nil, nil
+		}
+		return "id IN (SELECT role_id FROM user_roles WHERE user_id = ?)", []any{id}, nil
+	}
+	return scim.Columns(scimGroupColumns)(cmp)
+}
+
+// uuidComparison compares the uuid column for (in)equality, values that
+// aren't uuids match nothing
+func uuidComparison(column string, cmp *scim.Comparison) (string, []any, error) {
+	s, _ := cmp.Value.(string)
+	if cmp.Op != "eq" && cmp.Op != "ne" {
+		return "", nil, scimFilterError(cmp)
+	}
+	id, err := uuid.FromString(s)
+	if err != nil && cmp.Op == "eq" {
+		return noMatch, nil, nil
+	}
+	if err != nil {
+		return "1 = 1", nil, nil
+	}
+	if cmp.Op == "ne" {
+		return column + " <> ?", []any{id}, nil
+	}
+	return column + " = ?", []any{id}, nil
+}
+
+func scimFilterError(cmp *scim.Comparison) error {
+	return fmt.Errorf("%w: can't filter on %s with %s", scim.ErrInvalidFilter, cmp.Attr, cmp.Op)
+}
+
+// scimWhere applies the filter to the query, it can be run more than once
+func scimWhere(db *gorm.DB, f scim.Filter, m scim.Mapper) (*gorm.DB, error) {
+	if f != nil {
+		cond, args, err := scim.SQL(f, m)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(cond, args...)
+	}
+	// the query is counted and then listed
+	return db.Session(&gorm.Session{}), nil
+}
+
+// scimProvisioned scopes the users to the ones of the provider, the ones with
+// a profile of it. The others aren't seen by its SCIM client
+func scimProvisioned(provider string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("id IN (SELECT user_id FROM user_profiles WHERE provider = ?)", provider)
+	}
+}
+
+// ListSCIMUsers lists a page of the users of the provider matching the
+// filter, deactivated ones included, along with how many match
+func (o *ORM) ListSCIMUsers(provider string, f scim.Filter, offset, limit int) ([]models.User, int64, error) {
+	db, err := scimWhere(o.DB.Model(&models.User{}).Scopes(scimProvisioned(provider)), f, scimUserMapper(provider))
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []models.User
+	if err := db.Preload(consts.EntityNames.Roles).Preload(consts.EntityNames.UserProfiles, "provider = ?", provider).
+		Order("created_at").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// FindSCIMUser finds the user of the provider, deactivated or not, along
+// with its roles and the profile of the provider
+func (o *ORM) FindSCIMUser(provider string, id uuid.UUID) (*models.User, error) {
+	u := &models.User{}
+	if err := o.DB.Scopes(scimProvisioned(provider)).
+		Preload(consts.EntityNames.Roles).Preload(consts.EntityNames.UserProfiles, "provider = ?", provider).
+		First(u, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// SaveSCIMUser creates the user, or updates its email, names and whether it
+// is active, and keeps the external id of the provider on its profile. Only
+// the users of the provider are updated
+func (o *ORM) SaveSCIMUser(u *models.User, provider string, externalID string) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if u.ID != uuid.Nil {
+			if err := tx.Scopes(scimProvisioned(provider)).Select("id").First(&models.User{}, "id = ?", u.ID).Error; err != nil {
+				return err
+			}
+		}
+		var taken int64
+		if err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", strings.ToLower(u.Email), u.ID).
+			Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrEmailAlreadyRegistered
+		}
+		if u.ID == uuid.Nil {
+			if err := tx.Omit(clause.Associations).Create(u).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(u).Select("email", "first_name", "last_name", "deleted_at").
+			Omit(clause.Associations).Updates(u).Error; err != nil {
+			return err
+		}
+		return saveSCIMProfile(tx, u, provider, externalID)
+	})
+}
+
+// saveSCIMProfile links the user to the provider, by its external id when
+// the provider gave one
+func saveSCIMProfile(tx *gorm.DB, u *models.User, provider string, externalID string) error {
+	p := &models.UserProfile{}
+	err := tx.First(p, "user_id = ? AND provider = ?", u.ID, provider).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if externalID == "" {
+			externalID = u.ID.String()
+		}
+		p = &models.UserProfile{UserID: u.ID, Email: u.Email, Provider: provider, ExternalUserID: externalID}
+		if err := tx.Omit(clause.Associations).Create(p).Error; err != nil {
+			return err
+		}
+		u.UserProfiles = []models.UserProfile{*p}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	updates := map[string]any{"email": u.Email}
+	if externalID != "" {
+		updates["external_user_id"] = externalID
+	}
+	if err := tx.Model(p).Updates(updates).Error; err != nil {
+		return err
+	}
+	u.UserProfiles = []models.UserProfile{*p}
+	return nil
+}
+
+// ListSCIMGroups lists a page of the roles of the provider matching the
+// filter along with how many match
+func (o *ORM) ListSCIMGroups(provider string, f scim.Filter, offset, limit int) ([]models.Role, int64, error) {
+	db, err := scimWhere(o.DB.Model(&models.Role{}).Scopes(scimGroups(provider)), f, scimGroupMapper)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var roles []models.Role
+	if err := db.Order("id").Offset(offset).Limit(limit).Find(&roles).Error; err != nil {
+		return nil, 0, err
+	}
+	return roles, total, nil
+}
+
+// FindSCIMGroup finds the role of the group, one of the provider
+func (o *ORM) FindSCIMGroup(provider string, id uint) (*models.Role, error) {
+	r := &models.Role{}
+	if err := o.DB.Scopes(scimGroups(provider)).First(r, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ListRoleMembers lists the users of the provider having each of the roles
+func (o *ORM) ListRoleMembers(provider string, roleIDs ...uint) (map[uint][]models.User, error) {
+	members := map[uint][]models.User{}
+	if len(roleIDs) == 0 {
+		return members, nil
+	}
+	var links []models.UserRole
+	if err := o.DB.Where("role_id IN ?", roleIDs).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return members, nil
+	}
+	ids := make([]uuid.UUID, 0, len(links))
+	for _, l := range links {
+		ids = append(ids, l.UserID)
+	}
+	var users []models.User
+	if err := o.DB.Scopes(scimProvisioned(provider)).Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	byID := map[uuid.UUID]models.User{}
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	for _, l := range links {
+		if u, ok := byID[l.UserID]; ok {
+			members[uint(l.RoleID)] = append(members[uint(l.RoleID)], u)
+		}
+	}
+	return members, nil
+}
+
+// SaveSCIMGroup creates the role of the provider, or renames it, and makes
+// the users its only members among the users of the provider
+func (o *ORM) SaveSCIMGroup(r *models.Role, provider string, memberIDs []uuid.UUID) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if r.ID != 0 {
+			if err := tx.Scopes(scimGroups(provider)).First(&models.Role{}, "id = ?", r.ID).Error; err != nil {
+				return err
+			}
+		}
+		if consts.IsSystemRole(r.Name) {
+			return ErrSystemRole
+		}
+		var taken int64
+		if err := tx.Model(&models.Role{}).Where("name = ? AND id <> ?", r.Name, r.ID).
+			Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrRoleExists
+		}
+		if r.ID == 0 {
+			r.SCIMProvider = provider
+			if err := tx.Omit(clause.Associations).Create(r).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(r).Omit(clause.Associations).Update("name", r.Name).Error; err != nil {
+			return err
+		}
+		return setRoleMembers(tx, r.ID, provider, memberIDs)
+	})
+}
+
+// setRoleMembers replaces the users of the provider having the role, the
+// others keep it
+func setRoleMembers(tx *gorm.DB, roleID uint, provider string, userIDs []uuid.UUID) error {
+	seen := map[uuid.UUID]bool{}
+	links := make([]models.UserRole, 0, len(userIDs))
+	for _, id := range userIDs {
+		if !seen[id] {
+			seen[id] = true
+			links = append(links, models.UserRole{UserID: id, RoleID: int(roleID)})
+		}
+	}
+	if len(links) > 0 {
+		var found int64
+		if err := tx.Model(&models.User{}).Scopes(scimProvisioned(provider)).
+			Where("id IN ?", userIDs).Count(&found).Error; err != nil {
+			return err
+		}
+		if int(found) != len(links) {
+			return ErrUnknownMember
+		}
+	}
+	if err := tx.Where("role_id = ? AND user_id IN (SELECT user_id FROM user_profiles WHERE provider = ?)", roleID, provider).
+		Delete(&models.UserRole{}).Error; err != nil {
+		return err
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	return tx.Create(&links).Error
+}
+
+// DeleteSCIMGroup removes the role of the provider from its members and
+// deletes it
+func (o *ORM) DeleteSCIMGroup(provider string, id uint) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		r := &models.Role{}
+		if err := tx.Scopes(scimGroups(provider)).First(r, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", id).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Select(clause.Associations).Delete(r).Error
+	})
+}
+
+// scimGroups scopes the roles to the groups the SCIM client of the provider
+// created, the system roles, the ones of the admins and of other providers
+// aren't seen by it
+func scimGroups(provider string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("scim_provider = ?", provider)
+	}
+}
@@ -0,0 +1,243 @@
+package orm_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/scim"
+	"gorm.io/gorm"
+)
+
+func TestORM_AuthenticateSCIMClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		found   bool
+		wantErr error
+	}{
+		{name: "unknown token", wantErr: orm.ErrInvalidSCIMClient},
+		{name: "authenticates the client", found: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			q := mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "scim_clients" WHERE token_hash = $1`))
+			if !tt.found {
+				q.WillReturnError(gorm.ErrRecordNotFound)
+			} else {
+				q.WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(uuid.Must(uuid.NewV4()), "okta"))
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "scim_clients" SET "last_used_at"=$1`)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+			c, err := o.AuthenticateSCIMClient("token")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ORM.AuthenticateSCIMClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.found && (c.Provider() != "scim:okta" || c.LastUsedAt == nil) {
+				t.Errorf("ORM.AuthenticateSCIMClient() = %+v, want okta used now", c)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestORM_ListSCIMUsers(t *testing.T) {
+	// the users are always scoped to the ones of the provider
+	provisioned := func(n int) string {
+		return fmt.Sprintf(`id IN (SELECT user_id FROM user_profiles WHERE provider = $%d)`, n)
+	}
+	tests := []struct {
+		name    string
+		filter  string
+		where   string
+		args    []any
+		wantErr bool
+	}{
+		{name: "user name", filter: `userName eq "Ann@Example.com"`,
+			where: `WHERE LOWER(email) = $1 AND ` + provisioned(2), args: []any{"ann@example.com", "scim:okta"}},
+		{name: "external id of the provider", filter: `externalId eq "00u1"`,
+			where: `WHERE (id IN (SELECT user_id FROM user_profiles WHERE provider = $1 AND external_user_id = $2)) AND ` +
+				provisioned(3),
+			args: []any{"scim:okta", "00u1", "scim:okta"}},
+		{name: "deactivated users", filter: `active eq false`,
+			where: `WHERE deleted_at IS NOT NULL AND ` + provisioned(1), args: []any{"scim:okta"}},
+		{name: "id that isn't one", filter: `id eq "nope"`,
+			where: `WHERE 1 = 0 AND ` + provisioned(1), args: []any{"scim:okta"}},
+		{name: "unsupported attribute", filter: `title eq "x"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			f, err := scim.ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantErr {
+				args := make([]driver.Value, 0, len(tt.args))
+				for _, a := range tt.args {
+					args = append(args, a)
+				}
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "users" ` + tt.where)).
+					WithArgs(args...).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" ` + tt.where + ` ORDER BY created_at LIMIT 10`)).
+					WithArgs(args...).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			}
+			_, _, err = o.ListSCIMUsers("scim:okta", f, 0, 10)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ORM.ListSCIMUsers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, scim.ErrInvalidFilter) {
+				t.Errorf("ORM.ListSCIMUsers() error = %v, want ErrInvalidFilter", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestORM_SCIMGroups_owner(t *testing.T) {
+	o := sqliteOrm(t)
+	admin := &models.Role{}
+	if err := o.DB.First(admin, "name = ?", "admin").Error; err != nil {
+		t.Fatal(err)
+	}
+	auditors := &models.Role{Name: "auditors"}
+	if err := o.CreateRole(auditors); err != nil {
+		t.Fatal(err)
+	}
+	sales := &models.Role{Name: "sales"}
+	if err := o.SaveSCIMGroup(sales, "scim:azure", nil); err != nil {
+		t.Fatalf("ORM.SaveSCIMGroup() error = %v", err)
+	}
+	engineering := &models.Role{Name: "engineering"}
+	if err := o.SaveSCIMGroup(engineering, "scim:okta", nil); err != nil {
+		t.Fatalf("ORM.SaveSCIMGroup() error = %v", err)
+	}
+
+	roles, total, err := o.ListSCIMGroups("scim:okta", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("ORM.ListSCIMGroups() error = %v", err)
+	}
+	if total != 1 || len(roles) != 1 || roles[0].ID != engineering.ID {
+		t.Errorf("ORM.ListSCIMGroups() = %v, want only the engineering group", roles)
+	}
+	// the system roles, the ones of the admins and of other providers
+	// aren't the groups of the client
+	for _, r := range []*models.Role{admin, auditors, sales} {
+		if _, err := o.FindSCIMGroup("scim:okta", r.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("ORM.FindSCIMGroup() of the %s role error = %v, want %v", r.Name, err, gorm.ErrRecordNotFound)
+		}
+		renamed := &models.Role{Name: "renamed"}
+		renamed.ID = r.ID
+		if err := o.SaveSCIMGroup(renamed, "scim:okta", nil); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("ORM.SaveSCIMGroup() of the %s role error = %v, want %v", r.Name, err, gorm.ErrRecordNotFound)
+		}
+		if err := o.DeleteSCIMGroup("scim:okta", r.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("ORM.DeleteSCIMGroup() of the %s role error = %v, want %v", r.Name, err, gorm.ErrRecordNotFound)
+		}
+	}
+	for _, name := range []string{"admin", "org:owner"} {
+		if err := o.SaveSCIMGroup(&models.Role{Name: name}, "scim:okta", nil); !errors.Is(err, orm.ErrSystemRole) {
+			t.Errorf("ORM.SaveSCIMGroup() named %s error = %v, want %v", name, err, orm.ErrSystemRole)
+		}
+	}
+	engineering.Name = "user"
+	if err := o.SaveSCIMGroup(engineering, "scim:okta", nil); !errors.Is(err, orm.ErrSystemRole) {
+		t.Errorf("ORM.SaveSCIMGroup() renamed to user error = %v, want %v", err, orm.ErrSystemRole)
+	}
+	if err := o.DeleteSCIMGroup("scim:okta", engineering.ID); err != nil {
+		t.Errorf("ORM.DeleteSCIMGroup() error = %v", err)
+	}
+}
+
+func TestORM_SCIMUsers_provider(t *testing.T) {
+	o := sqliteOrm(t)
+	seeded := &models.User{}
+	if err := o.DB.First(seeded, "email = ?", "user@test.com").Error; err != nil {
+		t.Fatal(err)
+	}
+	ann := &models.User{Email: "ann@example.com"}
+	if err := o.SaveSCIMUser(ann, "scim:okta", "00u1"); err != nil {
+		t.Fatalf("ORM.SaveSCIMUser() error = %v", err)
+	}
+	bob := &models.User{Email: "bob@example.com"}
+	if err := o.SaveSCIMUser(bob, "scim:azure", "b1"); err != nil {
+		t.Fatalf("ORM.SaveSCIMUser() error = %v", err)
+	}
+
+	users, total, err := o.ListSCIMUsers("scim:okta", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("ORM.ListSCIMUsers() error = %v", err)
+	}
+	if total != 1 || len(users) != 1 || users[0].ID != ann.ID {
+		t.Errorf("ORM.ListSCIMUsers() = %d %v, want only the user of the provider", total, users)
+	}
+	for _, id := range []uuid.UUID{seeded.ID, bob.ID} {
+		if _, err := o.FindSCIMUser("scim:okta", id); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("ORM.FindSCIMUser() of another user error = %v, want %v", err, gorm.ErrRecordNotFound)
+		}
+	}
+	seeded.FirstName = &seeded.Email
+	if err := o.SaveSCIMUser(seeded, "scim:okta", ""); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("ORM.SaveSCIMUser() of another user error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+
+	// the groups only reach the users of the provider, the others keep them
+	g := &models.Role{Name: "engineering"}
+	if err := o.SaveSCIMGroup(g, "scim:okta", []uuid.UUID{seeded.ID}); !errors.Is(err, orm.ErrUnknownMember) {
+		t.Errorf("ORM.SaveSCIMGroup() with another user error = %v, want %v", err, orm.ErrUnknownMember)
+	}
+	g = &models.Role{Name: "engineering"}
+	if err := o.SaveSCIMGroup(g, "scim:okta", []uuid.UUID{ann.ID}); err != nil {
+		t.Fatalf("ORM.SaveSCIMGroup() error = %v", err)
+	}
+	if err := o.DB.Create(&models.UserRole{UserID: bob.ID, RoleID: int(g.ID)}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := o.SaveSCIMGroup(g, "scim:okta", nil); err != nil {
+		t.Fatalf("ORM.SaveSCIMGroup() error = %v", err)
+	}
+	var links []models.UserRole
+	if err := o.DB.Find(&links, "role_id = ?", g.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].UserID != bob.ID {
+		t.Errorf("ORM.SaveSCIMGroup() left members %v, want only the user of the other provider", links)
+	}
+	members, err := o.ListRoleMembers("scim:azure", g.ID)
+	if err != nil || len(members[g.ID]) != 1 {
+		t.Errorf("ORM.ListRoleMembers() = %v, err %v, want the user of the provider", members, err)
+	}
+}
+
+func TestORM_FindUserByID_deactivated(t *testing.T) {
+	gormDB, mock := mockOrm(t)
+	o := &orm.ORM{DB: gormDB}
+	id := uuid.Must(uuid.NewV4())
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1`)).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "deleted_at"}).AddRow(id, "ann@example.com", time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_permissions"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "permission_id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_roles"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "role_id"}))
+	if _, err := o.FindUserByID(id); !errors.Is(err, orm.ErrUserDeactivated) {
+		t.Errorf("ORM.FindUserByID() error = %v, want %v", err, orm.ErrUserDeactivated)
+	}
+}
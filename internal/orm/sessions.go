@@ -0,0 +1,83 @@
+package orm
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/gorm"
+)
+
+// sessionTouchInterval is how stale the last seen of a session gets before
+// a request updates it, so not every request writes
+const sessionTouchInterval = time.Minute
+
+// ErrSessionRevoked when the session of a token was revoked or expired
+var ErrSessionRevoked = errors.New("session was revoked")
+
+// CreateSession records the session of a login, it lasts as long as its
+// refresh tokens
+func (o *ORM) CreateSession(s *models.Session, ttl time.Duration) error {
+	now := time.Now().UTC()
+	s.LastSeenAt = &now
+	s.ExpiresAt = now.Add(ttl)
+	return o.DB.Create(s).Error
+}
+
+// FindActiveSession finds the session of the user, ErrSessionRevoked is
+// returned when it was revoked or expired. It's read from the primary so a
+// revocation applies at once
+func (o *ORM) FindActiveSession(id uuid.UUID, userID uuid.UUID) (*models.Session, error) {
+	s := &models.Session{}
+	if err := o.Primary().DB.First(s, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, err
+	}
+	if !s.Active() {
+		return nil, ErrSessionRevoked
+	}
+	return s, nil
+}
+
+// TouchSession records the session was just seen from the ip, it's only
+// written when the last time is stale
+func (o *ORM) TouchSession(s *models.Session, clientIP string) error {
+	now := time.Now().UTC()
+	if s.LastSeenAt != nil && now.Sub(*s.LastSeenAt) < sessionTouchInterval && s.ClientIP == clientIP {
+		return nil
+	}
+	return o.DB.Model(s).Updates(map[string]any{"last_seen_at": now, "client_ip": clientIP}).Error
+}
+
+// ExtendSession keeps the session alive for as long as the refresh tokens
+// issued now
+func (o *ORM) ExtendSession(s *models.Session, ttl time.Duration, clientIP string) error {
+	now := time.Now().UTC()
+	return o.DB.Model(s).Updates(map[string]any{
+		"last_seen_at": now, "client_ip": clientIP, "expires_at": now.Add(ttl),
+	}).Error
+}
+
+// ListActiveSessions lists the sessions of the user that weren't revoked and
+// haven't expired, the last seen first
+func (o *ORM) ListActiveSessions(userID uuid.UUID) ([]*models.Session, error) {
+	ls := []*models.Session{}
+	err := o.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now().UTC()).
+		Order("last_seen_at DESC").Find(&ls).Error
+	return ls, err
+}
+
+// RevokeSession revokes the active session of the user, its tokens are
+// refused from now on
+func (o *ORM) RevokeSession(userID uuid.UUID, id uuid.UUID) error {
+	tx := o.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now().UTC())
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package orm_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"gorm.io/gorm"
+)
+
+func TestORM_FindActiveSession(t *testing.T) {
+	id, userID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	now := time.Now()
+	tests := []struct {
+		name      string
+		revokedAt *time.Time
+		expiresAt time.Time
+		wantErr   error
+	}{
+		{name: "active session", expiresAt: now.Add(time.Hour)},
+		{name: "revoked session", revokedAt: &now, expiresAt: now.Add(time.Hour), wantErr: orm.ErrSessionRevoked},
+		{name: "expired session", expiresAt: now.Add(-time.Minute), wantErr: orm.ErrSessionRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "sessions" WHERE id = $1 AND user_id = $2`)).
+				WithArgs(id, userID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "revoked_at"}).
+					AddRow(id, userID, tt.expiresAt, tt.revokedAt))
+			_, err := o.FindActiveSession(id, userID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.FindActiveSession() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestORM_RevokeSession(t *testing.T) {
+	id, userID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name    string
+		rows    int64
+		wantErr error
+	}{
+		{name: "active session", rows: 1},
+		{name: "someone else's or revoked session", rows: 0, wantErr: gorm.ErrRecordNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(
+				`UPDATE "sessions" SET "revoked_at"=$1,"updated_at"=$2 WHERE id = $3 AND user_id = $4 AND revoked_at IS NULL`)).
+				WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), id, userID).
+				WillReturnResult(sqlmock.NewResult(0, tt.rows))
+			mock.ExpectCommit()
+			if err := o.RevokeSession(userID, id); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.RevokeSession() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
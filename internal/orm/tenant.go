@@ -0,0 +1,173 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// tenantField is the field of BaseModelTenant holding the organization
+const tenantField = "OrganizationID"
+
+// allTenantsCtxKey marks a context that may reach across organizations
+type allTenantsCtxKey struct{}
+
+var (
+	// ErrNoTenant when a tenant owned model is used without an organization
+	// in the context, and without the AllTenants escape hatch
+	ErrNoTenant = errors.New("no organization in the context for a tenant scoped model")
+
+	// ErrCrossTenantWrite when a row of another organization is written
+	ErrCrossTenantWrite = errors.New("row belongs to another organization")
+)
+
+// TenantPlugin scopes the queries of the models embedding BaseModelTenant to
+// the organization in the statement context: reads, updates and deletes are
+// filtered by it and creates are stamped with it. Raw SQL isn't scoped
+type TenantPlugin struct{}
+
+// Name of the plugin for gorm
+func (TenantPlugin) Name() string {
+	return "tenant"
+}
+
+// Initialize registers the callbacks of the plugin
+func (p TenantPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("tenant:query", p.filter); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("tenant:row", p.filter); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenant:update", p.filterWrite); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("tenant:delete", p.filterWrite); err != nil {
+		return err
+	}
+	return cb.Create().Before("gorm:create").Register("tenant:create", p.stamp)
+}
+
+// WithTenant returns a context scoped to the organization, the auth
+// middleware does the same on the request context
+func WithTenant(ctx context.Context, orgID uuid.UUID) context.Context {
+	return context.WithValue(ctx, consts.ProjectContextKeys.OrganizationIDCtxKey, orgID)
+}
+
+// TenantFromContext returns the organization the context is scoped to
+func TenantFromContext(ctx context.Context) (uuid.UUID, bool) {
+	if ctx == nil {
+		return uuid.Nil, false
+	}
+	id, ok := ctx.Value(consts.ProjectContextKeys.OrganizationIDCtxKey).(uuid.UUID)
+	return id, ok && id != uuid.Nil
+}
+
+// Tenant returns the db for the request context, the tenant owned models are
+// scoped to its organization
+func (o *ORM) Tenant(ctx context.Context) *gorm.DB {
+	return o.DB.WithContext(ctx)
+}
+
+// AllTenants is the escape hatch for admin jobs to reach across the
+// organizations, use it as a scope: db.Scopes(orm.AllTenants)
+func AllTenants(db *gorm.DB) *gorm.DB {
+	db.Statement.Context = context.WithValue(db.Statement.Context, allTenantsCtxKey{}, true)
+	return db
+}
+
+// tenantOf returns the organization the statement must be scoped to, false
+// when the model isn't tenant owned or the escape hatch is used
+func tenantOf(db *gorm.DB) (uuid.UUID, *schema.Field, bool) {
+	s := db.Statement.Schema
+	if db.Error != nil || s == nil {
+		return uuid.Nil, nil, false
+	}
+	if _, ok := reflect.New(s.ModelType).Interface().(models.TenantOwned); !ok {
+		return uuid.Nil, nil, false
+	}
+	if all, _ := db.Statement.Context.Value(allTenantsCtxKey{}).(bool); all {
+		return uuid.Nil, nil, false
+	}
+	id, ok := TenantFromContext(db.Statement.Context)
+	if !ok {
+		db.AddError(ErrNoTenant)
+		return uuid.Nil, nil, false
+	}
+	return id, s.LookUpField(tenantField), true
+}
+
+// filter adds the organization condition to the statement
+func (TenantPlugin) filter(db *gorm.DB) {
+	id, field, ok := tenantOf(db)
+	if !ok || field == nil {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: id},
+	}})
+}
+
+// filterWrite adds the organization condition to updates and deletes, which
+// still need a condition of their own as gorm refuses global ones
+func (p TenantPlugin) filterWrite(db *gorm.DB) {
+	_, hasWhere := db.Statement.Clauses["WHERE"]
+	if !hasWhere && !db.AllowGlobalUpdate && !hasPrimaryKey(db) {
+		return
+	}
+	p.filter(db)
+}
+
+// hasPrimaryKey verifies if the statement value has its primary key set, so
+// gorm will add it as the condition
+func hasPrimaryKey(db *gorm.DB) bool {
+	s, rv := db.Statement.Schema, db.Statement.ReflectValue
+	if s == nil || s.PrioritizedPrimaryField == nil || !rv.IsValid() {
+		return false
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		return rv.Len() > 0
+	case reflect.Struct:
+		_, zero := s.PrioritizedPrimaryField.ValueOf(db.Statement.Context, rv)
+		return !zero
+	}
+	return false
+}
+
+// stamp sets the organization on the rows created, rows of another
+// organization are refused
+func (TenantPlugin) stamp(db *gorm.DB) {
+	id, field, ok := tenantOf(db)
+	if !ok || field == nil {
+		return
+	}
+	ctx := db.Statement.Context
+	set := func(rv reflect.Value) {
+		v, zero := field.ValueOf(ctx, rv)
+		if !zero && v != id {
+			db.AddError(ErrCrossTenantWrite)
+			return
+		}
+		if err := field.Set(ctx, rv, id); err != nil {
+			db.AddError(err)
+		}
+	}
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			set(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		set(rv)
+	}
+}
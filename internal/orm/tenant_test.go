@@ -0,0 +1,194 @@
+package orm_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/gorm"
+)
+
+// note is a tenant owned model for the tests
+type note struct {
+	models.BaseModel
+	models.BaseModelTenant
+	Body string
+}
+
+func mockTenantOrm(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	gormDB, mock := mockOrm(t)
+	if err := gormDB.Use(orm.TenantPlugin{}); err != nil {
+		t.Fatalf("gorm.DB.Use() error = %v", err)
+	}
+	return gormDB, mock
+}
+
+func TestTenantPlugin_query(t *testing.T) {
+	orgA := uuid.Must(uuid.NewV4())
+	id := uuid.Must(uuid.NewV4())
+
+	t.Run("cross tenant read finds nothing", func(t *testing.T) {
+		o := sqliteOrm(t)
+		if err := o.DB.AutoMigrate(&note{}); err != nil {
+			t.Fatal(err)
+		}
+		orgB := uuid.Must(uuid.NewV4())
+		ctxA := orm.WithTenant(context.Background(), orgA)
+		ctxB := orm.WithTenant(context.Background(), orgB)
+		mine, theirs := &note{Body: "a"}, &note{Body: "b"}
+		if err := o.Tenant(ctxA).Create(mine).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := o.Tenant(ctxB).Create(theirs).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		err := o.Tenant(ctxA).First(&note{}, "id = ?", theirs.ID).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("First() of the other organization's row error = %v, want %v", err, gorm.ErrRecordNotFound)
+		}
+		ns := []note{}
+		if err := o.Tenant(ctxA).Find(&ns).Error; err != nil {
+			t.Fatalf("Find() error = %v", err)
+		}
+		if len(ns) != 1 || ns[0].ID != mine.ID {
+			t.Errorf("Find() = %+v, want only the row of the organization %s", ns, orgA)
+		}
+		all := []note{}
+		if err := o.DB.Scopes(orm.AllTenants).Find(&all).Error; err != nil || len(all) != 2 {
+			t.Errorf("Find() across tenants = %d rows, err %v, want both", len(all), err)
+		}
+	})
+	t.Run("reads are filtered on the organization", func(t *testing.T) {
+		db, mock := mockTenantOrm(t)
+		mock.ExpectQuery(regexp.QuoteMeta(
+			`SELECT * FROM "notes" WHERE id = $1 AND "notes"."organization_id" = $2`)).
+			WithArgs(id, orgA).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "organization_id", "body"}))
+		err := db.WithContext(orm.WithTenant(context.Background(), orgA)).First(&note{}, "id = ?", id).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("First() error = %v, want %v", err, gorm.ErrRecordNotFound)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+	t.Run("count is scoped", func(t *testing.T) {
+		db, mock := mockTenantOrm(t)
+		mock.ExpectQuery(regexp.QuoteMeta(
+			`SELECT count(*) FROM "notes" WHERE "notes"."organization_id" = $1`)).
+			WithArgs(orgA).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		var count int64
+		if err := db.WithContext(orm.WithTenant(context.Background(), orgA)).Model(&note{}).Count(&count).Error; err != nil {
+			t.Errorf("Count() error = %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+	t.Run("no tenant in the context", func(t *testing.T) {
+		db, mock := mockTenantOrm(t)
+		err := db.WithContext(context.Background()).Find(&[]note{}).Error
+		if !errors.Is(err, orm.ErrNoTenant) {
+			t.Errorf("Find() error = %v, want %v", err, orm.ErrNoTenant)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+	t.Run("escape hatch reads across tenants", func(t *testing.T) {
+		db, mock := mockTenantOrm(t)
+		mock.ExpectQuery(`^SELECT \* FROM "notes"$`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "organization_id", "body"}))
+		if err := db.Scopes(orm.AllTenants).Find(&[]note{}).Error; err != nil {
+			t.Errorf("Find() error = %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+	t.Run("models not tenant owned aren't scoped", func(t *testing.T) {
+		db, mock := mockTenantOrm(t)
+		mock.ExpectQuery(`^SELECT \* FROM "roles"$`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+		if err := db.Find(&[]models.Role{}).Error; err != nil {
+			t.Errorf("Find() error = %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+}
+
+func TestTenantPlugin_write(t *testing.T) {
+	orgA := uuid.Must(uuid.NewV4())
+	orgB := uuid.Must(uuid.NewV4())
+	ctx := orm.WithTenant(context.Background(), orgA)
+
+	t.Run("create stamps the tenant", func(t *testing.T) {
+		db, mock := mockTenantOrm(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "notes" ("organization_id","body") VALUES ($1,$2)`)).
+			WithArgs(orgA, "hello").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		n := &note{Body: "hello"}
+		if err := db.WithContext(ctx).Omit("ID", "CreatedAt", "UpdatedAt").Create(n).Error; err != nil {
+			t.Errorf("Create() error = %v", err)
+		}
+		if n.OrganizationID != orgA {
+			t.Errorf("Create() organization = %v, want %v", n.OrganizationID, orgA)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+	t.Run("create for another tenant fails", func(t *testing.T) {
+		db, mock := mockTenantOrm(t)
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		n := &note{BaseModelTenant: models.BaseModelTenant{OrganizationID: orgB}}
+		if err := db.WithContext(ctx).Create(n).Error; !errors.Is(err, orm.ErrCrossTenantWrite) {
+			t.Errorf("Create() error = %v, want %v", err, orm.ErrCrossTenantWrite)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+	t.Run("update of another tenant's row changes nothing", func(t *testing.T) {
+		db, mock := mockTenantOrm(t)
+		n := &note{}
+		n.ID = uuid.Must(uuid.NewV4())
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(
+			`UPDATE "notes" SET "body"=$1,"updated_at"=$2 WHERE "notes"."organization_id" = $3 AND "id" = $4`)).
+			WithArgs("x", sqlmock.AnyArg(), orgA, n.ID).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		tx := db.WithContext(ctx).Model(n).Update("body", "x")
+		if tx.Error != nil || tx.RowsAffected != 0 {
+			t.Errorf("Update() error = %v, rows %d, want no rows", tx.Error, tx.RowsAffected)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+	t.Run("delete without conditions is refused", func(t *testing.T) {
+		db, mock := mockTenantOrm(t)
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		err := db.WithContext(ctx).Delete(&note{}).Error
+		if !errors.Is(err, gorm.ErrMissingWhereClause) {
+			t.Errorf("Delete() error = %v, want %v", err, gorm.ErrMissingWhereClause)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package orm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/listing"
+	"gorm.io/gorm"
+)
+
+// UserListing is what the lists of users can be filtered and sorted on
+var UserListing = &listing.Options{
+	Filters: map[string]string{
+		"email": "email", "first_name": "first_name", "last_name": "last_name",
+		"created_at": "created_at", "updated_at": "updated_at", "deleted_at": "deleted_at",
+	},
+	Sorts: map[string]string{"email": "email", "updated_at": "updated_at"},
+}
+
+// UserChanges are the changes to the user, the nil ones are left as they are
+type UserChanges struct {
+	Email     *string
+	FirstName *string
+	LastName  *string
+}
+
+// ListUsers lists the page of the users the list query asks for.
+// Deactivated users are only listed when [deactivated] is set
+func (o *ORM) ListUsers(deactivated bool, q *listing.Query) (*Page[models.User], error) {
+	db := o.DB
+	if !deactivated {
+		db = db.Where("deleted_at IS NULL")
+	}
+	return ListPage[models.User](db, q, consts.EntityNames.UserProfiles,
+		consts.EntityNames.Permissions, consts.EntityNames.Roles)
+}
+
+// FindUser finds the user, deactivated or not, along with its profiles,
+// roles and permissions
+func (o *ORM) FindUser(id uuid.UUID) (*models.User, error) {
+	u := &models.User{}
+	rolePerm := fmt.Sprintf(nestedFmt, consts.EntityNames.Roles, consts.EntityNames.Permissions)
+	if err := o.DB.Preload(consts.EntityNames.UserProfiles).Preload(consts.EntityNames.Permissions).
+		Preload(consts.EntityNames.Roles).Preload(rolePerm).First(u, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// UpdateUser changes the email and names of the user, the email can't be
+// the one of another user
+func (o *ORM) UpdateUser(id uuid.UUID, ch *UserChanges) (*models.User, error) {
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		u := &models.User{}
+		if err := tx.First(u, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := checkVersion(tx, u); err != nil {
+			return err
+		}
+		changes := map[string]any{}
+		if ch.Email != nil {
+			email := strings.ToLower(strings.TrimSpace(*ch.Email))
+			var taken int64
+			if err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", email, id).
+				Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken > 0 {
+				return ErrEmailAlreadyRegistered
+			}
+			changes["email"] = email
+		}
+		if ch.FirstName != nil {
+			changes["first_name"] = strings.TrimSpace(*ch.FirstName)
+		}
+		if ch.LastName != nil {
+			changes["last_name"] = strings.TrimSpace(*ch.LastName)
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		return tx.Model(u).Updates(changes).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	// read back from the primary, a replica may not have the update yet
+	return o.Primary().FindUser(id)
+}
+
+// SetUserActive deactivates the user, soft deleting it so it can't sign in
+// anymore, or restores it
+func (o *ORM) SetUserActive(id uuid.UUID, active bool) (*models.User, error) {
+	var deletedAt *time.Time
+	if !active {
+		now := time.Now().UTC()
+		deletedAt = &now
+	}
+	upd := o.DB.Model(&models.User{}).Where("id = ?", id).Update("deleted_at", deletedAt)
+	if upd.Error != nil {
+		return nil, upd.Error
+	}
+	if upd.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return o.Primary().FindUser(id)
+}
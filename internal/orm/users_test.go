@@ -0,0 +1,132 @@
+package orm_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"gorm.io/gorm"
+)
+
+// expectFindUser expects the user to be found with no profiles, roles or
+// permissions
+func expectFindUser(mock sqlmock.Sqlmock, id uuid.UUID) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1`)).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(id, "jane@example.com"))
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "user_permissions"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "permission_id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "user_roles"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "role_id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_profiles" WHERE "user_profiles"."user_id" = $1`)).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}))
+}
+
+func TestORM_UpdateUser(t *testing.T) {
+	id := uuid.Must(uuid.NewV4())
+	email, first := "Jane@Example.com", "Jane"
+	stale := uint(2)
+	tests := []struct {
+		name    string
+		version *uint
+		changes *orm.UserChanges
+		mock    func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name:    "names",
+			changes: &orm.UserChanges{FirstName: &first},
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "first_name"=$1,"updated_at"=$2 WHERE "id" = $3`)).
+					WithArgs(first, sqlmock.AnyArg(), id).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectFindUser(mock, id)
+			},
+		},
+		{
+			name:    "email of another user",
+			changes: &orm.UserChanges{Email: &email},
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "users" WHERE email = $1 AND id <> $2`)).
+					WithArgs("jane@example.com", id).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectRollback()
+			},
+			wantErr: orm.ErrEmailAlreadyRegistered,
+		},
+		{
+			name:    "changed since the version",
+			version: &stale,
+			changes: &orm.UserChanges{FirstName: &first},
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectRollback()
+			},
+			wantErr: orm.ErrVersionConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			if tt.version != nil {
+				o = o.WithContext(orm.IfVersion(context.Background(), *tt.version))
+			}
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1`)).
+				WithArgs(id).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email", "version"}).AddRow(id, "jane@example.org", 3))
+			tt.mock(mock)
+			if _, err := o.UpdateUser(id, tt.changes); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.UpdateUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestORM_SetUserActive(t *testing.T) {
+	id := uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name    string
+		active  bool
+		rows    int64
+		wantErr error
+	}{
+		{name: "deactivates", active: false, rows: 1},
+		{name: "restores", active: true, rows: 1},
+		{name: "unknown user", active: false, rows: 0, wantErr: gorm.ErrRecordNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gormDB, mock := mockOrm(t)
+			o := &orm.ORM{DB: gormDB}
+			deletedAt := sqlmock.AnyArg()
+			if tt.active {
+				deletedAt = nil
+			}
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "deleted_at"=$1,"updated_at"=$2 WHERE id = $3`)).
+				WithArgs(deletedAt, sqlmock.AnyArg(), id).
+				WillReturnResult(sqlmock.NewResult(0, tt.rows))
+			mock.ExpectCommit()
+			if tt.rows > 0 {
+				expectFindUser(mock, id)
+			}
+			if _, err := o.SetUserActive(id, tt.active); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ORM.SetUserActive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
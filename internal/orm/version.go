@@ -0,0 +1,164 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// versionField is the field of BaseModelVersioned holding the version
+const versionField = "Version"
+
+// versionCtxKey holds the version the writes of the context are made against
+type versionCtxKey struct{}
+
+// ErrVersionConflict when the row was changed since the version the write was
+// made against
+var ErrVersionConflict = errors.New("the row was changed by someone else, fetch it again")
+
+// VersionPlugin versions the models embedding BaseModelVersioned: updates
+// bump their version, and when the statement context holds an expected
+// version, updates and deletes of another version fail with
+// ErrVersionConflict. Raw SQL isn't versioned. The plugin builds the updates
+// itself, so it's used after the TenantPlugin
+type VersionPlugin struct{}
+
+// Name of the plugin for gorm
+func (VersionPlugin) Name() string {
+	return "version"
+}
+
+// Initialize registers the callbacks of the plugin
+func (p VersionPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	// the update is built here, so after the conditions of the tenants
+	if err := cb.Update().Before("gorm:update").After("tenant:update").Register("version:update", p.bump); err != nil {
+		return err
+	}
+	// the checks fail the statement before its transaction is committed
+	if err := cb.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").
+		Register("version:check_update", p.bumped); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("version:delete", p.filter); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").
+		Register("version:check_delete", p.check)
+}
+
+// IfVersion returns a context whose updates and deletes of versioned models
+// only apply to the rows still at the version
+func IfVersion(ctx context.Context, version uint) context.Context {
+	return context.WithValue(ctx, versionCtxKey{}, version)
+}
+
+// WithContext returns the orm running its queries with the context, like one
+// made by IfVersion
+func (o *ORM) WithContext(ctx context.Context) *ORM {
+	return &ORM{DB: o.DB.WithContext(ctx)}
+}
+
+// checkVersion fails when the row read isn't at the version the writes of
+// the db are made against, for the writes that may end up changing nothing
+func checkVersion(db *gorm.DB, m models.Versioned) error {
+	if v, ok := expectedVersion(db); ok && v != m.CurrentVersion() {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// versionOf returns the version field of the versioned models of the
+// statement
+func versionOf(db *gorm.DB) (*schema.Field, bool) {
+	if !versioned(db) || db.Statement.SQL.Len() > 0 {
+		return nil, false
+	}
+	f := db.Statement.Schema.LookUpField(versionField)
+	return f, f != nil
+}
+
+// expectedVersion returns the version the statement is made against
+func expectedVersion(db *gorm.DB) (uint, bool) {
+	v, ok := db.Statement.Context.Value(versionCtxKey{}).(uint)
+	return v, ok
+}
+
+// filter adds the expected version condition to the statement
+func (VersionPlugin) filter(db *gorm.DB) {
+	f, ok := versionOf(db)
+	if !ok {
+		return
+	}
+	if v, ok := expectedVersion(db); ok {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName}, Value: v},
+		}})
+	}
+}
+
+// bump adds the expected version condition and the version increment to the
+// update. The SET clause gorm would build is built here, as gorm replaces
+// any SET clause added before
+func (p VersionPlugin) bump(db *gorm.DB) {
+	f, ok := versionOf(db)
+	if !ok {
+		return
+	}
+	p.filter(db)
+	stmt := db.Statement
+	for _, c := range stmt.Schema.UpdateClauses {
+		stmt.AddClause(c)
+	}
+	stmt.AddClauseIfNotExists(clause.Update{})
+	set := callbacks.ConvertToAssignments(stmt)
+	if len(set) == 0 || db.Error != nil {
+		return
+	}
+	column := clause.Column{Name: f.DBName}
+	set = append(set, clause.Assignment{Column: column, Value: gorm.Expr("? + 1", column)})
+	stmt.AddClause(set)
+	stmt.Build(stmt.BuildClauses...)
+}
+
+// bumped checks the update and moves the row updated to the next version
+func (p VersionPlugin) bumped(db *gorm.DB) {
+	p.check(db)
+	rv := db.Statement.ReflectValue
+	if !versioned(db) || db.RowsAffected == 0 || rv.Kind() != reflect.Struct {
+		return
+	}
+	f := db.Statement.Schema.LookUpField(versionField)
+	v, _ := f.ValueOf(db.Statement.Context, rv)
+	current, _ := v.(uint)
+	if expected, ok := expectedVersion(db); ok {
+		current = expected
+	}
+	db.AddError(f.Set(db.Statement.Context, rv, current+1))
+}
+
+// check fails the statement when no row was at the expected version
+func (VersionPlugin) check(db *gorm.DB) {
+	if !versioned(db) || db.RowsAffected > 0 {
+		return
+	}
+	if _, ok := expectedVersion(db); ok {
+		db.AddError(ErrVersionConflict)
+	}
+}
+
+// versioned verifies if the statement went fine on a versioned model
+func versioned(db *gorm.DB) bool {
+	s := db.Statement.Schema
+	if db.Error != nil || s == nil {
+		return false
+	}
+	_, ok := reflect.New(s.ModelType).Interface().(models.Versioned)
+	return ok
+}
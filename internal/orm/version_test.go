@@ -0,0 +1,139 @@
+package orm_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/gorm"
+)
+
+// draft is a versioned model for the tests
+type draft struct {
+	models.BaseModel
+	models.BaseModelVersioned
+	Body string
+}
+
+func mockVersionOrm(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	gormDB, mock := mockOrm(t)
+	if err := gormDB.Use(orm.VersionPlugin{}); err != nil {
+		t.Fatalf("gorm.DB.Use() error = %v", err)
+	}
+	return gormDB, mock
+}
+
+func TestVersionPlugin_update(t *testing.T) {
+	id := uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		sql         string
+		args        []driver.Value
+		rows        int64
+		wantVersion uint
+		wantErr     error
+	}{
+		{
+			name:        "bumps the version",
+			ctx:         context.Background(),
+			sql:         `UPDATE "drafts" SET "body"=$1,"updated_at"=$2,"version"="version" + 1 WHERE "id" = $3`,
+			args:        []driver.Value{"new", sqlmock.AnyArg(), id},
+			rows:        1,
+			wantVersion: 4,
+		},
+		{
+			name:        "at the expected version",
+			ctx:         orm.IfVersion(context.Background(), 3),
+			sql:         `UPDATE "drafts" SET "body"=$1,"updated_at"=$2,"version"="version" + 1 WHERE "drafts"."version" = $3 AND "id" = $4`,
+			args:        []driver.Value{"new", sqlmock.AnyArg(), 3, id},
+			rows:        1,
+			wantVersion: 4,
+		},
+		{
+			name:        "changed since",
+			ctx:         orm.IfVersion(context.Background(), 2),
+			sql:         `UPDATE "drafts" SET "body"=$1,"updated_at"=$2,"version"="version" + 1 WHERE "drafts"."version" = $3 AND "id" = $4`,
+			args:        []driver.Value{"new", sqlmock.AnyArg(), 2, id},
+			rows:        0,
+			wantVersion: 3,
+			wantErr:     orm.ErrVersionConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := mockVersionOrm(t)
+			d := &draft{BaseModel: models.BaseModel{ID: id}, BaseModelVersioned: models.BaseModelVersioned{Version: 3}}
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(tt.sql)).
+				WithArgs(tt.args...).
+				WillReturnResult(sqlmock.NewResult(0, tt.rows))
+			if tt.wantErr != nil {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectCommit()
+			}
+			err := db.WithContext(tt.ctx).Model(d).Update("body", "new").Error
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if d.Version != tt.wantVersion {
+				t.Errorf("Update() version = %d, want %d", d.Version, tt.wantVersion)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestVersionPlugin_delete(t *testing.T) {
+	id := uuid.Must(uuid.NewV4())
+	db, mock := mockVersionOrm(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "drafts" WHERE "drafts"."version" = $1 AND "drafts"."id" = $2`)).
+		WithArgs(2, id).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	err := db.WithContext(orm.IfVersion(context.Background(), 2)).Delete(&draft{BaseModel: models.BaseModel{ID: id}}).Error
+	if !errors.Is(err, orm.ErrVersionConflict) {
+		t.Errorf("Delete() error = %v, want %v", err, orm.ErrVersionConflict)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestVersionPlugin_tenant(t *testing.T) {
+	type page struct {
+		models.BaseModel
+		models.BaseModelTenant
+		models.BaseModelVersioned
+		Body string
+	}
+	orgID, id := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	db, mock := mockTenantOrm(t)
+	if err := db.Use(orm.VersionPlugin{}); err != nil {
+		t.Fatalf("gorm.DB.Use() error = %v", err)
+	}
+	// the update is built by the version plugin after the tenant condition
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "pages" SET "body"=$1,"updated_at"=$2,"version"="version" + 1 WHERE "pages"."organization_id" = $3 AND "pages"."version" = $4 AND "id" = $5`)).
+		WithArgs("new", sqlmock.AnyArg(), orgID, 1, id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	ctx := orm.IfVersion(orm.WithTenant(context.Background(), orgID), 1)
+	p := &page{BaseModel: models.BaseModel{ID: id}, BaseModelTenant: models.BaseModelTenant{OrganizationID: orgID}}
+	if err := db.WithContext(ctx).Model(p).Update("body", "new").Error; err != nil {
+		t.Errorf("Update() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
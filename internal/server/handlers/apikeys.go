@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// apiKey is an api key of the user, without the key itself
+type apiKey struct {
+	ID                  uint       `json:"id"`
+	Name                string     `json:"name"`
+	Prefix              string     `json:"prefix"`
+	RequireSigning      bool       `json:"require_signing"`
+	HasSigningSecret    bool       `json:"has_signing_secret"`
+	AllowedCIDRs        []string   `json:"allowed_cidrs"`
+	AllowedPathPrefixes []string   `json:"allowed_path_prefixes"`
+	CreatedAt           *time.Time `json:"created_at"`
+}
+
+// apiKeyInput is the body to change the settings of an api key, the ones
+// left out don't change and empty lists lift the restrictions
+type apiKeyInput struct {
+	RequireSigning      *bool     `json:"require_signing"`
+	AllowedCIDRs        *[]string `json:"allowed_cidrs"`
+	AllowedPathPrefixes *[]string `json:"allowed_path_prefixes"`
+}
+
+// ormAPIKeySettings is reachable where the orm param shadows the package
+type ormAPIKeySettings = orm.APIKeySettings
+
+func toAPIKey(k *models.UserAPIKey) *apiKey {
+	return &apiKey{
+		ID:                  k.ID,
+		Name:                k.Name,
+		Prefix:              k.Prefix(),
+		RequireSigning:      k.RequireSigning,
+		HasSigningSecret:    k.SigningSecret != "",
+		AllowedCIDRs:        k.CIDRList(),
+		AllowedPathPrefixes: k.PathPrefixList(),
+		CreatedAt:           k.CreatedAt,
+	}
+}
+
+// apiKeyID parses the id of the api key in the path
+func apiKeyID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errors.New("invalid api key id"))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// APIKeys lists the api keys of the authenticated user
+func APIKeys(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := ownUser(c)
+		if !ok {
+			return
+		}
+		keys, err := orm.ListUserAPIKeys(u.ID)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		out := make([]*apiKey, 0, len(keys))
+		for _, k := range keys {
+			out = append(out, toAPIKey(k))
+		}
+		c.JSON(http.StatusOK, gin.H{"api_keys": out})
+	}
+}
+
+// UpdateAPIKey changes the settings of an api key of the authenticated user:
+// requiring signed requests, which needs a signing secret first, and the
+// CIDR ranges and path prefixes the key is restricted to
+func UpdateAPIKey(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := ownUser(c)
+		if !ok {
+			return
+		}
+		id, ok := apiKeyID(c)
+		if !ok {
+			return
+		}
+		in := &apiKeyInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		k, err := orm.WithContext(c.Request.Context()).UpdateAPIKeySettings(u.ID, id, &ormAPIKeySettings{
+			RequireSigning:      in.RequireSigning,
+			AllowedCIDRs:        in.AllowedCIDRs,
+			AllowedPathPrefixes: in.AllowedPathPrefixes,
+		})
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[APIKeys.Update] user: %s key: %d require signing: %v cidrs: [%s] prefixes: [%s]",
+			u.ID, id, k.RequireSigning, k.AllowedCIDRs, k.AllowedPathPrefixes)
+		c.JSON(http.StatusOK, toAPIKey(k))
+	}
+}
+
+// RotateSigningSecret sets a new signing secret on an api key of the
+// authenticated user, it's only shown this once
+func RotateSigningSecret(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := ownUser(c)
+		if !ok {
+			return
+		}
+		id, ok := apiKeyID(c)
+		if !ok {
+			return
+		}
+		secret, err := orm.WithContext(c.Request.Context()).RotateAPIKeySigningSecret(u.ID, id)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[APIKeys.RotateSigningSecret] user: %s key: %d", u.ID, id)
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusCreated, gin.H{"id": id, "signing_secret": secret})
+	}
+}
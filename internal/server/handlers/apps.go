@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// authorizedApp is an app the user authorised to act on their behalf
+type authorizedApp struct {
+	ClientID  string     `json:"client_id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	GrantedAt *time.Time `json:"granted_at"`
+}
+
+// ownUser returns the authenticated user when they call for themselves,
+// apps acting on their behalf can't manage their account
+func ownUser(c *gin.Context) (*models.User, bool) {
+	u, err := auth.GetUser(c)
+	if err != nil {
+		abortWithError(c, http.StatusUnauthorized, err)
+		return nil, false
+	}
+	if _, err := auth.GetServicePrincipal(c); err == nil {
+		abortWithError(c, http.StatusForbidden, errors.New("apps can't do this on behalf of the user"))
+		return nil, false
+	}
+	return u, true
+}
+
+// AuthorizedApps lists the apps the authenticated user authorised
+func AuthorizedApps(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := ownUser(c)
+		if !ok {
+			return
+		}
+		grants, err := orm.ListOAuthGrants(u.ID)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		apps := make([]authorizedApp, 0, len(grants))
+		for _, g := range grants {
+			app := authorizedApp{ClientID: g.ClientID, Scopes: g.ScopeList(), GrantedAt: g.CreatedAt}
+			if g.Client != nil {
+				app.Name = g.Client.Name
+			}
+			apps = append(apps, app)
+		}
+		c.JSON(http.StatusOK, gin.H{"apps": apps})
+	}
+}
+
+// RevokeApp revokes the access of an app to the authenticated user, its
+// tokens stop working right away
+func RevokeApp(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := ownUser(c)
+		if !ok {
+			return
+		}
+		clientID := c.Param("clientId")
+		if err := orm.WithContext(c.Request.Context()).RevokeOAuthGrant(u.ID, clientID); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Apps.Revoke] user: %s revoked client: %s", u.ID, clientID)
+		c.Status(http.StatusNoContent)
+	}
+}
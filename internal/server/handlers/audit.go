@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+)
+
+// auditEntryOutput is a change of the audit log as we show it, before and
+// after are the columns changed
+type auditEntryOutput struct {
+	ID             uint            `json:"id"`
+	Action         string          `json:"action"`
+	Table          string          `json:"table"`
+	RowID          string          `json:"row_id"`
+	ActorID        *uuid.UUID      `json:"actor_id"`
+	ImpersonatorID *uuid.UUID      `json:"impersonator_id,omitempty"`
+	APIKeyID       *uint           `json:"api_key_id,omitempty"`
+	ClientID       string          `json:"client_id,omitempty"`
+	OrganizationID *uuid.UUID      `json:"organization_id,omitempty"`
+	RequestID      string          `json:"request_id"`
+	Before         json.RawMessage `json:"before,omitempty"`
+	After          json.RawMessage `json:"after,omitempty"`
+	CreatedAt      *time.Time      `json:"created_at"`
+}
+
+// auditListing is reachable where the orm param shadows the package
+var auditListing = orm.AuditListing
+
+func newAuditEntryOutput(e *models.AuditEntry) *auditEntryOutput {
+	out := &auditEntryOutput{
+		ID:             e.ID,
+		Action:         e.Action,
+		Table:          e.Table,
+		RowID:          e.RowID,
+		ActorID:        e.ActorID,
+		ImpersonatorID: e.ImpersonatorID,
+		APIKeyID:       e.APIKeyID,
+		ClientID:       e.ClientID,
+		OrganizationID: e.OrganizationID,
+		RequestID:      e.RequestID,
+		CreatedAt:      e.CreatedAt,
+	}
+	if e.Before != "" {
+		out.Before = json.RawMessage(e.Before)
+	}
+	if e.After != "" {
+		out.After = json.RawMessage(e.After)
+	}
+	return out
+}
+
+// AuditEntries lists a page of the changes of the audit log, filtered by
+// table, row, actor or request among others
+func AuditEntries(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, ok := listQuery(c, auditListing)
+		if !ok {
+			return
+		}
+		page, err := orm.ListAuditEntries(q)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		out := make([]*auditEntryOutput, 0, len(page.Rows))
+		for i := range page.Rows {
+			out = append(out, newAuditEntryOutput(&page.Rows[i]))
+		}
+		listPage(c, "entries", out, q, page.Total, page.Next)
+	}
+}
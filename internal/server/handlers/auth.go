@@ -2,27 +2,38 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/markbates/goth/gothic"
 
 	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/pkg/auth"
 	"github.com/rakin92/go-rest-service/pkg/cfg"
 	"github.com/rakin92/go-rest-service/pkg/consts"
 	"github.com/rakin92/go-rest-service/pkg/logger"
 )
 
-// AuthProviders begin login with the auth provider
-func AuthProviders() gin.HandlerFunc {
+// AuthProviders begin login with the auth provider, the client may ask for the
+// callback `response_mode` and `redirect_uri`
+func AuthProviders(sc *cfg.Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// You have to add value context with provider name to get provider name in GetProviderName method
 		c.Request = addProviderToContext(c, c.Param(string(consts.ProjectContextKeys.ProviderCtxKey)))
 		// try to get the user without re-authenticating
 		if gothUser, err := gothic.CompleteUserAuth(c.Writer, c.Request); err != nil {
 			logger.Error(&err, "error auth")
+			intent, err := newAuthIntent(c, sc)
+			if err != nil {
+				abortWithError(c, http.StatusBadRequest, err)
+				return
+			}
+			if err := setAuthIntent(c, sc, intent); err != nil {
+				abortWithError(c, http.StatusInternalServerError, err)
+				return
+			}
 			gothic.BeginAuthHandler(c.Writer, c.Request)
 		} else {
 			logger.Debug("user: %#v", gothUser)
@@ -33,46 +44,152 @@ func AuthProviders() gin.HandlerFunc {
 // Callback callback to complete auth provider flow
 func Callback(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		provider := c.Param(string(consts.ProjectContextKeys.ProviderCtxKey))
 		// You have to add value context with provider name to get provider name in GetProviderName method
-		c.Request = addProviderToContext(c, c.Param(string(consts.ProjectContextKeys.ProviderCtxKey)))
+		c.Request = addProviderToContext(c, provider)
+		intent := popAuthIntent(c, sc)
+		res := newCallbackResponse(sc, provider, intent)
+
+		// the provider tells us when the user denied access or it failed
+		if code := c.Query("error"); code != "" {
+			if !providerErrCode.MatchString(code) {
+				code = "auth_failed"
+			}
+			res.error(c, http.StatusUnauthorized, code, fmt.Errorf("provider error: %s", code))
+			return
+		}
 		gothUsr, err := gothic.CompleteUserAuth(c.Writer, c.Request)
 		if err != nil {
-			c.AbortWithError(http.StatusInternalServerError, err)
+			res.error(c, http.StatusUnauthorized, "auth_failed", err)
+			return
+		}
+
+		// the user started the flow to link this provider to their account
+		if intent.LinkUserID != "" {
+			linkCallback(c, orm, intent, res, &gothUsr)
 			return
 		}
 
 		// finds the user in our system from goth jwt
-		u, err := orm.FindUserByJWT(gothUsr.Email, gothUsr.Provider, gothUsr.UserID)
+		u, err := orm.FindUserByJWT(gothUsr.Provider, gothUsr.UserID)
 		if err != nil {
-			if u, err = orm.UpsertUserProfile(&gothUsr); err != nil {
+			if u, err = orm.UpsertUserProfile(&gothUsr, sc.Auth.MergeVerifiedEmails); err != nil {
 				logger.Error(&err, "[Auth.CallBack.UserLoggedIn.FindUserByJWT.Error]: %s", err.Error())
-				c.AbortWithError(http.StatusInternalServerError, err)
+				res.error(c, ormErrorStatus(err), callbackErrorCode(err), err)
+				return
 			}
 		}
-		claims := &jwt.RegisteredClaims{
-			ID:        gothUsr.UserID,
-			Subject:   u.Email,
-			Issuer:    gothUsr.Provider,
-			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-			NotBefore: jwt.NewNumericDate(time.Now().UTC()),
-			ExpiresAt: jwt.NewNumericDate(gothUsr.ExpiresAt.UTC()),
+		s, err := startSession(c, sc, orm, u, gothUsr.Provider)
+		if err != nil {
+			logger.Error(&err, "[Auth.Callback.Session] error: %s", err.Error())
+			res.error(c, http.StatusInternalServerError, "server_error", err)
+			return
 		}
-
-		// issue a new JWT token
-		jwtToken := jwt.NewWithClaims(jwt.GetSigningMethod(sc.JWT.Algorithm), claims)
-		token, err := jwtToken.SignedString([]byte(sc.JWT.Secret))
+		// issue a new JWT token pair
+		pair, err := auth.IssueTokenPair(sc, u, gothUsr.Provider, gothUsr.UserID, s.ID)
 		if err != nil {
 			logger.Error(&err, "[Auth.Callback.JWT] error: %s", err.Error())
-			c.AbortWithError(http.StatusInternalServerError, err)
+			res.error(c, http.StatusInternalServerError, "server_error", err)
+			return
+		}
+		res.tokens(c, pair)
+	}
+}
+
+// TokenExchange exchanges a token native clients got from the provider SDK
+// for our own token pair
+func TokenExchange(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, err := auth.GetTokenVerifier(c.Param(string(consts.ProjectContextKeys.ProviderCtxKey)))
+		if err != nil {
+			abortWithError(c, http.StatusNotFound, err)
+			return
+		}
+		pt := &auth.ProviderToken{}
+		if err := c.ShouldBind(pt); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
 			return
 		}
-		json := gin.H{
-			"type":          "Bearer",
-			"token":         token,
-			"refresh_token": gothUsr.RefreshToken,
-			"user_id":       u.ID,
+		gothUsr, err := v.Verify(pt)
+		if err != nil {
+			logger.Warn("[Auth.TokenExchange.Verify] error: %s", err.Error())
+			abortWithError(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		u, err := orm.FindUserByJWT(gothUsr.Provider, gothUsr.UserID)
+		if err != nil {
+			if u, err = orm.UpsertUserProfile(gothUsr, sc.Auth.MergeVerifiedEmails); err != nil {
+				logger.Error(&err, "[Auth.TokenExchange.UpsertUserProfile] error: %s", err.Error())
+				abortWithError(c, ormErrorStatus(err), err)
+				return
+			}
+		}
+		s, err := startSession(c, sc, orm, u, gothUsr.Provider)
+		if err != nil {
+			logger.Error(&err, "[Auth.TokenExchange.Session] error: %s", err.Error())
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		pair, err := auth.IssueTokenPair(sc, u, gothUsr.Provider, gothUsr.UserID, s.ID)
+		if err != nil {
+			logger.Error(&err, "[Auth.TokenExchange.JWT] error: %s", err.Error())
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, pair)
+	}
+}
+
+// refreshRequest is the body to renew a token pair
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
+// Refresh issues a new token pair from a valid refresh token, sent in the body
+// or in the cookie set by the cookie response mode
+func Refresh(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := &refreshRequest{}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBind(req); err != nil {
+				abortWithError(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if req.RefreshToken == "" {
+			req.RefreshToken, _ = c.Cookie(auth.RefreshTokenCookie)
+		}
+		if req.RefreshToken == "" {
+			abortWithError(c, http.StatusBadRequest, errors.New("refresh_token is required"))
+			return
+		}
+		claims, err := auth.ParseClaims(sc, req.RefreshToken)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, err)
+			return
+		}
+		if claims.TokenType != auth.RefreshTokenType {
+			abortWithError(c, http.StatusUnauthorized, auth.ErrInvalidTokenType)
+			return
+		}
+		u, err := orm.FindUserByJWT(claims.Issuer, claims.ID)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, auth.ErrForbidden)
+			return
+		}
+		s, err := refreshSession(c, sc, orm, u, claims)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, err)
+			return
+		}
+		pair, err := auth.IssueTokenPair(sc, u, claims.Issuer, claims.ID, s.ID)
+		if err != nil {
+			logger.Error(&err, "[Auth.Refresh.JWT] error: %s", err.Error())
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
 		}
-		c.JSON(http.StatusOK, json)
+		c.JSON(http.StatusOK, pair)
 	}
 }
 
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+const (
+	authorizationCodeTTL = 5 * time.Minute
+	consentTicketTTL     = 10 * time.Minute
+)
+
+var (
+	// ErrInvalidConsentTicket when the consent form wasn't issued to the user
+	ErrInvalidConsentTicket = errors.New("invalid or expired consent ticket")
+
+	consentTmpl = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Authorize {{.Client}}</title></head>
+<body>
+<h1>{{.Client}} wants to access your account</h1>
+<p>It will be allowed to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="ticket" value="{{.Ticket}}">
+<button type="submit" name="decision" value="deny">Deny</button>
+<button type="submit" name="decision" value="allow">Allow</button>
+</form>
+</body>
+</html>`))
+)
+
+// authorizeRequest is the authorization request of the client for the user
+// in sub. It's signed into the consent form so it can't be tampered with, as
+// a consent ticket so no other token we sign can pass for it
+type authorizeRequest struct {
+	jwt.RegisteredClaims
+	TokenType           string `json:"typ"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state,omitempty"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// Authorize is the OAuth2 authorization endpoint for the authorization code
+// grant with PKCE. The user is asked for consent unless they already granted
+// the client the scopes
+func Authorize(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, err := auth.GetUser(c)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, err)
+			return
+		}
+		if _, err := auth.GetServicePrincipal(c); err == nil {
+			abortWithError(c, http.StatusForbidden, errors.New("clients can't authorize other clients"))
+			return
+		}
+		// Until the redirect uri is known good the errors can't be redirected
+		client, err := orm.FindOAuthClient(c.Query("client_id"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, errors.New("unknown client_id"))
+			return
+		}
+		req := &authorizeRequest{
+			ClientID:            client.ClientID,
+			RedirectURI:         c.Query("redirect_uri"),
+			State:               c.Query("state"),
+			CodeChallenge:       c.Query("code_challenge"),
+			CodeChallengeMethod: c.Query("code_challenge_method"),
+		}
+		if uris := client.RedirectURIList(); req.RedirectURI == "" && len(uris) == 1 {
+			req.RedirectURI = uris[0]
+		}
+		if !client.HasRedirectURI(req.RedirectURI) {
+			abortWithError(c, http.StatusBadRequest, auth.ErrInvalidRedirectURI)
+			return
+		}
+
+		if c.Query("response_type") != "code" {
+			authorizeError(c, req, "unsupported_response_type", "response_type must be code")
+			return
+		}
+		if !client.HasGrantType(consts.GrantTypes.AuthorizationCode) {
+			authorizeError(c, req, oauthUnauthorizedClient, "client is not allowed the authorization code grant")
+			return
+		}
+		if req.CodeChallenge == "" || req.CodeChallengeMethod != auth.PKCEMethodS256 {
+			authorizeError(c, req, oauthInvalidRequest, "PKCE with the S256 code_challenge_method is required")
+			return
+		}
+		scopes, err := auth.DelegatedScopes(u, client, c.Query("scope"))
+		if err != nil {
+			authorizeError(c, req, oauthInvalidScope, err.Error())
+			return
+		}
+		req.Scope = strings.Join(scopes, " ")
+
+		if c.Query("prompt") != "consent" {
+			if g, err := orm.FindOAuthGrant(u.ID, client.ClientID); err == nil && g.HasScopes(scopes) {
+				issueAuthorizationCode(c, orm, u, req)
+				return
+			}
+		}
+		renderConsent(c, sc, u, client, req)
+	}
+}
+
+// AuthorizeConsent records the decision of the user on the consent form and
+// redirects back to the client
+func AuthorizeConsent(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, err := auth.GetUser(c)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, err)
+			return
+		}
+		req := &authorizeRequest{}
+		if err := parseSignedClaims(sc, c.PostForm("ticket"), req); err != nil ||
+			req.TokenType != auth.ConsentTicketType || req.Subject != u.ID.String() {
+			abortWithError(c, http.StatusBadRequest, ErrInvalidConsentTicket)
+			return
+		}
+		if c.PostForm("decision") != "allow" {
+			authorizeError(c, req, "access_denied", "the user denied the request")
+			return
+		}
+		if _, err := orm.WithContext(c.Request.Context()).GrantOAuthScopes(u.ID, req.ClientID, strings.Fields(req.Scope)); err != nil {
+			c.Error(err)
+			authorizeError(c, req, oauthServerError, "the consent couldn't be saved")
+			return
+		}
+		logger.Info("[OAuth.AuthorizeConsent] user: %s granted client: %s", u.ID, req.ClientID)
+		issueAuthorizationCode(c, orm, u, req)
+	}
+}
+
+// renderConsent shows the consent form, the request goes along signed
+func renderConsent(c *gin.Context, sc *cfg.Server, u *models.User, client *models.OAuthClient, req *authorizeRequest) {
+	now := time.Now().UTC()
+	req.TokenType = auth.ConsentTicketType
+	req.Subject = u.ID.String()
+	req.IssuedAt = jwt.NewNumericDate(now)
+	req.ExpiresAt = jwt.NewNumericDate(now.Add(consentTicketTTL))
+	ticket, err := auth.SignClaims(sc, req)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := consentTmpl.Execute(c.Writer, gin.H{
+		"Client": client.Name,
+		"Scopes": strings.Fields(req.Scope),
+		"Ticket": ticket,
+		"Action": c.Request.URL.Path,
+	}); err != nil {
+		c.Error(err)
+	}
+}
+
+// issueAuthorizationCode redirects back to the client with a new code
+func issueAuthorizationCode(c *gin.Context, orm *orm.ORM, u *models.User, req *authorizeRequest) {
+	code, err := orm.CreateOAuthAuthorizationCode(&models.OAuthAuthorizationCode{
+		ClientID:            req.ClientID,
+		UserID:              u.ID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		c.Error(err)
+		authorizeError(c, req, oauthServerError, "the code couldn't be issued")
+		return
+	}
+	authorizeRedirect(c, req, url.Values{"code": {code}})
+}
+
+// authorizeError redirects back to the client with a RFC 6749 error
+func authorizeError(c *gin.Context, req *authorizeRequest, code string, desc string) {
+	authorizeRedirect(c, req, url.Values{"error": {code}, "error_description": {desc}})
+}
+
+// authorizeRedirect redirects to the redirect uri of the request with the
+// values and state added to its query
+func authorizeRedirect(c *gin.Context, req *authorizeRequest, values url.Values) {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, auth.ErrInvalidRedirectURI)
+		return
+	}
+	q := u.Query()
+	for k, v := range values {
+		q[k] = v
+	}
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	u.RawQuery = q.Encode()
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, u.String())
+	c.Abort()
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+var (
+	providerErrCode = regexp.MustCompile(`^[a-z_]{1,64}$`)
+
+	postMessageTmpl = template.Must(template.New("post_message").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Signing in</title></head>
+<body>
+<script>
+(function () {
+	var payload = {{.Payload}};
+	if (window.opener) {
+		window.opener.postMessage(payload, {{.Origin}});
+	}
+	window.close();
+})();
+</script>
+</body>
+</html>`))
+)
+
+// callbackResponse hands the result of the OAuth callback over to the client
+// with the response mode of the provider, or the one asked for on the request
+type callbackResponse struct {
+	sc          *cfg.Server
+	mode        string
+	redirectURI string
+}
+
+// newCallbackResponse resolves the response mode and redirect uri, falling
+// back to json when there is nowhere to redirect to
+func newCallbackResponse(sc *cfg.Server, provider string, intent *authIntent) *callbackResponse {
+	r := &callbackResponse{
+		sc:          sc,
+		mode:        intent.ResponseMode,
+		redirectURI: intent.RedirectURI,
+	}
+	if p := sc.AuthProvider(provider); r.mode == "" && p != nil {
+		r.mode = p.ResponseMode
+	}
+	if r.redirectURI == "" {
+		r.redirectURI = sc.Auth.DefaultRedirectURI
+	}
+	if r.mode == "" || r.redirectURI == "" {
+		r.mode = consts.ResponseModes.JSON
+	}
+	return r
+}
+
+// tokens responds with the issued token pair
+func (r *callbackResponse) tokens(c *gin.Context, pair *auth.TokenPair) {
+	switch r.mode {
+	case consts.ResponseModes.Fragment:
+		r.redirect(c, tokenValues(pair))
+	case consts.ResponseModes.Cookie:
+		r.setTokenCookies(c, pair)
+		r.redirect(c, nil)
+	case consts.ResponseModes.PostMessage:
+		r.postMessage(c, tokenValues(pair))
+	default:
+		c.JSON(http.StatusOK, pair)
+	}
+}
+
+// values responds with the given values, json mode answers with the body
+func (r *callbackResponse) values(c *gin.Context, body any, v url.Values) {
+	switch r.mode {
+	case consts.ResponseModes.Fragment, consts.ResponseModes.Cookie:
+		r.redirect(c, v)
+	case consts.ResponseModes.PostMessage:
+		r.postMessage(c, v)
+	default:
+		c.JSON(http.StatusOK, body)
+	}
+}
+
+// error responds with the error code, the error details are only logged when
+// redirecting so they don't leak into the frontend
+func (r *callbackResponse) error(c *gin.Context, status int, code string, err error) {
+	logger.Warn("[Auth.Callback] %s: %s", code, err.Error())
+	c.Error(err)
+	v := url.Values{"error": {code}}
+	switch r.mode {
+	case consts.ResponseModes.Fragment, consts.ResponseModes.Cookie:
+		r.redirect(c, v)
+	case consts.ResponseModes.PostMessage:
+		r.postMessage(c, v)
+	default:
+		c.AbortWithStatusJSON(status, gin.H{"error": code, "message": err.Error()})
+	}
+}
+
+// redirect sends the browser to the redirect uri with the values in the
+// fragment, so they never reach any server logs
+func (r *callbackResponse) redirect(c *gin.Context, v url.Values) {
+	location := r.redirectURI
+	if len(v) > 0 {
+		location += "#" + v.Encode()
+	}
+	c.Redirect(http.StatusFound, location)
+}
+
+// postMessage renders a page handing the values to the window that opened the
+// popup, only the redirect uri origin can receive them
+func (r *callbackResponse) postMessage(c *gin.Context, v url.Values) {
+	payload := map[string]string{}
+	for k := range v {
+		payload[k] = v.Get(k)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	err := postMessageTmpl.Execute(c.Writer, gin.H{
+		"Payload": payload,
+		"Origin":  auth.RedirectOrigin(r.redirectURI),
+	})
+	if err != nil {
+		logger.Error(&err, "[Auth.Callback.PostMessage] error: %s", err.Error())
+	}
+}
+
+// setTokenCookies stores the token pair in HttpOnly cookies, the refresh
+// token is only sent to the refresh endpoint
+func (r *callbackResponse) setTokenCookies(c *gin.Context, pair *auth.TokenPair) {
+	secure := strings.HasPrefix(r.sc.URISchema, "https")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(auth.TokenCookie, pair.Token,
+		int(time.Until(pair.ExpiresAt).Seconds()), "/", "", secure, true)
+	c.SetCookie(auth.RefreshTokenCookie, pair.RefreshToken,
+		int(r.sc.JWT.RefreshTokenTTL.Seconds()), r.sc.VersionedEndpoint("/auth/refresh"), "", secure, true)
+}
+
+// tokenValues flattens the token pair
+func tokenValues(pair *auth.TokenPair) url.Values {
+	return url.Values{
+		"type":          {pair.Type},
+		"token":         {pair.Token},
+		"refresh_token": {pair.RefreshToken},
+		"expires_at":    {pair.ExpiresAt.Format(time.RFC3339)},
+		"user_id":       {pair.UserID.String()},
+	}
+}
+
+// callbackErrorCode maps the callback errors to the codes given to the client
+func callbackErrorCode(err error) string {
+	switch {
+	case errors.Is(err, orm.ErrEmailAlreadyRegistered):
+		return "email_already_registered"
+	case errors.Is(err, orm.ErrProfileLinkedToOtherUser):
+		return "identity_already_linked"
+	case errors.Is(err, orm.ErrUserDeactivated):
+		return "user_deactivated"
+	}
+	return "server_error"
+}
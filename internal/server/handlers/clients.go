@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// oauthClientInput is the body to register an oauth client
+type oauthClientInput struct {
+	Name         string   `json:"name" binding:"required"`
+	Public       bool     `json:"public"`
+	GrantTypes   []string `json:"grant_types"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+}
+
+// oauthClientOutput is an oauth client as we show it, the secret is only
+// set when the client is created
+type oauthClientOutput struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Name         string   `json:"name"`
+	Public       bool     `json:"public"`
+	GrantTypes   []string `json:"grant_types"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+}
+
+func newOAuthClientOutput(c *models.OAuthClient) *oauthClientOutput {
+	return &oauthClientOutput{
+		ClientID:     c.ClientID,
+		Name:         c.Name,
+		Public:       c.Public,
+		GrantTypes:   c.GrantTypeList(),
+		RedirectURIs: c.RedirectURIList(),
+		Scopes:       c.ScopeTags(),
+	}
+}
+
+// CreateOAuthClient registers a service or partner app client, the secret of
+// confidential clients is only ever returned in this response
+func CreateOAuthClient(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		in := &oauthClientInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		if len(in.GrantTypes) == 0 && in.Public {
+			in.GrantTypes = []string{consts.GrantTypes.AuthorizationCode, consts.GrantTypes.RefreshToken}
+		} else if len(in.GrantTypes) == 0 {
+			in.GrantTypes = []string{consts.GrantTypes.ClientCredentials}
+		}
+		client := &models.OAuthClient{
+			Name:         in.Name,
+			Public:       in.Public,
+			GrantTypes:   strings.Join(in.GrantTypes, " "),
+			RedirectURIs: strings.Join(in.RedirectURIs, " "),
+		}
+		secret, err := orm.WithContext(c.Request.Context()).CreateOAuthClient(client, in.Scopes)
+		if err != nil {
+			abortWithError(c, oauthClientErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.CreateOAuthClient] client registered: %s", client.ClientID)
+		out := newOAuthClientOutput(client)
+		out.ClientSecret = secret
+		c.JSON(http.StatusCreated, out)
+	}
+}
+
+// OAuthClients lists the registered clients
+func OAuthClients(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clients, err := orm.ListOAuthClients()
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		out := make([]*oauthClientOutput, 0, len(clients))
+		for i := range clients {
+			out = append(out, newOAuthClientOutput(&clients[i]))
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// DeleteOAuthClient removes a client, its tokens stop working
+func DeleteOAuthClient(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("clientId")
+		if err := orm.WithContext(c.Request.Context()).DeleteOAuthClient(id); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.DeleteOAuthClient] client removed: %s", id)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// oauthClientErrorStatus maps the client registration errors of the orm
+func oauthClientErrorStatus(err error) int {
+	if errors.Is(err, orm.ErrUnknownScope) || errors.Is(err, orm.ErrInvalidGrantType) ||
+		errors.Is(err, orm.ErrInvalidRedirectURI) {
+		return http.StatusBadRequest
+	}
+	return ormErrorStatus(err)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+)
+
+// errPreconditionFailed when the If-Match header can't be a version we gave
+var errPreconditionFailed = errors.New("the If-Match header isn't the ETag of a version of the row")
+
+// etag is the entity tag of the version of a row
+func etag(version uint) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// setETag sets the ETag header of the version of the row answered
+func setETag(c *gin.Context, version uint) {
+	c.Header("ETag", etag(version))
+}
+
+// notModified sets the ETag header of the version of the row, and answers
+// with a 304 when the If-None-Match header has it
+func notModified(c *gin.Context, version uint) bool {
+	setETag(c, version)
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+	tag := etag(version)
+	for _, t := range strings.Split(header, ",") {
+		// the comparison is the weak one, RFC 7232 section 3.2
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			c.AbortWithStatus(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch returns the context of the writes of the request, made against the
+// version of its If-Match header when it has one. It answers with a 412 when
+// the header can't be a version, * included as it doesn't name one
+func ifMatch(c *gin.Context) (context.Context, bool) {
+	ctx := c.Request.Context()
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return ctx, true
+	}
+	// the comparison is the strong one, weak tags never match
+	version, err := strconv.ParseUint(strings.Trim(header, `"`), 10, 32)
+	if err != nil || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		abortWithError(c, http.StatusPreconditionFailed, errPreconditionFailed)
+		return nil, false
+	}
+	return orm.IfVersion(ctx, uint(version)), true
+}
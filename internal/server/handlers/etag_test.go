@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/migration"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+)
+
+// sqliteOrm is the orm on a migrated and seeded SQLite database of the test
+func sqliteOrm(t *testing.T) *orm.ORM {
+	o, err := orm.Init(&cfg.DB{
+		Dialect: consts.Dialects.SQLite,
+		DSN:     filepath.Join(t.TempDir(), "test.db") + "?_foreign_keys=on",
+	})
+	if err != nil {
+		t.Fatalf("orm.Init() error = %v", err)
+	}
+	if err := migration.ServiceAutoMigration(o.DB); err != nil {
+		t.Fatalf("migration.ServiceAutoMigration() error = %v", err)
+	}
+	return o
+}
+
+func TestIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name        string
+		header      string
+		wantOK      bool
+		wantVersion bool
+	}{
+		{name: "no header", header: "", wantOK: true},
+		{name: "version", header: `"3"`, wantOK: true, wantVersion: true},
+		{name: "any version", header: "*"},
+		{name: "weak tag", header: `W/"3"`},
+		{name: "unquoted", header: "3"},
+		{name: "not a version", header: `"abc"`},
+		{name: "many tags", header: `"3", "4"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPut, "/", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("If-Match", tt.header)
+			}
+			ctx, ok := ifMatch(c)
+			if ok != tt.wantOK {
+				t.Fatalf("ifMatch() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				if w.Code != http.StatusPreconditionFailed || !c.IsAborted() {
+					t.Errorf("ifMatch() status = %d, want %d", w.Code, http.StatusPreconditionFailed)
+				}
+				return
+			}
+			// the writes are made against a version with a context of their own
+			if got := ctx != c.Request.Context(); got != tt.wantVersion {
+				t.Errorf("ifMatch() made against a version = %v, want %v", got, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "no header", header: ""},
+		{name: "current version", header: `"2"`, want: true},
+		{name: "weak current version", header: `W/"2"`, want: true},
+		{name: "among others", header: `"1", "2"`, want: true},
+		{name: "any version", header: "*", want: true},
+		{name: "older version", header: `"1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("If-None-Match", tt.header)
+			}
+			if got := notModified(c, 2); got != tt.want {
+				t.Fatalf("notModified() = %v, want %v", got, tt.want)
+			}
+			if tt.want && w.Code != http.StatusNotModified {
+				t.Errorf("notModified() status = %d, want %d", w.Code, http.StatusNotModified)
+			}
+			if got := w.Header().Get("ETag"); got != `"2"` {
+				t.Errorf("notModified() ETag = %s, want %s", got, `"2"`)
+			}
+		})
+	}
+}
+
+func TestDeleteUser_ifMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	o := sqliteOrm(t)
+	u := &models.User{}
+	if err := o.DB.First(u, "email = ?", "user@test.com").Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.DELETE("/users/:id", DeleteUser(o))
+	for _, tt := range []struct {
+		name     string
+		header   string
+		wantCode int
+	}{
+		{name: "stale version", header: etag(u.Version + 1), wantCode: http.StatusPreconditionFailed},
+		{name: "any version", header: "*", wantCode: http.StatusPreconditionFailed},
+		{name: "current version", header: etag(u.Version), wantCode: http.StatusNoContent},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodDelete, "/users/"+u.ID.String(), nil)
+			req.Header.Set("If-Match", tt.header)
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("DELETE /users/:id code = %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+			got := &models.User{}
+			if err := o.DB.First(got, "id = ?", u.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if deactivated := got.DeletedAt != nil; deactivated != (tt.wantCode == http.StatusNoContent) {
+				t.Errorf("DELETE /users/:id deactivated = %v, want %v", deactivated, !deactivated)
+			}
+		})
+	}
+}
+
+func TestDeleteRole_ifMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	o := sqliteOrm(t)
+	role := &models.Role{Name: "auditor"}
+	if err := o.CreateRole(role); err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.DELETE("/roles/:id", DeleteRole(o))
+	for _, tt := range []struct {
+		name     string
+		header   string
+		wantCode int
+	}{
+		{name: "stale version", header: etag(role.Version + 1), wantCode: http.StatusPreconditionFailed},
+		{name: "weak current version", header: "W/" + etag(role.Version), wantCode: http.StatusPreconditionFailed},
+		{name: "current version", header: etag(role.Version), wantCode: http.StatusNoContent},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodDelete, "/roles/"+strconv.FormatUint(uint64(role.ID), 10), nil)
+			req.Header.Set("If-Match", tt.header)
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("DELETE /roles/:id code = %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+			_, err := o.FindRole(role.ID)
+			if deleted := err != nil; deleted != (tt.wantCode == http.StatusNoContent) {
+				t.Errorf("DELETE /roles/:id deleted = %v, err %v", deleted, err)
+			}
+		})
+	}
+}
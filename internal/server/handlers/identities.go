@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/gothic"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// Identities lists the OAuth profiles linked to the authenticated user
+func Identities(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, err := auth.GetUser(c)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, err)
+			return
+		}
+		ups, err := orm.FindUserProfiles(u.ID)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"identities": ups})
+	}
+}
+
+// LinkIdentity begins the auth provider flow to link a new profile to the
+// authenticated user, the callback finishes the link
+func LinkIdentity(sc *cfg.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, err := auth.GetUser(c)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, err)
+			return
+		}
+		intent, err := newAuthIntent(c, sc)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		intent.LinkUserID = u.ID.String()
+		if err := setAuthIntent(c, sc, intent); err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Request = addProviderToContext(c, c.Param(string(consts.ProjectContextKeys.ProviderCtxKey)))
+		gothic.BeginAuthHandler(c.Writer, c.Request)
+	}
+}
+
+// UnlinkIdentity removes an OAuth profile from the authenticated user
+func UnlinkIdentity(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, err := auth.GetUser(c)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, err)
+			return
+		}
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, errors.New("invalid identity id"))
+			return
+		}
+		if err := orm.WithContext(c.Request.Context()).UnlinkUserProfile(u.ID, uint(id)); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// linkCallback completes the link of the provider profile started by
+// LinkIdentity
+func linkCallback(c *gin.Context, orm *orm.ORM, intent *authIntent, res *callbackResponse, gu *goth.User) {
+	userID, err := uuid.FromString(intent.LinkUserID)
+	if err != nil {
+		res.error(c, http.StatusBadRequest, "invalid_request", err)
+		return
+	}
+	up, err := orm.LinkUserProfile(userID, gu)
+	if err != nil {
+		logger.Error(&err, "[Auth.Callback.Link] error: %s", err.Error())
+		res.error(c, ormErrorStatus(err), callbackErrorCode(err), err)
+		return
+	}
+	logger.Info("[Auth.Callback.Link] %s profile linked to user: %s", gu.Provider, userID)
+	res.values(c, up, url.Values{
+		"linked":      {up.Provider},
+		"identity_id": {strconv.FormatUint(uint64(up.ID), 10)},
+	})
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// impersonationToken is the token for an admin to act as a user
+type impersonationToken struct {
+	Type           string    `json:"type"`
+	Token          string    `json:"token"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	UserID         uuid.UUID `json:"user_id"`
+	ImpersonatorID uuid.UUID `json:"impersonator_id"`
+}
+
+// Impersonate issues a short lived token for the authenticated admin to act
+// as the user, admins that can impersonate can't be impersonated themselves
+// and neither can users with a permission the admin doesn't have
+func Impersonate(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admin, err := auth.GetUser(c)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, err)
+			return
+		}
+		if _, err := auth.GetImpersonator(c); err == nil {
+			abortWithError(c, http.StatusForbidden, errors.New("can't impersonate while impersonating"))
+			return
+		}
+		id, err := uuid.FromString(c.Param("userId"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, errors.New("invalid user id"))
+			return
+		}
+		u, err := orm.FindUserByID(id)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		if err := auth.CanImpersonate(admin, u); err != nil {
+			abortWithError(c, http.StatusForbidden, err)
+			return
+		}
+		token, claims, err := auth.IssueImpersonationToken(sc, admin, u)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		entry := &models.ImpersonationLog{
+			TokenID:        claims.ID,
+			ImpersonatorID: admin.ID,
+			UserID:         u.ID,
+			Method:         c.Request.Method,
+			Path:           c.Request.URL.Path,
+			Status:         http.StatusCreated,
+			ClientIP:       c.ClientIP(),
+		}
+		if err := orm.CreateImpersonationLog(entry); err != nil {
+			// no impersonation without its audit trail
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		logger.Info("[Admin.Impersonate] user: %s impersonated by: %s", u.ID, admin.ID)
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusCreated, &impersonationToken{
+			Type:           auth.TokenHeadName,
+			Token:          token,
+			ExpiresAt:      claims.ExpiresAt.Time,
+			UserID:         u.ID,
+			ImpersonatorID: admin.ID,
+		})
+	}
+}
+
+// Impersonations lists the impersonation audit log, newest first, filtered
+// by the `user_id` and `impersonator_id` query params
+func Impersonations(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := optionalUUID(c.Query("user_id"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, errors.New("invalid user_id"))
+			return
+		}
+		adminID, err := optionalUUID(c.Query("impersonator_id"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, errors.New("invalid impersonator_id"))
+			return
+		}
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		ls, err := orm.ListImpersonationLogs(userID, adminID, limit)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"impersonations": ls})
+	}
+}
+
+// optionalUUID parses the uuid, an empty one is uuid.Nil
+func optionalUUID(s string) (uuid.UUID, error) {
+	if s == "" {
+		return uuid.Nil, nil
+	}
+	return uuid.FromString(s)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+)
+
+const (
+	authIntentCookie = "gg-auth-intent"
+	samlIntentCookie = "gg-auth-saml-intent"
+	authIntentTTL    = 10 * time.Minute
+)
+
+// authIntent carries what the user meant to do when the OAuth flow started,
+// across the provider redirect. It's signed so it can't be forged
+type authIntent struct {
+	jwt.RegisteredClaims
+	LinkUserID   string `json:"link_user_id,omitempty"`
+	ResponseMode string `json:"response_mode,omitempty"`
+	RedirectURI  string `json:"redirect_uri,omitempty"`
+	// SAMLRequestID is the id of the request the SAML response must answer
+	SAMLRequestID string `json:"saml_request_id,omitempty"`
+}
+
+// newAuthIntent reads the response mode and redirect uri the client asked
+// for, the redirect uri must be in the allowlist
+func newAuthIntent(c *gin.Context, sc *cfg.Server) (*authIntent, error) {
+	intent := &authIntent{
+		ResponseMode: c.Query("response_mode"),
+		RedirectURI:  c.Query("redirect_uri"),
+	}
+	if intent.ResponseMode != "" && !consts.IsResponseMode(intent.ResponseMode) {
+		return nil, fmt.Errorf("response_mode [%s] is not supported", intent.ResponseMode)
+	}
+	if intent.RedirectURI != "" && !auth.ValidRedirectURI(sc.Auth.RedirectAllowlist, intent.RedirectURI) {
+		return nil, auth.ErrInvalidRedirectURI
+	}
+	return intent, nil
+}
+
+// setAuthIntent stores the signed intent in a short lived cookie
+func setAuthIntent(c *gin.Context, sc *cfg.Server, intent *authIntent) error {
+	return setIntentCookie(c, sc, authIntentCookie, http.SameSiteLaxMode, intent)
+}
+
+// popAuthIntent reads and clears the intent cookie, an empty intent is
+// returned when there is none or it isn't valid
+func popAuthIntent(c *gin.Context, sc *cfg.Server) *authIntent {
+	return popIntentCookie(c, sc, authIntentCookie)
+}
+
+// setSAMLIntent stores the signed intent in a cookie sent along the cross-site
+// POST of the identity provider, browsers only allow it over https
+func setSAMLIntent(c *gin.Context, sc *cfg.Server, intent *authIntent) error {
+	sameSite := http.SameSiteLaxMode
+	if strings.HasPrefix(sc.URISchema, "https") {
+		sameSite = http.SameSiteNoneMode
+	}
+	return setIntentCookie(c, sc, samlIntentCookie, sameSite, intent)
+}
+
+// popSAMLIntent reads and clears the SAML intent cookie
+func popSAMLIntent(c *gin.Context, sc *cfg.Server) *authIntent {
+	return popIntentCookie(c, sc, samlIntentCookie)
+}
+
+// setIntentCookie signs the intent into the cookie
+func setIntentCookie(c *gin.Context, sc *cfg.Server, name string, sameSite http.SameSite, intent *authIntent) error {
+	now := time.Now().UTC()
+	intent.IssuedAt = jwt.NewNumericDate(now)
+	intent.ExpiresAt = jwt.NewNumericDate(now.Add(authIntentTTL))
+	token, err := jwt.NewWithClaims(jwt.GetSigningMethod(sc.JWT.Algorithm), intent).
+		SignedString([]byte(sc.JWT.Secret))
+	if err != nil {
+		return err
+	}
+	c.SetSameSite(sameSite)
+	c.SetCookie(name, token, int(authIntentTTL.Seconds()), "/", "",
+		strings.HasPrefix(sc.URISchema, "https"), true)
+	return nil
+}
+
+// popIntentCookie reads and clears the cookie, an empty intent is returned
+// when there is none or it isn't valid
+func popIntentCookie(c *gin.Context, sc *cfg.Server, name string) *authIntent {
+	intent := &authIntent{}
+	raw, err := c.Cookie(name)
+	if err != nil || raw == "" {
+		return intent
+	}
+	c.SetCookie(name, "", -1, "/", "", strings.HasPrefix(sc.URISchema, "https"), true)
+	if err := parseSignedClaims(sc, raw, intent); err != nil {
+		return &authIntent{}
+	}
+	return intent
+}
+
+// parseSignedClaims validates a token we signed for ourselves into the claims
+func parseSignedClaims(sc *cfg.Server, raw string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		if jwt.GetSigningMethod(sc.JWT.Algorithm) != t.Method {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(sc.JWT.Secret), nil
+	})
+	return err
+}
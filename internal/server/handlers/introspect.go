@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+	"github.com/rakin92/go-rest-service/pkg/storage/cache"
+)
+
+// userInfo are the claims about the authenticated user, OpenID Connect Core
+// section 5.3.2, along with its roles and effective permissions
+type userInfo struct {
+	Subject     string   `json:"sub"`
+	Email       string   `json:"email"`
+	GivenName   *string  `json:"given_name,omitempty"`
+	FamilyName  *string  `json:"family_name,omitempty"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// Introspect is the RFC 7662 token introspection endpoint, only registered
+// service clients authenticating with their secret may ask about a token.
+// Guessing keys locks the ip out like on the authenticated routes
+func Introspect(sc *cfg.Server, orm *orm.ORM, che *cache.Cache) gin.HandlerFunc {
+	var lk *auth.Lockout
+	if che != nil {
+		lk = auth.NewLockout(che, &sc.Auth.Lockout)
+	}
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if retry, err := lk.Check(ctx, auth.IPKey(c.ClientIP())); err != nil {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			abortWithError(c, http.StatusTooManyRequests, err)
+			return
+		}
+		client, ok := authenticateTokenClient(c, orm, false)
+		if !ok {
+			return
+		}
+		if !client.HasGrantType(consts.GrantTypes.ClientCredentials) {
+			oauthError(c, http.StatusForbidden, oauthUnauthorizedClient,
+				errors.New("only service clients can introspect tokens"))
+			return
+		}
+		token := c.PostForm("token")
+		if token == "" {
+			oauthError(c, http.StatusBadRequest, oauthInvalidRequest, errors.New("token is required"))
+			return
+		}
+		in := auth.Introspect(ctx, sc, orm, lk, c.ClientIP(), token)
+		logger.Debug("[OAuth.Introspect] client: %s active: %t", client.ClientID, in.Active)
+		oauthTokenResponse(c, in)
+	}
+}
+
+// UserInfo answers who the authenticated user is, to the user or the apps
+// acting on its behalf
+func UserInfo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, err := auth.GetUser(c)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, err)
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, &userInfo{
+			Subject:     u.ID.String(),
+			Email:       u.Email,
+			GivenName:   u.FirstName,
+			FamilyName:  u.LastName,
+			Roles:       u.RoleNames(),
+			Permissions: u.PermissionTags(),
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+	"github.com/rakin92/go-rest-service/pkg/storage/cache"
+)
+
+// ldapLoginRequest are the directory credentials of the user
+type ldapLoginRequest struct {
+	Username string `json:"username" form:"username" binding:"required"`
+	Password string `json:"password" form:"password" binding:"required"`
+}
+
+// LDAPLogin binds to the directory with the user credentials and issues our
+// token pair, the roles its groups map to are synced on every login. Failed
+// attempts are counted per `ldap:<username>` account and IP
+func LDAPLogin(sc *cfg.Server, orm *orm.ORM, che *cache.Cache, p *auth.LDAPProvider) gin.HandlerFunc {
+	var lk *auth.Lockout
+	if che != nil {
+		lk = auth.NewLockout(che, &sc.Auth.Lockout)
+	}
+	return func(c *gin.Context) {
+		req := &ldapLoginRequest{}
+		if err := c.ShouldBind(req); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		ctx := c.Request.Context()
+		accountKey := auth.AccountKey(auth.LDAPProviderName + ":" + strings.ToLower(req.Username))
+		ipKey := auth.IPKey(c.ClientIP())
+		if retry, err := lk.Check(ctx, accountKey, ipKey); err != nil {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			abortWithError(c, http.StatusTooManyRequests, err)
+			return
+		}
+		id, err := p.Authenticate(req.Username, req.Password)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidCredentials) {
+				if retry := lk.Fail(ctx, accountKey, ipKey); retry > 0 {
+					c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+					abortWithError(c, http.StatusTooManyRequests, auth.ErrLockedOut)
+					return
+				}
+				abortWithError(c, http.StatusUnauthorized, err)
+				return
+			}
+			logger.Error(&err, "[Auth.LDAPLogin.Authenticate] error: %s", err.Error())
+			abortWithError(c, http.StatusBadGateway, errors.New("directory is unavailable"))
+			return
+		}
+		lk.Reset(ctx, accountKey)
+
+		// the profile is refreshed with the directory attributes on every login
+		u, err := orm.UpsertUserProfile(&id.User, sc.Auth.MergeVerifiedEmails)
+		if err != nil {
+			logger.Error(&err, "[Auth.LDAPLogin.UpsertUserProfile] error: %s", err.Error())
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		if err := orm.SyncUserRoles(u.ID, p.ManagedRoles(), id.Roles); err != nil {
+			logger.Error(&err, "[Auth.LDAPLogin.SyncUserRoles] error: %s", err.Error())
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if u, err = orm.FindUserByID(u.ID); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		s, err := startSession(c, sc, orm, u, id.Provider)
+		if err != nil {
+			logger.Error(&err, "[Auth.LDAPLogin.Session] error: %s", err.Error())
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		pair, err := auth.IssueTokenPair(sc, u, id.Provider, id.UserID, s.ID)
+		if err != nil {
+			logger.Error(&err, "[Auth.LDAPLogin.JWT] error: %s", err.Error())
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, pair)
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+	"github.com/rakin92/go-rest-service/pkg/storage/cache"
+)
+
+// Unlock lifts the lockout of an `account` (email, username or api key)
+// and/or an `ip` given as query params
+func Unlock(sc *cfg.Server, che *cache.Cache) gin.HandlerFunc {
+	var lk *auth.Lockout
+	if che != nil {
+		lk = auth.NewLockout(che, &sc.Auth.Lockout)
+	}
+	return func(c *gin.Context) {
+		keys := []string{}
+		if account := c.Query("account"); account != "" {
+			// api keys are locked out by their prefix too
+			keys = append(keys, auth.AccountKey(account), auth.KeyPrefixKey(account))
+		}
+		if ip := c.Query("ip"); ip != "" {
+			keys = append(keys, auth.IPKey(ip))
+		}
+		if len(keys) == 0 {
+			abortWithError(c, http.StatusBadRequest, errors.New("account or ip is required"))
+			return
+		}
+		for _, k := range keys {
+			if err := lk.Unlock(c.Request.Context(), k); err != nil {
+				abortWithError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		if u, err := auth.GetUser(c); err == nil {
+			logger.Info("[Admin.Unlock] lockouts lifted by user: %s", u.ID)
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
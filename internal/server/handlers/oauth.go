@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// OAuth2 error codes, RFC 6749 section 5.2
+const (
+	oauthInvalidRequest       = "invalid_request"
+	oauthInvalidClient        = "invalid_client"
+	oauthInvalidGrant         = "invalid_grant"
+	oauthInvalidScope         = "invalid_scope"
+	oauthUnauthorizedClient   = "unauthorized_client"
+	oauthUnsupportedGrantType = "unsupported_grant_type"
+	oauthServerError          = "server_error"
+)
+
+// oauthError answers with a RFC 6749 error body
+func oauthError(c *gin.Context, status int, code string, err error) {
+	c.Error(err)
+	if status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.AbortWithStatusJSON(status, gin.H{"error": code, "error_description": err.Error()})
+}
+
+// oauthClientCredentials reads the client credentials from the basic auth
+// header or, failing that, from the form
+func oauthClientCredentials(c *gin.Context) (string, string) {
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		return id, secret
+	}
+	return c.PostForm("client_id"), c.PostForm("client_secret")
+}
+
+// Token is the OAuth2 token endpoint, it implements the client credentials
+// grant for service clients and the authorization code and refresh token
+// grants for the apps acting on behalf of our users
+func Token(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		grantType := c.PostForm("grant_type")
+		if grantType == "" {
+			oauthError(c, http.StatusBadRequest, oauthInvalidRequest, errors.New("grant_type is required"))
+			return
+		}
+		if !consts.IsGrantType(grantType) {
+			oauthError(c, http.StatusBadRequest, oauthUnsupportedGrantType,
+				errors.New("grant type ["+grantType+"] is not supported"))
+			return
+		}
+		client, ok := authenticateTokenClient(c, orm, grantType != consts.GrantTypes.ClientCredentials)
+		if !ok {
+			return
+		}
+		if !client.HasGrantType(grantType) {
+			oauthError(c, http.StatusBadRequest, oauthUnauthorizedClient,
+				errors.New("client is not allowed the grant type ["+grantType+"]"))
+			return
+		}
+		switch grantType {
+		case consts.GrantTypes.ClientCredentials:
+			clientCredentialsGrant(c, sc, client)
+		case consts.GrantTypes.AuthorizationCode:
+			authorizationCodeGrant(c, sc, orm, client)
+		case consts.GrantTypes.RefreshToken:
+			refreshTokenGrant(c, sc, orm, client)
+		}
+	}
+}
+
+// authenticateTokenClient authenticates the client with its secret, public
+// clients are only identified by their client_id when [allowPublic]
+func authenticateTokenClient(c *gin.Context, orm *orm.ORM, allowPublic bool) (*models.OAuthClient, bool) {
+	id, secret := oauthClientCredentials(c)
+	if id == "" {
+		oauthError(c, http.StatusUnauthorized, oauthInvalidClient, errors.New("client authentication is required"))
+		return nil, false
+	}
+	if secret != "" {
+		client, err := orm.AuthenticateOAuthClient(id, secret)
+		if err != nil {
+			oauthClientError(c, err)
+			return nil, false
+		}
+		return client, true
+	}
+	client, err := orm.FindOAuthClient(id)
+	if err != nil || !allowPublic || !client.Public {
+		oauthError(c, http.StatusUnauthorized, oauthInvalidClient, errors.New("client authentication is required"))
+		return nil, false
+	}
+	return client, true
+}
+
+// clientCredentialsGrant issues a token for the service client itself
+func clientCredentialsGrant(c *gin.Context, sc *cfg.Server, client *models.OAuthClient) {
+	scopes, err := auth.GrantScopes(client, c.PostForm("scope"))
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, oauthInvalidScope, err)
+		return
+	}
+	token, exp, err := auth.IssueClientToken(sc, client, scopes)
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, oauthServerError, err)
+		return
+	}
+	logger.Info("[OAuth.Token] token issued to client: %s", client.ClientID)
+	oauthTokenResponse(c, gin.H{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(time.Until(exp).Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// authorizationCodeGrant exchanges the code, along with its PKCE verifier,
+// for a delegated access token and refresh token
+func authorizationCodeGrant(c *gin.Context, sc *cfg.Server, orm *orm.ORM, client *models.OAuthClient) {
+	code, err := orm.ConsumeOAuthAuthorizationCode(c.PostForm("code"))
+	if err != nil {
+		oauthGrantError(c, err)
+		return
+	}
+	if code.ClientID != client.ClientID || code.RedirectURI != c.PostForm("redirect_uri") ||
+		!auth.VerifyPKCE(c.PostForm("code_verifier"), code.CodeChallenge, code.CodeChallengeMethod) {
+		invalidGrantError(c)
+		return
+	}
+	grant, err := orm.FindOAuthGrant(code.UserID, client.ClientID)
+	if err != nil {
+		invalidGrantError(c)
+		return
+	}
+	delegatedTokens(c, sc, orm, grant, strings.Fields(code.Scope), "")
+}
+
+// refreshTokenGrant rotates the refresh token for a new delegated access
+// token, optionally narrowed to fewer scopes
+func refreshTokenGrant(c *gin.Context, sc *cfg.Server, orm *orm.ORM, client *models.OAuthClient) {
+	rt, next, err := orm.RotateOAuthRefreshToken(c.PostForm("refresh_token"), client.ClientID, sc.JWT.RefreshTokenTTL)
+	if err != nil {
+		oauthGrantError(c, err)
+		return
+	}
+	scopes := strings.Fields(rt.Scope)
+	if requested := c.PostForm("scope"); requested != "" {
+		g := &models.OAuthGrant{Scope: rt.Scope}
+		if scopes = strings.Fields(requested); !g.HasScopes(scopes) {
+			oauthError(c, http.StatusBadRequest, oauthInvalidScope, auth.ErrInvalidScope)
+			return
+		}
+	}
+	delegatedTokens(c, sc, orm, rt.Grant, scopes, next)
+}
+
+// delegatedTokens responds with a delegated access token for the grant and a
+// refresh token, a new one is issued when [refreshToken] is empty
+func delegatedTokens(c *gin.Context, sc *cfg.Server, orm *orm.ORM, grant *models.OAuthGrant, scopes []string, refreshToken string) {
+	token, exp, err := auth.IssueDelegatedToken(sc, grant, scopes)
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, oauthServerError, err)
+		return
+	}
+	if refreshToken == "" {
+		refreshToken, err = orm.CreateOAuthRefreshToken(grant.ID, strings.Join(scopes, " "), sc.JWT.RefreshTokenTTL)
+		if err != nil {
+			oauthError(c, http.StatusInternalServerError, oauthServerError, err)
+			return
+		}
+	}
+	logger.Info("[OAuth.Token] token issued to client: %s for user: %s", grant.ClientID, grant.UserID)
+	oauthTokenResponse(c, gin.H{
+		"access_token":  token,
+		"token_type":    "Bearer",
+		"expires_in":    int(time.Until(exp).Seconds()),
+		"refresh_token": refreshToken,
+		"scope":         strings.Join(scopes, " "),
+	})
+}
+
+// oauthTokenResponse responds with the tokens, they must never be cached
+func oauthTokenResponse(c *gin.Context, body any) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, body)
+}
+
+// oauthClientError maps the client authentication errors of the orm
+func oauthClientError(c *gin.Context, err error) {
+	if errors.Is(err, orm.ErrInvalidClient) {
+		oauthError(c, http.StatusUnauthorized, oauthInvalidClient, err)
+		return
+	}
+	oauthError(c, http.StatusInternalServerError, oauthServerError, err)
+}
+
+// invalidGrantError answers the code or refresh token can't be used
+func invalidGrantError(c *gin.Context) {
+	oauthGrantError(c, orm.ErrInvalidGrant)
+}
+
+// oauthGrantError maps the code and refresh token errors of the orm
+func oauthGrantError(c *gin.Context, err error) {
+	if errors.Is(err, orm.ErrInvalidGrant) {
+		oauthError(c, http.StatusBadRequest, oauthInvalidGrant, err)
+		return
+	}
+	oauthError(c, http.StatusInternalServerError, oauthServerError, err)
+}
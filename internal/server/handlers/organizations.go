@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// organizationInput is the body to create an organization
+type organizationInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// invitationInput is the body to invite someone to an organization
+type invitationInput struct {
+	Email string   `json:"email" binding:"required,email"`
+	Roles []string `json:"roles"`
+}
+
+// invitationOutput is a new invitation along with the token to accept it,
+// it's only ever returned when the invitation is created
+type invitationOutput struct {
+	*models.Invitation
+	Token string `json:"token"`
+}
+
+// acceptInvitationInput is the body to accept an invitation
+type acceptInvitationInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// CreateOrganization creates an organization owned by the authenticated user
+func CreateOrganization(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := ownUser(c)
+		if !ok {
+			return
+		}
+		in := &organizationInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		org := &models.Organization{Name: in.Name}
+		if err := orm.WithContext(c.Request.Context()).CreateOrganization(org, u.ID); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Organizations.Create] organization: %s created by: %s", org.ID, u.ID)
+		c.JSON(http.StatusCreated, org)
+	}
+}
+
+// MyOrganizations lists the organizations the authenticated user is a member of
+func MyOrganizations(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := ownUser(c)
+		if !ok {
+			return
+		}
+		ms, err := orm.ListUserMemberships(u.ID)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"memberships": ms})
+	}
+}
+
+// Members lists the members of the active organization
+func Members(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, err := auth.GetMembership(c)
+		if err != nil {
+			abortWithError(c, http.StatusForbidden, err)
+			return
+		}
+		ms, err := orm.ListMembers(m.OrganizationID)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"members": ms})
+	}
+}
+
+// InviteMember invites an email to join the active organization
+func InviteMember(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, err := auth.GetMembership(c)
+		if err != nil {
+			abortWithError(c, http.StatusForbidden, err)
+			return
+		}
+		in := &invitationInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		inv, token, err := orm.WithContext(c.Request.Context()).
+			CreateInvitation(m.OrganizationID, in.Email, in.Roles, m.UserID)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Organizations.Invite] %s invited to: %s by: %s", inv.Email, m.OrganizationID, m.UserID)
+		c.JSON(http.StatusCreated, &invitationOutput{Invitation: inv, Token: token})
+	}
+}
+
+// RemoveMember removes a user from the active organization
+func RemoveMember(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, err := auth.GetMembership(c)
+		if err != nil {
+			abortWithError(c, http.StatusForbidden, err)
+			return
+		}
+		userID, err := uuid.FromString(c.Param("userId"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, errors.New("invalid user id"))
+			return
+		}
+		if err := orm.WithContext(c.Request.Context()).RemoveMember(m.OrganizationID, userID); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Organizations.RemoveMember] user: %s removed from: %s by: %s", userID, m.OrganizationID, m.UserID)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// MyInvitations lists the pending invitations for the email of the
+// authenticated user
+func MyInvitations(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := ownUser(c)
+		if !ok {
+			return
+		}
+		is, err := orm.ListInvitations(u.Email)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"invitations": is})
+	}
+}
+
+// AcceptInvitation makes the authenticated user a member of the organization
+// they were invited to, with the token of the invitation
+func AcceptInvitation(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := ownUser(c)
+		if !ok {
+			return
+		}
+		id, err := uuid.FromString(c.Param("id"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, errors.New("invalid invitation id"))
+			return
+		}
+		in := &acceptInvitationInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		m, err := orm.WithContext(c.Request.Context()).AcceptInvitation(id, in.Token, u)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Organizations.AcceptInvitation] user: %s joined: %s", u.ID, m.OrganizationID)
+		c.JSON(http.StatusCreated, m)
+	}
+}
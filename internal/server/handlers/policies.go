@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/policy"
+)
+
+// explainInput is the request to explain the decision of the policies on,
+// as the authenticated admin or as the user and organization given
+type explainInput struct {
+	SubjectID      *uuid.UUID      `json:"subject_id"`
+	OrganizationID *uuid.UUID      `json:"organization_id"`
+	Action         string          `json:"action" binding:"required"`
+	Resource       policy.Resource `json:"resource"`
+}
+
+// Policies lists the rules resources are authorized with
+func Policies() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"rules": auth.Policies().Rules()})
+	}
+}
+
+// ExplainPolicy is the dry run of the policies on a request, it answers with
+// the decision and the outcome of every rule applying to it
+func ExplainPolicy(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		in := &explainInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		if in.Resource.Type == "" {
+			abortWithError(c, http.StatusBadRequest, errors.New("resource type is required"))
+			return
+		}
+		r := in.Resource
+		var req *policy.Input
+		if in.SubjectID == nil {
+			var err error
+			if req, err = auth.PolicyInput(c, in.Action, r); err != nil {
+				abortWithError(c, http.StatusUnauthorized, err)
+				return
+			}
+		} else {
+			u, err := orm.FindUserByID(*in.SubjectID)
+			if err != nil {
+				abortWithError(c, ormErrorStatus(err), err)
+				return
+			}
+			var m *models.Membership
+			if in.OrganizationID != nil {
+				// not being a member is a valid case to explain
+				m, _ = orm.FindMembership(*in.OrganizationID, u.ID)
+			}
+			req = &policy.Input{Subject: auth.SubjectAttributes(u, m, nil), Action: in.Action, Resource: r}
+			if m != nil {
+				req.Tenant = m.OrganizationID.String()
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"input": req, "decision": auth.Policies().Explain(req)})
+	}
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/listing"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// Resource describes the model of T the generic REST endpoints are mounted
+// for, see routes.RegisterResource
+type Resource[T any] struct {
+	// Path is where the endpoints are mounted within the group, like /notes
+	Path string
+	// Entity is the entity the permission tags are derived from, one of
+	// consts.EntityNames, and the key the rows are listed under
+	Entity string
+	// Fields are the json names of the fields the clients may set, a body
+	// with any other field is refused
+	Fields []string
+	// Filters are the columns the rows can be filtered on, like
+	// ?filter[title][ilike]=%go%
+	Filters []string
+	// Sorts are the not nullable columns the rows can be sorted on besides
+	// created_at and id, like ?sort=-title
+	Sorts []string
+	// Validate checks the model before it's created or updated, it may also
+	// set the fields the clients can't. Its errors are bad requests
+	Validate func(c *gin.Context, m *T) error
+	// Scope narrows the queries of the request, like to the rows of the
+	// user. The tenant owned models are already scoped to the organization
+	Scope func(c *gin.Context, db *gorm.DB) *gorm.DB
+}
+
+// Key is the key the rows are listed under
+func (r *Resource[T]) Key() string {
+	return consts.GetTableName(r.Entity)
+}
+
+// listing is what the list of the rows can be filtered and sorted on
+func (r *Resource[T]) listing() *listing.Options {
+	o := &listing.Options{Filters: map[string]string{}, Sorts: map[string]string{}}
+	for _, c := range r.Filters {
+		o.Filters[c] = c
+	}
+	for _, c := range r.Sorts {
+		o.Sorts[c] = c
+	}
+	return o
+}
+
+// db is the db for the request, scoped by the resource
+func (r *Resource[T]) db(c *gin.Context, o *orm.ORM) *gorm.DB {
+	db := o.Tenant(c.Request.Context())
+	if r.Scope != nil {
+		db = r.Scope(c, db)
+	}
+	return db
+}
+
+// bind sets the fields of the body on the model, it returns the json names
+// of the fields that were set
+func (r *Resource[T]) bind(c *gin.Context, m *T) ([]string, error) {
+	raw, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	allowed := map[string]bool{}
+	for _, f := range r.Fields {
+		allowed[f] = true
+	}
+	fields := make([]string, 0, len(body))
+	for name := range body {
+		if !allowed[name] {
+			return nil, fmt.Errorf("field [%s] can't be set", name)
+		}
+		fields = append(fields, name)
+	}
+	if err := json.Unmarshal(raw, m); err != nil {
+		return nil, err
+	}
+	if r.Validate != nil {
+		if err := r.Validate(c, m); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// CheckFields verifies the allowed fields and the filtered and sorted
+// columns are ones of the model
+func (r *Resource[T]) CheckFields(o *orm.ORM) error {
+	if r.Entity == "" || r.Path == "" {
+		return errors.New("a resource needs a path and an entity")
+	}
+	if _, err := resourceColumns[T](o.DB, r.Fields); err != nil {
+		return err
+	}
+	columns := append(append([]string{listing.DefaultSort, listing.TieBreaker}, r.Filters...), r.Sorts...)
+	return resourceHasColumns[T](o.DB, columns)
+}
+
+// ListResource lists a page of the rows, filtered, sorted and paged by the
+// query params
+func ListResource[T any](orm *orm.ORM, r *Resource[T]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, ok := listQuery(c, r.listing())
+		if !ok {
+			return
+		}
+		page, err := listResources[T](r.db(c, orm), q)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		listPage(c, r.Key(), page.Rows, q, page.Total, page.Next)
+	}
+}
+
+// GetResource shows the row
+func GetResource[T any](orm *orm.ORM, r *Resource[T]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, err := findResource[T](r.db(c, orm), c.Param("id"))
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		if v, ok := any(m).(models.Versioned); ok && notModified(c, v.CurrentVersion()) {
+			return
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+// CreateResource creates the row with the allowed fields of the body
+func CreateResource[T any](orm *orm.ORM, r *Resource[T]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m := new(T)
+		if _, err := r.bind(c, m); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := createResource(r.db(c, orm), m); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Resource.Create] %s created", r.Key())
+		if v, ok := any(m).(models.Versioned); ok {
+			setETag(c, v.CurrentVersion())
+		}
+		c.JSON(http.StatusCreated, m)
+	}
+}
+
+// UpdateResource changes the row with the allowed fields of the body, the
+// missing ones are left as they are
+func UpdateResource[T any](orm *orm.ORM, r *Resource[T]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		c.Request = c.Request.WithContext(ctx)
+		db := r.db(c, orm)
+		m, err := findResource[T](db, c.Param("id"))
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		fields, err := r.bind(c, m)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		columns, err := resourceColumns[T](db, fields)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := updateResource(db, m, columns); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Resource.Update] %s updated: %s", r.Key(), c.Param("id"))
+		if v, ok := any(m).(models.Versioned); ok {
+			setETag(c, v.CurrentVersion())
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+// DeleteResource deletes the row, soft deleting the models that can be
+func DeleteResource[T any](orm *orm.ORM, r *Resource[T]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		c.Request = c.Request.WithContext(ctx)
+		db := r.db(c, orm)
+		m, err := findResource[T](db, c.Param("id"))
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		if err := deleteResource(db, m); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Resource.Delete] %s deleted: %s", r.Key(), c.Param("id"))
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// The generic orm helpers, reachable where the orm param shadows the package
+
+func listResources[T any](db *gorm.DB, q *listing.Query) (*orm.Page[T], error) {
+	return orm.ListResources[T](db, q)
+}
+
+func findResource[T any](db *gorm.DB, id string) (*T, error) {
+	return orm.FindResource[T](db, id)
+}
+
+func createResource[T any](db *gorm.DB, m *T) error {
+	return orm.CreateResource(db, m)
+}
+
+func updateResource[T any](db *gorm.DB, m *T, columns []string) error {
+	return orm.UpdateResource(db, m, columns)
+}
+
+func deleteResource[T any](db *gorm.DB, m *T) error {
+	return orm.DeleteResource(db, m)
+}
+
+func resourceColumns[T any](db *gorm.DB, fields []string) ([]string, error) {
+	return orm.ResourceColumns[T](db, fields)
+}
+
+func resourceHasColumns[T any](db *gorm.DB, columns []string) error {
+	return orm.ResourceHasColumns[T](db, columns)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/pkg/listing"
+	"gorm.io/gorm"
+)
+
+// abortWithError stops the chain, records the error for the logger middleware
+// and answers with a JSON message
+func abortWithError(c *gin.Context, status int, err error) {
+	c.Error(err)
+	c.AbortWithStatusJSON(status, gin.H{"message": err.Error()})
+}
+
+// ormErrorStatus maps the errors returned by the orm to a HTTP status
+func ormErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, orm.ErrEmailAlreadyRegistered),
+		errors.Is(err, orm.ErrProfileLinkedToOtherUser),
+		errors.Is(err, orm.ErrLastLoginMethod),
+		errors.Is(err, orm.ErrAlreadyMember),
+		errors.Is(err, orm.ErrLastOwner),
+		errors.Is(err, orm.ErrNoSigningSecret),
+		errors.Is(err, orm.ErrRoleExists),
+		errors.Is(err, orm.ErrPermissionExists):
+		return http.StatusConflict
+	case errors.Is(err, orm.ErrUserDeactivated),
+		errors.Is(err, orm.ErrSystemRole),
+		errors.Is(err, orm.ErrSystemPermission):
+		return http.StatusForbidden
+	case errors.Is(err, orm.ErrInvalidOrgRole),
+		errors.Is(err, orm.ErrInvalidAPIKeyRestriction),
+		errors.Is(err, orm.ErrUnknownMember),
+		errors.Is(err, orm.ErrInvalidPermissionTag),
+		errors.Is(err, orm.ErrRoleCycle),
+		errors.Is(err, listing.ErrInvalidQuery):
+		return http.StatusBadRequest
+	case errors.Is(err, orm.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusInternalServerError
+}
+
+// listQuery parses the filter, sort, fields, cursor and limit query params of
+// a list, it answers with a bad request when they can't be
+func listQuery(c *gin.Context, o *listing.Options) (*listing.Query, bool) {
+	q, err := listing.Parse(c.Request.URL.Query(), o)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return nil, false
+	}
+	return q, true
+}
+
+// listPage answers with the rows of a page under the key, only their asked
+// fields if any, along with the total of the rows matching the filters and
+// the cursor of the next page. They are also in the X-Total-Count and Link
+// headers
+func listPage(c *gin.Context, key string, rows any, q *listing.Query, total int64, next string) {
+	out, err := listing.Sparse(rows, q.Fields)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	if next != "" {
+		c.Header("Link", listing.Link(c.Request.URL, next))
+	}
+	c.JSON(http.StatusOK, gin.H{key: out, "total": total, "next": next})
+}
@@ -0,0 +1,533 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// roleOutput is a role as we show it, with the names of its parents and the
+// tags of its permissions
+type roleOutput struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	System      bool     `json:"system"`
+	Version     uint     `json:"version"`
+	Parents     []string `json:"parents"`
+	Permissions []string `json:"permissions"`
+}
+
+// permissionOutput is a permission as we show it
+type permissionOutput struct {
+	ID          uint   `json:"id"`
+	Tag         string `json:"tag"`
+	Description string `json:"description"`
+	System      bool   `json:"system"`
+}
+
+// roleInput is the body to create or update a role
+type roleInput struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=255"`
+	Description *string `json:"description" binding:"omitempty,max=1024"`
+}
+
+// permissionInput is the body to create or update a permission
+type permissionInput struct {
+	Tag         *string `json:"tag" binding:"omitempty,min=1,max=255"`
+	Description *string `json:"description" binding:"omitempty,max=1024"`
+}
+
+func newRoleOutput(r *models.Role) *roleOutput {
+	out := &roleOutput{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		System:      consts.IsSystemRole(r.Name),
+		Version:     r.Version,
+		Parents:     make([]string, 0, len(r.ParentRoles)),
+		Permissions: make([]string, 0, len(r.Permissions)),
+	}
+	for _, p := range r.ParentRoles {
+		out.Parents = append(out.Parents, p.Name)
+	}
+	for _, p := range r.Permissions {
+		out.Permissions = append(out.Permissions, p.Tag)
+	}
+	return out
+}
+
+func newPermissionOutput(p *models.Permission) *permissionOutput {
+	return &permissionOutput{
+		ID:          p.ID,
+		Tag:         p.Tag,
+		Description: p.Description,
+		System:      consts.IsSystemPermission(p.Tag),
+	}
+}
+
+// idParam parses the numeric id of the path param
+func idParam(c *gin.Context, name string, what string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errors.New("invalid "+what+" id"))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// Roles lists the roles
+func Roles(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roles, err := o.ListRoles()
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		out := make([]*roleOutput, 0, len(roles))
+		for i := range roles {
+			out = append(out, newRoleOutput(&roles[i]))
+		}
+		c.JSON(http.StatusOK, gin.H{"roles": out})
+	}
+}
+
+// Role shows the role
+func Role(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := idParam(c, "id", "role")
+		if !ok {
+			return
+		}
+		r, err := o.FindRole(id)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		if notModified(c, r.Version) {
+			return
+		}
+		c.JSON(http.StatusOK, newRoleOutput(r))
+	}
+}
+
+// CreateRole creates a role without permissions
+func CreateRole(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		in := &roleInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		if in.Name == nil {
+			abortWithError(c, http.StatusBadRequest, errors.New("the role name is required"))
+			return
+		}
+		r := &models.Role{Name: *in.Name}
+		if in.Description != nil {
+			r.Description = *in.Description
+		}
+		if err := o.WithContext(c.Request.Context()).CreateRole(r); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.CreateRole] role created: %s", r.Name)
+		setETag(c, r.Version)
+		c.JSON(http.StatusCreated, newRoleOutput(r))
+	}
+}
+
+// UpdateRole renames the role or changes its description
+func UpdateRole(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := idParam(c, "id", "role")
+		if !ok {
+			return
+		}
+		in := &roleInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		r, err := o.WithContext(ctx).UpdateRole(id, &orm.RoleChanges{Name: in.Name, Description: in.Description})
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.UpdateRole] role updated: %d", id)
+		setETag(c, r.Version)
+		c.JSON(http.StatusOK, newRoleOutput(r))
+	}
+}
+
+// DeleteRole deletes the role, its users lose it
+func DeleteRole(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := idParam(c, "id", "role")
+		if !ok {
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := o.WithContext(ctx).DeleteRole(id); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.DeleteRole] role deleted: %d", id)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// AddRoleParent makes the role inherit from the parent role, one the admin
+// may grant
+func AddRoleParent(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := idParam(c, "id", "role")
+		if !ok {
+			return
+		}
+		parentID, ok := idParam(c, "parentId", "parent role")
+		if !ok {
+			return
+		}
+		if !canGrantRole(c, o, parentID) {
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := o.WithContext(ctx).AddRoleParent(id, parentID); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.AddRoleParent] role: %d parent: %d", id, parentID)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// RemoveRoleParent stops the role from inheriting from the parent role
+func RemoveRoleParent(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := idParam(c, "id", "role")
+		if !ok {
+			return
+		}
+		parentID, ok := idParam(c, "parentId", "parent role")
+		if !ok {
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := o.WithContext(ctx).RemoveRoleParent(id, parentID); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.RemoveRoleParent] role: %d parent: %d", id, parentID)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// AddRolePermission gives the permission to the role, one the admin holds
+func AddRolePermission(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := idParam(c, "id", "role")
+		if !ok {
+			return
+		}
+		permissionID, ok := idParam(c, "permissionId", "permission")
+		if !ok {
+			return
+		}
+		if !canGrantPermission(c, o, permissionID) {
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := o.WithContext(ctx).AddRolePermission(id, permissionID); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.AddRolePermission] role: %d permission: %d", id, permissionID)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// RemoveRolePermission takes the permission from the role
+func RemoveRolePermission(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := idParam(c, "id", "role")
+		if !ok {
+			return
+		}
+		permissionID, ok := idParam(c, "permissionId", "permission")
+		if !ok {
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := o.WithContext(ctx).RemoveRolePermission(id, permissionID); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.RemoveRolePermission] role: %d permission: %d", id, permissionID)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// Permissions lists the permissions
+func Permissions(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		perms, err := o.ListPermissions()
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		out := make([]*permissionOutput, 0, len(perms))
+		for i := range perms {
+			out = append(out, newPermissionOutput(&perms[i]))
+		}
+		c.JSON(http.StatusOK, gin.H{"permissions": out})
+	}
+}
+
+// CreatePermission creates an `action:entity` permission
+func CreatePermission(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		in := &permissionInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		if in.Tag == nil {
+			abortWithError(c, http.StatusBadRequest, errors.New("the permission tag is required"))
+			return
+		}
+		p := &models.Permission{Tag: *in.Tag}
+		if in.Description != nil {
+			p.Description = *in.Description
+		}
+		if err := o.WithContext(c.Request.Context()).CreatePermission(p); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.CreatePermission] permission created: %s", p.Tag)
+		c.JSON(http.StatusCreated, newPermissionOutput(p))
+	}
+}
+
+// UpdatePermission retags the permission or changes its description
+func UpdatePermission(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := idParam(c, "id", "permission")
+		if !ok {
+			return
+		}
+		in := &permissionInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		p, err := o.WithContext(c.Request.Context()).UpdatePermission(id, &orm.PermissionChanges{Tag: in.Tag, Description: in.Description})
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.UpdatePermission] permission updated: %d", id)
+		c.JSON(http.StatusOK, newPermissionOutput(p))
+	}
+}
+
+// DeletePermission deletes the permission, everything having it loses it
+func DeletePermission(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := idParam(c, "id", "permission")
+		if !ok {
+			return
+		}
+		if err := o.WithContext(c.Request.Context()).DeletePermission(id); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.DeletePermission] permission deleted: %d", id)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// AddUserRole gives the role to the user, one the admin holds to someone
+// else
+func AddUserRole(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := userParam(c)
+		if !ok {
+			return
+		}
+		roleID, ok := idParam(c, "roleId", "role")
+		if !ok {
+			return
+		}
+		if !canGrantTo(c, userID) || !canGrantRole(c, o, roleID) {
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := o.WithContext(ctx).AddUserRole(userID, roleID); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.AddUserRole] user: %s role: %d", userID, roleID)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// RemoveUserRole takes the role from the user
+func RemoveUserRole(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := userParam(c)
+		if !ok {
+			return
+		}
+		roleID, ok := idParam(c, "roleId", "role")
+		if !ok {
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := o.WithContext(ctx).RemoveUserRole(userID, roleID); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.RemoveUserRole] user: %s role: %d", userID, roleID)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// AddUserPermission gives the permission to the user directly, one the
+// admin holds to someone else
+func AddUserPermission(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := userParam(c)
+		if !ok {
+			return
+		}
+		permissionID, ok := idParam(c, "permissionId", "permission")
+		if !ok {
+			return
+		}
+		if !canGrantTo(c, userID) || !canGrantPermission(c, o, permissionID) {
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := o.WithContext(ctx).AddUserPermission(userID, permissionID); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.AddUserPermission] user: %s permission: %d", userID, permissionID)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// RemoveUserPermission takes the direct permission from the user
+func RemoveUserPermission(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := userParam(c)
+		if !ok {
+			return
+		}
+		permissionID, ok := idParam(c, "permissionId", "permission")
+		if !ok {
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := o.WithContext(ctx).RemoveUserPermission(userID, permissionID); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.RemoveUserPermission] user: %s permission: %d", userID, permissionID)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// canGrantTo aborts when the authenticated user is the one granted
+func canGrantTo(c *gin.Context, userID uuid.UUID) bool {
+	u, err := auth.GetUser(c)
+	if err != nil {
+		abortWithError(c, http.StatusUnauthorized, err)
+		return false
+	}
+	if err := auth.CanGrantTo(u, userID); err != nil {
+		abortWithError(c, http.StatusForbidden, err)
+		return false
+	}
+	return true
+}
+
+// canGrantRole aborts unless the authenticated user may grant the role
+func canGrantRole(c *gin.Context, o *orm.ORM, roleID uint) bool {
+	u, err := auth.GetUser(c)
+	if err != nil {
+		abortWithError(c, http.StatusUnauthorized, err)
+		return false
+	}
+	r, err := o.FindRole(roleID)
+	if err != nil {
+		abortWithError(c, ormErrorStatus(err), err)
+		return false
+	}
+	if err := auth.CanGrantRole(u, r); err != nil {
+		abortWithError(c, http.StatusForbidden, err)
+		return false
+	}
+	return true
+}
+
+// canGrantPermission aborts unless the authenticated user may grant the
+// permission
+func canGrantPermission(c *gin.Context, o *orm.ORM, permissionID uint) bool {
+	u, err := auth.GetUser(c)
+	if err != nil {
+		abortWithError(c, http.StatusUnauthorized, err)
+		return false
+	}
+	p, err := o.FindPermission(permissionID)
+	if err != nil {
+		abortWithError(c, ormErrorStatus(err), err)
+		return false
+	}
+	if err := auth.CanGrantPermission(u, p); err != nil {
+		abortWithError(c, http.StatusForbidden, err)
+		return false
+	}
+	return true
+}
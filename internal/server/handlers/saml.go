@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+	"github.com/rakin92/go-rest-service/pkg/storage/cache"
+)
+
+// samlProvider finds the identity provider of the `idp` path param
+func samlProvider(c *gin.Context) (*auth.SAMLProvider, bool) {
+	p, err := auth.GetSAMLProvider(c.Param(string(consts.ProjectContextKeys.SAMLIdPCtxKey)))
+	if err != nil {
+		abortWithError(c, http.StatusNotFound, err)
+		return nil, false
+	}
+	return p, true
+}
+
+// SAMLMetadata serves the service provider metadata the identity provider
+// registers us with
+func SAMLMetadata() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := samlProvider(c)
+		if !ok {
+			return
+		}
+		md, err := p.Metadata()
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Data(http.StatusOK, auth.SAMLMetadataContentType, md)
+	}
+}
+
+// SAMLLogin redirects to the identity provider with a signed request, the
+// client may ask for the ACS `response_mode` and `redirect_uri`
+func SAMLLogin(sc *cfg.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := samlProvider(c)
+		if !ok {
+			return
+		}
+		intent, err := newAuthIntent(c, sc)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		location, requestID, err := p.AuthnRequest()
+		if err != nil {
+			logger.Error(&err, "[Auth.SAMLLogin] error: %s", err.Error())
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		intent.SAMLRequestID = requestID
+		if err := setSAMLIntent(c, sc, intent); err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Redirect(http.StatusFound, location.String())
+	}
+}
+
+// SAMLACS is the assertion consumer service the identity provider posts its
+// signed response to, the user gets a `saml:<idp>` profile and our token pair
+func SAMLACS(sc *cfg.Server, orm *orm.ORM, che *cache.Cache) gin.HandlerFunc {
+	var assertions auth.NonceStore
+	if che != nil {
+		assertions = che
+	}
+	return func(c *gin.Context) {
+		p, ok := samlProvider(c)
+		if !ok {
+			return
+		}
+		intent := popSAMLIntent(c, sc)
+		if intent.ResponseMode == "" {
+			intent.ResponseMode = p.ResponseMode()
+		}
+		res := newCallbackResponse(sc, p.Provider(), intent)
+
+		requestIDs := []string{}
+		if intent.SAMLRequestID != "" {
+			requestIDs = append(requestIDs, intent.SAMLRequestID)
+		}
+		gothUsr, err := p.Authenticate(c.Request, requestIDs, assertions)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidSAMLResponse) || errors.Is(err, auth.ErrReplayedAssertion) {
+				res.error(c, http.StatusUnauthorized, "auth_failed", err)
+				return
+			}
+			logger.Error(&err, "[Auth.SAMLACS.Authenticate] error: %s", err.Error())
+			res.error(c, http.StatusInternalServerError, "server_error", err)
+			return
+		}
+
+		// the profile is refreshed with the assertion attributes on every login
+		u, err := orm.UpsertUserProfile(gothUsr, sc.Auth.MergeVerifiedEmails)
+		if err != nil {
+			logger.Error(&err, "[Auth.SAMLACS.UpsertUserProfile] error: %s", err.Error())
+			res.error(c, ormErrorStatus(err), callbackErrorCode(err), err)
+			return
+		}
+		s, err := startSession(c, sc, orm, u, gothUsr.Provider)
+		if err != nil {
+			logger.Error(&err, "[Auth.SAMLACS.Session] error: %s", err.Error())
+			res.error(c, http.StatusInternalServerError, "server_error", err)
+			return
+		}
+		pair, err := auth.IssueTokenPair(sc, u, gothUsr.Provider, gothUsr.UserID, s.ID)
+		if err != nil {
+			logger.Error(&err, "[Auth.SAMLACS.JWT] error: %s", err.Error())
+			res.error(c, http.StatusInternalServerError, "server_error", err)
+			return
+		}
+		res.tokens(c, pair)
+	}
+}
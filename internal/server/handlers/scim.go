@@ -0,0 +1,570 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+	"github.com/rakin92/go-rest-service/pkg/scim"
+)
+
+// scimMaxResults is the most resources a page lists
+const scimMaxResults = 200
+
+// scimJSON answers with a SCIM body
+func scimJSON(c *gin.Context, status int, body any) {
+	c.Header("Content-Type", scim.ContentType)
+	c.JSON(status, body)
+}
+
+// scimError answers with the SCIM error of the orm or protocol error
+func scimError(c *gin.Context, err error) {
+	c.Error(err)
+	var e *scim.Error
+	switch {
+	case errors.As(err, &e):
+	case errors.Is(err, scim.ErrInvalidFilter):
+		e = scim.NewError(http.StatusBadRequest, scim.ErrInvalidFilterType, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		e = scim.NewError(http.StatusNotFound, "", "resource not found")
+	case errors.Is(err, orm.ErrEmailAlreadyRegistered), errors.Is(err, orm.ErrRoleExists):
+		e = scim.NewError(http.StatusConflict, scim.ErrUniquenessType, err.Error())
+	case errors.Is(err, orm.ErrSystemRole):
+		e = scim.NewError(http.StatusBadRequest, scim.ErrMutabilityType, err.Error())
+	case errors.Is(err, orm.ErrUnknownMember):
+		e = scim.NewError(http.StatusBadRequest, scim.ErrInvalidValueType, err.Error())
+	default:
+		e = scim.NewError(http.StatusInternalServerError, "", err.Error())
+	}
+	c.Header("Content-Type", scim.ContentType)
+	c.AbortWithStatusJSON(e.StatusCode(), e)
+}
+
+// scimClient returns the authenticated SCIM client
+func scimClient(c *gin.Context) (*models.SCIMClient, bool) {
+	client, err := auth.GetSCIMClient(c)
+	if err != nil {
+		scimError(c, scim.NewError(http.StatusUnauthorized, "", err.Error()))
+		return nil, false
+	}
+	return client, true
+}
+
+// scimPage reads the filter and the 1-based page of a list request
+func scimPage(c *gin.Context) (scim.Filter, int, int, error) {
+	f, err := scim.ParseFilter(c.Query("filter"))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	start, err := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	if err != nil || start < 1 {
+		start = 1
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(scimMaxResults)))
+	if err != nil || count > scimMaxResults {
+		count = scimMaxResults
+	}
+	if count < 0 {
+		count = 0
+	}
+	return f, start, count, nil
+}
+
+// scimUserID reads the user id of the path, unknown ids aren't found
+func scimUserID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.FromString(c.Param("id"))
+	if err != nil {
+		scimError(c, gorm.ErrRecordNotFound)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// scimGroupID reads the group id of the path, unknown ids aren't found
+func scimGroupID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		scimError(c, gorm.ErrRecordNotFound)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// toSCIMUser is the user as the identity provider sees it, the external id
+// is the one of its profile of the provider
+func toSCIMUser(sc *cfg.Server, u *models.User, provider string) *scim.User {
+	active := u.Active()
+	res := &scim.User{
+		Schemas:  []string{scim.UserSchema},
+		ID:       u.ID.String(),
+		UserName: u.Email,
+		Name:     &scim.Name{},
+		Emails:   []scim.Email{{Value: u.Email, Type: "work", Primary: true}},
+		Active:   &active,
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			LastModified: u.UpdatedAt,
+			Location:     sc.SchemaVersionedEndpoint("/scim/v2/Users/" + u.ID.String()),
+		},
+	}
+	if u.FirstName != nil {
+		res.Name.GivenName = *u.FirstName
+	}
+	if u.LastName != nil {
+		res.Name.FamilyName = *u.LastName
+	}
+	res.DisplayName = strings.TrimSpace(res.Name.GivenName + " " + res.Name.FamilyName)
+	for _, p := range u.UserProfiles {
+		if p.Provider == provider {
+			res.ExternalID = p.ExternalUserID
+		}
+	}
+	for _, r := range u.Roles {
+		if consts.IsOrgRole(r.Name) {
+			continue
+		}
+		id := strconv.FormatUint(uint64(r.ID), 10)
+		res.Groups = append(res.Groups, scim.Member{
+			Value:   id,
+			Display: r.Name,
+			Ref:     sc.SchemaVersionedEndpoint("/scim/v2/Groups/" + id),
+		})
+	}
+	return res
+}
+
+// fromSCIMUser sets what the identity provider manages on the user, the
+// user name is its email. Deactivated users are soft deleted
+func fromSCIMUser(res *scim.User, u *models.User) error {
+	email := res.UserName
+	if !strings.Contains(email, "@") && res.PrimaryEmail() != "" {
+		email = res.PrimaryEmail()
+	}
+	if email == "" {
+		return scim.NewError(http.StatusBadRequest, scim.ErrInvalidValueType, "userName is required")
+	}
+	u.Email = strings.ToLower(email)
+	u.FirstName, u.LastName = nil, nil
+	if res.Name != nil && res.Name.GivenName != "" {
+		u.FirstName = &res.Name.GivenName
+	}
+	if res.Name != nil && res.Name.FamilyName != "" {
+		u.LastName = &res.Name.FamilyName
+	}
+	switch {
+	case res.IsActive():
+		u.DeletedAt = nil
+	case u.DeletedAt == nil:
+		now := time.Now().UTC()
+		u.DeletedAt = &now
+	}
+	return nil
+}
+
+// toSCIMGroup is the role as the identity provider sees it
+func toSCIMGroup(sc *cfg.Server, r *models.Role, members []models.User) *scim.Group {
+	id := strconv.FormatUint(uint64(r.ID), 10)
+	res := &scim.Group{
+		Schemas:     []string{scim.GroupSchema},
+		ID:          id,
+		DisplayName: r.Name,
+		Meta: &scim.Meta{
+			ResourceType: "Group",
+			Created:      r.CreatedAt,
+			LastModified: r.UpdatedAt,
+			Location:     sc.SchemaVersionedEndpoint("/scim/v2/Groups/" + id),
+		},
+	}
+	for _, u := range members {
+		res.Members = append(res.Members, scim.Member{
+			Value:   u.ID.String(),
+			Display: u.Email,
+			Ref:     sc.SchemaVersionedEndpoint("/scim/v2/Users/" + u.ID.String()),
+		})
+	}
+	return res
+}
+
+// scimMemberIDs reads the users of the group members
+func scimMemberIDs(res *scim.Group) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(res.Members))
+	for _, m := range res.Members {
+		id, err := uuid.FromString(m.Value)
+		if err != nil {
+			return nil, scim.NewError(http.StatusBadRequest, scim.ErrInvalidValueType, "invalid member "+m.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// SCIMServiceProviderConfig tells the identity providers what we support
+func SCIMServiceProviderConfig() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scimJSON(c, http.StatusOK, &scim.ServiceProviderConfig{
+			Schemas: []string{scim.ServiceProviderConfigSchema},
+			Patch:   scim.Supported{Supported: true},
+			Filter:  scim.Filtering{Supported: true, MaxResults: scimMaxResults},
+			AuthenticationSchemes: []scim.AuthenticationScheme{{
+				Type:        "oauthbearertoken",
+				Name:        "Bearer token",
+				Description: "The token of the SCIM client, given when it was registered",
+			}},
+		})
+	}
+}
+
+// SCIMUsers lists a page of the users matching the filter
+func SCIMUsers(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := scimClient(c)
+		if !ok {
+			return
+		}
+		f, start, count, err := scimPage(c)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		users, total, err := orm.ListSCIMUsers(client.Provider(), f, start-1, count)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		resources := make([]any, 0, len(users))
+		for i := range users {
+			resources = append(resources, toSCIMUser(sc, &users[i], client.Provider()))
+		}
+		scimJSON(c, http.StatusOK, scim.NewListResponse(total, start, resources))
+	}
+}
+
+// SCIMUser answers with the user of the path
+func SCIMUser(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := scimClient(c)
+		if !ok {
+			return
+		}
+		id, ok := scimUserID(c)
+		if !ok {
+			return
+		}
+		u, err := orm.FindSCIMUser(client.Provider(), id)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		scimJSON(c, http.StatusOK, toSCIMUser(sc, u, client.Provider()))
+	}
+}
+
+// CreateSCIMUser provisions a user, the email must not be registered yet
+func CreateSCIMUser(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := scimClient(c)
+		if !ok {
+			return
+		}
+		res := &scim.User{}
+		if err := c.ShouldBindJSON(res); err != nil {
+			scimError(c, scim.NewError(http.StatusBadRequest, scim.ErrInvalidSyntaxType, err.Error()))
+			return
+		}
+		u := &models.User{}
+		if err := fromSCIMUser(res, u); err != nil {
+			scimError(c, err)
+			return
+		}
+		if err := orm.WithContext(c.Request.Context()).SaveSCIMUser(u, client.Provider(), res.ExternalID); err != nil {
+			scimError(c, err)
+			return
+		}
+		logger.Info("[SCIM.CreateUser] user: %s provisioned by: %s", u.ID, client.Name)
+		scimJSON(c, http.StatusCreated, toSCIMUser(sc, u, client.Provider()))
+	}
+}
+
+// ReplaceSCIMUser replaces what the identity provider manages of the user
+func ReplaceSCIMUser(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, u, ok := findSCIMUser(c, orm)
+		if !ok {
+			return
+		}
+		res := &scim.User{}
+		if err := c.ShouldBindJSON(res); err != nil {
+			scimError(c, scim.NewError(http.StatusBadRequest, scim.ErrInvalidSyntaxType, err.Error()))
+			return
+		}
+		if saveSCIMUser(c, orm, client, u, res) {
+			scimJSON(c, http.StatusOK, toSCIMUser(sc, u, client.Provider()))
+		}
+	}
+}
+
+// PatchSCIMUser applies the PATCH operations to the user
+func PatchSCIMUser(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, u, ok := findSCIMUser(c, orm)
+		if !ok {
+			return
+		}
+		req := &scim.PatchRequest{}
+		if err := c.ShouldBindJSON(req); err != nil {
+			scimError(c, scim.NewError(http.StatusBadRequest, scim.ErrInvalidSyntaxType, err.Error()))
+			return
+		}
+		res := toSCIMUser(sc, u, client.Provider())
+		if err := res.ApplyPatch(req.Operations); err != nil {
+			scimError(c, err)
+			return
+		}
+		if saveSCIMUser(c, orm, client, u, res) {
+			scimJSON(c, http.StatusOK, toSCIMUser(sc, u, client.Provider()))
+		}
+	}
+}
+
+// DeleteSCIMUser deactivates the user, it's soft deleted and can no longer
+// sign in
+func DeleteSCIMUser(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, u, ok := findSCIMUser(c, orm)
+		if !ok {
+			return
+		}
+		res := toSCIMUser(sc, u, client.Provider())
+		inactive := false
+		res.Active = &inactive
+		if saveSCIMUser(c, orm, client, u, res) {
+			c.Status(http.StatusNoContent)
+		}
+	}
+}
+
+// findSCIMUser finds the user of the path for the authenticated SCIM client
+func findSCIMUser(c *gin.Context, o *orm.ORM) (*models.SCIMClient, *models.User, bool) {
+	client, ok := scimClient(c)
+	if !ok {
+		return nil, nil, false
+	}
+	id, ok := scimUserID(c)
+	if !ok {
+		return nil, nil, false
+	}
+	u, err := o.FindSCIMUser(client.Provider(), id)
+	if err != nil {
+		scimError(c, err)
+		return nil, nil, false
+	}
+	return client, u, true
+}
+
+// saveSCIMUser saves the user as the resource of the identity provider says
+func saveSCIMUser(c *gin.Context, o *orm.ORM, client *models.SCIMClient, u *models.User, res *scim.User) bool {
+	if err := fromSCIMUser(res, u); err != nil {
+		scimError(c, err)
+		return false
+	}
+	if err := o.SaveSCIMUser(u, client.Provider(), res.ExternalID); err != nil {
+		scimError(c, err)
+		return false
+	}
+	logger.Info("[SCIM.SaveUser] user: %s updated by: %s active: %t", u.ID, client.Name, u.Active())
+	return true
+}
+
+// SCIMGroups lists a page of the groups matching the filter
+func SCIMGroups(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := scimClient(c)
+		if !ok {
+			return
+		}
+		f, start, count, err := scimPage(c)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		roles, total, err := orm.ListSCIMGroups(client.Provider(), f, start-1, count)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		ids := make([]uint, 0, len(roles))
+		for _, r := range roles {
+			ids = append(ids, r.ID)
+		}
+		members := map[uint][]models.User{}
+		if !strings.Contains(c.Query("excludedAttributes"), "members") {
+			if members, err = orm.ListRoleMembers(client.Provider(), ids...); err != nil {
+				scimError(c, err)
+				return
+			}
+		}
+		resources := make([]any, 0, len(roles))
+		for i := range roles {
+			resources = append(resources, toSCIMGroup(sc, &roles[i], members[roles[i].ID]))
+		}
+		scimJSON(c, http.StatusOK, scim.NewListResponse(total, start, resources))
+	}
+}
+
+// SCIMGroup answers with the group of the path
+func SCIMGroup(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := scimClient(c)
+		if !ok {
+			return
+		}
+		id, ok := scimGroupID(c)
+		if !ok {
+			return
+		}
+		r, err := orm.FindSCIMGroup(client.Provider(), id)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		members, err := orm.ListRoleMembers(client.Provider(), r.ID)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		scimJSON(c, http.StatusOK, toSCIMGroup(sc, r, members[r.ID]))
+	}
+}
+
+// CreateSCIMGroup provisions a role with its members
+func CreateSCIMGroup(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := scimClient(c)
+		if !ok {
+			return
+		}
+		res := &scim.Group{}
+		if err := c.ShouldBindJSON(res); err != nil || res.DisplayName == "" {
+			scimError(c, scim.NewError(http.StatusBadRequest, scim.ErrInvalidSyntaxType, "displayName is required"))
+			return
+		}
+		saveSCIMGroup(c, sc, orm, client, &models.Role{Name: res.DisplayName}, res, http.StatusCreated)
+	}
+}
+
+// ReplaceSCIMGroup replaces the name and members of the group
+func ReplaceSCIMGroup(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := scimClient(c)
+		if !ok {
+			return
+		}
+		id, ok := scimGroupID(c)
+		if !ok {
+			return
+		}
+		res := &scim.Group{}
+		if err := c.ShouldBindJSON(res); err != nil || res.DisplayName == "" {
+			scimError(c, scim.NewError(http.StatusBadRequest, scim.ErrInvalidSyntaxType, "displayName is required"))
+			return
+		}
+		r, err := orm.FindSCIMGroup(client.Provider(), id)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		r.Name = res.DisplayName
+		saveSCIMGroup(c, sc, orm, client, r, res, http.StatusOK)
+	}
+}
+
+// PatchSCIMGroup applies the PATCH operations to the group, mostly adding
+// and removing members
+func PatchSCIMGroup(sc *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := scimClient(c)
+		if !ok {
+			return
+		}
+		id, ok := scimGroupID(c)
+		if !ok {
+			return
+		}
+		req := &scim.PatchRequest{}
+		if err := c.ShouldBindJSON(req); err != nil {
+			scimError(c, scim.NewError(http.StatusBadRequest, scim.ErrInvalidSyntaxType, err.Error()))
+			return
+		}
+		r, err := orm.FindSCIMGroup(client.Provider(), id)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		members, err := orm.ListRoleMembers(client.Provider(), r.ID)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		res := toSCIMGroup(sc, r, members[r.ID])
+		if err := res.ApplyPatch(req.Operations); err != nil {
+			scimError(c, err)
+			return
+		}
+		r.Name = res.DisplayName
+		saveSCIMGroup(c, sc, orm, client, r, res, http.StatusOK)
+	}
+}
+
+// saveSCIMGroup saves the role with the members of the group and answers
+// with it
+func saveSCIMGroup(c *gin.Context, sc *cfg.Server, o *orm.ORM, client *models.SCIMClient, r *models.Role, res *scim.Group, status int) {
+	ids, err := scimMemberIDs(res)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	if err := o.SaveSCIMGroup(r, client.Provider(), ids); err != nil {
+		scimError(c, err)
+		return
+	}
+	members, err := o.ListRoleMembers(client.Provider(), r.ID)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	logger.Info("[SCIM.SaveGroup] role: %s saved with %d members", r.Name, len(members[r.ID]))
+	scimJSON(c, status, toSCIMGroup(sc, r, members[r.ID]))
+}
+
+// DeleteSCIMGroup deletes the role, its members lose it
+func DeleteSCIMGroup(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := scimClient(c)
+		if !ok {
+			return
+		}
+		id, ok := scimGroupID(c)
+		if !ok {
+			return
+		}
+		if err := orm.WithContext(c.Request.Context()).DeleteSCIMGroup(client.Provider(), id); err != nil {
+			scimError(c, err)
+			return
+		}
+		logger.Info("[SCIM.DeleteGroup] role: %d deleted", id)
+		c.Status(http.StatusNoContent)
+	}
+}
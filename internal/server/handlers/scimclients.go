@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// scimClientInput is the body to register an identity provider
+type scimClientInput struct {
+	Name string `json:"name" binding:"required,max=128"`
+}
+
+// scimClientOutput is a SCIM client as we show it, the token is only set
+// when the client is created
+type scimClientOutput struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	Provider   string     `json:"provider"`
+	CreatedAt  *time.Time `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func newSCIMClientOutput(c *models.SCIMClient) *scimClientOutput {
+	return &scimClientOutput{
+		ID:         c.ID,
+		Name:       c.Name,
+		Provider:   c.Provider(),
+		CreatedAt:  c.CreatedAt,
+		LastUsedAt: c.LastUsedAt,
+	}
+}
+
+// CreateSCIMClient registers an identity provider to provision users, its
+// bearer token is only ever returned in this response
+func CreateSCIMClient(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		in := &scimClientInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		client := &models.SCIMClient{Name: in.Name}
+		token, err := orm.WithContext(c.Request.Context()).CreateSCIMClient(client)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.CreateSCIMClient] client registered: %s", client.Name)
+		out := newSCIMClientOutput(client)
+		out.Token = token
+		c.JSON(http.StatusCreated, out)
+	}
+}
+
+// SCIMClients lists the registered identity providers
+func SCIMClients(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clients, err := orm.ListSCIMClients()
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		out := make([]*scimClientOutput, 0, len(clients))
+		for i := range clients {
+			out = append(out, newSCIMClientOutput(&clients[i]))
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// DeleteSCIMClient removes an identity provider, its token stops working
+func DeleteSCIMClient(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.FromString(c.Param("id"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := orm.WithContext(c.Request.Context()).DeleteSCIMClient(id); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.DeleteSCIMClient] client removed: %s", id)
+		c.Status(http.StatusNoContent)
+	}
+}
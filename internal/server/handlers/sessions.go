@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// session is a device the user is signed in on
+type session struct {
+	ID         uuid.UUID  `json:"id"`
+	Provider   string     `json:"provider"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	ClientIP   string     `json:"client_ip"`
+	CreatedAt  *time.Time `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"`
+}
+
+// devices are the user agent markers of the devices, the most specific first
+var devices = []struct{ marker, name string }{
+	{"iPhone", "iPhone"}, {"iPad", "iPad"}, {"Android", "Android"},
+	{"Windows", "Windows"}, {"Macintosh", "Mac"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+}
+
+// deviceFromUserAgent names the device the user agent runs on
+func deviceFromUserAgent(ua string) string {
+	for _, d := range devices {
+		if strings.Contains(ua, d.marker) {
+			return d.name
+		}
+	}
+	return "Unknown"
+}
+
+// startSession records the session of a login from the request
+func startSession(c *gin.Context, sc *cfg.Server, o *orm.ORM, u *models.User, provider string) (*models.Session, error) {
+	ua := c.Request.UserAgent()
+	if len(ua) > 512 {
+		ua = ua[:512]
+	}
+	s := &models.Session{
+		UserID:    u.ID,
+		Provider:  provider,
+		Device:    deviceFromUserAgent(ua),
+		UserAgent: ua,
+		ClientIP:  c.ClientIP(),
+	}
+	if err := o.CreateSession(s, sc.JWT.RefreshTokenTTL); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// refreshSession keeps the session of the refresh token alive, the ones
+// issued before sessions were tracked get a session of their own
+func refreshSession(c *gin.Context, sc *cfg.Server, o *orm.ORM, u *models.User, claims *auth.Claims) (*models.Session, error) {
+	if claims.SessionID == "" {
+		return startSession(c, sc, o, u, claims.Issuer)
+	}
+	id, err := uuid.FromString(claims.SessionID)
+	if err != nil {
+		return nil, auth.ErrNoClaims
+	}
+	s, err := o.FindActiveSession(id, u.ID)
+	if err != nil {
+		return nil, auth.ErrSessionRevoked
+	}
+	if err := o.ExtendSession(s, sc.JWT.RefreshTokenTTL, c.ClientIP()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Sessions lists the devices the authenticated user is signed in on
+func Sessions(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := ownUser(c)
+		if !ok {
+			return
+		}
+		ls, err := orm.ListActiveSessions(u.ID)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		current, _ := auth.GetSessionID(c)
+		out := make([]session, 0, len(ls))
+		for _, s := range ls {
+			out = append(out, session{
+				ID:         s.ID,
+				Provider:   s.Provider,
+				Device:     s.Device,
+				UserAgent:  s.UserAgent,
+				ClientIP:   s.ClientIP,
+				CreatedAt:  s.CreatedAt,
+				LastSeenAt: s.LastSeenAt,
+				ExpiresAt:  s.ExpiresAt,
+				Current:    s.ID == current,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"sessions": out})
+	}
+}
+
+// RevokeSession signs the authenticated user out of one of their sessions,
+// its tokens are refused from now on
+func RevokeSession(orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := ownUser(c)
+		if !ok {
+			return
+		}
+		id, err := uuid.FromString(c.Param("id"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, errors.New("invalid session id"))
+			return
+		}
+		if err := orm.WithContext(c.Request.Context()).RevokeSession(u.ID, id); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Sessions.Revoke] user: %s session: %s", u.ID, id)
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// userOutput is a user as we show it, with its effective permissions
+type userOutput struct {
+	ID          uuid.UUID           `json:"id"`
+	Email       string              `json:"email"`
+	FirstName   *string             `json:"first_name"`
+	LastName    *string             `json:"last_name"`
+	Active      bool                `json:"active"`
+	Version     uint                `json:"version"`
+	CreatedAt   *time.Time          `json:"created_at"`
+	UpdatedAt   *time.Time          `json:"updated_at"`
+	DeletedAt   *time.Time          `json:"deleted_at,omitempty"`
+	Profiles    []userProfileOutput `json:"profiles"`
+	Roles       []string            `json:"roles"`
+	Permissions []string            `json:"permissions"`
+}
+
+// userProfileOutput is a login method of the user
+type userProfileOutput struct {
+	ID             uint       `json:"id"`
+	Provider       string     `json:"provider"`
+	ExternalUserID string     `json:"external_user_id"`
+	Email          string     `json:"email"`
+	FirstName      string     `json:"first_name"`
+	LastName       string     `json:"last_name"`
+	AvatarURL      string     `json:"avatar_url"`
+	CreatedAt      *time.Time `json:"created_at"`
+}
+
+// userInput is the body to update a user, the missing fields are left as
+// they are
+type userInput struct {
+	Email     *string `json:"email" binding:"omitempty,email"`
+	FirstName *string `json:"first_name" binding:"omitempty,max=255"`
+	LastName  *string `json:"last_name" binding:"omitempty,max=255"`
+}
+
+func newUserOutput(u *models.User) *userOutput {
+	out := &userOutput{
+		ID:          u.ID,
+		Email:       u.Email,
+		FirstName:   u.FirstName,
+		LastName:    u.LastName,
+		Active:      u.Active(),
+		Version:     u.Version,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+		DeletedAt:   u.DeletedAt,
+		Profiles:    make([]userProfileOutput, 0, len(u.UserProfiles)),
+		Roles:       u.RoleNames(),
+		Permissions: u.PermissionTags(),
+	}
+	for _, p := range u.UserProfiles {
+		out.Profiles = append(out.Profiles, userProfileOutput{
+			ID:             p.ID,
+			Provider:       p.Provider,
+			ExternalUserID: p.ExternalUserID,
+			Email:          p.Email,
+			FirstName:      p.FirstName,
+			LastName:       p.LastName,
+			AvatarURL:      p.AvatarURL,
+			CreatedAt:      p.CreatedAt,
+		})
+	}
+	return out
+}
+
+// userParam parses the id of the user in the path
+func userParam(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.FromString(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errors.New("invalid user id"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// Me shows the authenticated user
+func Me(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, err := auth.GetUser(c)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, err)
+			return
+		}
+		u, err = o.FindUser(u.ID)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		if notModified(c, u.Version) {
+			return
+		}
+		c.JSON(http.StatusOK, newUserOutput(u))
+	}
+}
+
+// UpdateMe changes the names of the authenticated user, the email belongs to
+// the login methods so it's only changed by admins
+func UpdateMe(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := ownUser(c)
+		if !ok {
+			return
+		}
+		in := &userInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		if in.Email != nil {
+			abortWithError(c, http.StatusForbidden, errors.New("the email can't be changed"))
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		u, err := o.WithContext(ctx).UpdateUser(u.ID, &orm.UserChanges{FirstName: in.FirstName, LastName: in.LastName})
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		setETag(c, u.Version)
+		c.JSON(http.StatusOK, newUserOutput(u))
+	}
+}
+
+// Users lists a page of the users, the `deactivated` ones too when asked
+func Users(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, ok := listQuery(c, orm.UserListing)
+		if !ok {
+			return
+		}
+		deactivated, _ := strconv.ParseBool(c.Query("deactivated"))
+		page, err := o.ListUsers(deactivated, q)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		out := make([]*userOutput, 0, len(page.Rows))
+		for i := range page.Rows {
+			out = append(out, newUserOutput(&page.Rows[i]))
+		}
+		listPage(c, "users", out, q, page.Total, page.Next)
+	}
+}
+
+// User shows the user, deactivated or not
+func User(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := userParam(c)
+		if !ok {
+			return
+		}
+		u, err := o.FindUser(id)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		if notModified(c, u.Version) {
+			return
+		}
+		c.JSON(http.StatusOK, newUserOutput(u))
+	}
+}
+
+// UpdateUser changes the email and names of the user
+func UpdateUser(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := userParam(c)
+		if !ok {
+			return
+		}
+		in := &userInput{}
+		if err := c.ShouldBindJSON(in); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		u, err := o.WithContext(ctx).UpdateUser(id, &orm.UserChanges{
+			Email:     in.Email,
+			FirstName: in.FirstName,
+			LastName:  in.LastName,
+		})
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.UpdateUser] user: %s updated", id)
+		setETag(c, u.Version)
+		c.JSON(http.StatusOK, newUserOutput(u))
+	}
+}
+
+// DeleteUser deactivates the user, it's soft deleted so it can be restored
+func DeleteUser(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := userParam(c)
+		if !ok {
+			return
+		}
+		if admin, err := auth.GetUser(c); err == nil && admin.ID == id {
+			abortWithError(c, http.StatusForbidden, errors.New("you can't deactivate yourself"))
+			return
+		}
+		ctx, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if _, err := o.WithContext(ctx).SetUserActive(id, false); err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.DeleteUser] user: %s deactivated", id)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// RestoreUser reactivates the deactivated user
+func RestoreUser(o *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := userParam(c)
+		if !ok {
+			return
+		}
+		u, err := o.WithContext(c.Request.Context()).SetUserActive(id, true)
+		if err != nil {
+			abortWithError(c, ormErrorStatus(err), err)
+			return
+		}
+		logger.Info("[Admin.RestoreUser] user: %s restored", id)
+		setETag(c, u.Version)
+		c.JSON(http.StatusOK, newUserOutput(u))
+	}
+}
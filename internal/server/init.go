@@ -1,27 +1,43 @@
 package server
 
 import (
+	"fmt"
+
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/providers/facebook"
 	"github.com/markbates/goth/providers/google"
 	"github.com/markbates/goth/providers/twitter"
+	"github.com/rakin92/go-rest-service/pkg/auth"
 	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+	"github.com/rakin92/go-rest-service/pkg/policy"
 )
 
-// initializeAuthProviders does just that, with Goth providers
+// initializeAuthProviders does just that, with Goth providers, the token
+// verifiers for the providers native clients can exchange tokens with and the
+// SAML identity providers
 func initializeAuthProviders(sc *cfg.Server) error {
 	providers := []goth.Provider{}
 	// Initialize Goth providers
 	for _, p := range sc.AuthProviders {
+		if p.ResponseMode != "" && !consts.IsResponseMode(p.ResponseMode) {
+			return fmt.Errorf("auth provider [%s] response mode [%s] is not supported",
+				p.Provider, p.ResponseMode)
+		}
 		switch p.Provider {
 		case "facebook":
 			providers = append(providers, facebook.New(p.ClientKey, p.Secret,
 				sc.SchemaVersionedEndpoint("/auth/"+p.Provider+"/callback"),
 				p.Scopes...))
+			auth.RegisterTokenVerifier(p.Provider,
+				auth.NewFacebookVerifier(p.ClientKey, p.Secret, p.Audiences...))
 		case "google":
 			providers = append(providers, google.New(p.ClientKey, p.Secret,
 				sc.SchemaVersionedEndpoint("/auth/"+p.Provider+"/callback"),
 				p.Scopes...))
+			auth.RegisterTokenVerifier(p.Provider,
+				auth.NewGoogleVerifier(p.ClientKey, p.Audiences...))
 		case "twitter":
 			providers = append(providers, twitter.New(p.ClientKey, p.Secret,
 				sc.SchemaVersionedEndpoint("/auth/"+p.Provider+"/callback")))
@@ -31,5 +47,40 @@ func initializeAuthProviders(sc *cfg.Server) error {
 		}
 	}
 	goth.UseProviders(providers...)
+	return initializeSAMLProviders(sc)
+}
+
+// initializeSAMLProviders loads the metadata of the SAML identity providers,
+// they share the key pair of our service provider
+func initializeSAMLProviders(sc *cfg.Server) error {
+	if len(sc.SAML.IDPs) == 0 {
+		return nil
+	}
+	key, cert, err := auth.LoadSAMLKeyPair(&sc.SAML)
+	if err != nil {
+		return err
+	}
+	for i := range sc.SAML.IDPs {
+		p, err := auth.NewSAMLProvider(sc, &sc.SAML.IDPs[i], key, cert)
+		if err != nil {
+			return err
+		}
+		auth.RegisterSAMLProvider(p)
+		logger.Info("[SAML] identity provider %s loaded", p.Name)
+	}
+	return nil
+}
+
+// initializePolicies loads the rules resources are authorized with
+func initializePolicies(sc *cfg.Server) error {
+	if sc.Auth.PolicyFile == "" {
+		return nil
+	}
+	e, err := policy.Load(sc.Auth.PolicyFile)
+	if err != nil {
+		return err
+	}
+	auth.UsePolicies(e)
+	logger.Info("[Policies] %d rules loaded from %s", len(e.Rules()), sc.Auth.PolicyFile)
 	return nil
 }
@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/server/handlers"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/storage/cache"
+)
+
+// Admin is the related routes to administrate the service, each one is
+// guarded by the permission tags it needs
+func Admin(sc *cfg.Server, r *gin.Engine, orm *orm.ORM, che *cache.Cache) error {
+	users := consts.GetTableName(consts.EntityNames.Users)
+	clients := consts.GetTableName(consts.EntityNames.OauthClients)
+	impersonations := consts.GetTableName(consts.EntityNames.Impersonations)
+	policies := consts.GetTableName(consts.EntityNames.Policies)
+	scimClients := consts.GetTableName(consts.EntityNames.ScimClients)
+	auditEntries := consts.GetTableName(consts.EntityNames.AuditEntries)
+	assignRoles := consts.FormatPermissionTag(consts.Permissions.Assign,
+		consts.GetTableName(consts.EntityNames.Roles))
+	assignPermissions := consts.FormatPermissionTag(consts.Permissions.Assign,
+		consts.GetTableName(consts.EntityNames.Permissions))
+	assignRoleParents := consts.FormatPermissionTag(consts.Permissions.Assign,
+		consts.GetTableName(consts.EntityNames.RoleParents))
+	assignRolePermissions := consts.FormatPermissionTag(consts.Permissions.Assign,
+		consts.GetTableName(consts.EntityNames.RolePermissions))
+	assignUserRoles := consts.FormatPermissionTag(consts.Permissions.Assign,
+		consts.GetTableName(consts.EntityNames.UserRoles))
+	assignUserPermissions := consts.FormatPermissionTag(consts.Permissions.Assign,
+		consts.GetTableName(consts.EntityNames.UserPermissions))
+	// Admin API group
+	adminAPI := r.Group(sc.VersionedEndpoint("/api/admin"))
+	adminAPI.Use(auth.Middleware(sc.VersionedEndpoint("/api/admin"), sc, orm, che))
+	{
+		adminAPI.GET("/users",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.List, users)),
+			handlers.Users(orm))
+		adminAPI.GET("/users/:id",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.Read, users)),
+			handlers.User(orm))
+		adminAPI.PATCH("/users/:id",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.Update, users)),
+			auth.RequirePolicy(consts.Permissions.Update, users, auth.FromParams("id")),
+			handlers.UpdateUser(orm))
+		adminAPI.DELETE("/users/:id",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.Delete, users)),
+			auth.RequirePolicy(consts.Permissions.Delete, users, auth.FromParams("id")),
+			handlers.DeleteUser(orm))
+		adminAPI.POST("/users/:id/restore",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.Update, users)),
+			auth.RequirePolicy(consts.Permissions.Update, users, auth.FromParams("id")),
+			handlers.RestoreUser(orm))
+		adminAPI.PUT("/users/:id/roles/:roleId",
+			auth.RequirePermission(assignUserRoles), handlers.AddUserRole(orm))
+		adminAPI.DELETE("/users/:id/roles/:roleId",
+			auth.RequirePermission(assignUserRoles), handlers.RemoveUserRole(orm))
+		adminAPI.PUT("/users/:id/permissions/:permissionId",
+			auth.RequirePermission(assignUserPermissions), handlers.AddUserPermission(orm))
+		adminAPI.DELETE("/users/:id/permissions/:permissionId",
+			auth.RequirePermission(assignUserPermissions), handlers.RemoveUserPermission(orm))
+
+		// Roles and permissions, the system ones can't be renamed or deleted
+		adminAPI.GET("/roles", auth.RequirePermission(assignRoles), handlers.Roles(orm))
+		adminAPI.POST("/roles", auth.RequirePermission(assignRoles), handlers.CreateRole(orm))
+		adminAPI.GET("/roles/:id", auth.RequirePermission(assignRoles), handlers.Role(orm))
+		adminAPI.PATCH("/roles/:id", auth.RequirePermission(assignRoles), handlers.UpdateRole(orm))
+		adminAPI.DELETE("/roles/:id", auth.RequirePermission(assignRoles), handlers.DeleteRole(orm))
+		adminAPI.PUT("/roles/:id/parents/:parentId",
+			auth.RequirePermission(assignRoleParents), handlers.AddRoleParent(orm))
+		adminAPI.DELETE("/roles/:id/parents/:parentId",
+			auth.RequirePermission(assignRoleParents), handlers.RemoveRoleParent(orm))
+		adminAPI.PUT("/roles/:id/permissions/:permissionId",
+			auth.RequirePermission(assignRolePermissions), handlers.AddRolePermission(orm))
+		adminAPI.DELETE("/roles/:id/permissions/:permissionId",
+			auth.RequirePermission(assignRolePermissions), handlers.RemoveRolePermission(orm))
+		adminAPI.GET("/permissions", auth.RequirePermission(assignPermissions), handlers.Permissions(orm))
+		adminAPI.POST("/permissions", auth.RequirePermission(assignPermissions), handlers.CreatePermission(orm))
+		adminAPI.PATCH("/permissions/:id", auth.RequirePermission(assignPermissions), handlers.UpdatePermission(orm))
+		adminAPI.DELETE("/permissions/:id", auth.RequirePermission(assignPermissions), handlers.DeletePermission(orm))
+
+		adminAPI.DELETE("/lockouts",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.Update, users)),
+			handlers.Unlock(sc, che))
+		adminAPI.GET("/oauth-clients",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.List, clients)),
+			handlers.OAuthClients(orm))
+		adminAPI.POST("/oauth-clients",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.Create, clients)),
+			handlers.CreateOAuthClient(orm))
+		adminAPI.DELETE("/oauth-clients/:clientId",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.Delete, clients)),
+			handlers.DeleteOAuthClient(orm))
+		adminAPI.POST("/impersonate/:userId",
+			auth.RequirePermission(auth.ImpersonatePermission),
+			handlers.Impersonate(sc, orm))
+		adminAPI.GET("/impersonations",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.List, impersonations)),
+			handlers.Impersonations(orm))
+		adminAPI.GET("/policies",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.List, policies)),
+			handlers.Policies())
+		adminAPI.POST("/policies/explain",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.Read, policies)),
+			handlers.ExplainPolicy(orm))
+		adminAPI.GET("/scim-clients",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.List, scimClients)),
+			handlers.SCIMClients(orm))
+		adminAPI.POST("/scim-clients",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.Create, scimClients)),
+			handlers.CreateSCIMClient(orm))
+		adminAPI.DELETE("/scim-clients/:id",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.Delete, scimClients)),
+			handlers.DeleteSCIMClient(orm))
+		adminAPI.GET("/audit",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.List, auditEntries)),
+			handlers.AuditEntries(orm))
+	}
+	return nil
+}
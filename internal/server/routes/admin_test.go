@@ -0,0 +1,210 @@
+package routes_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/migration"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/internal/server/routes"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/policy"
+)
+
+// sqliteServer is the admin and api routes on a migrated and seeded SQLite
+// database
+func sqliteServer(t *testing.T) (*gin.Engine, *orm.ORM) {
+	gin.SetMode(gin.TestMode)
+	o, err := orm.Init(&cfg.DB{
+		Dialect: consts.Dialects.SQLite,
+		DSN:     filepath.Join(t.TempDir(), "test.db") + "?_foreign_keys=on",
+	})
+	if err != nil {
+		t.Fatalf("orm.Init() error = %v", err)
+	}
+	if err := migration.ServiceAutoMigration(o.DB); err != nil {
+		t.Fatalf("migration.ServiceAutoMigration() error = %v", err)
+	}
+	r := gin.New()
+	if err := routes.Admin(&cfg.Server{}, r, o, nil); err != nil {
+		t.Fatalf("routes.Admin() error = %v", err)
+	}
+	if err := routes.AuthAPI(&cfg.Server{}, r, o, nil); err != nil {
+		t.Fatalf("routes.AuthAPI() error = %v", err)
+	}
+	return r, o
+}
+
+// seededKey is the API key of the seeded user with the email
+func seededKey(t *testing.T, o *orm.ORM, email string) *models.UserAPIKey {
+	k := &models.UserAPIKey{}
+	if err := o.DB.Joins("User").First(k, `"User"."email" = ?`, email).Error; err != nil {
+		t.Fatalf("First() of the seeded API key error = %v", err)
+	}
+	return k
+}
+
+func TestAdmin_userPolicies(t *testing.T) {
+	r, o := sqliteServer(t)
+	admin := seededKey(t, o, "admin@test.com")
+	user := seededKey(t, o, "user@test.com")
+	users := "/v1/api/admin/users"
+	// the seeded user role only reads users, the rest is the administrators'
+	tests := []struct {
+		name       string
+		key        *models.UserAPIKey
+		method     string
+		path       string
+		body       string
+		wantCode   int
+		wantDenied bool
+	}{
+		{name: "user lists the users", key: user, method: http.MethodGet, path: users,
+			wantCode: http.StatusForbidden},
+		{name: "user changes the admin's email", key: user, method: http.MethodPatch, path: users + "/" + admin.UserID.String(),
+			body: `{"email":"taken@test.com"}`, wantCode: http.StatusForbidden},
+		{name: "user restores the admin", key: user, method: http.MethodPost, path: users + "/" + admin.UserID.String() + "/restore",
+			wantCode: http.StatusForbidden},
+		{name: "user deletes the admin", key: user, method: http.MethodDelete, path: users + "/" + admin.UserID.String(),
+			wantCode: http.StatusForbidden},
+		{name: "admin deletes themselves", key: admin, method: http.MethodDelete, path: users + "/" + admin.UserID.String(),
+			wantCode: http.StatusForbidden, wantDenied: true},
+		{name: "admin lists the users", key: admin, method: http.MethodGet, path: users,
+			wantCode: http.StatusOK},
+		{name: "admin changes the user's name", key: admin, method: http.MethodPatch, path: users + "/" + user.UserID.String(),
+			body: `{"first_name":"Renamed"}`, wantCode: http.StatusOK},
+		{name: "admin deletes the user", key: admin, method: http.MethodDelete, path: users + "/" + user.UserID.String(),
+			wantCode: http.StatusNoContent},
+		{name: "admin restores the user", key: admin, method: http.MethodPost, path: users + "/" + user.UserID.String() + "/restore",
+			wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(auth.APIKeyHeader, tt.key.APIKey)
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("%s %s code = %d %s, want %d", tt.method, tt.path, w.Code, w.Body, tt.wantCode)
+			}
+			if tt.wantDenied && !strings.Contains(w.Body.String(), policy.ErrDenied.Error()) {
+				t.Errorf("%s %s = %s, want denied by the policies", tt.method, tt.path, w.Body)
+			}
+		})
+	}
+}
+
+func TestAdmin_updateUserPolicy(t *testing.T) {
+	r, o := sqliteServer(t)
+	admin := seededKey(t, o, "admin@test.com")
+	user := seededKey(t, o, "user@test.com")
+	// a role that may update users, but isn't the administrators' the
+	// policies let manage them
+	editors := &models.Role{Name: "editors"}
+	if err := o.CreateRole(editors); err != nil {
+		t.Fatal(err)
+	}
+	p := &models.Permission{}
+	if err := o.DB.First(p, "tag = ?", consts.FormatPermissionTag(consts.Permissions.Update,
+		consts.GetTableName(consts.EntityNames.Users))).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := o.AddRolePermission(editors.ID, p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.AddUserRole(user.UserID, editors.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		"/v1/api/admin/users/" + admin.UserID.String(),
+		"/v1/api/admin/users/" + admin.UserID.String() + "/restore",
+	} {
+		w := httptest.NewRecorder()
+		method := http.MethodPatch
+		if strings.HasSuffix(path, "/restore") {
+			method = http.MethodPost
+		}
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"email":"taken@test.com"}`))
+		req.Header.Set(auth.APIKeyHeader, user.APIKey)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), policy.ErrDenied.Error()) {
+			t.Errorf("%s %s by an editor = %d %s, want denied by the policies", method, path, w.Code, w.Body)
+		}
+	}
+}
+
+func TestAdmin_grantPolicy(t *testing.T) {
+	r, o := sqliteServer(t)
+	admin := seededKey(t, o, "admin@test.com")
+	user := seededKey(t, o, "user@test.com")
+	permission := func(action, entity string) *models.Permission {
+		p := &models.Permission{}
+		if err := o.DB.First(p, "tag = ?", consts.FormatPermissionTag(action, consts.GetTableName(entity))).Error; err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	deleteUsers := permission(consts.Permissions.Delete, consts.EntityNames.Users)
+	grant := func(key *models.UserAPIKey, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/v1/api/admin"+path, nil)
+		req.Header.Set(auth.APIKeyHeader, key.APIKey)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// the user role can't assign roles at all
+	if w := grant(user, "/users/"+user.UserID.String()+"/roles/1"); w.Code != http.StatusForbidden {
+		t.Fatalf("PUT /users/:id/roles/:roleId by the user code = %d %s, want %d", w.Code, w.Body, http.StatusForbidden)
+	}
+
+	// and once it may, only what it holds and never to itself
+	for _, p := range []*models.Permission{
+		permission(consts.Permissions.Assign, consts.EntityNames.UserRoles),
+		permission(consts.Permissions.Assign, consts.EntityNames.UserPermissions),
+		permission(consts.Permissions.Assign, consts.EntityNames.RolePermissions),
+	} {
+		if err := o.AddUserPermission(user.UserID, p.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		key      *models.UserAPIKey
+		path     string
+		wantCode int
+		wantErr  error
+	}{
+		{name: "user grants themselves admin", key: user, path: "/users/" + user.UserID.String() + "/roles/1",
+			wantCode: http.StatusForbidden, wantErr: auth.ErrSelfGrant},
+		{name: "user grants a permission to themselves", key: user, path: "/users/" + user.UserID.String() + "/permissions/" + strconv.Itoa(int(deleteUsers.ID)),
+			wantCode: http.StatusForbidden, wantErr: auth.ErrSelfGrant},
+		{name: "user grants admin to someone", key: user, path: "/users/" + admin.UserID.String() + "/roles/1",
+			wantCode: http.StatusForbidden, wantErr: auth.ErrCantGrant},
+		{name: "user grants a permission it lacks", key: user, path: "/users/" + admin.UserID.String() + "/permissions/" + strconv.Itoa(int(deleteUsers.ID)),
+			wantCode: http.StatusForbidden, wantErr: auth.ErrCantGrant},
+		{name: "user adds a permission it lacks to its role", key: user, path: "/roles/2/permissions/" + strconv.Itoa(int(deleteUsers.ID)),
+			wantCode: http.StatusForbidden, wantErr: auth.ErrCantGrant},
+		{name: "admin grants a permission it holds", key: admin, path: "/users/" + user.UserID.String() + "/permissions/" + strconv.Itoa(int(deleteUsers.ID)),
+			wantCode: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := grant(tt.key, tt.path)
+			if w.Code != tt.wantCode {
+				t.Errorf("PUT %s code = %d %s, want %d", tt.path, w.Code, w.Body, tt.wantCode)
+			}
+			if tt.wantErr != nil && !strings.Contains(w.Body.String(), tt.wantErr.Error()) {
+				t.Errorf("PUT %s = %s, want %v", tt.path, w.Body, tt.wantErr)
+			}
+		})
+	}
+}
@@ -6,22 +6,74 @@ import (
 	"github.com/rakin92/go-rest-service/internal/server/handlers"
 	"github.com/rakin92/go-rest-service/pkg/auth"
 	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/storage/cache"
 )
 
 // AuthAPI is the related routes which is only available user to be authenticated
 // user may use weather OAuth with JWT auth token or x-api-key headers
-func AuthAPI(sc *cfg.Server, r *gin.Engine, orm *orm.ORM) error {
+func AuthAPI(sc *cfg.Server, r *gin.Engine, orm *orm.ORM, che *cache.Cache) error {
+	provider := string(consts.ProjectContextKeys.ProviderCtxKey)
+	members := consts.GetTableName(consts.EntityNames.Memberships)
+	users := consts.GetTableName(consts.EntityNames.Users)
 	// Authorization API group
 	authorizedAPI := r.Group(sc.VersionedEndpoint("/api"))
-	authorizedAPI.Use(auth.Middleware(sc.VersionedEndpoint("/api"), sc, orm))
+	authorizedAPI.Use(auth.Middleware(sc.VersionedEndpoint("/api"), sc, orm, che))
 	{
-		authorizedAPI.GET("/user/:id", handlers.Health())
+		authorizedAPI.GET("/user/:id",
+			auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.Read, users)),
+			handlers.User(orm))
+
+		// The authenticated user
+		authorizedAPI.GET("/me", handlers.Me(orm))
+		authorizedAPI.PATCH("/me", handlers.UpdateMe(orm))
+
+		// Linked OAuth identities of the authenticated user, they sign in to
+		// the account so only the user's own session manages them
+		authorizedAPI.GET("/me/identities", auth.RequireSession(), handlers.Identities(orm))
+		authorizedAPI.GET("/me/identities/:"+provider+"/link", auth.RequireSession(), handlers.LinkIdentity(sc))
+		authorizedAPI.DELETE("/me/identities/:id", auth.RequireSession(), handlers.UnlinkIdentity(orm))
+
+		// Apps the authenticated user authorised through OAuth
+		authorizedAPI.GET("/me/apps", handlers.AuthorizedApps(orm))
+		authorizedAPI.DELETE("/me/apps/:clientId", handlers.RevokeApp(orm))
+
+		// Devices the authenticated user is signed in on
+		authorizedAPI.GET("/me/sessions", handlers.Sessions(orm))
+		authorizedAPI.DELETE("/me/sessions/:id", handlers.RevokeSession(orm))
+
+		// API keys of the authenticated user and their signing settings, a
+		// key can't loosen its own restrictions
+		authorizedAPI.GET("/me/api-keys", handlers.APIKeys(orm))
+		authorizedAPI.PATCH("/me/api-keys/:id", auth.RequireSession(), handlers.UpdateAPIKey(orm))
+		authorizedAPI.POST("/me/api-keys/:id/signing-secret", auth.RequireSession(), handlers.RotateSigningSecret(orm))
+
+		// Organizations of the authenticated user
+		authorizedAPI.POST("/orgs", handlers.CreateOrganization(orm))
+		authorizedAPI.GET("/me/orgs", handlers.MyOrganizations(orm))
+		authorizedAPI.GET("/me/invitations", handlers.MyInvitations(orm))
+		authorizedAPI.POST("/me/invitations/:id/accept", handlers.AcceptInvitation(orm))
+
+		// Members of the organization in the path, scoped to the membership
+		orgs := authorizedAPI.Group("/orgs/:" + auth.TenantParam)
+		orgs.GET("/members",
+			auth.RequireTenantPermission(consts.FormatPermissionTag(consts.Permissions.List, members)),
+			handlers.Members(orm))
+		orgs.POST("/invitations",
+			auth.RequireTenantPermission(consts.FormatPermissionTag(consts.Permissions.Create, members)),
+			handlers.InviteMember(orm))
+		orgs.DELETE("/members/:userId",
+			auth.RequireTenantPermission(consts.FormatPermissionTag(consts.Permissions.Delete, members)),
+			handlers.RemoveMember(orm))
+
+		// Models without handlers of their own get the generic CRUD endpoints
+		// with RegisterResource(authorizedAPI, orm, &handlers.Resource[T]{...})
 	}
 	return nil
 }
 
 // OpenAPI is the related open routes which can be used without being authenticated
-func OpenAPI(sc *cfg.Server, r *gin.Engine, orm *orm.ORM) error {
+func OpenAPI(sc *cfg.Server, r *gin.Engine, orm *orm.ORM, che *cache.Cache) error {
 	// Authorization API group
 	openAPI := r.Group(sc.VersionedEndpoint("/api"))
 	{
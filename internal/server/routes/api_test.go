@@ -0,0 +1,45 @@
+package routes_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rakin92/go-rest-service/pkg/auth"
+)
+
+func TestAuthAPI_apiKeySettingsNeedSession(t *testing.T) {
+	r, o := sqliteServer(t)
+	k := seededKey(t, o, "user@test.com")
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPatch, "/v1/api/me/api-keys/"+strconv.Itoa(int(k.ID)),
+			strings.NewReader(`{"require_signing":false}`)),
+		httptest.NewRequest(http.MethodPost, "/v1/api/me/api-keys/"+strconv.Itoa(int(k.ID))+"/signing-secret", nil),
+	} {
+		w := httptest.NewRecorder()
+		req.Header.Set(auth.APIKeyHeader, k.APIKey)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), auth.ErrSessionRequired.Error()) {
+			t.Errorf("%s %s with the API key = %d %s, want %d", req.Method, req.URL, w.Code, w.Body, http.StatusForbidden)
+		}
+	}
+}
+
+func TestAuthAPI_identitiesNeedSession(t *testing.T) {
+	r, o := sqliteServer(t)
+	k := seededKey(t, o, "user@test.com")
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/v1/api/me/identities", nil),
+		httptest.NewRequest(http.MethodGet, "/v1/api/me/identities/google/link", nil),
+		httptest.NewRequest(http.MethodDelete, "/v1/api/me/identities/1", nil),
+	} {
+		w := httptest.NewRecorder()
+		req.Header.Set(auth.APIKeyHeader, k.APIKey)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), auth.ErrSessionRequired.Error()) {
+			t.Errorf("%s %s with the API key = %d %s, want %d", req.Method, req.URL, w.Code, w.Body, http.StatusForbidden)
+		}
+	}
+}
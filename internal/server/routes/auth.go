@@ -4,17 +4,35 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/rakin92/go-rest-service/internal/orm"
 	"github.com/rakin92/go-rest-service/internal/server/handlers"
+	"github.com/rakin92/go-rest-service/pkg/auth"
 	"github.com/rakin92/go-rest-service/pkg/cfg"
 	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/storage/cache"
 )
 
 // Auth routes to support OAuth for auth providers
-func Auth(sc *cfg.Server, r *gin.Engine, orm *orm.ORM) error {
+func Auth(sc *cfg.Server, r *gin.Engine, orm *orm.ORM, che *cache.Cache) error {
 	provider := string(consts.ProjectContextKeys.ProviderCtxKey)
 	// OAuth handlers
 	rg := r.Group(sc.VersionedEndpoint("/auth"))
-	rg.GET("/:"+provider, handlers.AuthProviders())
+	rg.GET("/:"+provider, handlers.AuthProviders(sc))
 	rg.GET("/:"+provider+"/callback", handlers.Callback(sc, orm))
+	// Token handlers for native clients
+	rg.POST("/:"+provider+"/token", handlers.TokenExchange(sc, orm))
+	rg.POST("/refresh", handlers.Refresh(sc, orm))
+	// SAML service provider of each identity provider
+	sg := rg.Group("/saml/:" + string(consts.ProjectContextKeys.SAMLIdPCtxKey))
+	sg.GET("", handlers.SAMLLogin(sc))
+	sg.GET("/metadata", handlers.SAMLMetadata())
+	sg.POST("/acs", handlers.SAMLACS(sc, orm, che))
+	// Directory login with the user credentials
+	if sc.LDAP.URL != "" {
+		p, err := auth.NewLDAPProvider(&sc.LDAP)
+		if err != nil {
+			return err
+		}
+		rg.POST("/"+auth.LDAPProviderName+"/login", handlers.LDAPLogin(sc, orm, che, p))
+	}
 
 	return nil
 }
@@ -1,17 +1,26 @@
 package routes
 
 import (
+	"expvar"
+
 	"github.com/gin-gonic/gin"
 	"github.com/rakin92/go-rest-service/internal/orm"
 	"github.com/rakin92/go-rest-service/internal/server/handlers"
 	"github.com/rakin92/go-rest-service/pkg/auth"
 	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/storage/cache"
 )
 
 // Misc routes
-func Misc(sc *cfg.Server, r *gin.Engine, orm *orm.ORM) error {
+func Misc(sc *cfg.Server, r *gin.Engine, orm *orm.ORM, che *cache.Cache) error {
 	r.GET(sc.VersionedEndpoint("/health"), handlers.Health())
 	r.GET(sc.VersionedEndpoint("/secure-health"),
-		auth.Middleware(sc.VersionedEndpoint("/secure-health"), sc, orm), handlers.Health())
+		auth.Middleware(sc.VersionedEndpoint("/secure-health"), sc, orm, che), handlers.Health())
+	r.GET(sc.VersionedEndpoint("/metrics"),
+		auth.Middleware(sc.VersionedEndpoint("/metrics"), sc, orm, che),
+		auth.RequirePermission(consts.FormatPermissionTag(consts.Permissions.Read,
+			consts.GetTableName(consts.EntityNames.Metrics))),
+		gin.WrapH(expvar.Handler()))
 	return nil
 }
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/server/handlers"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/storage/cache"
+)
+
+// OAuth routes of the service acting as an OAuth2 authorization server
+func OAuth(sc *cfg.Server, r *gin.Engine, orm *orm.ORM, che *cache.Cache) error {
+	rg := r.Group(sc.VersionedEndpoint("/oauth"))
+	rg.POST("/token", handlers.Token(sc, orm))
+	rg.POST("/introspect", handlers.Introspect(sc, orm, che))
+
+	// Authorization code grant, the user must be signed in to give consent
+	authorize := rg.Group("/authorize")
+	authorize.Use(auth.Middleware(sc.VersionedEndpoint("/oauth/authorize"), sc, orm, che))
+	authorize.GET("", handlers.Authorize(sc, orm))
+	authorize.POST("", handlers.AuthorizeConsent(sc, orm))
+
+	// Claims about the user the token belongs to
+	userinfo := r.Group(sc.VersionedEndpoint("/userinfo"))
+	userinfo.Use(auth.Middleware(sc.VersionedEndpoint("/userinfo"), sc, orm, che))
+	userinfo.GET("", handlers.UserInfo())
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/server/handlers"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+)
+
+// RegisterResource mounts the list, get, create, update and delete endpoints
+// of the model under the group, each one guarded by the permission tag of its
+// action on the entity, like list:notes. The tags must be seeded
+func RegisterResource[T any](rg *gin.RouterGroup, orm *orm.ORM, res *handlers.Resource[T]) error {
+	if err := res.CheckFields(orm); err != nil {
+		return err
+	}
+	entity := consts.GetTableName(res.Entity)
+	can := func(action string) gin.HandlerFunc {
+		return auth.RequirePermission(consts.FormatPermissionTag(action, entity))
+	}
+	g := rg.Group(res.Path)
+	g.GET("", can(consts.Permissions.List), handlers.ListResource(orm, res))
+	g.POST("", can(consts.Permissions.Create), handlers.CreateResource(orm, res))
+	g.GET("/:id", can(consts.Permissions.Read), handlers.GetResource(orm, res))
+	g.PATCH("/:id", can(consts.Permissions.Update), handlers.UpdateResource(orm, res))
+	g.DELETE("/:id", can(consts.Permissions.Delete), handlers.DeleteResource(orm, res))
+	return nil
+}
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/server/handlers"
+	"github.com/rakin92/go-rest-service/pkg/auth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/storage/cache"
+)
+
+// SCIM routes the identity providers provision our users and groups with,
+// each one authenticates with the token of its SCIM client
+func SCIM(sc *cfg.Server, r *gin.Engine, orm *orm.ORM, che *cache.Cache) error {
+	rg := r.Group(sc.VersionedEndpoint("/scim/v2"))
+	rg.Use(auth.SCIMMiddleware(sc.VersionedEndpoint("/scim/v2"), sc, orm, che))
+	{
+		rg.GET("/ServiceProviderConfig", handlers.SCIMServiceProviderConfig())
+
+		rg.GET("/Users", handlers.SCIMUsers(sc, orm))
+		rg.POST("/Users", handlers.CreateSCIMUser(sc, orm))
+		rg.GET("/Users/:id", handlers.SCIMUser(sc, orm))
+		rg.PUT("/Users/:id", handlers.ReplaceSCIMUser(sc, orm))
+		rg.PATCH("/Users/:id", handlers.PatchSCIMUser(sc, orm))
+		rg.DELETE("/Users/:id", handlers.DeleteSCIMUser(sc, orm))
+
+		rg.GET("/Groups", handlers.SCIMGroups(sc, orm))
+		rg.POST("/Groups", handlers.CreateSCIMGroup(sc, orm))
+		rg.GET("/Groups/:id", handlers.SCIMGroup(sc, orm))
+		rg.PUT("/Groups/:id", handlers.ReplaceSCIMGroup(sc, orm))
+		rg.PATCH("/Groups/:id", handlers.PatchSCIMGroup(sc, orm))
+		rg.DELETE("/Groups/:id", handlers.DeleteSCIMGroup(orm))
+	}
+	return nil
+}
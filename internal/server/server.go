@@ -10,25 +10,40 @@ import (
 )
 
 // registerRoutes register the routes for the server
-func registerRoutes(sc *cfg.Server, r *gin.Engine, orm *orm.ORM) (err error) {
+func registerRoutes(sc *cfg.Server, r *gin.Engine, orm *orm.ORM, che *cache.Cache) (err error) {
 
 	// Miscellaneous routes
-	if err = routes.Misc(sc, r, orm); err != nil {
+	if err = routes.Misc(sc, r, orm, che); err != nil {
 		return err
 	}
 
 	// Auth routes
-	if err = routes.Auth(sc, r, orm); err != nil {
+	if err = routes.Auth(sc, r, orm, che); err != nil {
+		return err
+	}
+
+	// OAuth2 server routes
+	if err = routes.OAuth(sc, r, orm, che); err != nil {
 		return err
 	}
 
 	// Authenticated API routes
-	if err = routes.AuthAPI(sc, r, orm); err != nil {
+	if err = routes.AuthAPI(sc, r, orm, che); err != nil {
+		return err
+	}
+
+	// SCIM provisioning routes
+	if err = routes.SCIM(sc, r, orm, che); err != nil {
+		return err
+	}
+
+	// Admin API routes
+	if err = routes.Admin(sc, r, orm, che); err != nil {
 		return err
 	}
 
 	// Open API routes
-	if err = routes.OpenAPI(sc, r, orm); err != nil {
+	if err = routes.OpenAPI(sc, r, orm, che); err != nil {
 		return err
 	}
 
@@ -39,14 +54,28 @@ func registerRoutes(sc *cfg.Server, r *gin.Engine, orm *orm.ORM) (err error) {
 func Run(sc *cfg.Server, orm *orm.ORM, che *cache.Cache) {
 	r := gin.New()
 
+	// Only believe the forwarded client IP of our own proxies
+	if err := r.SetTrustedProxies(sc.TrustedProxies); err != nil {
+		logger.Fatal(&err, "Failed to set the trusted proxies")
+	}
+
 	r.Use(gin.Recovery())
 	r.Use(logger.Middleware(sc.ServiceName))
 
 	// Initialize the Auth providers
-	initializeAuthProviders(sc)
+	if err := initializeAuthProviders(sc); err != nil {
+		logger.Fatal(&err, "Failed to initialize the auth providers")
+	}
+
+	// Load the policies resources are authorized with
+	if err := initializePolicies(sc); err != nil {
+		logger.Fatal(&err, "Failed to load the policies")
+	}
 
 	// Routes and Handlers
-	registerRoutes(sc, r, orm)
+	if err := registerRoutes(sc, r, orm, che); err != nil {
+		logger.Fatal(&err, "Failed to register the routes")
+	}
 
 	// Inform the user where the server is listening
 	logger.Info("Running %s @ %s", sc.ServiceName, sc.SchemaVersionedEndpoint(""))
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+)
+
+var (
+	// ErrSelfGrant when a user grants themselves a role or a permission
+	ErrSelfGrant = errors.New("you can't grant yourself a role or permission")
+	// ErrCantGrant when the role or permission granted is one the user
+	// doesn't hold
+	ErrCantGrant = errors.New("you can't grant a role or permission you don't hold")
+)
+
+// CanGrantTo checks the user granting isn't the one granted
+func CanGrantTo(granter *models.User, userID uuid.UUID) error {
+	if granter.ID == userID {
+		return ErrSelfGrant
+	}
+	return nil
+}
+
+// CanGrantRole checks the user holds the role, or every permission of it when
+// it isn't a system one, the policies give the system roles more than their
+// permissions
+func CanGrantRole(granter *models.User, r *models.Role) error {
+	if ok, _ := granter.HasRole(int(r.ID)); ok {
+		return nil
+	}
+	if consts.IsSystemRole(r.Name) {
+		return ErrCantGrant
+	}
+	for _, p := range r.Permissions {
+		if ok, _ := granter.HasPermissionTag(p.Tag); !ok {
+			return ErrCantGrant
+		}
+	}
+	return nil
+}
+
+// CanGrantPermission checks the user holds the permission
+func CanGrantPermission(granter *models.User, p *models.Permission) error {
+	if ok, _ := granter.HasPermissionTag(p.Tag); !ok {
+		return ErrCantGrant
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+)
+
+func TestCanGrant(t *testing.T) {
+	support := models.Role{Name: "support", Permissions: []models.Permission{{Tag: "read:users"}, {Tag: "update:users"}}}
+	support.ID = 3
+	granter := &models.User{Roles: []models.Role{support}, Permissions: []models.Permission{{Tag: "assign:user_roles"}}}
+	granter.ID = uuid.Must(uuid.NewV4())
+	role := func(id uint, name string, tags ...string) *models.Role {
+		r := &models.Role{Name: name}
+		r.ID = id
+		for _, tag := range tags {
+			r.Permissions = append(r.Permissions, models.Permission{Tag: tag})
+		}
+		return r
+	}
+	t.Run("to", func(t *testing.T) {
+		if err := CanGrantTo(granter, uuid.Must(uuid.NewV4())); err != nil {
+			t.Errorf("CanGrantTo() someone else error = %v", err)
+		}
+		if err := CanGrantTo(granter, granter.ID); err != ErrSelfGrant {
+			t.Errorf("CanGrantTo() themselves error = %v, want %v", err, ErrSelfGrant)
+		}
+	})
+	roles := []struct {
+		name    string
+		role    *models.Role
+		wantErr error
+	}{
+		{name: "a role held", role: &support},
+		{name: "fewer permissions", role: role(4, "reader", "read:users")},
+		{name: "a permission the granter lacks", role: role(4, "deleter", "read:users", "delete:users"), wantErr: ErrCantGrant},
+		{name: "a system role not held", role: role(1, "admin"), wantErr: ErrCantGrant},
+	}
+	for _, tt := range roles {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CanGrantRole(granter, tt.role); err != tt.wantErr {
+				t.Errorf("CanGrantRole() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	permissions := []struct {
+		name    string
+		tag     string
+		wantErr error
+	}{
+		{name: "a permission of a role", tag: "update:users"},
+		{name: "a direct permission", tag: "assign:user_roles"},
+		{name: "a permission not held", tag: "delete:users", wantErr: ErrCantGrant},
+	}
+	for _, tt := range permissions {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CanGrantPermission(granter, &models.Permission{Tag: tt.tag}); err != tt.wantErr {
+				t.Errorf("CanGrantPermission() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// ImpersonationHeader is set on every response to an impersonated request,
+// with the id of the admin
+const ImpersonationHeader = "X-Impersonated-By"
+
+var (
+	// ErrNoImpersonator when the request isn't made impersonating a user
+	ErrNoImpersonator = errors.New("not impersonating a user")
+	// ErrCantImpersonate when the admin isn't allowed to act as the user
+	ErrCantImpersonate = errors.New("this user can't be impersonated")
+
+	// ImpersonatePermission is the permission tag needed to impersonate users
+	ImpersonatePermission = consts.FormatPermissionTag(consts.Permissions.Create,
+		consts.GetTableName(consts.EntityNames.Impersonations))
+)
+
+// GetImpersonator returns the admin impersonating the user of the request
+func GetImpersonator(c *gin.Context) (*models.User, error) {
+	v, exists := c.Get(string(consts.ProjectContextKeys.ImpersonatorCtxKey))
+	if !exists {
+		return nil, ErrNoImpersonator
+	}
+	u, ok := v.(*models.User)
+	if !ok || u == nil {
+		return nil, ErrNoImpersonator
+	}
+	return u, nil
+}
+
+// CanImpersonate checks the admin may act as the user: the admin can
+// impersonate, the user can't, and every permission of the user is one the
+// admin has already, so nobody gains a permission by impersonating
+func CanImpersonate(admin, user *models.User) error {
+	if ok, _ := admin.HasPermissionTag(ImpersonatePermission); !ok {
+		return ErrForbidden
+	}
+	if ok, _ := user.HasPermissionTag(ImpersonatePermission); ok || user.ID == admin.ID {
+		return ErrCantImpersonate
+	}
+	for _, tag := range user.PermissionTags() {
+		if ok, _ := admin.HasPermissionTag(tag); !ok {
+			return ErrCantImpersonate
+		}
+	}
+	return nil
+}
+
+// setImpersonator adds the admin impersonating the user to our gin context
+func setImpersonator(c *gin.Context, admin *models.User) {
+	c.Request = addToContext(c, consts.ProjectContextKeys.ImpersonatorCtxKey, admin)
+	c.Request = addToContext(c, consts.ProjectContextKeys.ImpersonatorIDCtxKey, admin.ID)
+}
+
+// authenticateImpersonation authenticates an admin acting as a user, the
+// admin must still be allowed to. Every request is recorded in the audit log
+// before it's handled, its status once answered
+func authenticateImpersonation(c *gin.Context, t *jwt.Token, orm *orm.ORM) {
+	claims, err := ClaimsFromToken(t)
+	if err != nil {
+		authError(c, err)
+		return
+	}
+	if claims.Act == nil {
+		authError(c, ErrForbidden)
+		return
+	}
+	userID, uerr := uuid.FromString(claims.Subject)
+	adminID, aerr := uuid.FromString(claims.Act.Subject)
+	if uerr != nil || aerr != nil {
+		authError(c, ErrForbidden)
+		return
+	}
+	admin, err := orm.FindUserByID(adminID)
+	if err != nil {
+		authError(c, ErrForbidden)
+		return
+	}
+	user, err := orm.FindUserByID(userID)
+	if err != nil {
+		authError(c, ErrForbidden)
+		return
+	}
+	// the permissions of either may have changed since the token was issued
+	if err := CanImpersonate(admin, user); err != nil {
+		authError(c, ErrForbidden)
+		return
+	}
+	entry := &models.ImpersonationLog{
+		TokenID:        claims.ID,
+		ImpersonatorID: admin.ID,
+		UserID:         user.ID,
+		Method:         c.Request.Method,
+		Path:           c.Request.URL.Path,
+		ClientIP:       c.ClientIP(),
+	}
+	if err := orm.CreateImpersonationLog(entry); err != nil {
+		// no impersonated request without its audit trail
+		logger.Error(&err, "[Auth.Impersonation] failed to audit the request of: %s as: %s", admin.ID, user.ID)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "[Auth] error: " + err.Error()})
+		return
+	}
+	setUser(c, user)
+	setImpersonator(c, admin)
+	c.Header(ImpersonationHeader, admin.ID.String())
+	logger.Debug("User: %s impersonated by: %s", user.ID, admin.ID)
+
+	nextWithTenant(c, orm)
+
+	if err := orm.SetImpersonationLogStatus(entry.ID, c.Writer.Status()); err != nil {
+		logger.Error(&err, "[Auth.Impersonation] failed to audit the status of: %s as: %s", admin.ID, user.ID)
+	}
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestGetImpersonator(t *testing.T) {
+	t.Run("not impersonating", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		if _, err := GetImpersonator(c); err != ErrNoImpersonator {
+			t.Errorf("GetImpersonator() error = %v, want %v", err, ErrNoImpersonator)
+		}
+	})
+	t.Run("impersonating", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		admin := &models.User{Email: "admin@test.com"}
+		setImpersonator(c, admin)
+		got, err := GetImpersonator(c)
+		if err != nil {
+			t.Errorf("GetImpersonator() error = %v, wantErr %v", err, false)
+			return
+		}
+		if got != admin {
+			t.Errorf("GetImpersonator() = %v, want %v", got, admin)
+		}
+	})
+}
+
+func TestCanImpersonate(t *testing.T) {
+	impersonate := models.Permission{Tag: ImpersonatePermission}
+	admin := &models.User{Roles: []models.Role{{Name: "support", Permissions: []models.Permission{
+		impersonate, {Tag: "read:users"}, {Tag: "update:users"},
+	}}}}
+	admin.ID = uuid.Must(uuid.NewV4())
+	user := func(tags ...string) *models.User {
+		u := &models.User{}
+		u.ID = uuid.Must(uuid.NewV4())
+		for _, tag := range tags {
+			u.Permissions = append(u.Permissions, models.Permission{Tag: tag})
+		}
+		return u
+	}
+	tests := []struct {
+		name    string
+		admin   *models.User
+		user    *models.User
+		wantErr error
+	}{
+		{name: "fewer permissions", admin: admin, user: user("read:users")},
+		{name: "same permissions", admin: admin, user: user("read:users", "update:users")},
+		{name: "a permission the admin lacks", admin: admin, user: user("read:users", "delete:users"), wantErr: ErrCantImpersonate},
+		{name: "another impersonator", admin: admin, user: user(ImpersonatePermission), wantErr: ErrCantImpersonate},
+		{name: "themselves", admin: admin, user: admin, wantErr: ErrCantImpersonate},
+		{name: "not an impersonator", admin: user("read:users"), user: user(), wantErr: ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CanImpersonate(tt.admin, tt.user); err != tt.wantErr {
+				t.Errorf("CanImpersonate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMiddleware_impersonationAudit(t *testing.T) {
+	jwtParse = jwt.Parse
+	gin.SetMode(gin.TestMode)
+	sc := testServer()
+	sc.Auth.ImpersonationTTL = time.Minute
+	admin := &models.User{Email: "admin@test.com"}
+	admin.ID = uuid.Must(uuid.NewV4())
+	u := &models.User{Email: "user@test.com"}
+	u.ID = uuid.Must(uuid.NewV4())
+	token, _, err := IssueImpersonationToken(sc, admin, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, audited := range []bool{true, false} {
+		t.Run(fmt.Sprintf("audited %v", audited), func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			permID := 1
+			mock.ExpectQuery(`SELECT \* FROM "users"`).WithArgs(admin.ID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(admin.ID, admin.Email))
+			mock.ExpectQuery(`SELECT \* FROM "user_permissions"`).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "permission_id"}).AddRow(admin.ID, permID))
+			mock.ExpectQuery(`SELECT \* FROM "permissions"`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "tag"}).AddRow(permID, ImpersonatePermission))
+			mock.ExpectQuery(`SELECT \* FROM "user_roles"`).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "role_id"}))
+			mock.ExpectQuery(`SELECT \* FROM "users"`).WithArgs(u.ID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(u.ID, u.Email))
+			mock.ExpectQuery(`SELECT \* FROM "user_permissions"`).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "permission_id"}))
+			mock.ExpectQuery(`SELECT \* FROM "user_roles"`).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "role_id"}))
+			mock.ExpectBegin()
+			insert := mock.ExpectQuery(`INSERT INTO "impersonation_logs"`)
+			if audited {
+				insert.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "impersonation_logs" SET "status"=\$1,"updated_at"=\$2 WHERE id = \$3`).
+					WithArgs(http.StatusTeapot, sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				insert.WillReturnError(errors.New("disk full"))
+				mock.ExpectRollback()
+			}
+
+			handled := false
+			w := httptest.NewRecorder()
+			_, r := gin.CreateTestContext(w)
+			r.Use(Middleware("/", sc, &orm.ORM{DB: gormDB}, nil))
+			r.GET("/", func(c *gin.Context) {
+				handled = true
+				c.Status(http.StatusTeapot)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			r.ServeHTTP(w, req)
+			if handled != audited {
+				t.Errorf("Middleware() handled = %v, want the request handled only once audited", handled)
+			}
+			if !audited && w.Code != http.StatusInternalServerError {
+				t.Errorf("Middleware() status = %d, want %d", w.Code, http.StatusInternalServerError)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
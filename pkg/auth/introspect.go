@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+)
+
+// APIKeyTokenType is the token_type introspection reports for api keys
+const APIKeyTokenType = "api_key"
+
+// Introspection is the state of a token, RFC 7662 section 2.2. Nothing but
+// active is told about inactive tokens
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	ID        string `json:"jti,omitempty"`
+	// extensions, the user the token acts as and how it was issued
+	UserID    string `json:"user_id,omitempty"`
+	Type      string `json:"typ,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	Act       *Actor `json:"act,omitempty"`
+}
+
+// Introspect tells if the token, a jwt we issued or an api key, would still
+// be accepted by Middleware and what it was issued for. Tokens failing for
+// any reason are inactive. Like Middleware, forged tokens and unknown keys
+// count as failed attempts of the ip asking, with lk when not nil
+func Introspect(ctx context.Context, sc *cfg.Server, orm *orm.ORM, lk *Lockout, ip string, token string) *Introspection {
+	t, err := ParseTokenString(sc, token)
+	if err != nil {
+		ve, ok := err.(*jwt.ValidationError)
+		if ok && ve.Errors&jwt.ValidationErrorMalformed != 0 {
+			return introspectAPIKey(ctx, orm, lk, ip, token)
+		}
+		if ok && ve.Errors&jwt.ValidationErrorSignatureInvalid != 0 {
+			lk.Fail(ctx, IPKey(ip))
+		}
+		return &Introspection{}
+	}
+	claims, err := ClaimsFromToken(t)
+	if err != nil || claims.ExpiresAt == nil {
+		return &Introspection{}
+	}
+	in := &Introspection{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: TokenHeadName,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		Subject:   claims.Subject,
+		Issuer:    claims.Issuer,
+		ID:        claims.ID,
+		Type:      claims.TokenType,
+		SessionID: claims.SessionID,
+		Act:       claims.Act,
+	}
+	if claims.IssuedAt != nil {
+		in.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		in.NotBefore = claims.NotBefore.Unix()
+	}
+	if err := introspectSubject(sc, orm, claims, in); err != nil {
+		return &Introspection{}
+	}
+	return in
+}
+
+// introspectSubject verifies what the token was issued to is still there,
+// the same way Middleware does, and fills who it is
+func introspectSubject(sc *cfg.Server, orm *orm.ORM, claims *Claims, in *Introspection) error {
+	switch claims.TokenType {
+	case ClientTokenType:
+		_, err := orm.FindOAuthClient(claims.ClientID)
+		return err
+	case DelegatedTokenType:
+		grantID, err := uuid.FromString(claims.ID)
+		if err != nil {
+			return err
+		}
+		grant, err := orm.FindOAuthGrantByID(grantID)
+		if err != nil {
+			return err
+		}
+		if grant.UserID.String() != claims.Subject || grant.ClientID != claims.ClientID {
+			return ErrForbidden
+		}
+		u, err := orm.FindUserByID(grant.UserID)
+		if err != nil {
+			return err
+		}
+		in.Username, in.UserID = u.Email, u.ID.String()
+		return nil
+	case ImpersonationTokenType:
+		if claims.Act == nil {
+			return ErrNoClaims
+		}
+		userID, uerr := uuid.FromString(claims.Subject)
+		adminID, aerr := uuid.FromString(claims.Act.Subject)
+		if uerr != nil || aerr != nil {
+			return ErrNoClaims
+		}
+		admin, err := orm.FindUserByID(adminID)
+		if err != nil {
+			return err
+		}
+		u, err := orm.FindUserByID(userID)
+		if err != nil {
+			return err
+		}
+		if err := CanImpersonate(admin, u); err != nil {
+			return ErrForbidden
+		}
+		in.Username, in.UserID = u.Email, u.ID.String()
+		return nil
+	case RefreshTokenType, AccessTokenType, "":
+		u, err := orm.FindUserByJWT(claims.Issuer, claims.ID)
+		if err != nil {
+			return err
+		}
+		if claims.SessionID != "" {
+			sid, err := uuid.FromString(claims.SessionID)
+			if err != nil {
+				return ErrNoClaims
+			}
+			if _, err := orm.FindActiveSession(sid, u.ID); err != nil {
+				return ErrSessionRevoked
+			}
+		} else if claims.TokenType != RefreshTokenType {
+			// the refresh tokens without one get one when they are used
+			if err := sessionless(sc, time.Now()); err != nil {
+				return err
+			}
+		}
+		if claims.TokenType == RefreshTokenType {
+			in.TokenType = ""
+		}
+		in.Username, in.UserID = u.Email, u.ID.String()
+		return nil
+	}
+	return ErrInvalidTokenType
+}
+
+// introspectAPIKey looks the token up as an api key. The keys restricted to
+// signed requests, ip ranges or paths are inactive, whoever holds them can't
+// be told to be allowed on their own
+func introspectAPIKey(ctx context.Context, orm *orm.ORM, lk *Lockout, ip string, token string) *Introspection {
+	if token == "" {
+		return &Introspection{}
+	}
+	ipKey, accountKey, prefixKey := IPKey(ip), AccountKey(token), KeyPrefixKey(token)
+	if _, err := lk.Check(ctx, accountKey, prefixKey); err != nil {
+		return &Introspection{}
+	}
+	k, err := orm.FindAPIKey(token)
+	if err != nil || k == nil {
+		lk.Fail(ctx, prefixKey, ipKey)
+		return &Introspection{}
+	}
+	if k.RequireSigning || len(k.CIDRList()) > 0 || len(k.PathPrefixList()) > 0 {
+		return &Introspection{}
+	}
+	return &Introspection{
+		Active:    true,
+		Username:  k.User.Email,
+		TokenType: APIKeyTokenType,
+		Subject:   k.UserID.String(),
+		UserID:    k.UserID.String(),
+		Type:      APIKeyTokenType,
+	}
+}
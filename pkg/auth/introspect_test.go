@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestIntrospect(t *testing.T) {
+	jwtParse = jwt.Parse
+	sc := testServer()
+	client := &models.OAuthClient{ClientID: "reports"}
+	token, _, err := IssueClientToken(sc, client, []string{"read:users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := SignClaims(sc, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))},
+		TokenType:        ClientTokenType,
+		ClientID:         client.ClientID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := testServer()
+	forged.JWT.Secret = "forged"
+	other, _, err := IssueClientToken(forged, client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		token  string
+		expect func(mock sqlmock.Sqlmock)
+		want   bool
+	}{
+		{
+			name:  "client token",
+			token: token,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "oauth_clients" WHERE client_id = $1`)).
+					WithArgs(client.ClientID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "client_id"}).AddRow(uuid.Must(uuid.NewV4()), client.ClientID))
+				mock.ExpectQuery(regexp.QuoteMeta(`oauth_client_scopes`)).
+					WillReturnRows(sqlmock.NewRows([]string{"oauth_client_id", "permission_id"}))
+			},
+			want: true,
+		},
+		{
+			name:  "client token of a deleted client",
+			token: token,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "oauth_clients" WHERE client_id = $1`)).
+					WithArgs(client.ClientID).
+					WillReturnError(gorm.ErrRecordNotFound)
+			},
+		},
+		{name: "expired token", token: expired},
+		{name: "forged token", token: other},
+		{
+			name:  "unknown api key",
+			token: "not-a-key",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_api_keys" WHERE api_key = $1`)).
+					WithArgs("not-a-key").
+					WillReturnError(gorm.ErrRecordNotFound)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.expect != nil {
+				tt.expect(mock)
+			}
+			got := Introspect(context.Background(), sc, &orm.ORM{DB: gormDB}, nil, "", tt.token)
+			if got.Active != tt.want {
+				t.Fatalf("Introspect() active = %v, want %v", got.Active, tt.want)
+			}
+			if !got.Active && *got != (Introspection{}) {
+				t.Errorf("Introspect() = %+v, want nothing told about an inactive token", got)
+			}
+			if got.Active && (got.ClientID != client.ClientID || got.Scope != "read:users" || got.Type != ClientTokenType) {
+				t.Errorf("Introspect() = %+v, want the claims of the client token", got)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestIntrospect_apiKey(t *testing.T) {
+	jwtParse = jwt.Parse
+	sc := testServer()
+	userID := uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name    string
+		columns []string
+		values  []driver.Value
+		want    bool
+	}{
+		{name: "unrestricted key", want: true},
+		{name: "key requiring signed requests", columns: []string{"require_signing"}, values: []driver.Value{true}},
+		{name: "key restricted to ip ranges", columns: []string{"allowed_cidrs"}, values: []driver.Value{"10.0.0.0/8"}},
+		{name: "key restricted to paths", columns: []string{"allowed_path_prefixes"}, values: []driver.Value{"/v1/api/orgs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			mock.MatchExpectationsInOrder(false)
+			gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			values := append([]driver.Value{1, userID, "the-key"}, tt.values...)
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_api_keys" WHERE api_key = $1`)).
+				WithArgs("the-key").
+				WillReturnRows(sqlmock.NewRows(append([]string{"id", "user_id", "api_key"}, tt.columns...)).AddRow(values...))
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users"`)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(userID, "user@test.com"))
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_permissions"`)).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "permission_id"}))
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_roles"`)).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "role_id"}))
+			got := Introspect(context.Background(), sc, &orm.ORM{DB: gormDB}, nil, "", "the-key")
+			if got.Active != tt.want {
+				t.Errorf("Introspect() = %+v, want active %v", got, tt.want)
+			}
+			if got.Active && (got.UserID != userID.String() || got.Type != APIKeyTokenType) {
+				t.Errorf("Introspect() = %+v, want the user of the key", got)
+			}
+		})
+	}
+
+	t.Run("unknown keys lock the ip out", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		store := newMemoryStore()
+		lk := testLockout(store)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_api_keys" WHERE api_key = $1`)).
+			WithArgs("not-a-key").
+			WillReturnError(gorm.ErrRecordNotFound)
+		if got := Introspect(context.Background(), sc, &orm.ORM{DB: gormDB}, lk, "192.0.2.1", "not-a-key"); got.Active {
+			t.Errorf("Introspect() of an unknown key = %+v, want inactive", got)
+		}
+		if store.counters[lockoutFailPrefix+IPKey("192.0.2.1")] != 1 || store.counters[lockoutFailPrefix+KeyPrefixKey("not-a-key")] != 1 {
+			t.Errorf("Introspect() counted %v, want a failure of the ip and the key prefix", store.counters)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+}
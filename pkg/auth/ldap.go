@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/markbates/goth"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+)
+
+// LDAPProviderName is the provider of the profiles of directory users
+const LDAPProviderName = "ldap"
+
+var (
+	// ErrInvalidCredentials when the directory rejects the username or password
+	ErrInvalidCredentials = errors.New("invalid username or password")
+
+	// ErrInvalidLDAPConfig when the directory can't be used as configured
+	ErrInvalidLDAPConfig = errors.New("invalid ldap configuration")
+
+	// ldapTimeout when the directory config doesn't set one
+	ldapTimeout = 10 * time.Second
+)
+
+// LDAPIdentity is the directory entry of the user that logged in
+type LDAPIdentity struct {
+	goth.User
+	DN     string
+	Groups []string // DNs of the groups the user is a member of
+	Roles  []string // names of the roles its groups map to
+}
+
+// LDAPProvider logs users in by binding to the directory with their
+// credentials, their groups are mapped to roles
+type LDAPProvider struct {
+	cfg        cfg.LDAP
+	groupRoles map[string]string // lower-cased group DNs and CNs to role names
+}
+
+// NewLDAPProvider validates the directory config, the roles its groups map to
+// can't be the ones of organizations
+func NewLDAPProvider(c *cfg.LDAP) (*LDAPProvider, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("%w: url must be ldap:// or ldaps://", ErrInvalidLDAPConfig)
+	}
+	if strings.Count(c.UserFilter, "%s") != 1 {
+		return nil, fmt.Errorf("%w: user filter must hold the username once as %%s", ErrInvalidLDAPConfig)
+	}
+	if c.GroupFilter != "" && strings.Count(c.GroupFilter, "%s") != 1 {
+		return nil, fmt.Errorf("%w: group filter must hold the user DN once as %%s", ErrInvalidLDAPConfig)
+	}
+	if c.Attributes.ID == "" || c.Attributes.Email == "" {
+		return nil, fmt.Errorf("%w: id and email attributes are required", ErrInvalidLDAPConfig)
+	}
+	p := &LDAPProvider{cfg: *c, groupRoles: map[string]string{}}
+	if p.cfg.Timeout <= 0 {
+		p.cfg.Timeout = ldapTimeout
+	}
+	if p.cfg.GroupBaseDN == "" {
+		p.cfg.GroupBaseDN = p.cfg.BaseDN
+	}
+	for group, role := range c.GroupRoles {
+		if consts.IsOrgRole(role) {
+			return nil, fmt.Errorf("%w: group [%s] can't map to the organization role [%s]",
+				ErrInvalidLDAPConfig, group, role)
+		}
+		p.groupRoles[strings.ToLower(group)] = role
+	}
+	return p, nil
+}
+
+// ManagedRoles are the roles the directory grants and revokes, the other
+// roles of its users are left alone
+func (p *LDAPProvider) ManagedRoles() []string {
+	seen := map[string]bool{}
+	roles := []string{}
+	for _, r := range p.groupRoles {
+		if !seen[r] {
+			seen[r] = true
+			roles = append(roles, r)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Authenticate finds the user entry by its username, binds as the user with
+// the password and looks up the groups it's a member of. Unknown users and
+// wrong passwords are both ErrInvalidCredentials
+func (p *LDAPProvider) Authenticate(username, password string) (*LDAPIdentity, error) {
+	// an empty password is an unauthenticated bind most directories accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := p.bindService(conn); err != nil {
+		return nil, err
+	}
+	entry, err := p.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap user bind: %w", err)
+	}
+	id, err := p.identity(entry)
+	if err != nil {
+		return nil, err
+	}
+	if p.cfg.Attributes.MemberOf != "" {
+		id.Groups = append(id.Groups, entry.GetAttributeValues(p.cfg.Attributes.MemberOf)...)
+	}
+	if p.cfg.GroupFilter != "" {
+		// the user may not be allowed to search groups, the service can
+		if err := p.bindService(conn); err != nil {
+			return nil, err
+		}
+		groups, err := p.findGroups(conn, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+		id.Groups = append(id.Groups, groups...)
+	}
+	id.Groups = uniqueFold(id.Groups)
+	id.Roles = p.roles(id.Groups)
+	return id, nil
+}
+
+// dial connects to the directory, upgrading to TLS when configured
+func (p *LDAPProvider) dial() (*ldap.Conn, error) {
+	u, _ := url.Parse(p.cfg.URL)
+	tc := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: p.cfg.InsecureSkipVerify}
+	conn, err := ldap.DialURL(p.cfg.URL, ldap.DialWithTLSConfig(tc),
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.cfg.Timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	conn.SetTimeout(p.cfg.Timeout)
+	if p.cfg.StartTLS && u.Scheme == "ldap" {
+		if err := conn.StartTLS(tc); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap start tls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// bindService binds as the service account, if there is one
+func (p *LDAPProvider) bindService(conn *ldap.Conn) error {
+	if p.cfg.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+		return fmt.Errorf("ldap service bind: %w", err)
+	}
+	return nil
+}
+
+// findUser finds the single entry of the username
+func (p *LDAPProvider) findUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	a := p.cfg.Attributes
+	attrs := []string{}
+	for _, name := range []string{a.ID, a.Email, a.FirstName, a.LastName, a.Name, a.MemberOf} {
+		if name != "" {
+			attrs = append(attrs, name)
+		}
+	}
+	res, err := conn.Search(ldap.NewSearchRequest(p.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(p.cfg.UserFilter, ldap.EscapeFilter(username)), attrs, nil))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap user search: %w", err)
+	}
+	if len(res.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return res.Entries[0], nil
+}
+
+// findGroups lists the DNs of the groups the user is a member of
+func (p *LDAPProvider) findGroups(conn *ldap.Conn, userDN string) ([]string, error) {
+	res, err := conn.Search(ldap.NewSearchRequest(p.cfg.GroupBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(p.cfg.GroupFilter, ldap.EscapeFilter(userDN)), []string{"cn"}, nil))
+	if err != nil {
+		return nil, fmt.Errorf("ldap group search: %w", err)
+	}
+	groups := make([]string, 0, len(res.Entries))
+	for _, e := range res.Entries {
+		groups = append(groups, e.DN)
+	}
+	return groups, nil
+}
+
+// identity maps the user entry to the profile of the provider
+func (p *LDAPProvider) identity(e *ldap.Entry) (*LDAPIdentity, error) {
+	a := p.cfg.Attributes
+	id := ldapAttributeString(e.GetRawAttributeValue(a.ID))
+	email := strings.TrimSpace(e.GetAttributeValue(a.Email))
+	if id == "" || email == "" {
+		return nil, fmt.Errorf("ldap entry [%s] has no %s or %s", e.DN, a.ID, a.Email)
+	}
+	gu := goth.User{
+		Provider: LDAPProviderName,
+		UserID:   id,
+		Email:    email,
+		RawData: map[string]any{
+			"dn":             e.DN,
+			"email_verified": p.cfg.EmailsVerified,
+		},
+	}
+	if a.FirstName != "" {
+		gu.FirstName = e.GetAttributeValue(a.FirstName)
+	}
+	if a.LastName != "" {
+		gu.LastName = e.GetAttributeValue(a.LastName)
+	}
+	if a.Name != "" {
+		gu.Name = e.GetAttributeValue(a.Name)
+	}
+	if gu.Name == "" {
+		gu.Name = strings.TrimSpace(gu.FirstName + " " + gu.LastName)
+	}
+	return &LDAPIdentity{User: gu, DN: e.DN}, nil
+}
+
+// roles maps the groups to roles by their DN, or else their CN
+func (p *LDAPProvider) roles(groups []string) []string {
+	seen := map[string]bool{}
+	roles := []string{}
+	for _, g := range groups {
+		role, ok := p.groupRoles[strings.ToLower(g)]
+		if !ok {
+			role, ok = p.groupRoles[strings.ToLower(ldapCN(g))]
+		}
+		if ok && !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// ldapCN is the CN of the first RDN of the DN, if it is one
+func ldapCN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return ""
+	}
+	for _, at := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(at.Type, "cn") {
+			return at.Value
+		}
+	}
+	return ""
+}
+
+// ldapAttributeString keeps text ids as they are and hex encodes binary ones,
+// like the objectGUID of Active Directory
+func ldapAttributeString(v []byte) string {
+	if !utf8.Valid(v) {
+		return hex.EncodeToString(v)
+	}
+	for _, r := range string(v) {
+		if !unicode.IsPrint(r) {
+			return hex.EncodeToString(v)
+		}
+	}
+	return strings.TrimSpace(string(v))
+}
+
+// uniqueFold drops the values repeated regardless of case
+func uniqueFold(values []string) []string {
+	seen := map[string]bool{}
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if k := strings.ToLower(v); !seen[k] {
+			seen[k] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+)
+
+// testDirectoryEntry is an entry of the in-process directory
+type testDirectoryEntry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+// testDirectory is an in-process LDAP server answering binds and searches,
+// the searches are matched by their filter and need the service account
+type testDirectory struct {
+	listener  net.Listener
+	passwords map[string]string               // DNs to passwords
+	results   map[string][]testDirectoryEntry // filters to entries
+}
+
+func newTestDirectory(t *testing.T) *testDirectory {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &testDirectory{listener: l, passwords: map[string]string{}, results: map[string][]testDirectoryEntry{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return d
+}
+
+func (d *testDirectory) URL() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *testDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	bound := ""
+	for {
+		p, err := ber.ReadPacket(conn)
+		if err != nil || len(p.Children) < 2 {
+			return
+		}
+		id := p.Children[0].Value.(int64)
+		op := p.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := ldap.LDAPResultInvalidCredentials
+			if pw, ok := d.passwords[dn]; ok && pw == password {
+				code, bound = ldap.LDAPResultSuccess, dn
+			}
+			conn.Write(testLDAPResult(id, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			if bound != "cn=svc,dc=corp" {
+				conn.Write(testLDAPResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights).Bytes())
+				continue
+			}
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			for _, e := range d.results[filter] {
+				conn.Write(testLDAPEntry(id, e).Bytes())
+			}
+			conn.Write(testLDAPResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func testLDAPMessage(id int64, op *ber.Packet) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	p.AppendChild(op)
+	return p
+}
+
+func testLDAPResult(id int64, app ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, app, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return testLDAPMessage(id, op)
+}
+
+func testLDAPEntry(id int64, e testDirectoryEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "objectName"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range e.attrs {
+		a := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		a.AppendChild(vals)
+		attrs.AppendChild(a)
+	}
+	op.AppendChild(attrs)
+	return testLDAPMessage(id, op)
+}
+
+func testLDAPConfig(url string) *cfg.LDAP {
+	return &cfg.LDAP{
+		URL:          url,
+		BindDN:       "cn=svc,dc=corp",
+		BindPassword: "svc-secret",
+		BaseDN:       "dc=corp",
+		UserFilter:   "(&(objectClass=user)(sAMAccountName=%s))",
+		GroupFilter:  "(member=%s)",
+		Attributes: cfg.LDAPAttributes{
+			ID: "objectGUID", Email: "mail", FirstName: "givenName", LastName: "sn", MemberOf: "memberOf",
+		},
+		GroupRoles: map[string]string{
+			"CN=Admins,OU=Groups,DC=corp": "admin",
+			"developers":                  "developer",
+		},
+	}
+}
+
+func TestLDAPProvider_Authenticate(t *testing.T) {
+	d := newTestDirectory(t)
+	annDN := "cn=Ann,ou=People,dc=corp"
+	d.passwords["cn=svc,dc=corp"] = "svc-secret"
+	d.passwords[annDN] = "ann-secret"
+	d.results["(&(objectClass=user)(sAMAccountName=ann))"] = []testDirectoryEntry{{dn: annDN, attrs: map[string][]string{
+		"objectGUID": {"\x01\x02\xfe"},
+		"mail":       {"Ann@Corp.com"},
+		"givenName":  {"Ann"},
+		"sn":         {"Lee"},
+		"memberOf":   {"cn=admins,ou=groups,dc=corp"},
+	}}}
+	d.results["(member="+annDN+")"] = []testDirectoryEntry{
+		{dn: "cn=Developers,ou=Groups,dc=corp"},
+		{dn: "cn=Admins,ou=Groups,dc=corp"},
+	}
+	// two entries for one username can't tell who is logging in
+	d.results["(&(objectClass=user)(sAMAccountName=twin))"] = []testDirectoryEntry{{dn: "cn=a,dc=corp"}, {dn: "cn=b,dc=corp"}}
+
+	p, err := NewLDAPProvider(testLDAPConfig(d.URL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  error
+	}{
+		{name: "valid credentials", username: "ann", password: "ann-secret"},
+		{name: "wrong password", username: "ann", password: "nope", wantErr: ErrInvalidCredentials},
+		{name: "empty password", username: "ann", wantErr: ErrInvalidCredentials},
+		{name: "unknown user", username: "bob", password: "bob-secret", wantErr: ErrInvalidCredentials},
+		{name: "ambiguous user", username: "twin", password: "x", wantErr: ErrInvalidCredentials},
+		{name: "filter injection", username: "ann)(sAMAccountName=*", password: "ann-secret", wantErr: ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Authenticate(tt.username, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LDAPProvider.Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Provider != LDAPProviderName || got.UserID != "0102fe" || got.Email != "Ann@Corp.com" ||
+				got.Name != "Ann Lee" || got.DN != annDN {
+				t.Errorf("LDAPProvider.Authenticate() = %+v, want the profile of ann", got.User)
+			}
+			if len(got.Groups) != 2 {
+				t.Errorf("LDAPProvider.Authenticate() groups = %v, want admins and developers", got.Groups)
+			}
+			if want := []string{"admin", "developer"}; !reflect.DeepEqual(got.Roles, want) {
+				t.Errorf("LDAPProvider.Authenticate() roles = %v, want %v", got.Roles, want)
+			}
+		})
+	}
+}
+
+func TestLDAPProvider_Authenticate_unavailable(t *testing.T) {
+	d := newTestDirectory(t)
+	// the service account was rotated
+	p, err := NewLDAPProvider(testLDAPConfig(d.URL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Authenticate("ann", "ann-secret")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("LDAPProvider.Authenticate() error = %v, want a directory error", err)
+	}
+}
+
+func TestNewLDAPProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *cfg.LDAP)
+		wantErr bool
+	}{
+		{name: "valid config", change: func(c *cfg.LDAP) {}},
+		{name: "http url", change: func(c *cfg.LDAP) { c.URL = "http://corp" }, wantErr: true},
+		{name: "user filter without username", change: func(c *cfg.LDAP) { c.UserFilter = "(uid=ann)" }, wantErr: true},
+		{name: "group filter without dn", change: func(c *cfg.LDAP) { c.GroupFilter = "(member=x)" }, wantErr: true},
+		{name: "no id attribute", change: func(c *cfg.LDAP) { c.Attributes.ID = "" }, wantErr: true},
+		{name: "organization role", change: func(c *cfg.LDAP) { c.GroupRoles["owners"] = "org:owner" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testLDAPConfig("ldaps://dc.corp:636")
+			tt.change(c)
+			p, err := NewLDAPProvider(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLDAPProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidLDAPConfig) {
+					t.Errorf("NewLDAPProvider() error = %v, want ErrInvalidLDAPConfig", err)
+				}
+				return
+			}
+			if got := strings.Join(p.ManagedRoles(), ","); got != "admin,developer" {
+				t.Errorf("LDAPProvider.ManagedRoles() = %s, want admin,developer", got)
+			}
+		})
+	}
+}
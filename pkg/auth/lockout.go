@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"strings"
+	"time"
+
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+const (
+	lockoutFailPrefix  = "lockout:fail:"
+	lockoutLockPrefix  = "lockout:lock:"
+	lockoutWaitPrefix  = "lockout:wait:"
+	accountKeyPrefix   = "account:"
+	ipKeyPrefix        = "ip:"
+	keyPrefixKeyPrefix = "keyprefix:"
+
+	// apiKeyPrefixLen is how much of an api key its prefix lockout covers
+	apiKeyPrefixLen = 8
+)
+
+var (
+	// ErrLockedOut when there were too many failed attempts
+	ErrLockedOut = errors.New("too many failed attempts, try again later")
+
+	// lockoutMetrics are exposed along the other expvar metrics
+	lockoutMetrics = expvar.NewMap("auth_lockout")
+)
+
+// LockoutStore keeps the failed attempt counters, cache.Cache implements it
+type LockoutStore interface {
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	AddWithTTL(ctx context.Context, key string, value string, ttl time.Duration) (string, error)
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Del(ctx context.Context, key string) (string, error)
+}
+
+// Lockout makes accounts and IPs with too many failed auth attempts wait
+// longer and longer before their next one, and then locks them out. A nil
+// Lockout never locks anything out
+type Lockout struct {
+	store LockoutStore
+	cfg   cfg.Lockout
+}
+
+// NewLockout creates the lockout, nil is returned when it is disabled
+func NewLockout(store LockoutStore, c *cfg.Lockout) *Lockout {
+	if store == nil || !c.Enabled {
+		return nil
+	}
+	return &Lockout{store: store, cfg: *c}
+}
+
+// AccountKey is the lockout key of an account, hashed so secrets like api
+// keys never end up in the cache
+func AccountKey(account string) string {
+	h := sha256.Sum256([]byte(account))
+	return accountKeyPrefix + hex.EncodeToString(h[:])
+}
+
+// KeyPrefixKey is the lockout key of the prefix of an api key, it catches
+// the guessing of unknown keys that never repeat. Hashed as AccountKey
+func KeyPrefixKey(apiKey string) string {
+	if len(apiKey) > apiKeyPrefixLen {
+		apiKey = apiKey[:apiKeyPrefixLen]
+	}
+	h := sha256.Sum256([]byte(apiKey))
+	return keyPrefixKeyPrefix + hex.EncodeToString(h[:])
+}
+
+// IPKey is the lockout key of a client IP
+func IPKey(ip string) string {
+	return ipKeyPrefix + ip
+}
+
+// Check returns ErrLockedOut and how long until it can retry when any of the
+// keys is locked out or still has to wait after its last failed attempt
+func (l *Lockout) Check(ctx context.Context, keys ...string) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+	for _, k := range keys {
+		for _, prefix := range []string{lockoutLockPrefix, lockoutWaitPrefix} {
+			ttl, err := l.store.TTL(ctx, prefix+k)
+			if err != nil {
+				logger.Error(&err, "[Auth.Lockout.Check] error: %s", err.Error())
+				continue
+			}
+			if ttl > 0 {
+				lockoutMetrics.Add("rejected", 1)
+				return ttl, ErrLockedOut
+			}
+		}
+	}
+	return 0, nil
+}
+
+// Fail records a failed attempt on the keys and locks them out when they
+// reach the max attempts. Past the first attempts, the keys must wait longer
+// on every one before the next: that wait is returned, the request is
+// answered with a 429 rather than held while it passes
+func (l *Lockout) Fail(ctx context.Context, keys ...string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	lockoutMetrics.Add("failures", 1)
+	var attempts int64
+	for _, k := range keys {
+		n, err := l.store.Incr(ctx, lockoutFailPrefix+k, l.cfg.Window)
+		if err != nil {
+			logger.Error(&err, "[Auth.Lockout.Fail] error: %s", err.Error())
+			continue
+		}
+		if n > attempts {
+			attempts = n
+		}
+		if n >= int64(l.maxAttempts(k)) {
+			l.lock(ctx, k, n)
+		}
+	}
+	d := l.delay(attempts)
+	if d <= 0 {
+		return 0
+	}
+	for _, k := range keys {
+		if _, err := l.store.AddWithTTL(ctx, lockoutWaitPrefix+k, "1", d); err != nil {
+			logger.Error(&err, "[Auth.Lockout.Fail] error: %s", err.Error())
+		}
+	}
+	return d
+}
+
+// Reset clears the failed attempts of the keys after a successful attempt
+func (l *Lockout) Reset(ctx context.Context, keys ...string) {
+	if l == nil {
+		return
+	}
+	for _, k := range keys {
+		for _, prefix := range []string{lockoutFailPrefix, lockoutWaitPrefix} {
+			if _, err := l.store.Del(ctx, prefix+k); err != nil {
+				logger.Error(&err, "[Auth.Lockout.Reset] error: %s", err.Error())
+			}
+		}
+	}
+}
+
+// Unlock lifts the lockout of the key and clears its failed attempts
+func (l *Lockout) Unlock(ctx context.Context, key string) error {
+	if l == nil {
+		return nil
+	}
+	for _, k := range []string{lockoutLockPrefix + key, lockoutWaitPrefix + key, lockoutFailPrefix + key} {
+		if _, err := l.store.Del(ctx, k); err != nil {
+			return err
+		}
+	}
+	lockoutMetrics.Add("unlocks", 1)
+	logger.Info("[Auth.Lockout] %s unlocked", key)
+	return nil
+}
+
+// lock locks the key out for the lockout duration
+func (l *Lockout) lock(ctx context.Context, key string, attempts int64) {
+	if _, err := l.store.AddWithTTL(ctx, lockoutLockPrefix+key, "1", l.cfg.LockoutDuration); err != nil {
+		logger.Error(&err, "[Auth.Lockout.Lock] error: %s", err.Error())
+		return
+	}
+	lockoutMetrics.Add("lockouts", 1)
+	logger.Warn("[Auth.Lockout] %s locked out for %s after %d failed attempts",
+		key, l.cfg.LockoutDuration, attempts)
+}
+
+// maxAttempts of the key, IPs and key prefixes are shared so they get their
+// own limit
+func (l *Lockout) maxAttempts(key string) int {
+	if strings.HasPrefix(key, ipKeyPrefix) || strings.HasPrefix(key, keyPrefixKeyPrefix) {
+		return l.cfg.MaxAttemptsIP
+	}
+	return l.cfg.MaxAttempts
+}
+
+// delay is the wait after the attempts, doubled on every attempt after the
+// first delayed one
+func (l *Lockout) delay(attempts int64) time.Duration {
+	n := attempts - int64(l.cfg.DelayAfter)
+	if n <= 0 || l.cfg.BaseDelay <= 0 {
+		return 0
+	}
+	d := l.cfg.BaseDelay
+	for i := int64(1); i < n && d < l.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	if l.cfg.MaxDelay > 0 && d > l.cfg.MaxDelay {
+		d = l.cfg.MaxDelay
+	}
+	return d
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+)
+
+// memoryStore is an in memory LockoutStore and NonceStore
+type memoryStore struct {
+	counters map[string]int64
+	ttls     map[string]time.Duration
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{counters: map[string]int64{}, ttls: map[string]time.Duration{}}
+}
+
+func (m *memoryStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	m.counters[key]++
+	if m.counters[key] == 1 {
+		m.ttls[key] = ttl
+	}
+	return m.counters[key], nil
+}
+
+func (m *memoryStore) AddWithTTL(ctx context.Context, key string, value string, ttl time.Duration) (string, error) {
+	m.ttls[key] = ttl
+	return "OK", nil
+}
+
+func (m *memoryStore) AddNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	if _, ok := m.ttls[key]; ok {
+		return false, nil
+	}
+	m.ttls[key] = ttl
+	return true, nil
+}
+
+func (m *memoryStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return m.ttls[key], nil
+}
+
+func (m *memoryStore) Del(ctx context.Context, key string) (string, error) {
+	delete(m.counters, key)
+	delete(m.ttls, key)
+	return "", nil
+}
+
+func testLockout(store LockoutStore) *Lockout {
+	return NewLockout(store, &cfg.Lockout{
+		Enabled:         true,
+		MaxAttempts:     5,
+		MaxAttemptsIP:   8,
+		DelayAfter:      2,
+		BaseDelay:       100 * time.Millisecond,
+		MaxDelay:        time.Second,
+		Window:          time.Minute,
+		LockoutDuration: 10 * time.Minute,
+	})
+}
+
+func TestNewLockout(t *testing.T) {
+	if l := NewLockout(newMemoryStore(), &cfg.Lockout{Enabled: false}); l != nil {
+		t.Errorf("NewLockout() = %v, want nil when disabled", l)
+	}
+	var l *Lockout
+	if _, err := l.Check(context.Background(), "key"); err != nil {
+		t.Errorf("Lockout.Check() on nil lockout error = %v", err)
+	}
+	if retry := l.Fail(context.Background(), "key"); retry != 0 {
+		t.Errorf("Lockout.Fail() on nil lockout = %v, want no wait", retry)
+	}
+}
+
+func TestLockout_Fail(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	l := testLockout(store)
+	account, ip := AccountKey("user@test.com"), IPKey("10.0.0.1")
+	// the memory store never expires the waits, they are over once deleted
+	waited := func() {
+		store.Del(ctx, lockoutWaitPrefix+account)
+		store.Del(ctx, lockoutWaitPrefix+ip)
+	}
+
+	waits := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, want := range waits {
+		if retry := l.Fail(ctx, account, ip); retry != want {
+			t.Fatalf("Lockout.Fail() after %d attempts = %v, want %v", i+1, retry, want)
+		}
+		retry, err := l.Check(ctx, account, ip)
+		if want == 0 && err != nil {
+			t.Fatalf("Lockout.Check() after %d attempts error = %v, want none", i+1, err)
+		}
+		if want > 0 && (!errors.Is(err, ErrLockedOut) || retry != want) {
+			t.Fatalf("Lockout.Check() after %d attempts = %v, %v, want %v to wait", i+1, retry, err, want)
+		}
+		waited()
+	}
+
+	l.Fail(ctx, account, ip)
+	waited()
+	retry, err := l.Check(ctx, account)
+	if !errors.Is(err, ErrLockedOut) || retry != 10*time.Minute {
+		t.Errorf("Lockout.Check() = %v, %v, want %v", retry, err, ErrLockedOut)
+	}
+	if _, err := l.Check(ctx, ip); err != nil {
+		t.Errorf("Lockout.Check() ip error = %v, ip has a higher limit", err)
+	}
+
+	if err := l.Unlock(ctx, account); err != nil {
+		t.Fatalf("Lockout.Unlock() error = %v", err)
+	}
+	if _, err := l.Check(ctx, account); err != nil {
+		t.Errorf("Lockout.Check() after unlock error = %v", err)
+	}
+}
+
+func TestLockout_keyPrefix(t *testing.T) {
+	ctx := context.Background()
+	l := testLockout(newMemoryStore())
+	ip := IPKey("10.0.0.1")
+
+	// every guess is another key, only their prefix repeats
+	for i := 0; i < 8; i++ {
+		l.Fail(ctx, KeyPrefixKey(fmt.Sprintf("0badc0de-%04d", i)), ip)
+	}
+	if _, err := l.Check(ctx, KeyPrefixKey("0badc0de-9999")); !errors.Is(err, ErrLockedOut) {
+		t.Errorf("Lockout.Check() of the guessed prefix error = %v, want %v", err, ErrLockedOut)
+	}
+	if _, err := l.Check(ctx, ip); !errors.Is(err, ErrLockedOut) {
+		t.Errorf("Lockout.Check() of the guessing ip error = %v, want %v", err, ErrLockedOut)
+	}
+	if _, err := l.Check(ctx, KeyPrefixKey("5ca1ab1e-0000")); err != nil {
+		t.Errorf("Lockout.Check() of another prefix error = %v, want none", err)
+	}
+}
+
+func TestLockout_Reset(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	l := testLockout(store)
+	account := AccountKey("user@test.com")
+
+	l.Fail(ctx, account)
+	l.Fail(ctx, account)
+	l.Reset(ctx, account)
+	if n := store.counters[lockoutFailPrefix+account]; n != 0 {
+		t.Errorf("Lockout.Reset() failed attempts = %d, want 0", n)
+	}
+}
+
+func TestLockout_delay(t *testing.T) {
+	l := testLockout(newMemoryStore())
+	tests := []struct {
+		attempts int64
+		want     time.Duration
+	}{
+		{attempts: 1, want: 0},
+		{attempts: 2, want: 0},
+		{attempts: 3, want: 100 * time.Millisecond},
+		{attempts: 4, want: 200 * time.Millisecond},
+		{attempts: 6, want: 800 * time.Millisecond},
+		{attempts: 7, want: time.Second},
+		{attempts: 70, want: time.Second},
+	}
+	for _, tt := range tests {
+		if got := l.delay(tt.attempts); got != tt.want {
+			t.Errorf("Lockout.delay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
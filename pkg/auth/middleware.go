@@ -4,13 +4,20 @@
 package auth
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/gofrs/uuid"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
 	"github.com/rakin92/go-rest-service/pkg/cfg"
 	"github.com/rakin92/go-rest-service/pkg/consts"
 	"github.com/rakin92/go-rest-service/pkg/logger"
+	"github.com/rakin92/go-rest-service/pkg/storage/cache"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,62 +29,233 @@ func authError(c *gin.Context, err error) {
 	c.AbortWithStatusJSON(http.StatusUnauthorized, e)
 }
 
-// Middleware wraps the request with auth middleware
-func Middleware(path string, cfg *cfg.Server, orm *orm.ORM) gin.HandlerFunc {
+// forbiddenError answers when the authenticated caller isn't allowed
+func forbiddenError(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "[Auth] error: " + err.Error()})
+}
+
+// lockedOutError answers when there were too many failed attempts
+func lockedOutError(c *gin.Context, retry time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "[Auth] error: " + ErrLockedOut.Error()})
+}
+
+// failedError counts the failed attempt on the keys and answers with the
+// error, or with a 429 when the next attempt must wait
+func failedError(c *gin.Context, lk *Lockout, err error, keys ...string) {
+	if retry := lk.Fail(c.Request.Context(), keys...); retry > 0 {
+		lockedOutError(c, retry)
+		return
+	}
+	authError(c, err)
+}
+
+// Middleware wraps the request with auth middleware, failed attempts are
+// counted per account, API key prefix and IP when there is a cache to count them with. The
+// nonces of signed requests are kept in the cache too
+func Middleware(path string, cfg *cfg.Server, orm *orm.ORM, che *cache.Cache) gin.HandlerFunc {
 	logger.Info("[Auth.Middleware] Applied to path: %s", path)
+	var lk *Lockout
+	var nonces NonceStore
+	if che != nil {
+		lk = NewLockout(che, &cfg.Auth.Lockout)
+		nonces = che
+	}
+	sv := NewRequestVerifier(nonces, &cfg.Auth.Signing)
 	return gin.HandlerFunc(func(c *gin.Context) {
+		ctx := c.Request.Context()
+		ipKey := IPKey(c.ClientIP())
+		if retry, err := lk.Check(ctx, ipKey); err != nil {
+			lockedOutError(c, retry)
+			return
+		}
+
 		// Check and authenticate with api key
-		if a, err := ParseAPIKey(c, cfg); err == nil {
-			user, err := orm.FindUserByAPIKey(a)
-			if err != nil {
-				authError(c, ErrForbidden)
+		a, err := ParseAPIKey(c, cfg)
+		if err != nil && err != ErrEmptyAPIKeyHeader {
+			authError(c, err)
+			return
+		}
+		if err == nil {
+			accountKey, prefixKey := AccountKey(a), KeyPrefixKey(a)
+			if retry, err := lk.Check(ctx, accountKey, prefixKey); err != nil {
+				lockedOutError(c, retry)
+				return
 			}
-			if user != nil {
-				c.Request = addToContext(c, consts.ProjectContextKeys.UserCtxKey, user)
-				c.Request = addUserIdToContext(c, user.ID)
-				logger.Debug("User authenticated via api: %s", user.ID)
+			k, err := orm.FindAPIKey(a)
+			if err != nil || k == nil {
+				// a guesser never tries the same key twice, unknown keys
+				// count on the IP and the key prefix
+				failedError(c, lk, ErrForbidden, prefixKey, ipKey)
+				return
 			}
-			c.Next()
-		} else {
-			if err != ErrEmptyAPIKeyHeader {
-				authError(c, err)
-			} else {
-				// Authenticate via JWT Token
-				t, err := ParseToken(c, cfg)
-				if err != nil {
+			// restricted keys used elsewhere don't lock their user out
+			if err := checkAPIKeyRestrictions(c, k); err != nil {
+				forbiddenError(c, err)
+				return
+			}
+			if err := sv.Verify(c, k); err != nil {
+				if err == ErrNoReplayProtection {
 					authError(c, err)
 				} else {
-					if claims, ok := t.Claims.(jwt.MapClaims); ok {
-						if claims["exp"] != nil {
-							issuer := claims["iss"].(string)
-							userid := claims["jti"].(string)
-							email := claims["sub"].(string)
-							if claims["aud"] != nil {
-								audiences := claims["aud"]
-								logger.Warn("\n\naudiences: %s\n\n", audiences)
-							}
-							if claims["alg"] != nil {
-								algo := claims["alg"].(string)
-								logger.Warn("\n\nalgo: %s\n\n", algo)
-							}
-							if user, err := orm.FindUserByJWT(email, issuer, userid); err != nil {
-								authError(c, ErrForbidden)
-							} else {
-								if user != nil {
-									c.Request = addToContext(c, consts.ProjectContextKeys.UserCtxKey, user)
-									c.Request = addUserIdToContext(c, user.ID)
-									logger.Debug("User: %s", user.ID)
-								}
-								c.Next()
-							}
-						} else {
-							authError(c, ErrMissingExpField)
-						}
-					} else {
-						authError(c, err)
-					}
+					failedError(c, lk, err, accountKey, ipKey)
 				}
+				return
+			}
+			lk.Reset(ctx, accountKey)
+			user := &k.User
+			setUser(c, user)
+			c.Request = addToContext(c, consts.ProjectContextKeys.APIKeyIDCtxKey, k.ID)
+			logger.Debug("User authenticated via api: %s", user.ID)
+			nextWithTenant(c, orm)
+			return
+		}
+
+		// Authenticate via JWT Token
+		t, err := ParseToken(c, cfg)
+		if err != nil {
+			// forged tokens count as failed attempts, expired ones don't
+			if ve, ok := err.(*jwt.ValidationError); ok &&
+				ve.Errors&(jwt.ValidationErrorSignatureInvalid|jwt.ValidationErrorMalformed) != 0 {
+				failedError(c, lk, err, ipKey)
+				return
 			}
+			authError(c, err)
+			return
+		}
+		claims, ok := t.Claims.(jwt.MapClaims)
+		if !ok {
+			authError(c, ErrNoClaims)
+			return
+		}
+		if claims["exp"] == nil {
+			authError(c, ErrMissingExpField)
+			return
+		}
+		switch typ, _ := claims["typ"].(string); typ {
+		case AccessTokenType, "":
+		case ClientTokenType:
+			authenticateClient(c, t, orm)
+			return
+		case DelegatedTokenType:
+			authenticateDelegated(c, t, orm)
+			return
+		case ImpersonationTokenType:
+			authenticateImpersonation(c, t, orm)
+			return
+		default:
+			// refresh tokens, consent tickets and whatever else we sign
+			// don't authenticate requests
+			authError(c, ErrInvalidTokenType)
+			return
+		}
+		issuer, _ := claims["iss"].(string)
+		userid, _ := claims["jti"].(string)
+		email, _ := claims["sub"].(string)
+		accountKey := AccountKey(email)
+		if retry, err := lk.Check(ctx, accountKey); err != nil {
+			lockedOutError(c, retry)
+			return
 		}
+		user, err := orm.FindUserByJWT(issuer, userid)
+		if err != nil || user == nil {
+			failedError(c, lk, ErrForbidden, accountKey, ipKey)
+			return
+		}
+		if err := checkSession(c, cfg, claims, user, orm); err != nil {
+			authError(c, err)
+			return
+		}
+		setUser(c, user)
+		logger.Debug("User: %s", user.ID)
+		nextWithTenant(c, orm)
+	})
+}
+
+// authenticateClient authenticates the oauth client of a client credentials
+// token, the client must still be registered
+func authenticateClient(c *gin.Context, t *jwt.Token, orm *orm.ORM) {
+	claims, err := ClaimsFromToken(t)
+	if err != nil {
+		authError(c, err)
+		return
+	}
+	client, err := orm.FindOAuthClient(claims.ClientID)
+	if err != nil {
+		authError(c, ErrForbidden)
+		return
+	}
+	setServicePrincipal(c, &ServicePrincipal{
+		ClientID: client.ClientID,
+		Name:     client.Name,
+		Scopes:   strings.Fields(claims.Scope),
 	})
+	logger.Debug("Service client: %s", client.ClientID)
+	c.Next()
+}
+
+// authenticateDelegated authenticates a client acting on behalf of a user,
+// the grant the token came from must not have been revoked
+func authenticateDelegated(c *gin.Context, t *jwt.Token, orm *orm.ORM) {
+	claims, err := ClaimsFromToken(t)
+	if err != nil {
+		authError(c, err)
+		return
+	}
+	grantID, err := uuid.FromString(claims.ID)
+	if err != nil {
+		authError(c, ErrForbidden)
+		return
+	}
+	grant, err := orm.FindOAuthGrantByID(grantID)
+	if err != nil || grant.UserID.String() != claims.Subject || grant.ClientID != claims.ClientID {
+		authError(c, ErrForbidden)
+		return
+	}
+	user, err := orm.FindUserByID(grant.UserID)
+	if err != nil {
+		authError(c, ErrForbidden)
+		return
+	}
+	setUser(c, user)
+	setServicePrincipal(c, &ServicePrincipal{
+		ClientID: grant.ClientID,
+		Scopes:   strings.Fields(claims.Scope),
+	})
+	logger.Debug("User: %s via client: %s", user.ID, grant.ClientID)
+	nextWithTenant(c, orm)
+}
+
+// setUser adds the authenticated user to our gin context
+func setUser(c *gin.Context, user *models.User) {
+	c.Request = addToContext(c, consts.ProjectContextKeys.UserCtxKey, user)
+	c.Request = addUserIdToContext(c, user.ID)
+}
+
+// RequirePermission only lets the request through when the authenticated
+// user has all the permission tags, and the client calling was granted them
+// as scopes when it's a service client or acts on behalf of the user. It
+// must run after Middleware
+func RequirePermission(tags ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, uerr := GetUser(c)
+		p, perr := GetServicePrincipal(c)
+		if uerr != nil && perr != nil {
+			authError(c, uerr)
+			return
+		}
+		for _, tag := range tags {
+			if u != nil {
+				if ok, _ := u.HasPermissionTag(tag); !ok {
+					forbiddenError(c, ErrForbidden)
+					return
+				}
+			}
+			if p != nil && !p.HasScope(tag) {
+				forbiddenError(c, ErrForbidden)
+				return
+			}
+		}
+		c.Next()
+	}
 }
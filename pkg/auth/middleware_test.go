@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestMiddleware_tokenType(t *testing.T) {
+	jwtParse = jwt.Parse
+	gin.SetMode(gin.TestMode)
+	sc := testServer()
+	for _, typ := range []string{RefreshTokenType, ConsentTicketType, "unknown"} {
+		t.Run(typ, func(t *testing.T) {
+			token, err := SignClaims(sc, &Claims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+				},
+				TokenType: typ,
+			})
+			if err != nil {
+				t.Fatalf("SignClaims() error = %v", err)
+			}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+			// rejected before the orm is needed
+			Middleware("/", sc, nil, nil)(c)
+			if w.Code != http.StatusUnauthorized || !c.IsAborted() {
+				t.Errorf("Middleware() status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestFailedError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	lk := testLockout(newMemoryStore())
+	ip := IPKey("10.0.0.1")
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		failedError(c, lk, ErrForbidden, ip)
+		if w.Code != want {
+			t.Fatalf("failedError() after %d attempts status = %d, want %d", i+1, w.Code, want)
+		}
+		if retry := w.Header().Get("Retry-After"); (want == http.StatusTooManyRequests) != (retry != "") {
+			t.Errorf("failedError() after %d attempts Retry-After = %q", i+1, retry)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/gofrs/uuid"
 	"github.com/golang-jwt/jwt/v4"
 
+	"github.com/rakin92/go-rest-service/internal/orm/models"
 	"github.com/rakin92/go-rest-service/pkg/cfg"
 	"github.com/rakin92/go-rest-service/pkg/consts"
 )
@@ -30,6 +31,12 @@ var (
 	// - "cookie:<name>"
 	APIKeyLookup = "param:api_key,query:api_key,cookie:api_key,header:" + APIKeyHeader
 
+	// TokenCookie is the cookie name holding the jwt token
+	TokenCookie = "jwt"
+
+	// RefreshTokenCookie is the cookie name holding the refresh token
+	RefreshTokenCookie = "jwt_refresh"
+
 	// TokenLookup is a string in the form of "<source>:<name>" that is used
 	// to extract token from the request.
 	// Optional. Default value "header:Authorization".
@@ -37,7 +44,7 @@ var (
 	// - "header:<name>"
 	// - "query:<name>"
 	// - "cookie:<name>"
-	TokenLookup = "param:api_key,query:token,cookie:jwt,header:Authorization"
+	TokenLookup = "param:api_key,query:token,cookie:" + TokenCookie + ",header:Authorization"
 
 	// ErrNoClaims when HTTP status 403 is given
 	ErrNoClaims = errors.New("invalid token")
@@ -69,6 +76,9 @@ var (
 	// ErrEmptyParamToken can be thrown if authing with parameter in path, the parameter in path is empty
 	ErrEmptyParamToken = errors.New("parameter token is empty")
 
+	// ErrNoUser when there is no authenticated user in the context
+	ErrNoUser = errors.New("no authenticated user")
+
 	// ErrInvalidSigningAlgorithm indicates signing algorithm is invalid, needs to be HS256, HS384, HS512, RS256, RS384 or RS512
 	ErrInvalidSigningAlgorithm = errors.New("invalid signing algorithm")
 
@@ -150,13 +160,22 @@ func ParseToken(c *gin.Context, sc *cfg.Server) (t *jwt.Token, err error) {
 	if err != nil {
 		return nil, err
 	}
+	t, err = ParseTokenString(sc, token)
+	if err == nil {
+		c.Set("AUTH_JWT_TOKEN", token)
+	}
+	return t, err
+}
+
+// ParseTokenString parses and validates a raw jwt token signed with the
+// server JWT config
+func ParseTokenString(sc *cfg.Server, token string) (*jwt.Token, error) {
 	SigningAlgorithm := sc.JWT.Algorithm
 	Key := []byte(sc.JWT.Secret)
 	return jwtParse(token, func(t *jwt.Token) (any, error) {
 		if jwtGetSigningMethod(SigningAlgorithm) != t.Method {
 			return nil, ErrInvalidSigningAlgorithm
 		}
-		c.Set("AUTH_JWT_TOKEN", token)
 		return Key, nil
 	})
 }
@@ -202,3 +221,16 @@ func addUserIdToContext(c *gin.Context, userID uuid.UUID) *http.Request {
 	c.Set(string(usrCtxKey), userID)
 	return c.Request.WithContext(context.WithValue(c.Request.Context(), usrCtxKey, userID))
 }
+
+// GetUser returns the authenticated user from our gin context
+func GetUser(c *gin.Context) (*models.User, error) {
+	v, exists := c.Get(string(consts.ProjectContextKeys.UserCtxKey))
+	if !exists {
+		return nil, ErrNoUser
+	}
+	u, ok := v.(*models.User)
+	if !ok || u == nil {
+		return nil, ErrNoUser
+	}
+	return u, nil
+}
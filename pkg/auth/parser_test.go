@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
 	"github.com/rakin92/go-rest-service/pkg/cfg"
 	"github.com/rakin92/go-rest-service/pkg/consts"
 )
@@ -518,3 +519,25 @@ func Test_addUserIdToContext(t *testing.T) {
 		})
 	}
 }
+
+func TestGetUser(t *testing.T) {
+	t.Run("no user in context", func(t *testing.T) {
+		ctx, _ := createTestContext()
+		if _, err := GetUser(ctx); err != ErrNoUser {
+			t.Errorf("GetUser() error = %v, want %v", err, ErrNoUser)
+		}
+	})
+	t.Run("user in context", func(t *testing.T) {
+		ctx, _ := createTestContext()
+		u := &models.User{Email: "email"}
+		addToContext(ctx, consts.ProjectContextKeys.UserCtxKey, u)
+		got, err := GetUser(ctx)
+		if err != nil {
+			t.Errorf("GetUser() error = %v, wantErr %v", err, false)
+			return
+		}
+		if got != u {
+			t.Errorf("GetUser() = %v, want %v", got, u)
+		}
+	})
+}
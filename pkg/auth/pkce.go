@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// PKCEMethodS256 is the only code challenge method we accept, plain would
+// leak the verifier along with the authorization request
+const PKCEMethodS256 = "S256"
+
+// pkceVerifier is the format of a code verifier, RFC 7636 section 4.1
+var pkceVerifier = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// PKCEChallenge derives the S256 code challenge of the verifier
+func PKCEChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// VerifyPKCE checks the code verifier matches the challenge sent on the
+// authorization request
+func VerifyPKCE(verifier string, challenge string, method string) bool {
+	if method != PKCEMethodS256 || challenge == "" || !pkceVerifier.MatchString(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
@@ -0,0 +1,29 @@
+package auth
+
+import "testing"
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B example
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		method    string
+		want      bool
+	}{
+		{name: "valid verifier", verifier: verifier, challenge: challenge, method: PKCEMethodS256, want: true},
+		{name: "wrong verifier", verifier: verifier + "x", challenge: challenge, method: PKCEMethodS256, want: false},
+		{name: "plain method", verifier: challenge, challenge: challenge, method: "plain", want: false},
+		{name: "short verifier", verifier: "abc", challenge: PKCEChallenge("abc"), method: PKCEMethodS256, want: false},
+		{name: "empty challenge", verifier: verifier, challenge: "", method: PKCEMethodS256, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, tt.challenge, tt.method); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
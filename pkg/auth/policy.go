@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+	"github.com/rakin92/go-rest-service/pkg/policy"
+)
+
+// ResourceLoader returns the attributes of the resource the request is about
+type ResourceLoader func(c *gin.Context) (map[string]any, error)
+
+var policies = policy.Default()
+
+// UsePolicies replaces the policies resources are authorized with
+func UsePolicies(e *policy.Engine) {
+	policies = e
+}
+
+// Policies returns the policies resources are authorized with
+func Policies() *policy.Engine {
+	return policies
+}
+
+// SubjectAttributes are the attributes of the subject the policies see, the
+// membership and the service principal are optional
+func SubjectAttributes(u *models.User, m *models.Membership, p *ServicePrincipal) map[string]any {
+	s := map[string]any{
+		"id":              nil,
+		"email":           nil,
+		"roles":           []string{},
+		"permissions":     []string{},
+		"org_roles":       []string{},
+		"org_permissions": []string{},
+		"client_id":       nil,
+		"scopes":          []string{},
+		"impersonator_id": nil,
+	}
+	if u != nil {
+		s["id"], s["email"], s["roles"], s["permissions"] = u.ID.String(), u.Email, u.RoleNames(), u.PermissionTags()
+	}
+	if m != nil {
+		roles, perms := []string{}, []string{}
+		for _, r := range m.Roles {
+			roles = append(roles, r.Name)
+			for _, perm := range r.Permissions {
+				perms = append(perms, perm.Tag)
+			}
+		}
+		s["org_roles"], s["org_permissions"] = roles, perms
+	}
+	if p != nil {
+		s["client_id"], s["scopes"] = p.ClientID, p.Scopes
+	}
+	return s
+}
+
+// PolicyInput builds the request the policies decide on from the
+// authenticated caller and the organization the request is for
+func PolicyInput(c *gin.Context, action string, r policy.Resource) (*policy.Input, error) {
+	u, uerr := GetUser(c)
+	p, perr := GetServicePrincipal(c)
+	if uerr != nil && perr != nil {
+		return nil, uerr
+	}
+	m, _ := GetMembership(c)
+	in := &policy.Input{
+		Subject:  SubjectAttributes(u, m, p),
+		Action:   action,
+		Resource: r,
+	}
+	if admin, err := GetImpersonator(c); err == nil {
+		in.Subject["impersonator_id"] = admin.ID.String()
+	}
+	if m != nil {
+		in.Tenant = m.OrganizationID.String()
+	}
+	return in, nil
+}
+
+// Authorize verifies if the policies allow the authenticated caller the
+// action on the resource, policy.ErrDenied is returned when they don't
+func Authorize(c *gin.Context, action string, r policy.Resource) error {
+	in, err := PolicyInput(c, action, r)
+	if err != nil {
+		return err
+	}
+	if d := policies.Evaluate(in); !d.Allowed {
+		logger.Info("[Auth.Authorize] %s %s denied: %s", action, r.Type, d.Reason)
+		return policy.ErrDenied
+	}
+	return nil
+}
+
+// RequirePolicy only lets the request through when the policies allow the
+// authenticated caller the action on the resource. It must run after
+// Middleware
+func RequirePolicy(action, resource string, load ResourceLoader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		attrs := map[string]any{}
+		if load != nil {
+			var err error
+			if attrs, err = load(c); err != nil {
+				forbiddenError(c, policy.ErrDenied)
+				return
+			}
+		}
+		err := Authorize(c, action, policy.Resource{Type: resource, Attributes: attrs})
+		switch err {
+		case nil:
+			c.Next()
+		case policy.ErrDenied:
+			forbiddenError(c, err)
+		default:
+			authError(c, err)
+		}
+	}
+}
+
+// FromParams loads the resource attributes from the path params, named as
+// the params
+func FromParams(params ...string) ResourceLoader {
+	return func(c *gin.Context) (map[string]any, error) {
+		attrs := map[string]any{}
+		for _, p := range params {
+			attrs[p] = c.Param(p)
+		}
+		return attrs, nil
+	}
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+)
+
+func TestRequirePolicy(t *testing.T) {
+	u := &models.User{Roles: []models.Role{{Name: "user"}}}
+	u.ID = uuid.Must(uuid.NewV4())
+	admin := &models.User{Roles: []models.Role{{Name: "admin"}}}
+	admin.ID = uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name     string
+		user     *models.User
+		id       string
+		wantCode int
+	}{
+		{name: "updates themselves", user: u, id: u.ID.String(), wantCode: http.StatusOK},
+		{name: "updates someone else", user: u, id: admin.ID.String(), wantCode: http.StatusForbidden},
+		{name: "admin updates someone else", user: admin, id: u.ID.String(), wantCode: http.StatusOK},
+		{name: "unauthenticated", id: u.ID.String(), wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPatch, "/", nil)
+			c.Params = gin.Params{{Key: "id", Value: tt.id}}
+			if tt.user != nil {
+				setUser(c, tt.user)
+			}
+			RequirePolicy("update", "users", FromParams("id"))(c)
+			if !c.IsAborted() {
+				c.Status(http.StatusOK)
+			}
+			if w.Code != tt.wantCode {
+				t.Errorf("RequirePolicy() code = %v, want %v", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
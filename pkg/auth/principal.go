@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+)
+
+var (
+	// ErrNoServicePrincipal when there is no authenticated oauth client in the context
+	ErrNoServicePrincipal = errors.New("no authenticated service client")
+
+	// ErrInvalidScope when the client asks for scopes it isn't allowed
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// ServicePrincipal is the machine identity of an oauth client calling the api
+// with the client credentials grant, or on behalf of the user in the context
+// with a delegated token. Either way it's limited to its scopes
+type ServicePrincipal struct {
+	ClientID string
+	Name     string
+	Scopes   []string
+}
+
+// HasScope verifies if the service was granted the scope
+func (p *ServicePrincipal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantScopes returns the scopes to grant the client, all the allowed ones
+// when none are requested, or ErrInvalidScope if any isn't allowed
+func GrantScopes(c *models.OAuthClient, requested string) ([]string, error) {
+	allowed := c.ScopeTags()
+	if strings.TrimSpace(requested) == "" {
+		return allowed, nil
+	}
+	scopes := strings.Fields(requested)
+	for _, s := range scopes {
+		if !containsAny(allowed, s) {
+			return nil, ErrInvalidScope
+		}
+	}
+	return scopes, nil
+}
+
+// DelegatedScopes returns the scopes the client may be granted on behalf of
+// the user, the ones asked for that both the client is allowed and the user
+// holds. ErrInvalidScope is returned when none are left
+func DelegatedScopes(u *models.User, c *models.OAuthClient, requested string) ([]string, error) {
+	scopes, err := GrantScopes(c, requested)
+	if err != nil {
+		return nil, err
+	}
+	granted := []string{}
+	for _, s := range scopes {
+		if ok, _ := u.HasPermissionTag(s); ok {
+			granted = append(granted, s)
+		}
+	}
+	if len(granted) == 0 {
+		return nil, ErrInvalidScope
+	}
+	return granted, nil
+}
+
+// GetServicePrincipal returns the authenticated oauth client from our gin context
+func GetServicePrincipal(c *gin.Context) (*ServicePrincipal, error) {
+	v, exists := c.Get(string(consts.ProjectContextKeys.ServiceCtxKey))
+	if !exists {
+		return nil, ErrNoServicePrincipal
+	}
+	p, ok := v.(*ServicePrincipal)
+	if !ok || p == nil {
+		return nil, ErrNoServicePrincipal
+	}
+	return p, nil
+}
+
+// setServicePrincipal adds the authenticated oauth client to our gin context
+func setServicePrincipal(c *gin.Context, p *ServicePrincipal) {
+	c.Request = addToContext(c, consts.ProjectContextKeys.ServiceCtxKey, p)
+	c.Request = addToContext(c, consts.ProjectContextKeys.ClientIDCtxKey, p.ClientID)
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+)
+
+func TestGrantScopes(t *testing.T) {
+	client := &models.OAuthClient{Scopes: []models.Permission{
+		{Tag: "read:users"}, {Tag: "list:users"},
+	}}
+	tests := []struct {
+		name      string
+		requested string
+		want      []string
+		wantErr   bool
+	}{
+		{name: "no scope asked grants all", requested: "", want: []string{"read:users", "list:users"}},
+		{name: "subset of the scopes", requested: "list:users", want: []string{"list:users"}},
+		{name: "scope not allowed", requested: "list:users delete:users", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GrantScopes(client, tt.requested)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GrantScopes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GrantScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelegatedScopes(t *testing.T) {
+	client := &models.OAuthClient{Scopes: []models.Permission{
+		{Tag: "read:users"}, {Tag: "list:users"}, {Tag: "delete:users"},
+	}}
+	u := &models.User{Permissions: []models.Permission{{Tag: "read:users"}, {Tag: "list:users"}}}
+	tests := []struct {
+		name      string
+		requested string
+		want      []string
+		wantErr   bool
+	}{
+		{name: "only the ones the user holds", requested: "", want: []string{"read:users", "list:users"}},
+		{name: "subset of the scopes", requested: "read:users delete:users", want: []string{"read:users"}},
+		{name: "user holds none", requested: "delete:users", wantErr: true},
+		{name: "client not allowed", requested: "update:users", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DelegatedScopes(u, client, tt.requested)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DelegatedScopes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DelegatedScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequirePermission_ServicePrincipal(t *testing.T) {
+	admin := &models.User{Permissions: []models.Permission{{Tag: "read:users"}}}
+	tests := []struct {
+		name      string
+		user      *models.User
+		principal *ServicePrincipal
+		want      int
+	}{
+		{name: "no principal", want: http.StatusUnauthorized},
+		{name: "scope granted", principal: &ServicePrincipal{Scopes: []string{"read:users"}}, want: http.StatusOK},
+		{name: "scope missing", principal: &ServicePrincipal{Scopes: []string{"list:users"}}, want: http.StatusForbidden},
+		{name: "delegated scope granted", user: admin, principal: &ServicePrincipal{Scopes: []string{"read:users"}}, want: http.StatusOK},
+		{name: "delegated scope missing", user: admin, principal: &ServicePrincipal{Scopes: []string{"list:users"}}, want: http.StatusForbidden},
+		{name: "delegated user lacks permission", user: &models.User{}, principal: &ServicePrincipal{Scopes: []string{"read:users"}}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.user != nil {
+				setUser(c, tt.user)
+			}
+			if tt.principal != nil {
+				setServicePrincipal(c, tt.principal)
+			}
+			RequirePermission("read:users")(c)
+			if !c.IsAborted() {
+				c.Status(http.StatusOK)
+			}
+			if c.Writer.Status() != tt.want {
+				t.Errorf("RequirePermission() status = %v, want %v", c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
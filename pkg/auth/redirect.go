@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidRedirectURI when the redirect uri isn't in the allowlist
+var ErrInvalidRedirectURI = errors.New("redirect_uri is not allowed")
+
+// ValidRedirectURI checks the redirect uri against the allowlist, the scheme
+// and host must match exactly and the path must start with the allowed path
+func ValidRedirectURI(allowlist []string, redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	if err != nil || u.Host == "" || u.User != nil || u.Fragment != "" ||
+		(u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+	for _, allowed := range allowlist {
+		a, err := url.Parse(allowed)
+		if err != nil || a.Host == "" {
+			continue
+		}
+		if !strings.EqualFold(a.Scheme, u.Scheme) || !strings.EqualFold(a.Host, u.Host) {
+			continue
+		}
+		prefix := strings.TrimSuffix(a.Path, "/")
+		if u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// RedirectOrigin returns the origin (scheme and host) of the redirect uri
+func RedirectOrigin(redirectURI string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
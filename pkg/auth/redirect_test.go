@@ -0,0 +1,39 @@
+package auth
+
+import "testing"
+
+func TestValidRedirectURI(t *testing.T) {
+	allowlist := []string{"https://app.example.com/auth", "http://localhost:3000"}
+	tests := []struct {
+		name string
+		uri  string
+		want bool
+	}{
+		{name: "exact path", uri: "https://app.example.com/auth", want: true},
+		{name: "sub path", uri: "https://app.example.com/auth/done?next=/", want: true},
+		{name: "root allowed", uri: "http://localhost:3000/anything", want: true},
+		{name: "path prefix trick", uri: "https://app.example.com/authevil", want: false},
+		{name: "other path", uri: "https://app.example.com/", want: false},
+		{name: "other scheme", uri: "http://app.example.com/auth", want: false},
+		{name: "other host", uri: "https://evil.com/auth", want: false},
+		{name: "host suffix trick", uri: "https://app.example.com.evil.com/auth", want: false},
+		{name: "userinfo trick", uri: "https://app.example.com@evil.com/auth", want: false},
+		{name: "other port", uri: "http://localhost:3001", want: false},
+		{name: "javascript", uri: "javascript:alert(1)", want: false},
+		{name: "relative", uri: "/auth", want: false},
+		{name: "empty", uri: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidRedirectURI(allowlist, tt.uri); got != tt.want {
+				t.Errorf("ValidRedirectURI() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectOrigin(t *testing.T) {
+	if got := RedirectOrigin("https://app.example.com/auth?x=1"); got != "https://app.example.com" {
+		t.Errorf("RedirectOrigin() = %v, want %v", got, "https://app.example.com")
+	}
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"errors"
+	"expvar"
+	"net"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+var (
+	// ErrAPIKeyIPNotAllowed when the api key is used from outside its CIDR ranges
+	ErrAPIKeyIPNotAllowed = errors.New("the api key can't be used from this address")
+
+	// ErrAPIKeyPathNotAllowed when the api key is used outside its path prefixes
+	ErrAPIKeyPathNotAllowed = errors.New("the api key can't be used for this route")
+
+	// apiKeyDenials are exposed along the other expvar metrics
+	apiKeyDenials = expvar.NewMap("auth_api_key_denied")
+)
+
+// checkAPIKeyRestrictions verifies the api key can be used from the client
+// ip, as resolved through the trusted proxies, and for the route. Denials
+// are logged on their own since they point to a valid key used elsewhere
+func checkAPIKeyRestrictions(c *gin.Context, k *models.UserAPIKey) error {
+	ip := c.ClientIP()
+	err := error(nil)
+	switch {
+	case !k.AllowsIP(net.ParseIP(ip)):
+		apiKeyDenials.Add("ip", 1)
+		err = ErrAPIKeyIPNotAllowed
+	case !k.AllowsPath(c.Request.URL.Path):
+		apiKeyDenials.Add("route", 1)
+		err = ErrAPIKeyPathNotAllowed
+	default:
+		return nil
+	}
+	logger.Warn("[Auth.APIKeyRestriction] denied api key: %d (%s...) of user: %s from ip: %s to %s %s: %s",
+		k.ID, k.Prefix(), k.UserID, ip, c.Request.Method, c.Request.URL.Path, err.Error())
+	return err
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+)
+
+func Test_checkAPIKeyRestrictions(t *testing.T) {
+	k := &models.UserAPIKey{AllowedCIDRs: "198.51.100.0/24", AllowedPathPrefixes: "/v1/api/orgs"}
+	tests := []struct {
+		name      string
+		proxies   []string
+		remote    string
+		forwarded string
+		path      string
+		wantErr   error
+	}{
+		{name: "allowed address and route", remote: "198.51.100.7:4000", path: "/v1/api/orgs/1/members"},
+		{name: "address outside the ranges", remote: "203.0.113.9:4000", path: "/v1/api/orgs", wantErr: ErrAPIKeyIPNotAllowed},
+		{name: "route outside the prefixes", remote: "198.51.100.7:4000", path: "/v1/api/admin/policies",
+			wantErr: ErrAPIKeyPathNotAllowed},
+		{name: "forwarded address of a trusted proxy", proxies: []string{"10.0.0.0/8"}, remote: "10.0.0.2:4000",
+			forwarded: "198.51.100.7", path: "/v1/api/orgs"},
+		{name: "forwarded address of an untrusted proxy", remote: "203.0.113.9:4000",
+			forwarded: "198.51.100.7", path: "/v1/api/orgs", wantErr: ErrAPIKeyIPNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, r := gin.CreateTestContext(httptest.NewRecorder())
+			if err := r.SetTrustedProxies(tt.proxies); err != nil {
+				t.Fatalf("SetTrustedProxies() error = %v", err)
+			}
+			c.Request = httptest.NewRequest(http.MethodGet, tt.path, nil)
+			c.Request.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				c.Request.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if err := checkAPIKeyRestrictions(c, k); err != tt.wantErr {
+				t.Errorf("checkAPIKeyRestrictions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
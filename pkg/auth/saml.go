@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/markbates/goth"
+	dsig "github.com/russellhaering/goxmldsig"
+
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+const (
+	// SAMLProviderPrefix prefixes the name of the identity provider in the
+	// provider of the profiles of its users
+	SAMLProviderPrefix = "saml:"
+
+	// SAMLMetadataContentType is the content type of the metadata documents
+	SAMLMetadataContentType = "application/samlmetadata+xml"
+
+	samlAssertionPrefix = "saml:assertion:"
+)
+
+var (
+	// ErrUnknownSAMLProvider when there is no identity provider with the name
+	ErrUnknownSAMLProvider = errors.New("unknown saml identity provider")
+
+	// ErrInvalidSAMLResponse when the response of the identity provider can't
+	// be trusted, the details are only logged
+	ErrInvalidSAMLResponse = errors.New("invalid saml response")
+
+	// ErrReplayedAssertion when the assertion was already used to log in
+	ErrReplayedAssertion = errors.New("saml assertion was already used")
+
+	// ErrInvalidSAMLConfig when the identity provider can't be used as configured
+	ErrInvalidSAMLConfig = errors.New("invalid saml configuration")
+
+	// samlMetadataTimeout is how long fetching the metadata of the identity
+	// providers may take
+	samlMetadataTimeout = 10 * time.Second
+
+	samlName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+	samlProviders = map[string]*SAMLProvider{}
+)
+
+// SAMLProvider logs users in with a SAML 2.0 identity provider, we are the
+// service provider with its endpoints under /auth/saml/<name>
+type SAMLProvider struct {
+	Name string
+	cfg  cfg.SAMLIdP
+	sp   saml.ServiceProvider
+}
+
+// LoadSAMLKeyPair reads the PEM certificate and RSA key of the service provider
+func LoadSAMLKeyPair(c *cfg.SAML) (*rsa.PrivateKey, *x509.Certificate, error) {
+	pair, err := tls.LoadX509KeyPair(c.CertificateFile, c.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidSAMLConfig, err.Error())
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: the key must be an RSA key", ErrInvalidSAMLConfig)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidSAMLConfig, err.Error())
+	}
+	return key, cert, nil
+}
+
+// NewSAMLProvider loads the metadata of the identity provider, from its file
+// or else its url
+func NewSAMLProvider(sc *cfg.Server, idp *cfg.SAMLIdP, key *rsa.PrivateKey, cert *x509.Certificate) (*SAMLProvider, error) {
+	if !samlName.MatchString(idp.Name) {
+		return nil, fmt.Errorf("%w: name [%s] must be lower case letters, digits, - or _",
+			ErrInvalidSAMLConfig, idp.Name)
+	}
+	if idp.ResponseMode != "" && !consts.IsResponseMode(idp.ResponseMode) {
+		return nil, fmt.Errorf("%w: response mode [%s] is not supported", ErrInvalidSAMLConfig, idp.ResponseMode)
+	}
+	md, err := loadSAMLMetadata(idp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata of [%s]: %s", ErrInvalidSAMLConfig, idp.Name, err.Error())
+	}
+	base := "/auth/saml/" + idp.Name
+	metadataURL, err := url.Parse(sc.SchemaVersionedEndpoint(base + "/metadata"))
+	if err != nil {
+		return nil, err
+	}
+	acsURL, err := url.Parse(sc.SchemaVersionedEndpoint(base + "/acs"))
+	if err != nil {
+		return nil, err
+	}
+	return &SAMLProvider{
+		Name: idp.Name,
+		cfg:  *idp,
+		sp: saml.ServiceProvider{
+			EntityID:          metadataURL.String(),
+			Key:               key,
+			Certificate:       cert,
+			MetadataURL:       *metadataURL,
+			AcsURL:            *acsURL,
+			IDPMetadata:       md,
+			AuthnNameIDFormat: saml.PersistentNameIDFormat,
+			AllowIDPInitiated: idp.AllowIDPInitiated,
+			SignatureMethod:   dsig.RSASHA256SignatureMethod,
+		},
+	}, nil
+}
+
+// RegisterSAMLProvider makes the identity provider available to log in with
+func RegisterSAMLProvider(p *SAMLProvider) {
+	samlProviders[p.Name] = p
+}
+
+// GetSAMLProvider returns the identity provider registered with the name
+func GetSAMLProvider(name string) (*SAMLProvider, error) {
+	p, ok := samlProviders[name]
+	if !ok {
+		return nil, ErrUnknownSAMLProvider
+	}
+	return p, nil
+}
+
+// Provider is the provider of the profiles of its users
+func (p *SAMLProvider) Provider() string {
+	return SAMLProviderPrefix + p.Name
+}
+
+// ResponseMode is how the ACS hands the tokens when the client didn't ask
+func (p *SAMLProvider) ResponseMode() string {
+	return p.cfg.ResponseMode
+}
+
+// Metadata is the document the identity provider registers us with
+func (p *SAMLProvider) Metadata() ([]byte, error) {
+	b, err := xml.MarshalIndent(p.sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+// AuthnRequest builds the signed redirect to the identity provider, the
+// response must answer the request id
+func (p *SAMLProvider) AuthnRequest() (*url.URL, string, error) {
+	location := p.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if location == "" {
+		return nil, "", fmt.Errorf("%w: [%s] has no redirect binding", ErrInvalidSAMLConfig, p.Name)
+	}
+	req, err := p.sp.MakeAuthenticationRequest(location, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return nil, "", err
+	}
+	u, err := req.Redirect("", &p.sp)
+	if err != nil {
+		return nil, "", err
+	}
+	return u, req.ID, nil
+}
+
+// Authenticate validates the signed response posted to the ACS, it must
+// answer one of the request ids unless logins may start from the identity
+// provider. Assertions are only accepted once when there is a store to
+// remember them
+func (p *SAMLProvider) Authenticate(r *http.Request, requestIDs []string, store NonceStore) (*goth.User, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, ErrInvalidSAMLResponse
+	}
+	a, err := p.sp.ParseResponse(r, requestIDs)
+	if err != nil {
+		var ire *saml.InvalidResponseError
+		if errors.As(err, &ire) {
+			err = ire.PrivateErr
+		}
+		logger.Warn("[Auth.SAML] %s response rejected: %s", p.Name, err.Error())
+		return nil, ErrInvalidSAMLResponse
+	}
+	if store != nil {
+		ttl := saml.MaxIssueDelay + saml.MaxClockSkew
+		if a.Conditions != nil && !a.Conditions.NotOnOrAfter.IsZero() {
+			ttl = time.Until(a.Conditions.NotOnOrAfter) + saml.MaxClockSkew
+		}
+		fresh, err := store.AddNX(r.Context(), samlAssertionPrefix+p.Name+":"+a.ID, "1", ttl)
+		if err != nil {
+			return nil, err
+		}
+		if !fresh {
+			return nil, ErrReplayedAssertion
+		}
+	}
+	return p.user(a)
+}
+
+// user maps the assertion to the profile of the provider
+func (p *SAMLProvider) user(a *saml.Assertion) (*goth.User, error) {
+	nameID := &saml.NameID{}
+	if a.Subject != nil && a.Subject.NameID != nil {
+		nameID = a.Subject.NameID
+	}
+	attrs := p.cfg.Attributes
+	id := strings.TrimSpace(nameID.Value)
+	if attrs.ID != "" {
+		id = samlAttribute(a, attrs.ID)
+	}
+	email := samlAttribute(a, attrs.Email)
+	if email == "" && nameID.Format == string(saml.EmailAddressNameIDFormat) {
+		email = strings.TrimSpace(nameID.Value)
+	}
+	if id == "" || email == "" {
+		logger.Warn("[Auth.SAML] %s assertion %s has no user id or email", p.Name, a.ID)
+		return nil, ErrInvalidSAMLResponse
+	}
+	gu := &goth.User{
+		Provider:  p.Provider(),
+		UserID:    id,
+		Email:     email,
+		FirstName: samlAttribute(a, attrs.FirstName),
+		LastName:  samlAttribute(a, attrs.LastName),
+		Name:      samlAttribute(a, attrs.Name),
+		RawData: map[string]any{
+			"name_id":        nameID.Value,
+			"email_verified": p.cfg.EmailsVerified,
+		},
+	}
+	if gu.Name == "" {
+		gu.Name = strings.TrimSpace(gu.FirstName + " " + gu.LastName)
+	}
+	return gu, nil
+}
+
+// loadSAMLMetadata reads the metadata file, or fetches the metadata url
+func loadSAMLMetadata(idp *cfg.SAMLIdP) (*saml.EntityDescriptor, error) {
+	if idp.MetadataFile != "" {
+		data, err := os.ReadFile(idp.MetadataFile)
+		if err != nil {
+			return nil, err
+		}
+		return samlsp.ParseMetadata(data)
+	}
+	u, err := url.Parse(idp.MetadataURL)
+	if err != nil || u.Host == "" {
+		return nil, errors.New("a metadata file or url is required")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), samlMetadataTimeout)
+	defer cancel()
+	return samlsp.FetchMetadata(ctx, http.DefaultClient, *u)
+}
+
+// samlAttribute is the first value of the attribute with the name, or
+// friendly name
+func samlAttribute(a *saml.Assertion, name string) string {
+	if name == "" {
+		return ""
+	}
+	for _, st := range a.AttributeStatements {
+		for _, at := range st.Attributes {
+			if (at.Name == name || strings.EqualFold(at.FriendlyName, name)) && len(at.Values) > 0 {
+				return strings.TrimSpace(at.Values[0].Value)
+			}
+		}
+	}
+	return ""
+}
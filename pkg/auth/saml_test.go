@@ -0,0 +1,351 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+)
+
+// testIdP is a stand in identity provider that logs in the session user
+type testIdP struct {
+	saml.IdentityProvider
+	server  *httptest.Server
+	sp      *saml.EntityDescriptor
+	session *saml.Session
+}
+
+func newTestKeyPair(t *testing.T, cn string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// newTestIdP serves the metadata of an identity provider signing with a new
+// key pair
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	idp := &testIdP{session: &saml.Session{
+		ID:           "session-1",
+		NameID:       "u-123",
+		NameIDFormat: string(saml.PersistentNameIDFormat),
+		CustomAttributes: []saml.Attribute{
+			testSAMLAttribute("email", "jane@example.com"),
+			testSAMLAttribute("firstName", "Jane"),
+			testSAMLAttribute("lastName", "Doe"),
+		},
+	}}
+	idp.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp.ServeMetadata(w, r)
+	}))
+	t.Cleanup(idp.server.Close)
+	key, cert := newTestKeyPair(t, "idp")
+	base, _ := url.Parse(idp.server.URL)
+	idp.IdentityProvider = saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		MetadataURL:             *base.ResolveReference(&url.URL{Path: "/metadata"}),
+		SSOURL:                  *base.ResolveReference(&url.URL{Path: "/sso"}),
+		ServiceProviderProvider: idp,
+		SessionProvider:         idp,
+	}
+	return idp
+}
+
+func testSAMLAttribute(name, value string) saml.Attribute {
+	return saml.Attribute{
+		FriendlyName: name,
+		Name:         name,
+		NameFormat:   "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+		Values:       []saml.AttributeValue{{Type: "xs:string", Value: value}},
+	}
+}
+
+func (idp *testIdP) GetServiceProvider(r *http.Request, id string) (*saml.EntityDescriptor, error) {
+	if idp.sp == nil || idp.sp.EntityID != id {
+		return nil, os.ErrNotExist
+	}
+	return idp.sp, nil
+}
+
+func (idp *testIdP) GetSession(w http.ResponseWriter, r *http.Request, req *saml.IdpAuthnRequest) *saml.Session {
+	return idp.session
+}
+
+// respond answers the redirect of the service provider with the post form of
+// the signed response, an unsolicited one when there is no redirect
+func (idp *testIdP) respond(t *testing.T, location *url.URL) *http.Request {
+	t.Helper()
+	req := &saml.IdpAuthnRequest{
+		IDP:                     &idp.IdentityProvider,
+		HTTPRequest:             httptest.NewRequest(http.MethodGet, idp.SSOURL.String(), nil),
+		Now:                     saml.TimeNow(),
+		ServiceProviderMetadata: idp.sp,
+		SPSSODescriptor:         &idp.sp.SPSSODescriptors[0],
+		ACSEndpoint:             &idp.sp.SPSSODescriptors[0].AssertionConsumerServices[0],
+	}
+	if location != nil {
+		var err error
+		if req, err = saml.NewIdpAuthnRequest(&idp.IdentityProvider,
+			httptest.NewRequest(http.MethodGet, location.String(), nil)); err != nil {
+			t.Fatal(err)
+		}
+		if err := req.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, idp.session); err != nil {
+		t.Fatal(err)
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestACSRequest(form.URL, form.SAMLResponse)
+}
+
+func newTestACSRequest(acs, samlResponse string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, acs,
+		strings.NewReader(url.Values{"SAMLResponse": {samlResponse}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func newTestSAMLProvider(t *testing.T, idp *testIdP, allowIDPInitiated bool) *SAMLProvider {
+	t.Helper()
+	sc := &cfg.Server{Host: "localhost", Port: "7777", URISchema: "http://", ServiceVersion: "v1"}
+	key, cert := newTestKeyPair(t, "sp")
+	p, err := NewSAMLProvider(sc, &cfg.SAMLIdP{
+		Name:              "corp",
+		MetadataURL:       idp.MetadataURL.String(),
+		AllowIDPInitiated: allowIDPInitiated,
+		EmailsVerified:    true,
+		Attributes:        cfg.SAMLAttributes{Email: "email", FirstName: "firstName", LastName: "lastName"},
+	}, key, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.sp = p.sp.Metadata()
+	return p
+}
+
+func TestSAMLProvider_Authenticate(t *testing.T) {
+	tests := []struct {
+		name              string
+		allowIDPInitiated bool
+		// request returns the ACS request and the request ids it may answer
+		request  func(t *testing.T, idp *testIdP, p *SAMLProvider) (*http.Request, []string)
+		replayed bool
+		wantErr  error
+	}{
+		{
+			name: "signed response",
+			request: func(t *testing.T, idp *testIdP, p *SAMLProvider) (*http.Request, []string) {
+				location, id, err := p.AuthnRequest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				return idp.respond(t, location), []string{id}
+			},
+		},
+		{
+			name: "answers another request",
+			request: func(t *testing.T, idp *testIdP, p *SAMLProvider) (*http.Request, []string) {
+				location, _, err := p.AuthnRequest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				return idp.respond(t, location), []string{"id-other"}
+			},
+			wantErr: ErrInvalidSAMLResponse,
+		},
+		{
+			name: "tampered response",
+			request: func(t *testing.T, idp *testIdP, p *SAMLProvider) (*http.Request, []string) {
+				location, id, err := p.AuthnRequest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				// in clear text, encrypted assertions can't be edited
+				sso := &idp.sp.SPSSODescriptors[0]
+				for i, kd := range sso.KeyDescriptors {
+					if kd.Use == "encryption" {
+						sso.KeyDescriptors = append(sso.KeyDescriptors[:i], sso.KeyDescriptors[i+1:]...)
+						break
+					}
+				}
+				r := idp.respond(t, location)
+				if err := r.ParseForm(); err != nil {
+					t.Fatal(err)
+				}
+				raw, err := base64.StdEncoding.DecodeString(r.PostForm.Get("SAMLResponse"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				tampered := strings.Replace(string(raw), "jane@example.com", "admin@example.com", 1)
+				if tampered == string(raw) {
+					t.Fatal("the email isn't in the response")
+				}
+				return newTestACSRequest(r.URL.String(),
+					base64.StdEncoding.EncodeToString([]byte(tampered))), []string{id}
+			},
+			wantErr: ErrInvalidSAMLResponse,
+		},
+		{
+			name: "signed by another key",
+			request: func(t *testing.T, idp *testIdP, p *SAMLProvider) (*http.Request, []string) {
+				location, id, err := p.AuthnRequest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				forger := *idp
+				forger.Key, forger.Certificate = newTestKeyPair(t, "idp")
+				return forger.respond(t, location), []string{id}
+			},
+			wantErr: ErrInvalidSAMLResponse,
+		},
+		{
+			name: "replayed assertion",
+			request: func(t *testing.T, idp *testIdP, p *SAMLProvider) (*http.Request, []string) {
+				location, id, err := p.AuthnRequest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				return idp.respond(t, location), []string{id}
+			},
+			replayed: true,
+			wantErr:  ErrReplayedAssertion,
+		},
+		{
+			name: "unsolicited response",
+			request: func(t *testing.T, idp *testIdP, p *SAMLProvider) (*http.Request, []string) {
+				return idp.respond(t, nil), nil
+			},
+			wantErr: ErrInvalidSAMLResponse,
+		},
+		{
+			name:              "unsolicited response allowed",
+			allowIDPInitiated: true,
+			request: func(t *testing.T, idp *testIdP, p *SAMLProvider) (*http.Request, []string) {
+				return idp.respond(t, nil), nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newTestIdP(t)
+			p := newTestSAMLProvider(t, idp, tt.allowIDPInitiated)
+			r, requestIDs := tt.request(t, idp, p)
+			store := newMemoryStore()
+			if tt.replayed {
+				if err := r.ParseForm(); err != nil {
+					t.Fatal(err)
+				}
+				samlResponse := r.PostForm.Get("SAMLResponse")
+				if _, err := p.Authenticate(r, requestIDs, store); err != nil {
+					t.Fatalf("SAMLProvider.Authenticate() first use error = %v", err)
+				}
+				r = newTestACSRequest(r.URL.String(), samlResponse)
+			}
+			got, err := p.Authenticate(r, requestIDs, store)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SAMLProvider.Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.Provider != "saml:corp" || got.UserID != "u-123" || got.Email != "jane@example.com" ||
+				got.Name != "Jane Doe" || got.RawData["email_verified"] != true {
+				t.Errorf("SAMLProvider.Authenticate() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestNewSAMLProvider(t *testing.T) {
+	idp := newTestIdP(t)
+	sc := &cfg.Server{Host: "localhost", Port: "7777", URISchema: "http://", ServiceVersion: "v1"}
+	key, cert := newTestKeyPair(t, "sp")
+	tests := []struct {
+		name    string
+		idp     cfg.SAMLIdP
+		wantErr bool
+	}{
+		{
+			name: "metadata url",
+			idp:  cfg.SAMLIdP{Name: "corp", MetadataURL: idp.MetadataURL.String()},
+		},
+		{
+			name:    "invalid name",
+			idp:     cfg.SAMLIdP{Name: "Corp/IdP", MetadataURL: idp.MetadataURL.String()},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported response mode",
+			idp:     cfg.SAMLIdP{Name: "corp", MetadataURL: idp.MetadataURL.String(), ResponseMode: "query"},
+			wantErr: true,
+		},
+		{
+			name:    "no metadata",
+			idp:     cfg.SAMLIdP{Name: "corp"},
+			wantErr: true,
+		},
+		{
+			name:    "missing metadata file",
+			idp:     cfg.SAMLIdP{Name: "corp", MetadataFile: "testdata/missing.xml"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewSAMLProvider(sc, &tt.idp, key, cert)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSAMLProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidSAMLConfig) {
+					t.Errorf("NewSAMLProvider() error = %v, want %v", err, ErrInvalidSAMLConfig)
+				}
+				return
+			}
+			if got, want := p.sp.AcsURL.String(), "http://localhost:7777/v1/auth/saml/corp/acs"; got != want {
+				t.Errorf("NewSAMLProvider() ACS = %v, want %v", got, want)
+			}
+			md, err := p.Metadata()
+			if err != nil || !strings.Contains(string(md), `entityID="http://localhost:7777/v1/auth/saml/corp/metadata"`) {
+				t.Errorf("SAMLProvider.Metadata() = %s, %v", md, err)
+			}
+		})
+	}
+}
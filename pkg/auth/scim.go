@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+	"github.com/rakin92/go-rest-service/pkg/scim"
+	"github.com/rakin92/go-rest-service/pkg/storage/cache"
+)
+
+var (
+	// ErrNoSCIMClient when there is no authenticated SCIM client in the context
+	ErrNoSCIMClient = errors.New("no authenticated scim client")
+
+	// errInvalidSCIMClient is reachable where the orm param shadows the package
+	errInvalidSCIMClient = orm.ErrInvalidSCIMClient
+)
+
+// scimAuthError answers with a SCIM error body, identity providers don't
+// understand ours
+func scimAuthError(c *gin.Context, status int, err error) {
+	c.Header("Content-Type", scim.ContentType)
+	c.AbortWithStatusJSON(status, scim.NewError(status, "", "[Auth] error: "+err.Error()))
+}
+
+// SCIMMiddleware authenticates the SCIM client of an identity provider with
+// its bearer token, invalid tokens count as failed attempts of the IP
+func SCIMMiddleware(path string, cfg *cfg.Server, orm *orm.ORM, che *cache.Cache) gin.HandlerFunc {
+	logger.Info("[Auth.SCIMMiddleware] Applied to path: %s", path)
+	var lk *Lockout
+	if che != nil {
+		lk = NewLockout(che, &cfg.Auth.Lockout)
+	}
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		ipKey := IPKey(c.ClientIP())
+		if retry, err := lk.Check(ctx, ipKey); err != nil {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			scimAuthError(c, http.StatusTooManyRequests, err)
+			return
+		}
+		token, err := jwtFromHeader(c, "Authorization")
+		if err != nil {
+			scimAuthError(c, http.StatusUnauthorized, err)
+			return
+		}
+		client, err := orm.AuthenticateSCIMClient(token)
+		if err != nil {
+			if !errors.Is(err, errInvalidSCIMClient) {
+				scimAuthError(c, http.StatusUnauthorized, ErrForbidden)
+				return
+			}
+			if retry := lk.Fail(ctx, ipKey); retry > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+				scimAuthError(c, http.StatusTooManyRequests, ErrLockedOut)
+				return
+			}
+			scimAuthError(c, http.StatusUnauthorized, ErrForbidden)
+			return
+		}
+		c.Set(string(consts.ProjectContextKeys.SCIMClientCtxKey), client)
+		logger.Debug("SCIM client: %s", client.Name)
+		c.Next()
+	}
+}
+
+// GetSCIMClient returns the authenticated SCIM client from our gin context
+func GetSCIMClient(c *gin.Context) (*models.SCIMClient, error) {
+	v, exists := c.Get(string(consts.ProjectContextKeys.SCIMClientCtxKey))
+	if !exists {
+		return nil, ErrNoSCIMClient
+	}
+	client, ok := v.(*models.SCIMClient)
+	if !ok || client == nil {
+		return nil, ErrNoSCIMClient
+	}
+	return client, nil
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+// GetSessionID returns the session of the token the request was
+// authenticated with, false when it has none
+func GetSessionID(c *gin.Context) (uuid.UUID, bool) {
+	v, exists := c.Get(string(consts.ProjectContextKeys.SessionIDCtxKey))
+	if !exists {
+		return uuid.Nil, false
+	}
+	id, ok := v.(uuid.UUID)
+	return id, ok
+}
+
+// RequireSession only lets through the requests authenticated with the
+// token of a user signed in, not an API key nor a client acting on its
+// behalf. It must run after Middleware
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := GetUser(c); err != nil {
+			authError(c, err)
+			return
+		}
+		_, apiKey := c.Get(string(consts.ProjectContextKeys.APIKeyIDCtxKey))
+		if _, err := GetServicePrincipal(c); apiKey || err == nil {
+			forbiddenError(c, ErrSessionRequired)
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkSession verifies the session of the access token is still active and
+// records it was seen. Tokens issued before sessions were tracked have none,
+// see sessionless
+func checkSession(c *gin.Context, sc *cfg.Server, claims jwt.MapClaims, u *models.User, orm *orm.ORM) error {
+	sid, _ := claims["sid"].(string)
+	if sid == "" {
+		return sessionless(sc, time.Now())
+	}
+	id, err := uuid.FromString(sid)
+	if err != nil {
+		return ErrNoClaims
+	}
+	s, err := orm.FindActiveSession(id, u.ID)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+	if err := orm.TouchSession(s, c.ClientIP()); err != nil {
+		logger.Error(&err, "[Auth.checkSession] error: %s", err.Error())
+	}
+	c.Request = addToContext(c, consts.ProjectContextKeys.SessionIDCtxKey, s.ID)
+	return nil
+}
+
+// sessionless returns ErrNoSession unless an access token without a session
+// can still be one issued before the SessionCutover. A signed out session
+// can't reach them, so they are only accepted until they all expired
+func sessionless(sc *cfg.Server, now time.Time) error {
+	if now.Before(sc.Auth.SessionCutover.Add(sc.JWT.AccessTokenTTL)) {
+		return nil
+	}
+	return ErrNoSession
+}
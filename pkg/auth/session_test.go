@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func Test_checkSession(t *testing.T) {
+	u := &models.User{}
+	u.ID = uuid.Must(uuid.NewV4())
+	sid := uuid.Must(uuid.NewV4())
+	now := time.Now()
+	tests := []struct {
+		name      string
+		sid       string
+		revokedAt *time.Time
+		cutover   time.Time
+		wantErr   error
+	}{
+		{name: "token without session", sid: "", wantErr: ErrNoSession},
+		// tokens issued before the cutover are accepted until they expired
+		{name: "token without session since the cutover", sid: "", cutover: now.Add(-time.Minute)},
+		{name: "token without session long after the cutover", sid: "", cutover: now.Add(-2 * time.Hour),
+			wantErr: ErrNoSession},
+		{name: "active session", sid: sid.String()},
+		{name: "revoked session", sid: sid.String(), revokedAt: &now, wantErr: ErrSessionRevoked},
+		{name: "invalid session", sid: "nope", wantErr: ErrNoClaims},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.sid == sid.String() {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "sessions" WHERE id = $1 AND user_id = $2`)).
+					WithArgs(sid, u.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "client_ip", "last_seen_at", "expires_at", "revoked_at"}).
+						AddRow(sid, u.ID, "192.0.2.1", now, now.Add(time.Hour), tt.revokedAt))
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request.RemoteAddr = "192.0.2.1:4000"
+			sc := &cfg.Server{JWT: cfg.JWT{AccessTokenTTL: time.Hour}, Auth: cfg.Auth{SessionCutover: tt.cutover}}
+			err = checkSession(c, sc, jwt.MapClaims{"sid": tt.sid}, u, &orm.ORM{DB: gormDB})
+			if err != tt.wantErr {
+				t.Errorf("checkSession() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got, ok := GetSessionID(c); ok != (tt.wantErr == nil && tt.sid != "") || (ok && got != sid) {
+				t.Errorf("GetSessionID() = %v, %v", got, ok)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	u := &models.User{}
+	u.ID = uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name     string
+		setup    func(c *gin.Context)
+		wantCode int
+	}{
+		{name: "signed in", setup: func(c *gin.Context) { setUser(c, u) }, wantCode: http.StatusOK},
+		{name: "api key", setup: func(c *gin.Context) {
+			setUser(c, u)
+			c.Request = addToContext(c, consts.ProjectContextKeys.APIKeyIDCtxKey, uint(1))
+		}, wantCode: http.StatusForbidden},
+		{name: "delegated client", setup: func(c *gin.Context) {
+			setUser(c, u)
+			setServicePrincipal(c, &ServicePrincipal{ClientID: "reports"})
+		}, wantCode: http.StatusForbidden},
+		{name: "unauthenticated", setup: func(c *gin.Context) {}, wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPatch, "/", nil)
+			tt.setup(c)
+			RequireSession()(c)
+			if !c.IsAborted() {
+				c.Status(http.StatusOK)
+			}
+			if w.Code != tt.wantCode {
+				t.Errorf("RequireSession() code = %v, want %v", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+	"github.com/rakin92/go-rest-service/pkg/logger"
+)
+
+const (
+	// SignatureHeader holds the hex HMAC-SHA256 of the signing string
+	SignatureHeader = "X-Signature"
+	// SignatureTimestampHeader holds the unix time the request was signed at
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	// SignatureNonceHeader holds the random value making the request unique
+	SignatureNonceHeader = "X-Signature-Nonce"
+
+	signingNoncePrefix = "signing:nonce:"
+	minNonceLength     = 16
+	maxNonceLength     = 128
+	// maxSignedBodySize is the largest body a signed request may have, the
+	// whole body is read to verify it
+	maxSignedBodySize = 10 << 20
+)
+
+var (
+	// ErrSignatureRequired when the api key only accepts signed requests
+	ErrSignatureRequired = errors.New("the api key requires signed requests")
+
+	// ErrInvalidSignature when the signature doesn't match the request
+	ErrInvalidSignature = errors.New("invalid request signature")
+
+	// ErrSignatureExpired when the request was signed too far from now
+	ErrSignatureExpired = errors.New("request signature timestamp is out of range")
+
+	// ErrReplayedRequest when the nonce of the request was already used
+	ErrReplayedRequest = errors.New("request nonce was already used")
+
+	// ErrNoReplayProtection when the nonces can't be checked, signed requests
+	// are refused then
+	ErrNoReplayProtection = errors.New("signed requests can't be verified right now")
+
+	// ErrSignedBodyTooLarge when the body of a signed request is over
+	// maxSignedBodySize
+	ErrSignedBodyTooLarge = errors.New("the body of the signed request is too large")
+)
+
+// NonceStore keeps the nonces of the signed requests until they expire,
+// cache.Cache implements it
+type NonceStore interface {
+	AddNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error)
+}
+
+// SigningString is what the clients sign, the method, the path with its
+// query, the timestamp, the nonce and the hex sha256 of the body, joined by
+// new lines
+func SigningString(method, uri, timestamp, nonce string, body []byte) string {
+	h := sha256.Sum256(body)
+	return strings.Join([]string{
+		strings.ToUpper(method), uri, timestamp, nonce, hex.EncodeToString(h[:]),
+	}, "\n")
+}
+
+// SignRequest returns the hex HMAC-SHA256 of the request signed with the secret
+func SignRequest(secret, method, uri, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(SigningString(method, uri, timestamp, nonce, body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RequestVerifier verifies the requests signed with api keys
+type RequestVerifier struct {
+	store   NonceStore
+	maxSkew time.Duration
+	now     func() time.Time
+}
+
+// NewRequestVerifier creates the verifier, the nonces are kept in the store
+func NewRequestVerifier(store NonceStore, c *cfg.Signing) *RequestVerifier {
+	skew := c.MaxSkew
+	if skew <= 0 {
+		skew = 5 * time.Minute
+	}
+	return &RequestVerifier{store: store, maxSkew: skew, now: time.Now}
+}
+
+// IsSigned verifies if the request carries a signature
+func IsSigned(c *gin.Context) bool {
+	return c.GetHeader(SignatureHeader) != ""
+}
+
+// Verify checks the signature of the request against the api key, unsigned
+// requests pass unless the key requires signing. The nonce is only recorded
+// once the signature is valid, so nobody else can burn them
+func (v *RequestVerifier) Verify(c *gin.Context, k *models.UserAPIKey) error {
+	if !IsSigned(c) {
+		if k.RequireSigning {
+			return ErrSignatureRequired
+		}
+		return nil
+	}
+	if k.SigningSecret == "" {
+		return ErrInvalidSignature
+	}
+	ts, nonce := c.GetHeader(SignatureTimestampHeader), c.GetHeader(SignatureNonceHeader)
+	if len(nonce) < minNonceLength || len(nonce) > maxNonceLength {
+		return ErrInvalidSignature
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if skew := v.now().Sub(time.Unix(unix, 0)); skew > v.maxSkew || skew < -v.maxSkew {
+		return ErrSignatureExpired
+	}
+	body, err := readBody(c)
+	if err != nil {
+		return err
+	}
+	want := SignRequest(k.SigningSecret, c.Request.Method, c.Request.URL.RequestURI(), ts, nonce, body)
+	if !hmac.Equal([]byte(want), []byte(strings.ToLower(c.GetHeader(SignatureHeader)))) {
+		return ErrInvalidSignature
+	}
+	if v.store == nil {
+		return ErrNoReplayProtection
+	}
+	// the nonce is kept as long as its timestamp could still be accepted
+	fresh, err := v.store.AddNX(c.Request.Context(),
+		signingNoncePrefix+strconv.FormatUint(uint64(k.ID), 10)+":"+nonce, ts, 2*v.maxSkew)
+	if err != nil {
+		logger.Error(&err, "[Auth.RequestVerifier.Verify] error: %s", err.Error())
+		return ErrNoReplayProtection
+	}
+	if !fresh {
+		return ErrReplayedRequest
+	}
+	return nil
+}
+
+// readBody reads the body of the request, up to maxSignedBodySize, leaving
+// it for the handlers
+func readBody(c *gin.Context) ([]byte, error) {
+	if c.Request.Body == nil {
+		return []byte{}, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSignedBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxSignedBodySize {
+		return nil, ErrSignedBodyTooLarge
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+)
+
+func TestRequestVerifier_Verify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	secret := "s3cr3t"
+	nonce := "0123456789abcdef"
+	body := `{"name":"acme"}`
+	signed := &models.UserAPIKey{SigningSecret: secret}
+	required := &models.UserAPIKey{SigningSecret: secret, RequireSigning: true}
+	tests := []struct {
+		name      string
+		key       *models.UserAPIKey
+		unsigned  bool
+		timestamp time.Time
+		nonce     string
+		signBody  string
+		sigSecret string
+		replay    bool
+		wantErr   error
+	}{
+		{name: "unsigned request", key: &models.UserAPIKey{}, unsigned: true},
+		{name: "unsigned request for a key requiring signing", key: required, unsigned: true, wantErr: ErrSignatureRequired},
+		{name: "valid signature", key: required},
+		{name: "valid signature within the skew", key: signed, timestamp: now.Add(-4 * time.Minute)},
+		{name: "timestamp too old", key: signed, timestamp: now.Add(-6 * time.Minute), wantErr: ErrSignatureExpired},
+		{name: "timestamp in the future", key: signed, timestamp: now.Add(6 * time.Minute), wantErr: ErrSignatureExpired},
+		{name: "tampered body", key: signed, signBody: `{"name":"evil"}`, wantErr: ErrInvalidSignature},
+		{name: "wrong secret", key: signed, sigSecret: "other", wantErr: ErrInvalidSignature},
+		{name: "key without secret", key: &models.UserAPIKey{}, wantErr: ErrInvalidSignature},
+		{name: "short nonce", key: signed, nonce: "abc", wantErr: ErrInvalidSignature},
+		{name: "replayed nonce", key: signed, replay: true, wantErr: ErrReplayedRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewRequestVerifier(newMemoryStore(), &cfg.Signing{MaxSkew: 5 * time.Minute})
+			v.now = func() time.Time { return now }
+			request := func() *gin.Context {
+				c, _ := gin.CreateTestContext(httptest.NewRecorder())
+				c.Request = httptest.NewRequest(http.MethodPost, "/v1/api/orgs?x=1", strings.NewReader(body))
+				if tt.unsigned {
+					return c
+				}
+				ts := tt.timestamp
+				if ts.IsZero() {
+					ts = now
+				}
+				n, signBody, sigSecret := tt.nonce, tt.signBody, tt.sigSecret
+				if n == "" {
+					n = nonce
+				}
+				if signBody == "" {
+					signBody = body
+				}
+				if sigSecret == "" {
+					sigSecret = secret
+				}
+				unix := strconv.FormatInt(ts.Unix(), 10)
+				c.Request.Header.Set(SignatureTimestampHeader, unix)
+				c.Request.Header.Set(SignatureNonceHeader, n)
+				c.Request.Header.Set(SignatureHeader,
+					SignRequest(sigSecret, http.MethodPost, "/v1/api/orgs?x=1", unix, n, []byte(signBody)))
+				return c
+			}
+			if tt.replay {
+				if err := v.Verify(request(), tt.key); err != nil {
+					t.Fatalf("Verify() first request error = %v", err)
+				}
+			}
+			c := request()
+			if err := v.Verify(c, tt.key); err != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if b, _ := readBody(c); string(b) != body {
+				t.Errorf("Verify() left body = %q, want %q", b, body)
+			}
+		})
+	}
+}
+
+func TestRequestVerifier_noStore(t *testing.T) {
+	v := NewRequestVerifier(nil, &cfg.Signing{})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := "0123456789abcdef"
+	c.Request.Header.Set(SignatureTimestampHeader, ts)
+	c.Request.Header.Set(SignatureNonceHeader, nonce)
+	c.Request.Header.Set(SignatureHeader, SignRequest("s", http.MethodGet, "/", ts, nonce, nil))
+	if err := v.Verify(c, &models.UserAPIKey{SigningSecret: "s"}); err != ErrNoReplayProtection {
+		t.Errorf("Verify() error = %v, want %v", err, ErrNoReplayProtection)
+	}
+}
+
+func TestReadBody_limit(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("a", maxSignedBodySize+1)))
+	if _, err := readBody(c); err != ErrSignedBodyTooLarge {
+		t.Errorf("readBody() error = %v, want %v", err, ErrSignedBodyTooLarge)
+	}
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("a", maxSignedBodySize)))
+	if b, err := readBody(c); err != nil || len(b) != maxSignedBodySize {
+		t.Errorf("readBody() = %d bytes, error %v, want the whole body", len(b), err)
+	}
+}
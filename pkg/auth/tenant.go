@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/consts"
+)
+
+const (
+	// TenantHeader selects the organization the request is for
+	TenantHeader = "X-Organization-ID"
+	// TenantParam selects the organization the request is for from the path,
+	// it takes precedence over the header
+	TenantParam = "orgId"
+)
+
+var (
+	// ErrNoMembership when the request isn't for an organization of the user
+	ErrNoMembership = errors.New("not a member of the organization")
+
+	// ErrTenantMismatch when the path and header select different organizations
+	ErrTenantMismatch = errors.New("the organization of the path and header don't match")
+)
+
+// GetMembership returns the membership of the user to the organization the
+// request is for
+func GetMembership(c *gin.Context) (*models.Membership, error) {
+	v, exists := c.Get(string(consts.ProjectContextKeys.MembershipCtxKey))
+	if !exists {
+		return nil, ErrNoMembership
+	}
+	m, ok := v.(*models.Membership)
+	if !ok || m == nil {
+		return nil, ErrNoMembership
+	}
+	return m, nil
+}
+
+// setMembership adds the active membership to our gin context
+func setMembership(c *gin.Context, m *models.Membership) {
+	c.Request = addToContext(c, consts.ProjectContextKeys.MembershipCtxKey, m)
+	c.Request = addToContext(c, consts.ProjectContextKeys.OrganizationIDCtxKey, m.OrganizationID)
+}
+
+// tenantFromRequest returns the organization selected by the path or the
+// header, uuid.Nil when the request isn't for one
+func tenantFromRequest(c *gin.Context) (uuid.UUID, error) {
+	param, header := c.Param(TenantParam), c.GetHeader(TenantHeader)
+	if param != "" && header != "" && param != header {
+		return uuid.Nil, ErrTenantMismatch
+	}
+	raw := param
+	if raw == "" {
+		raw = header
+	}
+	if raw == "" {
+		return uuid.Nil, nil
+	}
+	id, err := uuid.FromString(raw)
+	if err != nil {
+		return uuid.Nil, errors.New("invalid organization id")
+	}
+	return id, nil
+}
+
+// nextWithTenant resolves the active membership when the request is for an
+// organization, the authenticated user must be a member of it
+func nextWithTenant(c *gin.Context, orm *orm.ORM) {
+	orgID, err := tenantFromRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "[Auth] error: " + err.Error()})
+		return
+	}
+	if orgID != uuid.Nil {
+		u, err := GetUser(c)
+		if err != nil {
+			forbiddenError(c, ErrNoMembership)
+			return
+		}
+		m, err := orm.FindMembership(orgID, u.ID)
+		if err != nil {
+			forbiddenError(c, ErrNoMembership)
+			return
+		}
+		setMembership(c, m)
+	}
+	c.Next()
+}
+
+// RequireTenantPermission only lets the request through when the member has
+// all the permission tags within the active organization, and the client
+// calling on their behalf was granted them as scopes. It must run after
+// Middleware
+func RequireTenantPermission(tags ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, err := GetMembership(c)
+		if err != nil {
+			forbiddenError(c, err)
+			return
+		}
+		p, _ := GetServicePrincipal(c)
+		for _, tag := range tags {
+			if !m.HasPermissionTag(tag) || (p != nil && !p.HasScope(tag)) {
+				forbiddenError(c, ErrForbidden)
+				return
+			}
+		}
+		c.Next()
+	}
+}
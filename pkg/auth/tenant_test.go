@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+)
+
+func Test_tenantFromRequest(t *testing.T) {
+	orgID := uuid.Must(uuid.NewV4())
+	other := uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name    string
+		param   string
+		header  string
+		want    uuid.UUID
+		wantErr bool
+	}{
+		{name: "no organization", want: uuid.Nil},
+		{name: "from the path", param: orgID.String(), want: orgID},
+		{name: "from the header", header: orgID.String(), want: orgID},
+		{name: "path and header match", param: orgID.String(), header: orgID.String(), want: orgID},
+		{name: "path and header mismatch", param: orgID.String(), header: other.String(), wantErr: true},
+		{name: "invalid id", header: "acme", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.param != "" {
+				c.Params = gin.Params{{Key: TenantParam, Value: tt.param}}
+			}
+			if tt.header != "" {
+				c.Request.Header.Set(TenantHeader, tt.header)
+			}
+			got, err := tenantFromRequest(c)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("tenantFromRequest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("tenantFromRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireTenantPermission(t *testing.T) {
+	member := &models.Membership{Roles: []models.Role{
+		{Name: "org:member", Permissions: []models.Permission{{Tag: "list:memberships"}}},
+	}}
+	tests := []struct {
+		name       string
+		membership *models.Membership
+		principal  *ServicePrincipal
+		tag        string
+		want       int
+	}{
+		{name: "no membership", tag: "list:memberships", want: http.StatusForbidden},
+		{name: "member permission", membership: member, tag: "list:memberships", want: http.StatusOK},
+		{name: "missing permission", membership: member, tag: "delete:memberships", want: http.StatusForbidden},
+		{name: "client without the scope", membership: member, principal: &ServicePrincipal{}, tag: "list:memberships", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.membership != nil {
+				setMembership(c, tt.membership)
+			}
+			if tt.principal != nil {
+				setServicePrincipal(c, tt.principal)
+			}
+			RequireTenantPermission(tt.tag)(c)
+			if !c.IsAborted() {
+				c.Status(http.StatusOK)
+			}
+			if c.Writer.Status() != tt.want {
+				t.Errorf("RequireTenantPermission() status = %v, want %v", c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+)
+
+// Token types carried on the `typ` claim of the tokens we issue
+const (
+	AccessTokenType  = "access"
+	RefreshTokenType = "refresh"
+	ClientTokenType  = "client"
+	// DelegatedTokenType is issued to a client acting on behalf of a user
+	DelegatedTokenType = "delegated"
+	// ImpersonationTokenType is issued to an admin acting as a user
+	ImpersonationTokenType = "impersonation"
+	// ConsentTicketType signs the authorization request into the consent
+	// form, it doesn't authenticate anything
+	ConsentTicketType = "consent"
+)
+
+var (
+	// ErrInvalidTokenType when a token is used for something it wasn't issued for
+	ErrInvalidTokenType = errors.New("invalid token type")
+
+	// ErrSessionRevoked when the session the token belongs to was signed out
+	ErrSessionRevoked = errors.New("session was revoked")
+
+	// ErrNoSession when the access token doesn't carry its session and the
+	// ones issued before sessions were tracked are no longer accepted
+	ErrNoSession = errors.New("the token has no session, sign in again")
+
+	// ErrSessionRequired when the request must be made by the user signed
+	// in, not with an API key
+	ErrSessionRequired = errors.New("a signed in session is required")
+)
+
+// Claims are the claims of the tokens we issue. The user is identified by
+// the provider profile it logged in with: jti the external user id and iss
+// the provider, sub is the email of the user and isn't used to find it.
+// Client tokens identify the oauth client instead,
+// and delegated tokens the user id as sub with the grant id as jti.
+// Impersonation tokens carry the user id as sub and the admin in act. The
+// tokens of a login carry its session as sid
+type Claims struct {
+	jwt.RegisteredClaims
+	TokenType string `json:"typ,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Act       *Actor `json:"act,omitempty"`
+}
+
+// Actor is the party acting as the subject of the token, RFC 8693 section 4.1
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// TokenPair is an access token along with the refresh token to renew it
+type TokenPair struct {
+	Type         string    `json:"type"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	UserID       uuid.UUID `json:"user_id"`
+	SessionID    uuid.UUID `json:"session_id"`
+}
+
+// SignClaims signs the claims with the server JWT config
+func SignClaims(sc *cfg.Server, claims jwt.Claims) (string, error) {
+	m := jwtGetSigningMethod(sc.JWT.Algorithm)
+	if m == nil {
+		return "", ErrInvalidSigningAlgorithm
+	}
+	return jwt.NewWithClaims(m, claims).SignedString([]byte(sc.JWT.Secret))
+}
+
+// IssueTokenPair issues a new access and refresh token for the user logged in
+// with the given provider profile, both belong to the session
+func IssueTokenPair(sc *cfg.Server, u *models.User, provider string, externalUserID string,
+	sessionID uuid.UUID) (*TokenPair, error) {
+	now := time.Now().UTC()
+	newClaims := func(typ string, ttl time.Duration) *Claims {
+		return &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        externalUserID,
+				Subject:   u.Email,
+				Issuer:    provider,
+				IssuedAt:  jwt.NewNumericDate(now),
+				NotBefore: jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			},
+			TokenType: typ,
+			SessionID: sessionID.String(),
+		}
+	}
+	access := newClaims(AccessTokenType, sc.JWT.AccessTokenTTL)
+	token, err := SignClaims(sc, access)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := SignClaims(sc, newClaims(RefreshTokenType, sc.JWT.RefreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		Type:         TokenHeadName,
+		Token:        token,
+		RefreshToken: refresh,
+		ExpiresAt:    access.ExpiresAt.Time,
+		UserID:       u.ID,
+		SessionID:    sessionID,
+	}, nil
+}
+
+// IssueClientToken issues an access token for the oauth client with the
+// granted scopes, it returns the token and its expiration
+func IssueClientToken(sc *cfg.Server, c *models.OAuthClient, scopes []string) (string, time.Time, error) {
+	now := time.Now().UTC()
+	exp := now.Add(sc.JWT.AccessTokenTTL)
+	token, err := SignClaims(sc, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   c.ClientID,
+			Issuer:    sc.ServiceName,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+		TokenType: ClientTokenType,
+		ClientID:  c.ClientID,
+		Scope:     strings.Join(scopes, " "),
+	})
+	return token, exp, err
+}
+
+// IssueDelegatedToken issues an access token for the client of the grant to
+// act on behalf of its user with the scopes, it returns the token and its
+// expiration
+func IssueDelegatedToken(sc *cfg.Server, g *models.OAuthGrant, scopes []string) (string, time.Time, error) {
+	now := time.Now().UTC()
+	exp := now.Add(sc.JWT.AccessTokenTTL)
+	token, err := SignClaims(sc, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        g.ID.String(),
+			Subject:   g.UserID.String(),
+			Issuer:    sc.ServiceName,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+		TokenType: DelegatedTokenType,
+		ClientID:  g.ClientID,
+		Scope:     strings.Join(scopes, " "),
+	})
+	return token, exp, err
+}
+
+// IssueImpersonationToken issues a short lived access token for the admin to
+// act as the user, there is no refresh token
+func IssueImpersonationToken(sc *cfg.Server, admin *models.User, u *models.User) (string, *Claims, error) {
+	now := time.Now().UTC()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.Must(uuid.NewV4()).String(),
+			Subject:   u.ID.String(),
+			Issuer:    sc.ServiceName,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(sc.Auth.ImpersonationTTL)),
+		},
+		TokenType: ImpersonationTokenType,
+		Act:       &Actor{Subject: admin.ID.String()},
+	}
+	token, err := SignClaims(sc, claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// ParseClaims validates a raw token we issued and returns its claims
+func ParseClaims(sc *cfg.Server, raw string) (*Claims, error) {
+	t, err := ParseTokenString(sc, raw)
+	if err != nil {
+		return nil, err
+	}
+	return ClaimsFromToken(t)
+}
+
+// ClaimsFromToken reads our claims out of a parsed token
+func ClaimsFromToken(t *jwt.Token) (*Claims, error) {
+	mc, ok := t.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrNoClaims
+	}
+	b, err := json.Marshal(mc)
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	if err := json.Unmarshal(b, claims); err != nil {
+		return nil, ErrNoClaims
+	}
+	return claims, nil
+}
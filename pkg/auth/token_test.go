@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rakin92/go-rest-service/internal/orm/models"
+	"github.com/rakin92/go-rest-service/pkg/cfg"
+)
+
+func testServer() *cfg.Server {
+	return &cfg.Server{
+		JWT: cfg.JWT{
+			Algorithm:       "HS512",
+			Secret:          "{JWTsecret}",
+			AccessTokenTTL:  time.Hour,
+			RefreshTokenTTL: 24 * time.Hour,
+		},
+	}
+}
+
+func TestIssueTokenPair(t *testing.T) {
+	jwtParse = jwt.Parse
+	sc := testServer()
+	u := &models.User{Email: "user@test.com"}
+	u.ID = uuid.Must(uuid.NewV4())
+
+	sid := uuid.Must(uuid.NewV4())
+	pair, err := IssueTokenPair(sc, u, "google", "external_id", sid)
+	if err != nil {
+		t.Fatalf("IssueTokenPair() error = %v", err)
+	}
+	if pair.UserID != u.ID || pair.SessionID != sid || pair.Type != TokenHeadName {
+		t.Errorf("IssueTokenPair() = %+v, want user %s", pair, u.ID)
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantTyp string
+	}{
+		{name: "access token", raw: pair.Token, wantTyp: AccessTokenType},
+		{name: "refresh token", raw: pair.RefreshToken, wantTyp: RefreshTokenType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseClaims(sc, tt.raw)
+			if err != nil {
+				t.Errorf("ParseClaims() error = %v", err)
+				return
+			}
+			if claims.TokenType != tt.wantTyp {
+				t.Errorf("ParseClaims() typ = %v, want %v", claims.TokenType, tt.wantTyp)
+			}
+			if claims.Subject != u.Email || claims.Issuer != "google" || claims.ID != "external_id" {
+				t.Errorf("ParseClaims() = %+v, want the user profile", claims)
+			}
+			if claims.SessionID != sid.String() {
+				t.Errorf("ParseClaims() sid = %v, want %v", claims.SessionID, sid)
+			}
+		})
+	}
+}
+
+func TestParseClaims(t *testing.T) {
+	jwtParse = jwt.Parse
+	sc := testServer()
+
+	t.Run("invalid signature", func(t *testing.T) {
+		other := testServer()
+		other.JWT.Secret = "other"
+		raw, _ := SignClaims(other, &Claims{TokenType: AccessTokenType})
+		if _, err := ParseClaims(sc, raw); err == nil {
+			t.Errorf("ParseClaims() error = %v, wantErr %v", err, true)
+		}
+	})
+	t.Run("expired token", func(t *testing.T) {
+		raw, _ := SignClaims(sc, &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			},
+		})
+		if _, err := ParseClaims(sc, raw); err == nil {
+			t.Errorf("ParseClaims() error = %v, wantErr %v", err, true)
+		}
+	})
+	t.Run("invalid signing algorithm", func(t *testing.T) {
+		other := testServer()
+		other.JWT.Algorithm = "HS256"
+		raw, _ := SignClaims(other, &Claims{TokenType: AccessTokenType})
+		if _, err := ParseClaims(sc, raw); err == nil {
+			t.Errorf("ParseClaims() error = %v, wantErr %v", err, true)
+		}
+	})
+}
+
+func TestIssueClientToken(t *testing.T) {
+	jwtParse = jwt.Parse
+	sc := testServer()
+	client := &models.OAuthClient{ClientID: "client_id"}
+
+	raw, exp, err := IssueClientToken(sc, client, []string{"read:users", "list:users"})
+	if err != nil {
+		t.Fatalf("IssueClientToken() error = %v", err)
+	}
+	if exp.Before(time.Now()) {
+		t.Errorf("IssueClientToken() expires at %v, want in the future", exp)
+	}
+	claims, err := ParseClaims(sc, raw)
+	if err != nil {
+		t.Fatalf("ParseClaims() error = %v", err)
+	}
+	if claims.TokenType != ClientTokenType || claims.ClientID != "client_id" {
+		t.Errorf("ParseClaims() = %+v, want a client token", claims)
+	}
+	if claims.Scope != "read:users list:users" {
+		t.Errorf("ParseClaims() scope = %v, want %v", claims.Scope, "read:users list:users")
+	}
+}
+
+func TestIssueImpersonationToken(t *testing.T) {
+	jwtParse = jwt.Parse
+	sc := testServer()
+	sc.Auth.ImpersonationTTL = 15 * time.Minute
+	admin := &models.User{}
+	admin.ID = uuid.Must(uuid.NewV4())
+	u := &models.User{}
+	u.ID = uuid.Must(uuid.NewV4())
+
+	raw, issued, err := IssueImpersonationToken(sc, admin, u)
+	if err != nil {
+		t.Fatalf("IssueImpersonationToken() error = %v", err)
+	}
+	if d := time.Until(issued.ExpiresAt.Time); d <= 0 || d > sc.Auth.ImpersonationTTL {
+		t.Errorf("IssueImpersonationToken() expires in %v, want within %v", d, sc.Auth.ImpersonationTTL)
+	}
+	claims, err := ParseClaims(sc, raw)
+	if err != nil {
+		t.Fatalf("ParseClaims() error = %v", err)
+	}
+	if claims.TokenType != ImpersonationTokenType || claims.Subject != u.ID.String() {
+		t.Errorf("ParseClaims() = %+v, want an impersonation token of %s", claims, u.ID)
+	}
+	if claims.Act == nil || claims.Act.Subject != admin.ID.String() {
+		t.Errorf("ParseClaims() act = %+v, want %s", claims.Act, admin.ID)
+	}
+	if claims.ID == "" || claims.ID != issued.ID {
+		t.Errorf("ParseClaims() jti = %v, want %v", claims.ID, issued.ID)
+	}
+}
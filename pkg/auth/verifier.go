@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/markbates/goth"
+	"github.com/rakin92/go-rest-service/pkg/web"
+)
+
+var (
+	// GoogleTokenInfoURL is the endpoint validating google access and id tokens
+	GoogleTokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+	// FacebookGraphURL is the base of the facebook graph api
+	FacebookGraphURL = "https://graph.facebook.com"
+
+	// ErrEmptyProviderToken when there is no provider token to verify
+	ErrEmptyProviderToken = errors.New("access_token or id_token is required")
+
+	// ErrInvalidProviderToken when the provider rejects the token
+	ErrInvalidProviderToken = errors.New("invalid provider token")
+
+	// ErrInvalidAudience when the provider token was issued to another app
+	ErrInvalidAudience = errors.New("provider token was issued for another client")
+
+	// ErrUnsupportedProvider when the provider can't exchange tokens
+	ErrUnsupportedProvider = errors.New("provider doesn't support token exchange")
+
+	verifiers = map[string]TokenVerifier{}
+)
+
+// ProviderToken is the token a native client got from the provider SDK
+type ProviderToken struct {
+	AccessToken string `json:"access_token" form:"access_token"`
+	IDToken     string `json:"id_token" form:"id_token"`
+}
+
+// TokenVerifier validates a provider token and returns the profile it was
+// issued for
+type TokenVerifier interface {
+	Verify(t *ProviderToken) (*goth.User, error)
+}
+
+// RegisterTokenVerifier makes the provider available for token exchange
+func RegisterTokenVerifier(provider string, v TokenVerifier) {
+	verifiers[provider] = v
+}
+
+// GetTokenVerifier returns the verifier registered for the provider
+func GetTokenVerifier(provider string) (TokenVerifier, error) {
+	v, ok := verifiers[provider]
+	if !ok {
+		return nil, ErrUnsupportedProvider
+	}
+	return v, nil
+}
+
+// GoogleVerifier validates google tokens with the tokeninfo endpoint
+type GoogleVerifier struct {
+	ClientID  string
+	Audiences []string
+}
+
+// NewGoogleVerifier creates a verifier accepting tokens issued to the clients
+func NewGoogleVerifier(clientID string, audiences ...string) *GoogleVerifier {
+	return &GoogleVerifier{ClientID: clientID, Audiences: audiences}
+}
+
+// googleTokenInfo is the tokeninfo response, id tokens carry the profile
+type googleTokenInfo struct {
+	Error         string `json:"error"`
+	Audience      string `json:"aud"`
+	AuthorizedBy  string `json:"azp"`
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified string `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+}
+
+// Verify implements TokenVerifier
+func (v *GoogleVerifier) Verify(t *ProviderToken) (*goth.User, error) {
+	q := url.Values{}
+	switch {
+	case t.IDToken != "":
+		q.Set("id_token", t.IDToken)
+	case t.AccessToken != "":
+		q.Set("access_token", t.AccessToken)
+	default:
+		return nil, ErrEmptyProviderToken
+	}
+	body, err := web.Get(GoogleTokenInfoURL + "?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	info := &googleTokenInfo{}
+	if err := json.Unmarshal(body, info); err != nil {
+		return nil, err
+	}
+	if info.Error != "" || info.Subject == "" {
+		return nil, ErrInvalidProviderToken
+	}
+	if !containsAny(append([]string{v.ClientID}, v.Audiences...), info.Audience, info.AuthorizedBy) {
+		return nil, ErrInvalidAudience
+	}
+	raw := map[string]any{}
+	json.Unmarshal(body, &raw)
+	return &goth.User{
+		RawData:     raw,
+		Provider:    "google",
+		UserID:      info.Subject,
+		Email:       info.Email,
+		Name:        info.Name,
+		FirstName:   info.GivenName,
+		LastName:    info.FamilyName,
+		AvatarURL:   info.Picture,
+		AccessToken: t.AccessToken,
+		IDToken:     t.IDToken,
+	}, nil
+}
+
+// FacebookVerifier validates facebook access tokens with the graph api
+type FacebookVerifier struct {
+	AppID     string
+	AppSecret string
+	Audiences []string
+}
+
+// NewFacebookVerifier creates a verifier accepting tokens issued to the app
+func NewFacebookVerifier(appID string, appSecret string, audiences ...string) *FacebookVerifier {
+	return &FacebookVerifier{AppID: appID, AppSecret: appSecret, Audiences: audiences}
+}
+
+// facebookDebugToken is the debug_token response
+type facebookDebugToken struct {
+	Data struct {
+		AppID   string `json:"app_id"`
+		IsValid bool   `json:"is_valid"`
+		UserID  string `json:"user_id"`
+	} `json:"data"`
+}
+
+// facebookProfile is the /me response
+type facebookProfile struct {
+	ID        string `json:"id"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Picture   struct {
+		Data struct {
+			URL string `json:"url"`
+		} `json:"data"`
+	} `json:"picture"`
+}
+
+// Verify implements TokenVerifier
+func (v *FacebookVerifier) Verify(t *ProviderToken) (*goth.User, error) {
+	if t.AccessToken == "" {
+		return nil, ErrEmptyProviderToken
+	}
+	q := url.Values{}
+	q.Set("input_token", t.AccessToken)
+	q.Set("access_token", v.AppID+"|"+v.AppSecret)
+	body, err := web.Get(FacebookGraphURL + "/debug_token?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	debug := &facebookDebugToken{}
+	if err := json.Unmarshal(body, debug); err != nil {
+		return nil, err
+	}
+	if !debug.Data.IsValid || debug.Data.UserID == "" {
+		return nil, ErrInvalidProviderToken
+	}
+	if !containsAny(append([]string{v.AppID}, v.Audiences...), debug.Data.AppID) {
+		return nil, ErrInvalidAudience
+	}
+
+	q = url.Values{}
+	q.Set("fields", "id,email,name,first_name,last_name,picture")
+	q.Set("access_token", t.AccessToken)
+	body, err = web.Get(FacebookGraphURL + "/me?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	p := &facebookProfile{}
+	if err := json.Unmarshal(body, p); err != nil {
+		return nil, err
+	}
+	if p.ID != debug.Data.UserID {
+		return nil, fmt.Errorf("%w: profile doesn't match the token", ErrInvalidProviderToken)
+	}
+	raw := map[string]any{}
+	json.Unmarshal(body, &raw)
+	return &goth.User{
+		RawData:     raw,
+		Provider:    "facebook",
+		UserID:      p.ID,
+		Email:       p.Email,
+		Name:        p.Name,
+		FirstName:   p.FirstName,
+		LastName:    p.LastName,
+		AvatarURL:   p.Picture.Data.URL,
+		AccessToken: t.AccessToken,
+	}, nil
+}
+
+// containsAny checks if any of the values is in the list
+func containsAny(list []string, values ...string) bool {
+	for _, l := range list {
+		for _, v := range values {
+			if v != "" && strings.EqualFold(l, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGoogleVerifier_Verify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("id_token") {
+		case "valid":
+			w.Write([]byte(`{"aud":"web-client","sub":"123","email":"user@test.com","email_verified":"true","given_name":"Test"}`))
+		case "native":
+			w.Write([]byte(`{"aud":"ios-client","sub":"123","email":"user@test.com"}`))
+		case "other-app":
+			w.Write([]byte(`{"aud":"other-client","sub":"123","email":"user@test.com"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_token"}`))
+		}
+	}))
+	defer srv.Close()
+	GoogleTokenInfoURL = srv.URL
+
+	v := NewGoogleVerifier("web-client", "ios-client")
+	tests := []struct {
+		name    string
+		token   *ProviderToken
+		wantErr error
+	}{
+		{name: "valid id token", token: &ProviderToken{IDToken: "valid"}},
+		{name: "native client audience", token: &ProviderToken{IDToken: "native"}},
+		{name: "other app audience", token: &ProviderToken{IDToken: "other-app"}, wantErr: ErrInvalidAudience},
+		{name: "invalid token", token: &ProviderToken{IDToken: "invalid"}, wantErr: ErrInvalidProviderToken},
+		{name: "empty token", token: &ProviderToken{}, wantErr: ErrEmptyProviderToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GoogleVerifier.Verify() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && (got.UserID != "123" || got.Provider != "google" || got.Email != "user@test.com") {
+				t.Errorf("GoogleVerifier.Verify() = %+v, want google profile 123", got)
+			}
+		})
+	}
+}
+
+func TestFacebookVerifier_Verify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/debug_token":
+			switch r.URL.Query().Get("input_token") {
+			case "valid":
+				w.Write([]byte(`{"data":{"app_id":"app","is_valid":true,"user_id":"456"}}`))
+			case "other-app":
+				w.Write([]byte(`{"data":{"app_id":"other","is_valid":true,"user_id":"456"}}`))
+			default:
+				w.Write([]byte(`{"data":{"is_valid":false}}`))
+			}
+		case "/me":
+			w.Write([]byte(`{"id":"456","email":"user@test.com","first_name":"Test","last_name":"User"}`))
+		}
+	}))
+	defer srv.Close()
+	FacebookGraphURL = srv.URL
+
+	v := NewFacebookVerifier("app", "secret")
+	tests := []struct {
+		name    string
+		token   *ProviderToken
+		wantErr error
+	}{
+		{name: "valid access token", token: &ProviderToken{AccessToken: "valid"}},
+		{name: "other app", token: &ProviderToken{AccessToken: "other-app"}, wantErr: ErrInvalidAudience},
+		{name: "invalid token", token: &ProviderToken{AccessToken: "invalid"}, wantErr: ErrInvalidProviderToken},
+		{name: "id token only", token: &ProviderToken{IDToken: "valid"}, wantErr: ErrEmptyProviderToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("FacebookVerifier.Verify() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && (got.UserID != "456" || got.Provider != "facebook" || got.FirstName != "Test") {
+				t.Errorf("FacebookVerifier.Verify() = %+v, want facebook profile 456", got)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 // Package cfg is the configuration package hold all config objects
 package cfg
 
+import "time"
+
 // Server defines the configuration for the server
 type Server struct {
 	ServiceName    string
@@ -11,18 +13,69 @@ type Server struct {
 	URISchema      string
 	ServiceVersion string
 	SessionSecret  string
+	// TrustedProxies are the addresses or CIDR ranges of the proxies whose
+	// forwarded headers are believed to resolve the client IP, none when empty
+	TrustedProxies []string
 	JWT            JWT
+	Auth           Auth
 	Cache          Cache
 	Database       DB
 	MDB            MongoDB
 	Sentry         Sentry
 	AuthProviders  []AuthProvider
+	LDAP           LDAP
+	SAML           SAML
 }
 
 // JWT defines the options for JWT tokens
 type JWT struct {
-	Secret    string
-	Algorithm string
+	Secret          string
+	Algorithm       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// Auth defines the policies for authentication and account linking
+type Auth struct {
+	// MergeVerifiedEmails allows a new provider profile to be attached to an
+	// existing user with the same email, only when the provider asserts the
+	// email has been verified
+	MergeVerifiedEmails bool
+	// RedirectAllowlist are the URIs (origin and path prefix) the OAuth
+	// callback is allowed to redirect to
+	RedirectAllowlist []string
+	// DefaultRedirectURI is where the callback redirects when the client
+	// didn't ask for a redirect_uri
+	DefaultRedirectURI string
+	// ImpersonationTTL is how long the token of an admin impersonating a
+	// user lasts, it can't be refreshed
+	ImpersonationTTL time.Duration
+	// SessionCutover is when the tokens started carrying their session, the
+	// access tokens issued before have none and are accepted until they are
+	// all expired. They are always refused when zero
+	SessionCutover time.Time
+	// PolicyFile holds the rules resources are authorized with, the ones
+	// shipped with the service are used when empty
+	PolicyFile string
+	Lockout    Lockout
+	Signing    Signing
+}
+
+// Signing defines the verification of the requests signed with api keys
+type Signing struct {
+	MaxSkew time.Duration // how far the timestamp of a signed request may be from now
+}
+
+// Lockout defines the brute-force protection for failed auth attempts
+type Lockout struct {
+	Enabled         bool
+	MaxAttempts     int           // failed attempts of an account before it's locked
+	MaxAttemptsIP   int           // failed attempts of an IP or API key prefix before it's locked
+	DelayAfter      int           // failed attempts before the next ones must wait
+	BaseDelay       time.Duration // first wait, doubled on every further attempt
+	MaxDelay        time.Duration
+	Window          time.Duration // how long failed attempts are counted for
+	LockoutDuration time.Duration
 }
 
 // Cache defines the configuration for the cache
@@ -41,6 +94,10 @@ type DB struct {
 	AutoMigrate bool
 	MaxCon      int
 	MaxIdleCon  int
+	// ReplicaDSNs are the read replicas of the DSN, they are checked every
+	// ReplicaCheckInterval
+	ReplicaDSNs          []string
+	ReplicaCheckInterval time.Duration
 }
 
 // MongoDB defines the configuration for the mongo DB config
@@ -60,11 +117,81 @@ type Sentry struct {
 
 // AuthProvider defines the configuration for the Goth config
 type AuthProvider struct {
-	Provider  string
-	ClientKey string
-	Secret    string
-	Domain    string // If needed, like with auth0
-	Scopes    []string
+	Provider     string
+	ClientKey    string
+	Secret       string
+	Domain       string // If needed, like with auth0
+	Scopes       []string
+	Audiences    []string // Extra client ids accepted on exchanged tokens, like native apps
+	ResponseMode string   // How the callback hands the tokens: json, fragment, cookie or post_message
+}
+
+// LDAP defines the directory users can log in to with their credentials,
+// like Active Directory
+type LDAP struct {
+	URL                string // ldap:// or ldaps://, the provider is disabled when empty
+	StartTLS           bool
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+	// BindDN is the service account searching the directory, the searches
+	// are anonymous when empty
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	UserFilter   string // finds the user by login, %s is the escaped username
+	GroupBaseDN  string // where groups are searched, BaseDN when empty
+	GroupFilter  string // finds the groups of the user, %s is the escaped user DN
+	// EmailsVerified trusts the directory to own the emails of its users, so
+	// they may be merged into existing accounts
+	EmailsVerified bool
+	Attributes     LDAPAttributes
+	// GroupRoles maps the group DNs, or their CNs, to the names of the roles
+	// their members are granted
+	GroupRoles map[string]string
+}
+
+// LDAPAttributes are the attributes of the user entries
+type LDAPAttributes struct {
+	ID        string // stable id of the user, like uid or objectGUID
+	Email     string
+	FirstName string
+	LastName  string
+	Name      string
+	MemberOf  string // groups listed on the user entry, skipped when empty
+}
+
+// SAML defines the service provider the SAML identity providers log users in
+// to, its key signs the requests and decrypts the assertions
+type SAML struct {
+	CertificateFile string // PEM certificate published in the metadata
+	KeyFile         string // PEM RSA key of the certificate
+	IDPs            []SAMLIdP
+}
+
+// SAMLIdP defines an identity provider, its users get profiles with the
+// `saml:<name>` provider
+type SAMLIdP struct {
+	Name         string
+	MetadataURL  string // fetched when the service starts
+	MetadataFile string // used instead of the url when set
+	// AllowIDPInitiated accepts logins started from the identity provider
+	// portal, without a request of ours to answer
+	AllowIDPInitiated bool
+	// EmailsVerified trusts the identity provider to own the emails of its
+	// users, so they may be merged into existing accounts
+	EmailsVerified bool
+	ResponseMode   string // How the ACS hands the tokens: json, fragment, cookie or post_message
+	Attributes     SAMLAttributes
+}
+
+// SAMLAttributes are the names, or friendly names, of the assertion
+// attributes of the user
+type SAMLAttributes struct {
+	ID        string // stable id of the user, the NameID when empty
+	Email     string // the NameID is used when empty and it's an email
+	FirstName string
+	LastName  string
+	Name      string
 }
 
 func getValidHost(host string) string {
@@ -74,6 +201,17 @@ func getValidHost(host string) string {
 	return host
 }
 
+// AuthProvider returns the configuration of the auth provider, or nil if
+// the provider isn't configured
+func (s *Server) AuthProvider(provider string) *AuthProvider {
+	for i := range s.AuthProviders {
+		if s.AuthProviders[i].Provider == provider {
+			return &s.AuthProviders[i]
+		}
+	}
+	return nil
+}
+
 // ListenEndpoint builds the endpoint string (host + port)
 func (s *Server) ListenEndpoint() string {
 	if s.Port == "80" {
@@ -196,3 +196,42 @@ func TestServer_SchemaVersionedEndpoint(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_AuthProvider(t *testing.T) {
+	s := &Server{
+		AuthProviders: []AuthProvider{
+			{Provider: "google", ClientKey: "google-key"},
+			{Provider: "facebook", ClientKey: "facebook-key"},
+		},
+	}
+	tests := []struct {
+		name     string
+		provider string
+		want     string
+	}{
+		{
+			name:     "configured provider",
+			provider: "facebook",
+			want:     "facebook-key",
+		},
+		{
+			name:     "unknown provider",
+			provider: "twitter",
+			want:     "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.AuthProvider(tt.provider)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("Server.AuthProvider() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.ClientKey != tt.want {
+				t.Errorf("Server.AuthProvider() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package consts
 
 import (
 	"fmt"
+	"reflect"
 	"regexp"
 	"strings"
 )
@@ -26,6 +27,27 @@ type entitynames struct {
 	UserPermissions string
 	UserProfiles    string
 	UserRoles       string
+	OauthClients    string
+	Impersonations  string
+	Organizations   string
+	Memberships     string
+	Policies        string
+	ScimClients     string
+	AuditEntries    string
+	Metrics         string
+}
+
+type responseModes struct {
+	JSON        string
+	Fragment    string
+	Cookie      string
+	PostMessage string
+}
+
+type grantTypes struct {
+	ClientCredentials string
+	AuthorizationCode string
+	RefreshToken      string
 }
 
 type role struct {
@@ -33,9 +55,15 @@ type role struct {
 	Description string
 }
 
+type orgRoles struct {
+	Owner  role
+	Member role
+}
+
 type dialects struct {
 	PostgresSQL string
 	MySQL       string
+	SQLite      string
 }
 
 var (
@@ -60,11 +88,35 @@ var (
 		UserPermissions: "UserPermissions",
 		UserProfiles:    "UserProfiles",
 		UserRoles:       "UserRoles",
+		OauthClients:    "OauthClients",
+		Impersonations:  "Impersonations",
+		Organizations:   "Organizations",
+		Memberships:     "Memberships",
+		Policies:        "Policies",
+		ScimClients:     "ScimClients",
+		AuditEntries:    "AuditEntries",
+		Metrics:         "Metrics",
 	}
 	// Dialects are definition of databases
 	Dialects = dialects{
 		PostgresSQL: "postgres",
 		MySQL:       "mysql",
+		SQLite:      "sqlite3",
+	}
+
+	// ResponseModes are the ways the OAuth callback can hand the tokens over
+	ResponseModes = responseModes{
+		JSON:        "json",
+		Fragment:    "fragment",
+		Cookie:      "cookie",
+		PostMessage: "post_message",
+	}
+
+	// GrantTypes are the OAuth2 grants the service issues tokens for
+	GrantTypes = grantTypes{
+		ClientCredentials: "client_credentials",
+		AuthorizationCode: "authorization_code",
+		RefreshToken:      "refresh_token",
 	}
 
 	// Roles that are part of the system
@@ -79,6 +131,18 @@ var (
 		},
 	}
 
+	// OrgRoles are the roles of the members within an organization
+	OrgRoles = orgRoles{
+		Owner: role{
+			Name:        "org:owner",
+			Description: "Manages the organization and its members",
+		},
+		Member: role{
+			Name:        "org:member",
+			Description: "Member of the organization",
+		},
+	}
+
 	matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
 	matchAllCap   = regexp.MustCompile("([a-z0-9])([A-Z])")
 )
@@ -100,6 +164,67 @@ func FormatPermissionDesc(action string, entity string) string {
 		strings.ReplaceAll(FormatPermissionTag(action, entity), ":", " ")
 }
 
+// IsResponseMode checks if the mode is one of the supported response modes
+func IsResponseMode(mode string) bool {
+	switch mode {
+	case ResponseModes.JSON, ResponseModes.Fragment, ResponseModes.Cookie, ResponseModes.PostMessage:
+		return true
+	}
+	return false
+}
+
+// IsOrgRole checks if the role is one of the roles within an organization
+func IsOrgRole(name string) bool {
+	switch name {
+	case OrgRoles.Owner.Name, OrgRoles.Member.Name:
+		return true
+	}
+	return false
+}
+
+// IsSystemRole checks if the role is one the service relies on, of the app
+// or within an organization
+func IsSystemRole(name string) bool {
+	for _, r := range Roles {
+		if r.Name == name {
+			return true
+		}
+	}
+	return IsOrgRole(name)
+}
+
+// IsSystemPermission checks if the permission tag is one the service seeds,
+// an action on one of its entities, the routes rely on them
+func IsSystemPermission(tag string) bool {
+	action, entity, ok := strings.Cut(tag, ":")
+	return ok && hasField(Permissions, action, false) && hasField(EntityNames, entity, true)
+}
+
+// hasField checks if one of the string fields of the struct is the value,
+// as the table name of the field when [table] is set
+func hasField(s any, value string, table bool) bool {
+	v := reflect.ValueOf(s)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i).String()
+		if table {
+			f = GetTableName(f)
+		}
+		if f == value {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGrantType checks if the grant is one of the supported OAuth2 grant types
+func IsGrantType(grantType string) bool {
+	switch grantType {
+	case GrantTypes.ClientCredentials, GrantTypes.AuthorizationCode, GrantTypes.RefreshToken:
+		return true
+	}
+	return false
+}
+
 // ToSnakeCase converts camelcase str to snake_case
 func ToSnakeCase(str string) string {
 	snake := matchFirstCap.ReplaceAllString(str, "${1}_${2}")
@@ -116,6 +241,17 @@ type ContextKeys struct {
 	ProviderCtxKey       ContextKey // Provider in Auth
 	UserCtxKey           ContextKey // User db object in Auth
 	UserIDCtxKey         ContextKey // User db object in Auth
+	ServiceCtxKey        ContextKey // Service principal of an OAuth client in Auth
+	ClientIDCtxKey       ContextKey // OAuth client id in Auth
+	ImpersonatorCtxKey   ContextKey // Admin db object impersonating the user in Auth
+	ImpersonatorIDCtxKey ContextKey // Admin id impersonating the user in Auth
+	MembershipCtxKey     ContextKey // Membership db object of the active organization in Auth
+	OrganizationIDCtxKey ContextKey // Active organization id in Auth
+	SessionIDCtxKey      ContextKey // Session id of the token in Auth
+	SCIMClientCtxKey     ContextKey // SCIM client db object in Auth
+	SAMLIdPCtxKey        ContextKey // SAML identity provider in Auth
+	APIKeyIDCtxKey       ContextKey // API key id the user authenticated with in Auth
+	RequestIDCtxKey      ContextKey // Request id of the X-Request-ID header in the logger
 }
 
 var (
@@ -125,5 +261,16 @@ var (
 		ProviderCtxKey:       "gg-provider",
 		UserCtxKey:           "gg-auth-user",
 		UserIDCtxKey:         "auth-user-id",
+		ServiceCtxKey:        "gg-auth-service",
+		ClientIDCtxKey:       "auth-client-id",
+		ImpersonatorCtxKey:   "gg-auth-impersonator",
+		ImpersonatorIDCtxKey: "auth-impersonator-id",
+		MembershipCtxKey:     "gg-auth-membership",
+		OrganizationIDCtxKey: "auth-organization-id",
+		SessionIDCtxKey:      "auth-session-id",
+		SCIMClientCtxKey:     "gg-auth-scim-client",
+		SAMLIdPCtxKey:        "gg-saml-idp",
+		APIKeyIDCtxKey:       "auth-api-key-id",
+		RequestIDCtxKey:      "request-id",
 	}
 )
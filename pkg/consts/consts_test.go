@@ -132,3 +132,107 @@ func TestGetTableName(t *testing.T) {
 		})
 	}
 }
+
+func TestIsResponseMode(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		want bool
+	}{
+		{name: "json", mode: "json", want: true},
+		{name: "fragment", mode: "fragment", want: true},
+		{name: "cookie", mode: "cookie", want: true},
+		{name: "post_message", mode: "post_message", want: true},
+		{name: "unknown", mode: "form_post", want: false},
+		{name: "empty", mode: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsResponseMode(tt.mode); got != tt.want {
+				t.Errorf("IsResponseMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsGrantType(t *testing.T) {
+	tests := []struct {
+		name      string
+		grantType string
+		want      bool
+	}{
+		{name: "client_credentials", grantType: "client_credentials", want: true},
+		{name: "authorization_code", grantType: "authorization_code", want: true},
+		{name: "refresh_token", grantType: "refresh_token", want: true},
+		{name: "password", grantType: "password", want: false},
+		{name: "empty", grantType: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsGrantType(tt.grantType); got != tt.want {
+				t.Errorf("IsGrantType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsOrgRole(t *testing.T) {
+	tests := []struct {
+		name string
+		role string
+		want bool
+	}{
+		{name: "owner", role: "org:owner", want: true},
+		{name: "member", role: "org:member", want: true},
+		{name: "global role", role: "admin", want: false},
+		{name: "empty", role: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsOrgRole(tt.role); got != tt.want {
+				t.Errorf("IsOrgRole() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSystemRole(t *testing.T) {
+	tests := []struct {
+		name string
+		role string
+		want bool
+	}{
+		{name: "admin", role: "admin", want: true},
+		{name: "user", role: "user", want: true},
+		{name: "org role", role: "org:owner", want: true},
+		{name: "provisioned group", role: "engineering", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSystemRole(tt.role); got != tt.want {
+				t.Errorf("IsSystemRole() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSystemPermission(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want bool
+	}{
+		{name: "seeded", tag: "read:users", want: true},
+		{name: "seeded assign", tag: "assign:role_permissions", want: true},
+		{name: "unknown entity", tag: "read:invoices", want: false},
+		{name: "unknown action", tag: "export:users", want: false},
+		{name: "not a tag", tag: "users", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSystemPermission(tt.tag); got != tt.want {
+				t.Errorf("IsSystemPermission() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ package env
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rakin92/go-rest-service/pkg/logger"
 )
@@ -77,3 +79,101 @@ func MustGetFloat64(k string) float64 {
 	}
 	return i
 }
+
+// Get will return the env or the fallback value if it is not present
+func Get(k string, fallback string) string {
+	v := os.Getenv(k)
+	if v == "" {
+		return fallback
+	}
+	return v
+}
+
+// GetBool will return the env as boolean or the fallback value if it is not
+// present, it panics if the value can't be parsed
+func GetBool(k string, fallback bool) bool {
+	v := os.Getenv(k)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		logger.InvalidArgValue(k, v)
+		logger.Panic(&err, "ENV err: [%s]", err.Error())
+	}
+	return b
+}
+
+// GetInt will return the env as integer or the fallback value if it is not
+// present, it panics if the value can't be parsed
+func GetInt(k string, fallback int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return fallback
+	}
+	i, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		logger.InvalidArgValue(k, v)
+		logger.Panic(&err, "ENV err: [%s]", err.Error())
+	}
+	return int(i)
+}
+
+// GetDuration will return the env as time.Duration or the fallback value if it
+// is not present, it panics if the value can't be parsed
+func GetDuration(k string, fallback time.Duration) time.Duration {
+	v := os.Getenv(k)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		logger.InvalidArgValue(k, v)
+		logger.Panic(&err, "ENV err: [%s]", err.Error())
+	}
+	return d
+}
+
+// GetTime will return the env as a RFC 3339 time or the zero time if it is
+// not present, it panics if the value can't be parsed
+func GetTime(k string) time.Time {
+	v := os.Getenv(k)
+	if v == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		logger.InvalidArgValue(k, v)
+		logger.Panic(&err, "ENV err: [%s]", err.Error())
+	}
+	return t
+}
+
+// GetList will return the env as a list of comma separated values, or an
+// empty list if it is not present
+func GetList(k string) []string {
+	list := []string{}
+	for _, v := range strings.Split(os.Getenv(k), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// GetMap will return the env as a map of `key=value` pairs separated by
+// semicolons, the value is after the last `=` so keys may hold DNs. An empty
+// map is returned if it is not present
+func GetMap(k string) map[string]string {
+	m := map[string]string{}
+	for _, kv := range strings.Split(os.Getenv(k), ";") {
+		i := strings.LastIndex(kv, "=")
+		if i < 0 {
+			continue
+		}
+		if key, v := strings.TrimSpace(kv[:i]), strings.TrimSpace(kv[i+1:]); key != "" && v != "" {
+			m[key] = v
+		}
+	}
+	return m
+}
@@ -3,6 +3,7 @@ package env_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/rakin92/go-rest-service/pkg/env"
 	"github.com/stretchr/testify/assert"
@@ -195,3 +196,130 @@ func TestMustGetInt64(t *testing.T) {
 		assert.Equal(t, expect, got)
 	})
 }
+
+func TestGet(t *testing.T) {
+	t.Run("Returns fallback when can't find env variable", func(t *testing.T) {
+		got := env.Get("host", "localhost")
+		assert.Equal(t, "localhost", got)
+	})
+	t.Run("Returns env variable when found", func(t *testing.T) {
+		t.Setenv("host", "example.com")
+
+		got := env.Get("host", "localhost")
+		assert.Equal(t, "example.com", got)
+	})
+}
+
+func TestGetBool(t *testing.T) {
+	t.Run("Returns fallback when can't find env variable", func(t *testing.T) {
+		assert.Equal(t, true, env.GetBool("debug", true))
+		assert.Equal(t, false, env.GetBool("debug", false))
+	})
+	t.Run("Panic when fail to parse bool", func(t *testing.T) {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("GetBool should have panicked!")
+				}
+			}()
+			t.Setenv("debug", "not_supported_bool")
+			env.GetBool("debug", false)
+		}()
+	})
+	t.Run("Returns env variable when found", func(t *testing.T) {
+		t.Setenv("debug", "true")
+
+		assert.Equal(t, true, env.GetBool("debug", false))
+	})
+}
+
+func TestGetInt(t *testing.T) {
+	t.Run("Returns fallback when can't find env variable", func(t *testing.T) {
+		assert.Equal(t, 10, env.GetInt("attempts", 10))
+	})
+	t.Run("Panic when fail to parse int", func(t *testing.T) {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("GetInt should have panicked!")
+				}
+			}()
+			t.Setenv("attempts", "not_an_int")
+			env.GetInt("attempts", 10)
+		}()
+	})
+	t.Run("Returns env variable when found", func(t *testing.T) {
+		t.Setenv("attempts", "5")
+
+		assert.Equal(t, 5, env.GetInt("attempts", 10))
+	})
+}
+
+func TestGetDuration(t *testing.T) {
+	t.Run("Returns fallback when can't find env variable", func(t *testing.T) {
+		assert.Equal(t, time.Hour, env.GetDuration("ttl", time.Hour))
+	})
+	t.Run("Panic when fail to parse duration", func(t *testing.T) {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("GetDuration should have panicked!")
+				}
+			}()
+			t.Setenv("ttl", "not_a_duration")
+			env.GetDuration("ttl", time.Hour)
+		}()
+	})
+	t.Run("Returns env variable when found", func(t *testing.T) {
+		t.Setenv("ttl", "15m")
+
+		assert.Equal(t, 15*time.Minute, env.GetDuration("ttl", time.Hour))
+	})
+}
+
+func TestGetTime(t *testing.T) {
+	t.Run("Returns the zero time when can't find env variable", func(t *testing.T) {
+		assert.True(t, env.GetTime("since").IsZero())
+	})
+	t.Run("Panic when fail to parse time", func(t *testing.T) {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("GetTime should have panicked!")
+				}
+			}()
+			t.Setenv("since", "yesterday")
+			env.GetTime("since")
+		}()
+	})
+	t.Run("Returns env variable when found", func(t *testing.T) {
+		t.Setenv("since", "2022-06-01T12:00:00Z")
+
+		assert.Equal(t, time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC), env.GetTime("since"))
+	})
+}
+
+func TestGetList(t *testing.T) {
+	t.Run("Returns empty list when can't find env variable", func(t *testing.T) {
+		assert.Equal(t, []string{}, env.GetList("hosts"))
+	})
+	t.Run("Returns the trimmed values", func(t *testing.T) {
+		t.Setenv("hosts", "a.com, b.com,,c.com ")
+
+		assert.Equal(t, []string{"a.com", "b.com", "c.com"}, env.GetList("hosts"))
+	})
+}
+
+func TestGetMap(t *testing.T) {
+	t.Run("Returns empty map when can't find env variable", func(t *testing.T) {
+		assert.Equal(t, map[string]string{}, env.GetMap("roles"))
+	})
+	t.Run("Returns the trimmed pairs", func(t *testing.T) {
+		t.Setenv("roles", "cn=Admins,ou=Groups,dc=corp=admin; Developers = developer;;bad;empty=")
+
+		assert.Equal(t, map[string]string{
+			"cn=Admins,ou=Groups,dc=corp": "admin",
+			"Developers":                  "developer",
+		}, env.GetMap("roles"))
+	})
+}
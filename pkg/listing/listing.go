@@ -0,0 +1,358 @@
+// Package listing parses the query params of the list endpoints: the
+// filters, the sorting, the sparse fields and the cursor of the page, like
+//
+//	?filter[email][ilike]=%@example.com&sort=-created_at&fields=id,email&limit=20
+//
+// and turns them into SQL conditions against allowlisted columns
+package listing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultSort is the column the rows are sorted on when the query doesn't
+	// ask for another, the indexed creation time of the models
+	DefaultSort = "created_at"
+
+	// TieBreaker is the column ending every sort, so the order is total and
+	// the cursors point at a single row
+	TieBreaker = "id"
+
+	// MaxLimit is the most rows listed at once when the options don't say
+	MaxLimit = 100
+)
+
+// ErrInvalidQuery when the query params can't be parsed or ask for a column
+// that isn't allowed
+var ErrInvalidQuery = errors.New("invalid list query")
+
+// filter operators and their SQL, "ilike", "in" and "null" are built apart
+var filterOps = map[string]string{
+	"eq": "=", "ne": "<>", "lt": "<", "lte": "<=", "gt": ">", "gte": ">=",
+	"like": "LIKE", "ilike": "", "in": "", "null": "",
+}
+
+// filterParam is filter[name] or filter[name][op]
+var filterParam = regexp.MustCompile(`^filter\[([A-Za-z0-9_.]+)\](?:\[([a-z]+)\])?$`)
+
+// queryError wraps ErrInvalidQuery with what is wrong
+func queryError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidQuery, fmt.Sprintf(format, args...))
+}
+
+// Options are what a list endpoint allows
+type Options struct {
+	// Filters maps the names the rows can be filtered on to their columns
+	Filters map[string]string
+	// Sorts maps the names the rows can be sorted on to their columns, they
+	// must not be nullable for the cursors to work. The creation time and the
+	// id are always allowed
+	Sorts map[string]string
+	// MaxLimit is the most rows listed at once, MaxLimit when zero
+	MaxLimit int
+}
+
+// Filter is a condition on a column, Values has many values for the "in"
+// operator and one for the others
+type Filter struct {
+	Column string
+	Op     string
+	Values []string
+}
+
+// Order sorts on a column
+type Order struct {
+	Column string
+	Desc   bool
+}
+
+// Query is a parsed list query
+type Query struct {
+	Filters []Filter
+	// Sort always ends with the TieBreaker
+	Sort []Order
+	// Fields are the fields of the rows to show, all of them when empty
+	Fields []string
+	// After are the values of the Sort columns of the last row of the previous
+	// page, the first page has none
+	After []any
+	Limit int
+}
+
+// Parse parses the query params of the list: the filter[name][op], sort,
+// fields, cursor and limit ones
+func Parse(params url.Values, o *Options) (*Query, error) {
+	q := &Query{}
+	for key, values := range params {
+		if !strings.HasPrefix(key, "filter[") {
+			continue
+		}
+		f, err := parseFilter(key, values[len(values)-1], o.Filters)
+		if err != nil {
+			return nil, err
+		}
+		q.Filters = append(q.Filters, *f)
+	}
+	// the params come from a map, the conditions are kept in a stable order
+	sort.Slice(q.Filters, func(i, j int) bool {
+		a, b := q.Filters[i], q.Filters[j]
+		return a.Column < b.Column || a.Column == b.Column && a.Op < b.Op
+	})
+
+	orders, err := parseSort(params.Get("sort"), o.Sorts)
+	if err != nil {
+		return nil, err
+	}
+	q.Sort = orders
+
+	for _, f := range strings.Split(params.Get("fields"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			q.Fields = append(q.Fields, f)
+		}
+	}
+
+	max := o.MaxLimit
+	if max <= 0 {
+		max = MaxLimit
+	}
+	q.Limit = max
+	if l := params.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			return nil, queryError("the limit must be a positive number")
+		}
+		if limit < max {
+			q.Limit = limit
+		}
+	}
+
+	if c := params.Get("cursor"); c != "" {
+		if q.After, err = q.decodeCursor(c); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// parseFilter parses a filter[name] or filter[name][op] param
+func parseFilter(key, value string, columns map[string]string) (*Filter, error) {
+	m := filterParam.FindStringSubmatch(key)
+	if m == nil {
+		return nil, queryError("malformed filter %s", key)
+	}
+	column, ok := columns[m[1]]
+	if !ok {
+		return nil, queryError("can't filter on %s", m[1])
+	}
+	op := m[2]
+	if op == "" {
+		op = "eq"
+	}
+	if _, ok := filterOps[op]; !ok {
+		return nil, queryError("unknown filter operator %s", op)
+	}
+	f := &Filter{Column: column, Op: op, Values: []string{value}}
+	switch op {
+	case "in":
+		f.Values = strings.Split(value, ",")
+	case "null":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return nil, queryError("filter[%s][null] must be true or false", m[1])
+		}
+	}
+	return f, nil
+}
+
+// parseSort parses the sort param, a list of names descending when prefixed
+// with a minus
+func parseSort(param string, columns map[string]string) ([]Order, error) {
+	orders := []Order{}
+	seen := map[string]bool{}
+	for _, name := range strings.Split(param, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		o := Order{}
+		if strings.HasPrefix(name, "-") {
+			o.Desc = true
+			name = name[1:]
+		}
+		switch column, ok := columns[name]; {
+		case ok:
+			o.Column = column
+		case name == DefaultSort || name == TieBreaker:
+			o.Column = name
+		default:
+			return nil, queryError("can't sort on %s", name)
+		}
+		if seen[o.Column] {
+			return nil, queryError("%s is sorted on twice", name)
+		}
+		seen[o.Column] = true
+		orders = append(orders, o)
+	}
+	if len(orders) == 0 {
+		orders = append(orders, Order{Column: DefaultSort})
+		seen[DefaultSort] = true
+	}
+	if !seen[TieBreaker] {
+		// the tie breaker follows the direction of the last column
+		orders = append(orders, Order{Column: TieBreaker, Desc: orders[len(orders)-1].Desc})
+	}
+	return orders, nil
+}
+
+// Where is the condition of the filters and its args, the empty condition
+// when there are none
+func (q *Query) Where() (string, []any) {
+	conds := make([]string, 0, len(q.Filters))
+	args := []any{}
+	for _, f := range q.Filters {
+		switch f.Op {
+		case "ilike":
+			conds = append(conds, "LOWER("+f.Column+") LIKE LOWER(?)")
+			args = append(args, f.Values[0])
+		case "in":
+			conds = append(conds, f.Column+" IN ?")
+			args = append(args, f.Values)
+		case "null":
+			if null, _ := strconv.ParseBool(f.Values[0]); null {
+				conds = append(conds, f.Column+" IS NULL")
+			} else {
+				conds = append(conds, f.Column+" IS NOT NULL")
+			}
+		default:
+			conds = append(conds, f.Column+" "+filterOps[f.Op]+" ?")
+			args = append(args, f.Values[0])
+		}
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// OrderBy is the ORDER BY clause of the sort
+func (q *Query) OrderBy() string {
+	parts := make([]string, 0, len(q.Sort))
+	for _, o := range q.Sort {
+		if o.Desc {
+			parts = append(parts, o.Column+" DESC")
+		} else {
+			parts = append(parts, o.Column)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Seek is the condition of the rows after the cursor and its args, the
+// empty condition on the first page. For a, b ascending it's
+// (a > ?) OR (a = ? AND b > ?)
+func (q *Query) Seek() (string, []any) {
+	if len(q.After) == 0 {
+		return "", nil
+	}
+	ors := make([]string, 0, len(q.Sort))
+	args := []any{}
+	for i, o := range q.Sort {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, q.Sort[j].Column+" = ?")
+			args = append(args, q.After[j])
+		}
+		if o.Desc {
+			ands = append(ands, o.Column+" < ?")
+		} else {
+			ands = append(ands, o.Column+" > ?")
+		}
+		args = append(args, q.After[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+// cursor is what the opaque cursors hold, the sort they were made for and
+// the values of its columns
+type cursor struct {
+	Sort   string `json:"s"`
+	Values []any  `json:"v"`
+}
+
+// Cursor is the cursor of the page following the row with the values of
+// the Sort columns
+func (q *Query) Cursor(values []any) (string, error) {
+	raw, err := json.Marshal(&cursor{Sort: q.OrderBy(), Values: values})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// decodeCursor returns the values of the cursor, it must have been made for
+// the same sort
+func (q *Query) decodeCursor(s string) ([]any, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, queryError("malformed cursor")
+	}
+	c := &cursor{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	// the ids keep their precision
+	d.UseNumber()
+	if err := d.Decode(c); err != nil {
+		return nil, queryError("malformed cursor")
+	}
+	if c.Sort != q.OrderBy() || len(c.Values) != len(q.Sort) {
+		return nil, queryError("the cursor is for another sort")
+	}
+	for i, v := range c.Values {
+		if n, ok := v.(json.Number); ok {
+			c.Values[i] = n.String()
+		}
+	}
+	return c.Values, nil
+}
+
+// Link is the Link header pointing at the page of the cursor, with the other
+// params of the request kept as they are
+func Link(u *url.URL, next string) string {
+	params := u.Query()
+	params.Set("cursor", next)
+	link := url.URL{Path: u.Path, RawQuery: params.Encode()}
+	return `<` + link.String() + `>; rel="next"`
+}
+
+// Sparse keeps the fields of the rows, encoded as JSON objects, and their
+// id. The rows are returned as they are when there are no fields
+func Sparse(rows any, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return rows, nil
+	}
+	raw, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+	objects := []map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &objects); err != nil {
+		return nil, err
+	}
+	keep := map[string]bool{TieBreaker: true}
+	for _, f := range fields {
+		keep[f] = true
+	}
+	for _, o := range objects {
+		for name := range o {
+			if !keep[name] {
+				delete(o, name)
+			}
+		}
+	}
+	return objects, nil
+}
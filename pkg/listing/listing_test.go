@@ -0,0 +1,135 @@
+package listing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+var testOptions = &Options{
+	Filters: map[string]string{"email": "email", "name": "first_name", "created_at": "created_at"},
+	Sorts:   map[string]string{"email": "email"},
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantWhere string
+		wantArgs  []any
+		wantOrder string
+		wantLimit int
+		wantErr   bool
+	}{
+		{name: "defaults", wantWhere: "", wantArgs: []any{}, wantOrder: "created_at, id", wantLimit: MaxLimit},
+		{name: "equal", query: "filter[email]=jane@example.com",
+			wantWhere: "email = ?", wantArgs: []any{"jane@example.com"}, wantOrder: "created_at, id", wantLimit: MaxLimit},
+		{name: "operators", query: "filter[email][ilike]=%25@Example.com&filter[created_at][gte]=2022-01-01&filter[name][null]=false",
+			wantWhere: "created_at >= ? AND LOWER(email) LIKE LOWER(?) AND first_name IS NOT NULL",
+			wantArgs:  []any{"2022-01-01", "%@Example.com"}, wantOrder: "created_at, id", wantLimit: MaxLimit},
+		{name: "in", query: "filter[name][in]=Jane,John",
+			wantWhere: "first_name IN ?", wantArgs: []any{[]string{"Jane", "John"}}, wantOrder: "created_at, id", wantLimit: MaxLimit},
+		{name: "sort", query: "sort=-created_at", wantWhere: "", wantArgs: []any{},
+			wantOrder: "created_at DESC, id DESC", wantLimit: MaxLimit},
+		{name: "sort on many", query: "sort=email,-created_at&limit=10", wantWhere: "", wantArgs: []any{},
+			wantOrder: "email, created_at DESC, id DESC", wantLimit: 10},
+		{name: "limit over the max", query: "limit=1000", wantWhere: "", wantArgs: []any{},
+			wantOrder: "created_at, id", wantLimit: MaxLimit},
+		{name: "unknown filter", query: "filter[password]=x", wantErr: true},
+		{name: "unknown operator", query: "filter[email][regex]=x", wantErr: true},
+		{name: "malformed filter", query: "filter[email)=x", wantErr: true},
+		{name: "null not a bool", query: "filter[name][null]=maybe", wantErr: true},
+		{name: "unknown sort", query: "sort=first_name", wantErr: true},
+		{name: "sorted twice", query: "sort=email,-email", wantErr: true},
+		{name: "negative limit", query: "limit=-1", wantErr: true},
+		{name: "malformed cursor", query: "cursor=%7B", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := Parse(params, testOptions)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Errorf("Parse() error = %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			where, args := q.Where()
+			if where != tt.wantWhere || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("Where() = %q %v, want %q %v", where, args, tt.wantWhere, tt.wantArgs)
+			}
+			if order := q.OrderBy(); order != tt.wantOrder {
+				t.Errorf("OrderBy() = %q, want %q", order, tt.wantOrder)
+			}
+			if q.Limit != tt.wantLimit {
+				t.Errorf("Limit = %d, want %d", q.Limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestQuery_Cursor(t *testing.T) {
+	first, err := Parse(url.Values{"sort": {"-email"}}, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seek, _ := first.Seek(); seek != "" {
+		t.Errorf("Seek() = %q on the first page", seek)
+	}
+	cursor, err := first.Cursor([]any{"jane@example.com", 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := Parse(url.Values{"sort": {"-email"}, "cursor": {cursor}}, testOptions)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	seek, args := next.Seek()
+	if want := "((email < ?) OR (email = ? AND id < ?))"; seek != want {
+		t.Errorf("Seek() = %q, want %q", seek, want)
+	}
+	if want := []any{"jane@example.com", "jane@example.com", "42"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("Seek() args = %v, want %v", args, want)
+	}
+
+	if _, err := Parse(url.Values{"sort": {"email"}, "cursor": {cursor}}, testOptions); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Parse() with the cursor of another sort error = %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestLink(t *testing.T) {
+	u, _ := url.Parse("http://localhost/api/admin/users?filter%5Bemail%5D=a&cursor=old")
+	want := `</api/admin/users?cursor=new&filter%5Bemail%5D=a>; rel="next"`
+	if got := Link(u, "new"); got != want {
+		t.Errorf("Link() = %q, want %q", got, want)
+	}
+}
+
+func TestSparse(t *testing.T) {
+	type row struct {
+		ID    int    `json:"id"`
+		Email string `json:"email"`
+		Name  string `json:"name"`
+	}
+	rows := []row{{ID: 1, Email: "jane@example.com", Name: "Jane"}}
+	got, err := Sparse(rows, []string{"email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(got)
+	if want := `[{"email":"jane@example.com","id":1}]`; string(b) != want {
+		t.Errorf("Sparse() = %s, want %s", b, want)
+	}
+	if got, _ := Sparse(rows, nil); !reflect.DeepEqual(got, rows) {
+		t.Errorf("Sparse() without fields = %v, want the rows", got)
+	}
+}
@@ -1,13 +1,22 @@
 package logger
 
 import (
+	"context"
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
 	"github.com/rakin92/go-rest-service/pkg/consts"
 )
 
+// RequestIDHeader carries the id of the request, the one the caller sent is
+// kept when it looks like an id
+const RequestIDHeader = "X-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
 // logFields is used to structure of our request log data
 type logFields struct {
 	SerName    string
@@ -18,6 +27,7 @@ type logFields struct {
 	ClientIP   string
 	MsgStr     string
 	User       string
+	RequestID  string
 }
 
 func prepareLogFields(c *gin.Context, path, rawQ, server string, t time.Duration) *logFields {
@@ -35,10 +45,17 @@ func prepareLogFields(c *gin.Context, path, rawQ, server string, t time.Duration
 		MsgStr:     c.Errors.String(),
 	}
 
+	if id, exist := c.Get(string(consts.ProjectContextKeys.RequestIDCtxKey)); exist {
+		lf.RequestID = fmt.Sprintf("%v", id)
+	}
 	lf.User = "anonymous"
-	u, exist := c.Get(string(consts.ProjectContextKeys.UserIDCtxKey))
-	if exist {
+	if u, exist := c.Get(string(consts.ProjectContextKeys.UserIDCtxKey)); exist {
 		lf.User = fmt.Sprintf("%v", u)
+		if a, exist := c.Get(string(consts.ProjectContextKeys.ImpersonatorIDCtxKey)); exist {
+			lf.User = fmt.Sprintf("%v (impersonated by %v)", u, a)
+		}
+	} else if id, exist := c.Get(string(consts.ProjectContextKeys.ClientIDCtxKey)); exist {
+		lf.User = fmt.Sprintf("client:%v", id)
 	}
 	return lf
 }
@@ -51,6 +68,7 @@ func Middleware(serverName string) gin.HandlerFunc {
 		// before request
 		path := c.Request.URL.Path
 		rawQ := c.Request.URL.RawQuery
+		setRequestID(c)
 		c.Next()
 
 		d := time.Since(t)
@@ -59,22 +77,35 @@ func Middleware(serverName string) gin.HandlerFunc {
 	}
 }
 
+// setRequestID tags the request with the id of its header, or a new one, and
+// answers with it
+func setRequestID(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if !requestIDPattern.MatchString(id) {
+		id = uuid.Must(uuid.NewV4()).String()
+	}
+	key := consts.ProjectContextKeys.RequestIDCtxKey
+	c.Set(string(key), id)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), key, id))
+	c.Header(RequestIDHeader, id)
+}
+
 // logSwitch logs different levels of logs based on status code
 func logSwitch(lf *logFields) error {
 	// TODO: look into using log with fields
 	switch {
 	case lf.StatusCode >= 400 && lf.StatusCode < 500:
 		{
-			logger.Warn().Str("user", lf.User).Str("service_name", lf.SerName).Str("method", lf.Method).Str("path", lf.Path).Dur("latency", lf.Latency).Int("status", lf.StatusCode).Str("client_ip", lf.ClientIP).Msg(lf.MsgStr)
+			logger.Warn().Str("user", lf.User).Str("service_name", lf.SerName).Str("method", lf.Method).Str("path", lf.Path).Dur("latency", lf.Latency).Int("status", lf.StatusCode).Str("client_ip", lf.ClientIP).Str("request_id", lf.RequestID).Msg(lf.MsgStr)
 			return fmt.Errorf("received status code of 400s: %d", lf.StatusCode)
 		}
 	case lf.StatusCode >= 500:
 		{
-			logger.Error().Str("user", lf.User).Str("service_name", lf.SerName).Str("method", lf.Method).Str("path", lf.Path).Dur("latency", lf.Latency).Int("status", lf.StatusCode).Str("client_ip", lf.ClientIP).Msg(lf.MsgStr)
+			logger.Error().Str("user", lf.User).Str("service_name", lf.SerName).Str("method", lf.Method).Str("path", lf.Path).Dur("latency", lf.Latency).Int("status", lf.StatusCode).Str("client_ip", lf.ClientIP).Str("request_id", lf.RequestID).Msg(lf.MsgStr)
 			return fmt.Errorf("received status code of 500s: %d", lf.StatusCode)
 		}
 	default:
-		logger.Info().Str("user", lf.User).Str("service_name", lf.SerName).Str("method", lf.Method).Str("path", lf.Path).Dur("latency", lf.Latency).Int("status", lf.StatusCode).Str("client_ip", lf.ClientIP).Msg(lf.MsgStr)
+		logger.Info().Str("user", lf.User).Str("service_name", lf.SerName).Str("method", lf.Method).Str("path", lf.Path).Dur("latency", lf.Latency).Int("status", lf.StatusCode).Str("client_ip", lf.ClientIP).Str("request_id", lf.RequestID).Msg(lf.MsgStr)
 	}
 	return nil
 }
@@ -31,6 +31,7 @@ func Test_prepareLogFields(t *testing.T) {
 		server string
 		t      time.Duration
 		user   string
+		admin  string
 	}
 	tests := []struct {
 		name string
@@ -100,12 +101,37 @@ func Test_prepareLogFields(t *testing.T) {
 				User:       "user_id",
 			},
 		},
+		{
+			name: "passing with impersonated user_id",
+			args: args{
+				c:      ctx,
+				path:   "/user",
+				rawQ:   "",
+				server: "test",
+				t:      d,
+				user:   "user_id",
+				admin:  "admin_id",
+			},
+			want: &logFields{
+				SerName:    "test",
+				Path:       "/user",
+				Latency:    d,
+				Method:     "POST",
+				StatusCode: 200,
+				ClientIP:   "",
+				MsgStr:     "",
+				User:       "user_id (impersonated by admin_id)",
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.args.user != "" {
 				tt.args.c.Set(string(consts.ProjectContextKeys.UserIDCtxKey), tt.args.user)
 			}
+			if tt.args.admin != "" {
+				tt.args.c.Set(string(consts.ProjectContextKeys.ImpersonatorIDCtxKey), tt.args.admin)
+			}
 			if got := prepareLogFields(tt.args.c, tt.args.path, tt.args.rawQ, tt.args.server, tt.args.t); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("prepareLogFields() = %+v, want %+v", got, tt.want)
 			}
@@ -167,3 +193,31 @@ func Test_logSwitch(t *testing.T) {
 		})
 	}
 }
+
+func Test_setRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "kept", header: "req-42.a:b", keep: true},
+		{name: "missing", header: ""},
+		{name: "invalid", header: "no spaces allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request.Header.Set(RequestIDHeader, tt.header)
+			setRequestID(c)
+			id, _ := c.Request.Context().Value(consts.ProjectContextKeys.RequestIDCtxKey).(string)
+			if id == "" || w.Header().Get(RequestIDHeader) != id || c.GetString(string(consts.ProjectContextKeys.RequestIDCtxKey)) != id {
+				t.Fatalf("setRequestID() = %q, header %q", id, w.Header().Get(RequestIDHeader))
+			}
+			if (id == tt.header) != tt.keep {
+				t.Errorf("setRequestID() = %q, keep %q %v", id, tt.header, tt.keep)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrNotBoolean when a condition doesn't evaluate to true or false
+	ErrNotBoolean = errors.New("condition isn't a boolean")
+
+	// ErrMissingAttribute when a condition refers to an attribute the request
+	// doesn't have, the rule doesn't hold then
+	ErrMissingAttribute = errors.New("missing attribute")
+)
+
+// Expr is a parsed condition of a rule
+type Expr interface {
+	// Eval evaluates the expression against the attributes of the request
+	Eval(attrs map[string]any) (any, error)
+	String() string
+}
+
+type literal struct{ value any }
+
+type attribute struct{ path []string }
+
+type not struct{ x Expr }
+
+type binary struct {
+	op   string
+	l, r Expr
+}
+
+func (e literal) Eval(map[string]any) (any, error) { return e.value, nil }
+
+func (e literal) String() string {
+	if s, ok := e.value.(string); ok {
+		return strconv.Quote(s)
+	}
+	if e.value == nil {
+		return "null"
+	}
+	if items, ok := e.value.([]any); ok {
+		ss := make([]string, len(items))
+		for i, v := range items {
+			ss[i] = literal{value: v}.String()
+		}
+		return "[" + strings.Join(ss, ", ") + "]"
+	}
+	return fmt.Sprint(e.value)
+}
+
+// Eval walks the dotted path through the attributes
+func (e attribute) Eval(attrs map[string]any) (any, error) {
+	var v any = attrs
+	for _, k := range e.path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingAttribute, e)
+		}
+		if v, ok = m[k]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingAttribute, e)
+		}
+	}
+	return v, nil
+}
+
+func (e attribute) String() string { return strings.Join(e.path, ".") }
+
+func (e not) Eval(attrs map[string]any) (any, error) {
+	b, err := evalBool(e.x, attrs)
+	if err != nil {
+		return nil, err
+	}
+	return !b, nil
+}
+
+func (e not) String() string { return "!" + e.x.String() }
+
+func (e binary) Eval(attrs map[string]any) (any, error) {
+	switch e.op {
+	case "&&", "||":
+		l, err := evalBool(e.l, attrs)
+		if err != nil {
+			return nil, err
+		}
+		if (e.op == "&&") != l {
+			return l, nil
+		}
+		return evalBool(e.r, attrs)
+	}
+	l, err := e.l.Eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	r, err := e.r.Eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "in":
+		return contains(r, l), nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", e.op)
+}
+
+func (e binary) String() string {
+	return "(" + e.l.String() + " " + e.op + " " + e.r.String() + ")"
+}
+
+// evalBool evaluates the expression that must be a boolean
+func evalBool(e Expr, attrs map[string]any) (bool, error) {
+	v, err := e.Eval(attrs)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %s", ErrNotBoolean, e)
+	}
+	return b, nil
+}
+
+// normalize converts the values the attributes are built from to the ones of
+// the language: strings, float64 numbers, booleans, null and lists
+func normalize(v any) any {
+	switch t := v.(type) {
+	case nil, string, bool, float64:
+		return t
+	case fmt.Stringer:
+		return t.String()
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	}
+	return v
+}
+
+// equal compares two scalar values, lists are never equal
+func equal(l, r any) bool {
+	l, r = normalize(l), normalize(r)
+	switch l.(type) {
+	case nil, string, bool, float64:
+		return l == r
+	}
+	return false
+}
+
+// contains verifies if the list holds the value, anything but a list holds nothing
+func contains(list, v any) bool {
+	rv := reflect.ValueOf(normalize(list))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if equal(rv.Index(i).Interface(), v) {
+			return true
+		}
+	}
+	return false
+}
+
+// ## Parser
+
+type token struct {
+	kind string // ident, string, number, op or eof
+	text string
+	pos  int
+}
+
+// lex splits the condition in tokens
+func lex(src string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(src); {
+		ch := rune(src[i])
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == '"' || ch == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != src[i] {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			s := src[i+1 : j]
+			if ch == '"' {
+				var err error
+				if s, err = strconv.Unquote(src[i : j+1]); err != nil {
+					return nil, fmt.Errorf("invalid string at %d", i)
+				}
+			}
+			tokens = append(tokens, token{kind: "string", text: s, pos: i})
+			i = j + 1
+		case unicode.IsDigit(ch) || (ch == '-' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1]))):
+			j := i + 1
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{kind: "number", text: src[i:j], pos: i})
+			i = j
+		case unicode.IsLetter(ch) || ch == '_':
+			j := i + 1
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) ||
+				src[j] == '_' || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{kind: "ident", text: src[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, o := range []string{"==", "!=", "&&", "||", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", ch, i)
+			}
+			tokens = append(tokens, token{kind: "op", text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: "eof", pos: len(src)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// ParseExpr parses a condition:
+//
+//	expr    = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | compare
+//	compare = operand [ ( "==" | "!=" | "in" ) operand ]
+//	operand = "(" expr ")" | "[" [ operand { "," operand } ] "]" |
+//	          string | number | true | false | null | attribute
+//
+// Attributes are dotted paths, like subject.id or resource.owner_id
+func ParseExpr(src string) (Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != "eof" {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return e, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != "eof" {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the token when it's the operator or keyword
+func (p *parser) accept(text string) bool {
+	if t := p.peek(); (t.kind == "op" || t.kind == "ident") && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (Expr, error) {
+	l, err := p.and()
+	for err == nil && p.accept("||") {
+		var r Expr
+		if r, err = p.and(); err == nil {
+			l = binary{op: "||", l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) and() (Expr, error) {
+	l, err := p.unary()
+	for err == nil && p.accept("&&") {
+		var r Expr
+		if r, err = p.unary(); err == nil {
+			l = binary{op: "&&", l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) unary() (Expr, error) {
+	if p.accept("!") {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not{x: x}, nil
+	}
+	return p.compare()
+}
+
+func (p *parser) compare() (Expr, error) {
+	l, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "in"} {
+		if p.accept(op) {
+			r, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			return binary{op: op, l: l, r: r}, nil
+		}
+	}
+	return l, nil
+}
+
+func (p *parser) operand() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case "string":
+		return literal{value: t.text}, nil
+	case "number":
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		return literal{value: n}, nil
+	case "ident":
+		switch t.text {
+		case "true", "false":
+			return literal{value: t.text == "true"}, nil
+		case "null":
+			return literal{value: nil}, nil
+		case "in":
+			return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+		}
+		path := strings.Split(t.text, ".")
+		for _, k := range path {
+			if k == "" {
+				return nil, fmt.Errorf("invalid attribute %q at %d", t.text, t.pos)
+			}
+		}
+		return attribute{path: path}, nil
+	case "op":
+		switch t.text {
+		case "(":
+			e, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept(")") {
+				return nil, fmt.Errorf("missing ) at %d", p.peek().pos)
+			}
+			return e, nil
+		case "[":
+			return p.list()
+		}
+	case "eof":
+		return nil, errors.New("unexpected end of the condition")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// list parses the items of a literal list, after its [
+func (p *parser) list() (Expr, error) {
+	items := []any{}
+	if p.accept("]") {
+		return literal{value: items}, nil
+	}
+	for {
+		e, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		l, ok := e.(literal)
+		if !ok {
+			return nil, fmt.Errorf("list items must be literals: %s", e)
+		}
+		items = append(items, l.value)
+		if p.accept("]") {
+			return literal{value: items}, nil
+		}
+		if !p.accept(",") {
+			return nil, fmt.Errorf("missing ] at %d", p.peek().pos)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestParseExpr(t *testing.T) {
+	id := uuid.Must(uuid.NewV4())
+	attrs := map[string]any{
+		"subject": map[string]any{
+			"id":    id.String(),
+			"roles": []string{"user", "editor"},
+			"level": 3,
+		},
+		"resource": map[string]any{"owner_id": id, "public": true},
+		"tenant":   nil,
+	}
+	tests := []struct {
+		name     string
+		src      string
+		want     bool
+		wantErr  error
+		parseErr bool
+	}{
+		{name: "equal attributes", src: "subject.id == resource.owner_id", want: true},
+		{name: "not equal", src: `subject.id != "someone"`, want: true},
+		{name: "in list attribute", src: `"editor" in subject.roles`, want: true},
+		{name: "not in list attribute", src: `"admin" in subject.roles`, want: false},
+		{name: "in list literal", src: `subject.level in [1, 2, 3]`, want: true},
+		{name: "numbers", src: "subject.level == 3", want: true},
+		{name: "and or precedence", src: "false && false || true", want: true},
+		{name: "parentheses", src: "false && (false || true)", want: false},
+		{name: "negation", src: `!("admin" in subject.roles) && resource.public`, want: true},
+		{name: "null", src: "tenant == null", want: true},
+		{name: "single quotes", src: `'user' in subject.roles`, want: true},
+		{name: "missing attribute", src: "resource.organization_id == tenant", wantErr: ErrMissingAttribute},
+		{name: "not a boolean", src: "subject.id", wantErr: ErrNotBoolean},
+		{name: "short circuit", src: "false && resource.missing", want: false},
+		{name: "unterminated string", src: `subject.id == "abc`, parseErr: true},
+		{name: "missing operand", src: "subject.id ==", parseErr: true},
+		{name: "missing parenthesis", src: "(true", parseErr: true},
+		{name: "trailing tokens", src: "true true", parseErr: true},
+		{name: "unknown operator", src: "subject.level > 1", parseErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := ParseExpr(tt.src)
+			if (err != nil) != tt.parseErr {
+				t.Fatalf("ParseExpr() error = %v, parseErr %v", err, tt.parseErr)
+			}
+			if err != nil {
+				return
+			}
+			got, err := evalBool(e, attrs)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// Package policy is the resource-level authorization of the service. Rules
+// written in a small expression language are evaluated against the subject
+// doing the action, the attributes of the resource and the active tenant
+package policy
+
+import (
+	_ "embed" // default rules
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// EffectAllow lets the request through when its condition holds
+	EffectAllow = "allow"
+	// EffectDeny refuses the request when its condition holds, it wins over allow
+	EffectDeny = "deny"
+	// Wildcard matches any action or resource
+	Wildcard = "*"
+)
+
+var (
+	// ErrDenied when the policies don't allow the request
+	ErrDenied = errors.New("denied by policy")
+
+	//go:embed default.policy
+	defaultRules string
+
+	ruleRegex = regexp.MustCompile(`(?s)^(\S+)\s+(\S+)\s+(\S+)(?:\s+if\s+(.+))?$`)
+)
+
+// Rule allows or denies actions on resources, when its condition holds
+type Rule struct {
+	Effect    string   `json:"effect"`
+	Actions   []string `json:"actions"`
+	Resources []string `json:"resources"`
+	Condition Expr     `json:"-"`
+	Source    string   `json:"source"`
+	Line      int      `json:"line"`
+}
+
+// Resource is what the action is done on, its type is the table name of the
+// entity, like in the permission tags
+type Resource struct {
+	Type       string         `json:"type"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// Input is the request the policies decide on
+type Input struct {
+	Subject  map[string]any `json:"subject"`
+	Action   string         `json:"action"`
+	Resource Resource       `json:"resource"`
+	Tenant   string         `json:"tenant,omitempty"`
+}
+
+// Result is the outcome of a rule for the explanation of a decision
+type Result struct {
+	Rule    *Rule  `json:"rule"`
+	Matched bool   `json:"matched"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Decision of the policies on a request, the rules applying to it are only
+// listed when explained
+type Decision struct {
+	Allowed bool     `json:"allowed"`
+	Reason  string   `json:"reason"`
+	Rules   []Result `json:"rules,omitempty"`
+}
+
+// Engine evaluates the requests against the rules
+type Engine struct {
+	rules []*Rule
+}
+
+// Parse reads the rules, one per line:
+//
+//	allow|deny <actions> <resources> [if <condition>]
+//
+// Actions and resources are comma separated or *. Lines starting with # are
+// comments and the ones starting with spaces continue the previous rule
+func Parse(src string) (*Engine, error) {
+	e := &Engine{}
+	lines := strings.Split(src, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		start := i + 1
+		for i+1 < len(lines) && strings.TrimLeft(lines[i+1], " \t") != lines[i+1] &&
+			!strings.HasPrefix(strings.TrimSpace(lines[i+1]), "#") && strings.TrimSpace(lines[i+1]) != "" {
+			i++
+			line += " " + strings.TrimSpace(lines[i])
+		}
+		r, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("policy line %d: %w", start, err)
+		}
+		r.Line = start
+		e.rules = append(e.rules, r)
+	}
+	return e, nil
+}
+
+// parseRule parses a rule written on a single line
+func parseRule(line string) (*Rule, error) {
+	m := ruleRegex.FindStringSubmatch(line)
+	if m == nil {
+		return nil, errors.New("expected: allow|deny <actions> <resources> [if <condition>]")
+	}
+	if m[1] != EffectAllow && m[1] != EffectDeny {
+		return nil, fmt.Errorf("unknown effect %q", m[1])
+	}
+	r := &Rule{
+		Effect:    m[1],
+		Actions:   strings.Split(m[2], ","),
+		Resources: strings.Split(m[3], ","),
+		Source:    line,
+	}
+	if m[4] != "" {
+		cond, err := ParseExpr(m[4])
+		if err != nil {
+			return nil, err
+		}
+		r.Condition = cond
+	}
+	return r, nil
+}
+
+// Load reads the rules from the file
+func Load(path string) (*Engine, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(string(b))
+}
+
+// Default returns the engine with the rules shipped with the service
+func Default() *Engine {
+	e, err := Parse(defaultRules)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// Rules returns the rules of the engine in the order they were written
+func (e *Engine) Rules() []*Rule {
+	return e.rules
+}
+
+// Applies verifies if the rule is about the action on the resource type
+func (r *Rule) Applies(action, resource string) bool {
+	return matchAny(r.Actions, action) && matchAny(r.Resources, resource)
+}
+
+func matchAny(names []string, name string) bool {
+	for _, n := range names {
+		if n == Wildcard || n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed verifies if the policies allow the request
+func (e *Engine) Allowed(in *Input) bool {
+	return e.evaluate(in, false).Allowed
+}
+
+// Evaluate decides on the request, a deny rule holding wins over the allow
+// ones and nothing is allowed unless a rule says so. The conditions failing
+// to evaluate hold for the deny rules and not for the allow ones
+func (e *Engine) Evaluate(in *Input) *Decision {
+	return e.evaluate(in, false)
+}
+
+// Explain decides on the request like Evaluate, listing the outcome of every
+// rule applying to it
+func (e *Engine) Explain(in *Input) *Decision {
+	return e.evaluate(in, true)
+}
+
+func (e *Engine) evaluate(in *Input, explain bool) *Decision {
+	d := &Decision{}
+	attrs := in.attributes()
+	var allow, deny *Rule
+	for _, r := range e.rules {
+		if !r.Applies(in.Action, in.Resource.Type) {
+			continue
+		}
+		res := Result{Rule: r, Matched: true}
+		if r.Condition != nil {
+			ok, err := evalBool(r.Condition, attrs)
+			res.Matched = ok && err == nil
+			if err != nil {
+				// a deny rule that can't be evaluated denies
+				res.Matched = r.Effect == EffectDeny
+				res.Error = err.Error()
+			}
+		}
+		if explain {
+			d.Rules = append(d.Rules, res)
+		}
+		if !res.Matched {
+			continue
+		}
+		if r.Effect == EffectDeny && deny == nil {
+			deny = r
+			if !explain {
+				break
+			}
+		}
+		if r.Effect == EffectAllow && allow == nil {
+			allow = r
+		}
+	}
+	switch {
+	case deny != nil:
+		d.Reason = fmt.Sprintf("denied by the rule on line %d", deny.Line)
+	case allow != nil:
+		d.Allowed = true
+		d.Reason = fmt.Sprintf("allowed by the rule on line %d", allow.Line)
+	default:
+		d.Reason = "no rule allows the request"
+	}
+	return d
+}
+
+// attributes are the values the conditions are evaluated against
+func (in *Input) attributes() map[string]any {
+	resource := map[string]any{}
+	for k, v := range in.Resource.Attributes {
+		resource[k] = v
+	}
+	resource["type"] = in.Resource.Type
+	var tenant any
+	if in.Tenant != "" {
+		tenant = in.Tenant
+	}
+	subject := in.Subject
+	if subject == nil {
+		subject = map[string]any{}
+	}
+	return map[string]any{
+		"subject":    subject,
+		"action":     in.Action,
+		"resource":   resource,
+		"permission": in.Action + ":" + in.Resource.Type,
+		"tenant":     tenant,
+	}
+}
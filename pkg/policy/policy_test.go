@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    int
+		wantErr bool
+	}{
+		{name: "default rules", src: defaultRules, want: 5},
+		{name: "comments and blank lines", src: "# rules\n\nallow read users\n", want: 1},
+		{name: "continued line", src: "allow read users if true &&\n    true\nallow list users", want: 2},
+		{name: "unknown effect", src: "permit read users", wantErr: true},
+		{name: "missing resource", src: "allow read", wantErr: true},
+		{name: "invalid condition", src: "allow read users if subject.id ==", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Parse(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(e.Rules()) != tt.want {
+				t.Errorf("Parse() rules = %d, want %d", len(e.Rules()), tt.want)
+			}
+		})
+	}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	e := Default()
+	user := map[string]any{
+		"id": "u1", "roles": []string{"user"},
+		"org_permissions": []string{"update:documents"},
+	}
+	admin := map[string]any{"id": "a1", "roles": []string{"admin"}, "client_id": nil}
+	delegated := func(scopes ...string) map[string]any {
+		return map[string]any{"id": "a1", "roles": []string{"admin"}, "client_id": "reports", "scopes": scopes}
+	}
+	tests := []struct {
+		name string
+		in   *Input
+		want bool
+	}{
+		{
+			name: "user updates themselves",
+			in:   &Input{Subject: user, Action: "update", Resource: Resource{Type: "users", Attributes: map[string]any{"id": "u1"}}},
+			want: true,
+		},
+		{
+			name: "user updates someone else",
+			in:   &Input{Subject: user, Action: "update", Resource: Resource{Type: "users", Attributes: map[string]any{"id": "u2"}}},
+			want: false,
+		},
+		{
+			name: "admin updates someone else",
+			in:   &Input{Subject: admin, Action: "update", Resource: Resource{Type: "users", Attributes: map[string]any{"id": "u2"}}},
+			want: true,
+		},
+		{
+			name: "client of an admin with the scope",
+			in: &Input{Subject: delegated("update:users"), Action: "update",
+				Resource: Resource{Type: "users", Attributes: map[string]any{"id": "u2"}}},
+			want: true,
+		},
+		{
+			name: "client of an admin without the scope",
+			in: &Input{Subject: delegated("read:users"), Action: "update",
+				Resource: Resource{Type: "users", Attributes: map[string]any{"id": "u2"}}},
+			want: false,
+		},
+		{
+			name: "deny wins over allow",
+			in:   &Input{Subject: admin, Action: "delete", Resource: Resource{Type: "users", Attributes: map[string]any{"id": "a1"}}},
+			want: false,
+		},
+		{
+			name: "member updates a resource of the tenant",
+			in: &Input{Subject: user, Action: "update", Tenant: "o1",
+				Resource: Resource{Type: "documents", Attributes: map[string]any{"organization_id": "o1"}}},
+			want: true,
+		},
+		{
+			name: "member updates a resource of another tenant",
+			in: &Input{Subject: user, Action: "update", Tenant: "o1",
+				Resource: Resource{Type: "documents", Attributes: map[string]any{"organization_id": "o2"}}},
+			want: false,
+		},
+		{
+			name: "member without the permission in the tenant",
+			in: &Input{Subject: user, Action: "delete", Tenant: "o1",
+				Resource: Resource{Type: "documents", Attributes: map[string]any{"organization_id": "o1"}}},
+			want: false,
+		},
+		{
+			name: "no tenant",
+			in: &Input{Subject: user, Action: "update",
+				Resource: Resource{Type: "documents", Attributes: map[string]any{"organization_id": "o1"}}},
+			want: false,
+		},
+		{
+			name: "nothing applies",
+			in:   &Input{Subject: user, Action: "read", Resource: Resource{Type: "documents"}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := e.Evaluate(tt.in)
+			if d.Allowed != tt.want {
+				t.Errorf("Evaluate() = %v (%s), want %v", d.Allowed, d.Reason, tt.want)
+			}
+			if len(d.Rules) != 0 {
+				t.Errorf("Evaluate() listed %d rules, want none", len(d.Rules))
+			}
+			if e.Explain(tt.in).Allowed != tt.want {
+				t.Errorf("Explain() decided differently than Evaluate()")
+			}
+		})
+	}
+}
+
+func TestEngine_Explain(t *testing.T) {
+	e, err := Parse(`allow read documents if resource.public
+deny read documents if resource.archived
+allow update documents`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	d := e.Explain(&Input{Action: "read", Resource: Resource{Type: "documents",
+		Attributes: map[string]any{"public": true, "archived": false}}})
+	if !d.Allowed {
+		t.Errorf("Explain() = %v, want allowed", d.Reason)
+	}
+	if len(d.Rules) != 2 {
+		t.Fatalf("Explain() listed %d rules, want 2", len(d.Rules))
+	}
+	if !d.Rules[0].Matched || d.Rules[1].Matched {
+		t.Errorf("Explain() rules = %+v, want only the first to match", d.Rules)
+	}
+
+	// the deny rule can't tell without the attribute, so it denies
+	d = e.Explain(&Input{Action: "read", Resource: Resource{Type: "documents",
+		Attributes: map[string]any{"public": true}}})
+	if d.Allowed {
+		t.Errorf("Explain() = %v, want denied", d.Reason)
+	}
+	if len(d.Rules) != 2 || !d.Rules[1].Matched || d.Rules[1].Error == "" {
+		t.Errorf("Explain() rules = %+v, want the second to fail and hold", d.Rules)
+	}
+	if e.Allowed(&Input{Action: "read", Resource: Resource{Type: "documents"}}) {
+		t.Errorf("Allowed() with the allow rule failing to evaluate = true, want false")
+	}
+}
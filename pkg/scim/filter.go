@@ -0,0 +1,381 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidFilter when the filter can't be parsed or asks for something we
+// can't filter on
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Filter is a parsed filter, RFC 7644 section 3.4.2.2
+type Filter interface {
+	filter()
+}
+
+// Logical joins two filters with "and" or "or"
+type Logical struct {
+	Op          string
+	Left, Right Filter
+}
+
+// Not negates a filter
+type Not struct {
+	Filter Filter
+}
+
+// Comparison compares an attribute, lower cased and without its schema, with
+// the value. The value is nil for the "pr" operator
+type Comparison struct {
+	Attr  string
+	Op    string
+	Value any
+}
+
+func (*Logical) filter()    {}
+func (*Not) filter()        {}
+func (*Comparison) filter() {}
+
+// comparison operators taking a value, "pr" doesn't
+var compareOps = map[string]string{
+	"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<=",
+	"co": "LIKE", "sw": "LIKE", "ew": "LIKE",
+}
+
+// filterError wraps ErrInvalidFilter with what is wrong
+func filterError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidFilter, fmt.Sprintf(format, args...))
+}
+
+// ParseFilter parses a filter, the empty filter is nil
+func ParseFilter(src string) (Filter, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	tokens, err := lexFilter(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != nil {
+		return nil, filterError("unexpected %s", t.text)
+	}
+	return f, nil
+}
+
+// filterToken is a word, a quoted string or a bracket of a filter
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+func lexFilter(src string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(src); {
+		switch ch := src[i]; {
+		case ch == ' ' || ch == '\t':
+			i++
+		case strings.IndexByte("()[]", ch) >= 0:
+			tokens = append(tokens, filterToken{text: string(ch)})
+			i++
+		case ch == '"':
+			j := i + 1
+			for ; j < len(src) && src[j] != '"'; j++ {
+				if src[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(src) {
+				return nil, filterError("unterminated string")
+			}
+			var s string
+			if err := json.Unmarshal([]byte(src[i:j+1]), &s); err != nil {
+				return nil, filterError("invalid string %s", src[i:j+1])
+			}
+			tokens = append(tokens, filterToken{text: s, quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(src) && strings.IndexByte(" \t()[]\"", src[j]) < 0; j++ {
+			}
+			tokens = append(tokens, filterToken{text: src[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() *filterToken {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *filterParser) next() *filterToken {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+	}
+	return t
+}
+
+// keyword tells if the next token is the unquoted word, case insensitive
+func (p *filterParser) keyword(word string) bool {
+	t := p.peek()
+	return t != nil && !t.quoted && strings.EqualFold(t.text, word)
+}
+
+func (p *filterParser) expect(text string) error {
+	if t := p.next(); t == nil || t.quoted || t.text != text {
+		return filterError("expected %s", text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (Filter, error) {
+	if !p.keyword("not") {
+		return p.parseAtom()
+	}
+	p.next()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return &Not{Filter: f}, nil
+}
+
+func (p *filterParser) parseAtom() (Filter, error) {
+	t := p.next()
+	if t == nil {
+		return nil, filterError("unexpected end")
+	}
+	if !t.quoted && t.text == "(" {
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	}
+	if t.quoted || strings.IndexByte("()[]", t.text[0]) >= 0 {
+		return nil, filterError("expected an attribute, got %s", t.text)
+	}
+	attr := normalizeAttr(t.text)
+	if p.peek() != nil && !p.peek().quoted && p.peek().text == "[" {
+		// value path, emails[type eq "work"] filters on emails.type
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		prefixAttrs(f, attr)
+		return f, nil
+	}
+	op := p.next()
+	if op == nil || op.quoted {
+		return nil, filterError("expected an operator after %s", t.text)
+	}
+	cmp := &Comparison{Attr: attr, Op: strings.ToLower(op.text)}
+	if cmp.Op == "pr" {
+		return cmp, nil
+	}
+	if _, ok := compareOps[cmp.Op]; !ok {
+		return nil, filterError("unknown operator %s", op.text)
+	}
+	v := p.next()
+	if v == nil {
+		return nil, filterError("expected a value after %s", op.text)
+	}
+	value, err := filterValue(v)
+	if err != nil {
+		return nil, err
+	}
+	cmp.Value = value
+	return cmp, nil
+}
+
+// filterValue reads a string, boolean, null or number
+func filterValue(t *filterToken) (any, error) {
+	if t.quoted {
+		return t.text, nil
+	}
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, filterError("invalid value %s", t.text)
+	}
+	return n, nil
+}
+
+// normalizeAttr lower cases the attribute and drops its schema, the
+// attributes of a schema URN follow its last colon
+func normalizeAttr(attr string) string {
+	attr = strings.ToLower(attr)
+	if strings.HasPrefix(attr, "urn:") {
+		attr = attr[strings.LastIndex(attr, ":")+1:]
+	}
+	return attr
+}
+
+// prefixAttrs makes the attributes of a value path filter sub attributes
+func prefixAttrs(f Filter, prefix string) {
+	switch f := f.(type) {
+	case *Logical:
+		prefixAttrs(f.Left, prefix)
+		prefixAttrs(f.Right, prefix)
+	case *Not:
+		prefixAttrs(f.Filter, prefix)
+	case *Comparison:
+		f.Attr = prefix + "." + f.Attr
+	}
+}
+
+// Column is where a filtered attribute is stored. Strings are compared case
+// insensitive unless CaseExact
+type Column struct {
+	Name      string
+	CaseExact bool
+}
+
+// Mapper turns a comparison into its SQL condition and args
+type Mapper func(cmp *Comparison) (string, []any, error)
+
+// Columns maps the attributes to their columns, filtering on any other
+// attribute is invalid
+func Columns(columns map[string]Column) Mapper {
+	return func(cmp *Comparison) (string, []any, error) {
+		col, ok := columns[cmp.Attr]
+		if !ok {
+			return "", nil, filterError("can't filter on %s", cmp.Attr)
+		}
+		return col.Compare(cmp)
+	}
+}
+
+// Compare turns the comparison on the column into its SQL condition and args
+func (col Column) Compare(cmp *Comparison) (string, []any, error) {
+	if cmp.Op == "pr" {
+		return col.Name + " IS NOT NULL", nil, nil
+	}
+	if cmp.Value == nil {
+		switch cmp.Op {
+		case "eq":
+			return col.Name + " IS NULL", nil, nil
+		case "ne":
+			return col.Name + " IS NOT NULL", nil, nil
+		}
+		return "", nil, filterError("%s can't compare with null", cmp.Op)
+	}
+	lhs, value := col.Name, cmp.Value
+	if s, ok := value.(string); ok && !col.CaseExact {
+		lhs, value = "LOWER("+col.Name+")", strings.ToLower(s)
+	}
+	switch cmp.Op {
+	case "co", "sw", "ew":
+		s, ok := value.(string)
+		if !ok {
+			return "", nil, filterError("%s needs a string", cmp.Op)
+		}
+		s = likeEscaper.Replace(s)
+		switch cmp.Op {
+		case "co":
+			s = "%" + s + "%"
+		case "sw":
+			s = s + "%"
+		case "ew":
+			s = "%" + s
+		}
+		return lhs + " LIKE ? ESCAPE '!'", []any{s}, nil
+	}
+	return lhs + " " + compareOps[cmp.Op] + " ?", []any{value}, nil
+}
+
+// likeEscaper escapes the LIKE wildcards with the escape character every
+// dialect accepts the same way
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// SQL turns the filter into a SQL condition and its args
+func SQL(f Filter, m Mapper) (string, []any, error) {
+	switch f := f.(type) {
+	case *Logical:
+		left, largs, err := SQL(f.Left, m)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rargs, err := SQL(f.Right, m)
+		if err != nil {
+			return "", nil, err
+		}
+		return "(" + left + " " + strings.ToUpper(f.Op) + " " + right + ")", append(largs, rargs...), nil
+	case *Not:
+		cond, args, err := SQL(f.Filter, m)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + cond + ")", args, nil
+	case *Comparison:
+		return m(f)
+	}
+	return "", nil, filterError("unknown filter")
+}
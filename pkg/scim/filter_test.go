@@ -0,0 +1,78 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	columns := Columns(map[string]Column{
+		"username":       {Name: "email"},
+		"name.givenname": {Name: "first_name"},
+		"emails.value":   {Name: "email"},
+		"emails.type":    {Name: "email_type"},
+		"id":             {Name: "id", CaseExact: true},
+		"meta.created":   {Name: "created_at", CaseExact: true},
+	})
+	tests := []struct {
+		name     string
+		src      string
+		wantSQL  string
+		wantArgs []any
+		wantErr  bool
+	}{
+		{name: "empty filter"},
+		{name: "equal", src: `userName eq "Bjensen@Example.com"`,
+			wantSQL: "LOWER(email) = ?", wantArgs: []any{"bjensen@example.com"}},
+		{name: "case insensitive operator and attribute", src: `USERNAME EQ "a"`,
+			wantSQL: "LOWER(email) = ?", wantArgs: []any{"a"}},
+		{name: "schema urn", src: `urn:ietf:params:scim:schemas:core:2.0:User:name.givenName sw "Ba"`,
+			wantSQL: "LOWER(first_name) LIKE ? ESCAPE '!'", wantArgs: []any{"ba%"}},
+		{name: "case exact", src: `id eq "ABC"`, wantSQL: "id = ?", wantArgs: []any{"ABC"}},
+		{name: "contains escapes wildcards", src: `userName co "50%_!"`,
+			wantSQL: "LOWER(email) LIKE ? ESCAPE '!'", wantArgs: []any{"%50!%!_!!%"}},
+		{name: "ends with", src: `userName ew "@example.com"`,
+			wantSQL: "LOWER(email) LIKE ? ESCAPE '!'", wantArgs: []any{"%@example.com"}},
+		{name: "present", src: "name.givenName pr", wantSQL: "first_name IS NOT NULL"},
+		{name: "null", src: "name.givenName eq null", wantSQL: "first_name IS NULL"},
+		{name: "greater than", src: `meta.created gt "2011-05-13T04:42:34Z"`,
+			wantSQL: "created_at > ?", wantArgs: []any{"2011-05-13T04:42:34Z"}},
+		{name: "and binds tighter than or", src: `userName eq "a" or userName eq "b" and id eq "c"`,
+			wantSQL: "(LOWER(email) = ? OR (LOWER(email) = ? AND id = ?))", wantArgs: []any{"a", "b", "c"}},
+		{name: "parentheses and not", src: `not (userName eq "a" or id eq "b")`,
+			wantSQL: "NOT ((LOWER(email) = ? OR id = ?))", wantArgs: []any{"a", "b"}},
+		{name: "value path", src: `emails[type eq "work" and value co "@example.com"]`,
+			wantSQL: "(LOWER(email_type) = ? AND LOWER(email) LIKE ? ESCAPE '!')", wantArgs: []any{"work", "%@example.com%"}},
+		{name: "escaped string", src: `userName eq "a\"b"`, wantSQL: "LOWER(email) = ?", wantArgs: []any{`a"b`}},
+		{name: "unknown attribute", src: `title eq "Tour Guide"`, wantErr: true},
+		{name: "unknown operator", src: `userName like "a"`, wantErr: true},
+		{name: "missing value", src: `userName eq`, wantErr: true},
+		{name: "unterminated string", src: `userName eq "a`, wantErr: true},
+		{name: "missing parenthesis", src: `(userName eq "a"`, wantErr: true},
+		{name: "trailing tokens", src: `userName eq "a" "b"`, wantErr: true},
+		{name: "contains without a string", src: `userName co 1`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFilter(tt.src)
+			var sql string
+			var args []any
+			if err == nil && f != nil {
+				sql, args, err = SQL(f, columns)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidFilter) {
+					t.Errorf("ParseFilter() error = %v, want ErrInvalidFilter", err)
+				}
+				return
+			}
+			if sql != tt.wantSQL || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("SQL() = %q %v, want %q %v", sql, args, tt.wantSQL, tt.wantArgs)
+			}
+		})
+	}
+}
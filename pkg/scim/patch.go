@@ -0,0 +1,398 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PATCH operations, compared case insensitive
+const (
+	PatchAdd     = "add"
+	PatchReplace = "replace"
+	PatchRemove  = "remove"
+)
+
+// patchPath is the attribute a PATCH operation targets, with the filter of a
+// value path and its sub attribute, like emails[type eq "work"].value
+type patchPath struct {
+	attr   string
+	filter Filter
+	sub    string
+}
+
+func parsePatchPath(path string) (*patchPath, error) {
+	p := &patchPath{}
+	i := strings.IndexByte(path, '[')
+	if i < 0 {
+		p.attr = normalizeAttr(path)
+		return p, nil
+	}
+	j := strings.LastIndexByte(path, ']')
+	if j < i {
+		return nil, NewError(http.StatusBadRequest, ErrInvalidPathType, "invalid path "+path)
+	}
+	f, err := ParseFilter(path[i+1 : j])
+	if err != nil || f == nil {
+		return nil, NewError(http.StatusBadRequest, ErrInvalidPathType, "invalid path "+path)
+	}
+	p.attr, p.filter = normalizeAttr(path[:i]), f
+	p.sub = strings.ToLower(strings.TrimPrefix(path[j+1:], "."))
+	return p, nil
+}
+
+// patchOp validates the operation and lower cases it
+func patchOp(op *PatchOperation) (string, error) {
+	o := strings.ToLower(op.Op)
+	switch o {
+	case PatchAdd, PatchReplace, PatchRemove:
+	default:
+		return "", NewError(http.StatusBadRequest, ErrInvalidSyntaxType, "unknown operation "+op.Op)
+	}
+	if o != PatchRemove && len(op.Value) == 0 {
+		return "", NewError(http.StatusBadRequest, ErrInvalidValueType, "the operation needs a value")
+	}
+	if o == PatchRemove && op.Path == "" {
+		return "", NewError(http.StatusBadRequest, "noTarget", "remove needs a path")
+	}
+	return o, nil
+}
+
+// pathlessOps splits an operation without path, whose value holds the
+// attributes to change, into one operation per attribute
+func pathlessOps(op *PatchOperation) ([]PatchOperation, error) {
+	attrs := map[string]json.RawMessage{}
+	if err := json.Unmarshal(op.Value, &attrs); err != nil {
+		return nil, invalidValue("the operation needs an object value")
+	}
+	ops := make([]PatchOperation, 0, len(attrs))
+	for k, v := range attrs {
+		ops = append(ops, PatchOperation{Op: op.Op, Path: k, Value: v})
+	}
+	return ops, nil
+}
+
+func invalidValue(detail string) *Error {
+	return NewError(http.StatusBadRequest, ErrInvalidValueType, detail)
+}
+
+func invalidPath(path string) *Error {
+	return NewError(http.StatusBadRequest, ErrInvalidPathType, "unsupported path "+path)
+}
+
+func decodeString(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", invalidValue("expected a string")
+	}
+	return s, nil
+}
+
+// decodeBool accepts the strings some identity providers send booleans as
+func decodeBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, invalidValue("expected a boolean")
+}
+
+// ApplyPatch applies the PATCH operations to the user, in order
+func (u *User) ApplyPatch(ops []PatchOperation) error {
+	for i := range ops {
+		op, err := patchOp(&ops[i])
+		if err != nil {
+			return err
+		}
+		if ops[i].Path == "" {
+			sub, err := pathlessOps(&ops[i])
+			if err != nil {
+				return err
+			}
+			if err := u.ApplyPatch(sub); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := u.applyOp(op, ops[i].Path, ops[i].Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *User) applyOp(op, path string, value json.RawMessage) error {
+	p, err := parsePatchPath(path)
+	if err != nil {
+		return err
+	}
+	if p.filter != nil {
+		if p.attr != "emails" {
+			return invalidPath(path)
+		}
+		return u.applyEmailOp(op, p, value)
+	}
+	if u.Name == nil {
+		u.Name = &Name{}
+	}
+	var s string
+	switch p.attr {
+	case "active":
+		if op == PatchRemove {
+			u.Active = nil
+			return nil
+		}
+		b, err := decodeBool(value)
+		u.Active = &b
+		return err
+	case "name":
+		if op == PatchRemove {
+			u.Name = &Name{}
+			return nil
+		}
+		if op == PatchReplace {
+			u.Name = &Name{}
+		}
+		if err := json.Unmarshal(value, u.Name); err != nil {
+			return invalidValue("expected a name")
+		}
+		return nil
+	case "emails":
+		var emails []Email
+		if op != PatchRemove {
+			if err := json.Unmarshal(value, &emails); err != nil {
+				return invalidValue("expected a list of emails")
+			}
+		}
+		switch op {
+		case PatchAdd:
+			u.Emails = append(u.Emails, emails...)
+		default:
+			u.Emails = emails
+		}
+		return nil
+	case "groups":
+		return NewError(http.StatusBadRequest, ErrMutabilityType, "groups are changed through the group members")
+	}
+	if op != PatchRemove {
+		if s, err = decodeString(value); err != nil {
+			return err
+		}
+	}
+	switch p.attr {
+	case "username":
+		if op == PatchRemove || s == "" {
+			return invalidValue("userName is required")
+		}
+		u.UserName = s
+	case "externalid":
+		u.ExternalID = s
+	case "displayname":
+		u.DisplayName = s
+	case "name.givenname":
+		u.Name.GivenName = s
+	case "name.familyname":
+		u.Name.FamilyName = s
+	case "name.formatted":
+		u.Name.Formatted = s
+	default:
+		return invalidPath(path)
+	}
+	return nil
+}
+
+// applyEmailOp changes the emails matching the filter of the path, a new one
+// of the filtered type is added when none does
+func (u *User) applyEmailOp(op string, p *patchPath, value json.RawMessage) error {
+	if op == PatchRemove {
+		kept := u.Emails[:0]
+		for _, e := range u.Emails {
+			if !matchEmail(p.filter, &e) {
+				kept = append(kept, e)
+			}
+		}
+		u.Emails = kept
+		return nil
+	}
+	if p.sub != "value" {
+		return invalidPath("emails[...]." + p.sub)
+	}
+	v, err := decodeString(value)
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := range u.Emails {
+		if matchEmail(p.filter, &u.Emails[i]) {
+			u.Emails[i].Value, found = v, true
+		}
+	}
+	if !found {
+		e := Email{Value: v}
+		if c, ok := p.filter.(*Comparison); ok && c.Attr == "type" && c.Op == "eq" {
+			e.Type, _ = c.Value.(string)
+		}
+		u.Emails = append(u.Emails, e)
+	}
+	return nil
+}
+
+// matchEmail evaluates the equality filters of an email value path
+func matchEmail(f Filter, e *Email) bool {
+	switch f := f.(type) {
+	case *Logical:
+		if f.Op == "and" {
+			return matchEmail(f.Left, e) && matchEmail(f.Right, e)
+		}
+		return matchEmail(f.Left, e) || matchEmail(f.Right, e)
+	case *Not:
+		return !matchEmail(f.Filter, e)
+	case *Comparison:
+		var got any
+		switch f.Attr {
+		case "type":
+			got = strings.ToLower(e.Type)
+		case "value":
+			got = strings.ToLower(e.Value)
+		case "primary":
+			got = e.Primary
+		default:
+			return false
+		}
+		want := f.Value
+		if s, ok := want.(string); ok {
+			want = strings.ToLower(s)
+		}
+		switch f.Op {
+		case "eq":
+			return got == want
+		case "ne":
+			return got != want
+		}
+	}
+	return false
+}
+
+// ApplyPatch applies the PATCH operations to the group, in order
+func (g *Group) ApplyPatch(ops []PatchOperation) error {
+	for i := range ops {
+		op, err := patchOp(&ops[i])
+		if err != nil {
+			return err
+		}
+		if ops[i].Path == "" {
+			sub, err := pathlessOps(&ops[i])
+			if err != nil {
+				return err
+			}
+			if err := g.ApplyPatch(sub); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := g.applyOp(op, ops[i].Path, ops[i].Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Group) applyOp(op, path string, value json.RawMessage) error {
+	p, err := parsePatchPath(path)
+	if err != nil {
+		return err
+	}
+	switch p.attr {
+	case "displayname":
+		if op == PatchRemove {
+			return invalidValue("displayName is required")
+		}
+		s, err := decodeString(value)
+		if err != nil || s == "" {
+			return invalidValue("displayName is required")
+		}
+		g.DisplayName = s
+		return nil
+	case "externalid":
+		// groups are matched by their name, the external id isn't kept
+		return nil
+	case "members":
+	default:
+		return invalidPath(path)
+	}
+	var members []Member
+	if len(value) > 0 {
+		if err := json.Unmarshal(value, &members); err != nil {
+			return invalidValue("expected a list of members")
+		}
+	}
+	switch {
+	case op == PatchReplace && p.filter == nil:
+		g.Members = nil
+		fallthrough
+	case op == PatchAdd:
+		for _, m := range members {
+			if !g.hasMember(m.Value) {
+				g.Members = append(g.Members, m)
+			}
+		}
+	case op == PatchRemove && p.filter == nil && len(members) == 0:
+		g.Members = nil
+	case op == PatchRemove:
+		kept := g.Members[:0]
+		for _, m := range g.Members {
+			if !matchMember(p.filter, &m) && !containsMember(members, m.Value) {
+				kept = append(kept, m)
+			}
+		}
+		g.Members = kept
+	default:
+		return invalidPath(path)
+	}
+	return nil
+}
+
+func (g *Group) hasMember(value string) bool {
+	return containsMember(g.Members, value)
+}
+
+func containsMember(members []Member, value string) bool {
+	for _, m := range members {
+		if strings.EqualFold(m.Value, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMember evaluates the filter of a members value path on the member
+func matchMember(f Filter, m *Member) bool {
+	switch f := f.(type) {
+	case *Logical:
+		if f.Op == "and" {
+			return matchMember(f.Left, m) && matchMember(f.Right, m)
+		}
+		return matchMember(f.Left, m) || matchMember(f.Right, m)
+	case *Not:
+		return !matchMember(f.Filter, m)
+	case *Comparison:
+		s, _ := f.Value.(string)
+		if f.Attr != "value" {
+			return false
+		}
+		switch f.Op {
+		case "eq":
+			return strings.EqualFold(m.Value, s)
+		case "ne":
+			return !strings.EqualFold(m.Value, s)
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package scim
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func patchOps(t *testing.T, src string) []PatchOperation {
+	t.Helper()
+	var ops []PatchOperation
+	if err := json.Unmarshal([]byte(src), &ops); err != nil {
+		t.Fatal(err)
+	}
+	return ops
+}
+
+func TestUser_ApplyPatch(t *testing.T) {
+	active := true
+	inactive := false
+	tests := []struct {
+		name    string
+		ops     string
+		want    User
+		wantErr string
+	}{
+		{
+			name: "deactivates",
+			ops:  `[{"op": "replace", "path": "active", "value": false}]`,
+			want: User{UserName: "a@example.com", Active: &inactive, Name: &Name{GivenName: "Ann"}},
+		},
+		{
+			name: "boolean as a string",
+			ops:  `[{"op": "Replace", "path": "active", "value": "False"}]`,
+			want: User{UserName: "a@example.com", Active: &inactive, Name: &Name{GivenName: "Ann"}},
+		},
+		{
+			name: "without path",
+			ops:  `[{"op": "replace", "value": {"active": true, "name.familyName": "Smith"}}]`,
+			want: User{UserName: "a@example.com", Active: &active, Name: &Name{GivenName: "Ann", FamilyName: "Smith"}},
+		},
+		{
+			name: "merges the name",
+			ops:  `[{"op": "add", "path": "name", "value": {"familyName": "Smith"}}]`,
+			want: User{UserName: "a@example.com", Name: &Name{GivenName: "Ann", FamilyName: "Smith"}},
+		},
+		{
+			name: "email value path",
+			ops:  `[{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "b@example.com"}]`,
+			want: User{UserName: "a@example.com", Name: &Name{GivenName: "Ann"},
+				Emails: []Email{{Value: "b@example.com", Type: "work"}}},
+		},
+		{
+			name: "removes an attribute",
+			ops:  `[{"op": "remove", "path": "name.givenName"}]`,
+			want: User{UserName: "a@example.com", Name: &Name{}},
+		},
+		{name: "removes the user name", ops: `[{"op": "remove", "path": "userName"}]`, wantErr: ErrInvalidValueType},
+		{name: "unknown attribute", ops: `[{"op": "replace", "path": "title", "value": "x"}]`, wantErr: ErrInvalidPathType},
+		{name: "read only groups", ops: `[{"op": "add", "path": "groups", "value": []}]`, wantErr: ErrMutabilityType},
+		{name: "unknown operation", ops: `[{"op": "move", "path": "active", "value": true}]`, wantErr: ErrInvalidSyntaxType},
+		{name: "not a boolean", ops: `[{"op": "replace", "path": "active", "value": "nope"}]`, wantErr: ErrInvalidValueType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &User{UserName: "a@example.com", Name: &Name{GivenName: "Ann"}}
+			err := u.ApplyPatch(patchOps(t, tt.ops))
+			if tt.wantErr != "" {
+				if e, ok := err.(*Error); !ok || e.ScimType != tt.wantErr {
+					t.Fatalf("ApplyPatch() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyPatch() error = %v", err)
+			}
+			if !reflect.DeepEqual(*u, tt.want) {
+				t.Errorf("ApplyPatch() = %+v, want %+v", *u, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroup_ApplyPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     string
+		want    []string
+		wantErr bool
+	}{
+		{name: "adds members", ops: `[{"op": "add", "path": "members", "value": [{"value": "c"}, {"value": "a"}]}]`,
+			want: []string{"a", "b", "c"}},
+		{name: "removes a member by filter", ops: `[{"op": "remove", "path": "members[value eq \"a\"]"}]`,
+			want: []string{"b"}},
+		{name: "removes members by value", ops: `[{"op": "remove", "path": "members", "value": [{"value": "b"}]}]`,
+			want: []string{"a"}},
+		{name: "removes all members", ops: `[{"op": "remove", "path": "members"}]`},
+		{name: "replaces members", ops: `[{"op": "replace", "path": "members", "value": [{"value": "d"}]}]`,
+			want: []string{"d"}},
+		{name: "renames", ops: `[{"op": "replace", "value": {"displayName": "admins"}}]`,
+			want: []string{"a", "b"}},
+		{name: "empty name", ops: `[{"op": "replace", "path": "displayName", "value": ""}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Group{DisplayName: "users", Members: []Member{{Value: "a"}, {Value: "b"}}}
+			err := g.ApplyPatch(patchOps(t, tt.ops))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var got []string
+			for _, m := range g.Members {
+				got = append(got, m.Value)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ApplyPatch() members = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -68,3 +68,41 @@ func (c *Cache) Del(ctx context.Context, key string) (string, error) {
 	}
 	return "", nil
 }
+
+// Incr increments the counter of the key, the ttl is only set when the counter
+// is created so it expires a fixed time after the first increment
+func (c *Cache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	n, err := c.client.Incr(key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		if err := c.client.Expire(key, ttl).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// AddWithTTL inserts items to cache with their own ttl
+func (c *Cache) AddWithTTL(ctx context.Context, key string, value string, ttl time.Duration) (string, error) {
+	return c.client.Set(key, value, ttl).Result()
+}
+
+// AddNX inserts items to cache with their own ttl only when the key doesn't
+// exist yet, false is returned when it did
+func (c *Cache) AddNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	return c.client.SetNX(key, value, ttl).Result()
+}
+
+// TTL returns how long the key has to live, or zero when it doesn't exist
+func (c *Cache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	d, err := c.client.TTL(key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, nil
+	}
+	return d, nil
+}
@@ -2,9 +2,12 @@ package dbm
 
 import (
 	"fmt"
+	"strings"
 
-	// postgres required for golang-migrate db dialact
+	// mysql, postgres and sqlite3 required for golang-migrate db dialacts
+	_ "github.com/golang-migrate/migrate/v4/database/mysql"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
 	// file required for golang-migrate file system
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 
@@ -13,10 +16,13 @@ import (
 	"github.com/rakin92/go-rest-service/pkg/logger"
 )
 
-// Migrate runs the migrations scripts in scripts folder
+// scriptsDir holds a folder of scripts per dialect
+const scriptsDir = "pkg/storage/dbm/scripts"
+
+// Migrate runs the migrations scripts in the scripts folder of the dialect
 func Migrate(c *cfg.DB) error {
 	logger.Info("[Migrate.Scripts] Running DB Migration Scripts")
-	mg, err := migrate.New("file://pkg/storage/dbm/scripts/", c.DSN)
+	mg, err := migrate.New(fmt.Sprintf("file://%s/%s/", scriptsDir, c.Dialect), databaseURL(c))
 	if err != nil {
 		return fmt.Errorf("[Migration.Scripts]: %v", err)
 	}
@@ -29,3 +35,12 @@ func Migrate(c *cfg.DB) error {
 	logger.Info("[Migrate.Scripts] DB Migration Scripts complete")
 	return nil
 }
+
+// databaseURL is the DSN as golang-migrate wants it, prefixed by the dialect
+// when it isn't an URL already like the mysql and sqlite ones
+func databaseURL(c *cfg.DB) string {
+	if strings.Contains(c.DSN, "://") {
+		return c.DSN
+	}
+	return c.Dialect + "://" + c.DSN
+}
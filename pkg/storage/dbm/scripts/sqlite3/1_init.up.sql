@@ -0,0 +1,3 @@
+-- ROLE_TYPE is a postgres enum, the roles are plain strings here. The
+-- version is kept so the scripts of every dialect stay in step
+SELECT 1;